@@ -14,6 +14,7 @@ import (
 	"realm-of-conquest/internal/database"
 	"realm-of-conquest/internal/handlers"
 	"realm-of-conquest/internal/middleware"
+	"realm-of-conquest/internal/models"
 	"realm-of-conquest/internal/services"
 
 	"github.com/go-chi/chi/v5"
@@ -36,10 +37,26 @@ func main() {
 
 	// Initialize services
 	authService := services.NewAuthService(db, cfg.JWTSecret, cfg.JWTExpiry)
-	characterService := services.NewCharacterService(db)
+	ledgerService := services.NewLedgerService(db)
+	characterService := services.NewCharacterService(db, ledgerService)
 	gmService := services.NewGMService(db, cfg.JWTSecret, cfg.JWTExpiry)
 	ticketService := services.NewTicketService(db)
 	messageService := services.NewMessageService(db)
+	marketService := services.NewMarketService(db, ledgerService)
+	tradeService := services.NewTradeService(db, ledgerService)
+	fraudService := services.NewFraudService(db)
+	karmaService := services.NewKarmaService(db)
+	taxService := services.NewTaxService(db, ledgerService)
+	guildBonusService := services.NewGuildBonusService(db)
+	guildService := services.NewGuildService(db, ledgerService, guildBonusService)
+	caravanService := services.NewCaravanService(db, ledgerService, karmaService, taxService, guildService, guildBonusService)
+	fishingService := services.NewFishingService(db, ledgerService, karmaService, taxService, guildService, guildBonusService)
+	flagService := services.NewFlagService(db, ledgerService, karmaService, fishingService)
+	prisonService := services.NewPrisonService(db, ledgerService, guildService, karmaService)
+	miningService := services.NewMiningService(db, ledgerService, taxService, guildService, guildBonusService)
+	territoryWarService := services.NewTerritoryWarService(db, ledgerService, karmaService)
+	partyService := services.NewPartyService(db)
+	dungeonService := services.NewDungeonService(db, ledgerService, guildService, guildBonusService, taxService, partyService)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
@@ -47,6 +64,40 @@ func main() {
 	gmHandler := handlers.NewGMHandler(gmService, ticketService)
 	ticketHandler := handlers.NewTicketHandler(ticketService)
 	messageHandler := handlers.NewMessageHandler(messageService)
+	marketHandler := handlers.NewMarketHandler(marketService)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerService)
+	tradeHandler := handlers.NewTradeHandler(tradeService)
+	caravanHandler := handlers.NewCaravanHandler(caravanService)
+	flagHandler := handlers.NewFlagHandler(flagService)
+	internalHandler := handlers.NewInternalHandler(prisonService, flagService, partyService)
+	karmaHandler := handlers.NewKarmaHandler(karmaService)
+	prisonHandler := handlers.NewPrisonHandler(prisonService)
+	fishingHandler := handlers.NewFishingHandler(fishingService)
+	miningHandler := handlers.NewMiningHandler(miningService)
+	taxHandler := handlers.NewTaxHandler(taxService)
+	guildHandler := handlers.NewGuildHandler(guildService)
+	territoryWarHandler := handlers.NewTerritoryWarHandler(territoryWarService)
+	dungeonHandler := handlers.NewDungeonHandler(dungeonService)
+	partyHandler := handlers.NewPartyHandler(partyService)
+
+	// Background jobs stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go marketService.RunSweeper(jobsCtx, time.Minute)
+	go tradeService.RunSweeper(jobsCtx, 30*time.Second)
+	go fraudService.RunAnalyzer(jobsCtx, 15*time.Minute)
+	go caravanService.RunSweeper(jobsCtx, 30*time.Second)
+	go karmaService.RunDecay(jobsCtx, time.Hour)
+	go prisonService.RunReleaser(jobsCtx, 30*time.Second)
+	go prisonService.RunEvents(jobsCtx, 30*time.Second)
+	go fishingService.RunSweeper(jobsCtx, 30*time.Second)
+	go miningService.RunSweeper(jobsCtx, 30*time.Second)
+	go guildService.RunRelationSweeper(jobsCtx, time.Minute)
+	go guildService.RunProgress(jobsCtx, 5*time.Minute)
+	go territoryWarService.RunWarScheduler(jobsCtx, 10*time.Second)
+	go dungeonService.RunSweeper(jobsCtx, 30*time.Second)
+	go dungeonService.RunMatchmaker(jobsCtx, 5*time.Second)
+	go dungeonService.RunRankings(jobsCtx, 10*time.Minute)
 
 	r := chi.NewRouter()
 
@@ -105,6 +156,179 @@ func main() {
 			r.Get("/messages/unread", messageHandler.GetUnreadCount)
 			r.Patch("/messages/{id}/read", messageHandler.MarkAsRead)
 			r.Delete("/messages/{id}", messageHandler.Delete)
+
+			r.Get("/economy/history", ledgerHandler.GetHistory)
+
+			r.Get("/market/listings", marketHandler.Search)
+			r.Post("/market/listings", marketHandler.CreateListing)
+			r.Get("/market/listings/mine", marketHandler.MyListings)
+			r.Post("/market/listings/{id}/buy", marketHandler.Buy)
+			r.Delete("/market/listings/{id}", marketHandler.Cancel)
+
+			r.Post("/trades", tradeHandler.Create)
+			r.Get("/trades", tradeHandler.List)
+			r.Get("/trades/{id}", tradeHandler.Get)
+			r.Post("/trades/{id}/accept", tradeHandler.Accept)
+			r.Post("/trades/{id}/cancel", tradeHandler.Cancel)
+			r.Post("/trades/{id}/items", tradeHandler.AddItem)
+			r.Delete("/trades/{id}/items/{itemId}", tradeHandler.RemoveItem)
+			r.Put("/trades/{id}/gold", tradeHandler.SetGold)
+			r.Post("/trades/{id}/lock", tradeHandler.Lock)
+			r.Post("/trades/{id}/unlock", tradeHandler.Unlock)
+			r.Post("/trades/{id}/confirm", tradeHandler.Confirm)
+
+			r.Get("/caravans/types", caravanHandler.GetTypes)
+			r.Get("/caravans/routes", caravanHandler.GetRoutes)
+			r.Post("/caravans", caravanHandler.Create)
+			r.Get("/caravans", caravanHandler.ListMine)
+			r.Get("/caravans/active", caravanHandler.ListActive)
+			r.Get("/caravans/{id}", caravanHandler.Get)
+			r.Post("/caravans/{id}/depart", caravanHandler.Depart)
+			r.Post("/caravans/{id}/abandon", caravanHandler.Abandon)
+			r.Post("/caravans/{id}/attack", caravanHandler.Attack)
+			r.Post("/caravans/{id}/defend", caravanHandler.Defend)
+			r.Get("/caravans/{id}/attacks", caravanHandler.GetAttacks)
+			r.Get("/caravans/{id}/guards", caravanHandler.GetGuards)
+			r.Get("/caravans/guards/tiers", caravanHandler.GetGuardTiers)
+			r.Post("/caravans/{id}/guards/npc", caravanHandler.HireNPCGuard)
+			r.Post("/caravans/{id}/guards/contract", caravanHandler.ContractProtector)
+
+			r.Get("/protectors", caravanHandler.SearchProtectors)
+			r.Get("/protectors/me", caravanHandler.GetMyListing)
+			r.Put("/protectors/me", caravanHandler.UpsertListing)
+			r.Delete("/protectors/me", caravanHandler.DeactivateListing)
+
+			r.Get("/flag", flagHandler.GetStatus)
+			r.Post("/flag", flagHandler.Take)
+			r.Delete("/flag", flagHandler.Drop)
+			r.Get("/flag/red", flagHandler.ListRed)
+			r.Get("/flag/{characterId}", flagHandler.Inspect)
+			r.Get("/flag/{characterId}/attack", flagHandler.CheckAttack)
+			r.Post("/flag/{characterId}/attack", flagHandler.Attack)
+
+			r.Get("/karma", karmaHandler.GetProfile)
+			r.Get("/karma/history", karmaHandler.GetHistory)
+			r.Get("/karma/wanted", karmaHandler.ListWanted)
+
+			r.Get("/prison", prisonHandler.GetStatus)
+			r.Get("/prison/history", prisonHandler.GetHistory)
+			r.Get("/prison/events", prisonHandler.GetEvents)
+			r.Post("/prison/events/{type}/join", prisonHandler.JoinEvent)
+			r.Get("/prison/events/{type}/{id}", prisonHandler.GetEventResults)
+			r.Get("/prison/rankings", prisonHandler.GetRankings)
+			r.Post("/prison/courtyard/{characterId}/attack", prisonHandler.CourtyardFight)
+
+			r.Get("/fishing", fishingHandler.GetStatus)
+			r.Get("/fishing/spots", fishingHandler.GetSpots)
+			r.Post("/fishing/start", fishingHandler.Start)
+			r.Post("/fishing/stop", fishingHandler.Stop)
+			r.Get("/fishing/catches", fishingHandler.GetCatches)
+			r.Post("/fishing/sell", fishingHandler.Sell)
+			r.Post("/fishing/{characterId}/attack", fishingHandler.AttackFisher)
+
+			r.Get("/mining", miningHandler.GetStatus)
+			r.Get("/mining/nodes", miningHandler.GetNodes)
+			r.Post("/mining/start", miningHandler.Start)
+			r.Post("/mining/stop", miningHandler.Stop)
+			r.Get("/mining/ore", miningHandler.GetOre)
+			r.Post("/mining/sell", miningHandler.Sell)
+
+			r.Get("/tax/report", taxHandler.GetReport)
+
+			r.Get("/guilds", guildHandler.List)
+			r.Post("/guilds", guildHandler.Found)
+			r.Get("/guilds/{id}", guildHandler.Get)
+			r.Get("/guilds/{id}/members", guildHandler.GetMembers)
+			r.Post("/guilds/{id}/apply", guildHandler.Apply)
+			r.Delete("/guild-applications/{id}", guildHandler.CancelApplication)
+			r.Get("/guild-invites", guildHandler.ListInvites)
+			r.Post("/guild-invites/{id}/accept", guildHandler.AcceptInvite)
+			r.Post("/guild-invites/{id}/decline", guildHandler.DeclineInvite)
+
+			r.Get("/guild", guildHandler.GetMine)
+			r.Put("/guild/settings", guildHandler.UpdateSettings)
+			r.Get("/guild/applications", guildHandler.ListApplications)
+			r.Post("/guild/applications/{id}/accept", guildHandler.AcceptApplication)
+			r.Post("/guild/applications/{id}/reject", guildHandler.RejectApplication)
+			r.Post("/guild/invites", guildHandler.Invite)
+			r.Post("/guild/members/{characterId}/kick", guildHandler.Kick)
+			r.Put("/guild/members/{characterId}/rank", guildHandler.SetRank)
+			r.Post("/guild/leave", guildHandler.Leave)
+			r.Post("/guild/transfer", guildHandler.Transfer)
+			r.Post("/guild/disband", guildHandler.Disband)
+			r.Get("/guild/relations", guildHandler.ListRelations)
+			r.Post("/guild/relations/ally", guildHandler.ProposeAlliance)
+			r.Post("/guild/relations/enemy", guildHandler.DeclareEnemy)
+			r.Post("/guild/relations/{id}/cancel", guildHandler.CancelRelation)
+			r.Get("/guild/votes", guildHandler.ListVotes)
+			r.Get("/guild/votes/{id}", guildHandler.GetVote)
+			r.Post("/guild/votes/{id}/ballot", guildHandler.CastBallot)
+			r.Get("/guild/chat", guildHandler.GetChat)
+			r.Post("/guild/chat", guildHandler.SendChat)
+			r.Get("/guild/storage", guildHandler.GetStorage)
+			r.Post("/guild/storage/deposit", guildHandler.DepositItem)
+			r.Post("/guild/storage/{id}/withdraw", guildHandler.WithdrawItem)
+			r.Get("/guild/treasury", guildHandler.GetTreasury)
+			r.Post("/guild/treasury/deposit", guildHandler.DonateGold)
+			r.Post("/guild/treasury/withdraw", guildHandler.WithdrawGold)
+			r.Get("/guild/logs", guildHandler.GetLogs)
+			r.Get("/guild/level", guildHandler.GetLevel)
+			r.Get("/guild/quests", guildHandler.ListQuests)
+			r.Get("/guild/bonuses", guildHandler.GetBonuses)
+
+			r.Get("/territory/zones", territoryWarHandler.ListZones)
+			r.Get("/territory/wars", territoryWarHandler.List)
+			r.Post("/territory/wars", territoryWarHandler.Declare)
+			r.Get("/territory/wars/{id}", territoryWarHandler.Get)
+			r.Post("/territory/wars/{id}/cancel", territoryWarHandler.Cancel)
+			r.Post("/territory/wars/{id}/join", territoryWarHandler.Join)
+			r.Post("/territory/wars/{id}/point", territoryWarHandler.ReportPresence)
+			r.Post("/territory/wars/{id}/attack/{characterId}", territoryWarHandler.Attack)
+
+			r.Get("/dungeons", dungeonHandler.List)
+			r.Get("/dungeons/{id}", dungeonHandler.Get)
+			r.Get("/dungeon-instances", dungeonHandler.ListInstances)
+			r.Post("/dungeon-instances", dungeonHandler.Create)
+			r.Get("/dungeon-instances/{id}", dungeonHandler.GetInstance)
+			r.Post("/dungeon-instances/{id}/join", dungeonHandler.Join)
+			r.Post("/dungeon-instances/{id}/leave", dungeonHandler.Leave)
+			r.Post("/dungeon-instances/{id}/start", dungeonHandler.Start)
+			r.Post("/dungeon-instances/{id}/attack", dungeonHandler.Attack)
+			r.Get("/dungeon-instances/{id}/loot", dungeonHandler.ListLoot)
+			r.Get("/dungeon-queue", dungeonHandler.GetQueue)
+			r.Post("/dungeon-queue", dungeonHandler.JoinQueue)
+			r.Delete("/dungeon-queue", dungeonHandler.LeaveQueue)
+			r.Get("/dungeon-matches/{id}", dungeonHandler.GetMatch)
+			r.Post("/dungeon-matches/{id}/accept", dungeonHandler.AcceptMatch)
+			r.Post("/dungeon-matches/{id}/decline", dungeonHandler.DeclineMatch)
+			r.Get("/cross-server/rankings", dungeonHandler.GetCrossServerRankings)
+			r.Get("/cross-server/season", dungeonHandler.GetCrossServerSeason)
+
+			r.Get("/parties", partyHandler.ListPublic)
+			r.Post("/parties", partyHandler.Create)
+			r.Post("/parties/{id}/join", partyHandler.Join)
+			r.Get("/party-invites", partyHandler.ListInvites)
+			r.Post("/party-invites/{id}/accept", partyHandler.AcceptInvite)
+			r.Post("/party-invites/{id}/decline", partyHandler.DeclineInvite)
+
+			r.Get("/party", partyHandler.Get)
+			r.Put("/party/settings", partyHandler.UpdateSettings)
+			r.Post("/party/invites", partyHandler.Invite)
+			r.Post("/party/members/{characterId}/kick", partyHandler.Kick)
+			r.Post("/party/leave", partyHandler.Leave)
+			r.Post("/party/transfer", partyHandler.Transfer)
+			r.Get("/party/chat", partyHandler.GetChat)
+			r.Post("/party/chat", partyHandler.SendChat)
+		})
+
+		// Game server reports: combat and movement resolved in real time
+		r.Route("/internal", func(r chi.Router) {
+			r.Use(middleware.InternalAuth(cfg.InternalAPIKey))
+
+			r.Post("/pvp-results", internalHandler.ReportPvP)
+			r.Post("/characters/{characterId}/death", internalHandler.ReportDeath)
+			r.Post("/characters/{characterId}/map", internalHandler.EnterMap)
+			r.Post("/characters/{characterId}/kills", internalHandler.ReportKill)
 		})
 
 		r.Route("/gm", func(r chi.Router) {
@@ -115,6 +339,7 @@ func main() {
 
 				r.Get("/me", gmHandler.Me)
 				r.Get("/dashboard", gmHandler.Dashboard)
+				r.Get("/economy", ledgerHandler.GetEconomySummary)
 				r.Patch("/duty", gmHandler.SetDutyStatus)
 
 				// Player management (in-game)
@@ -122,6 +347,13 @@ func main() {
 				r.Post("/players/{characterId}/kick", gmHandler.KickCharacter)
 				r.Post("/players/{characterId}/message", gmHandler.SendGMMessage)
 
+				// Prison (can_jail)
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireGMPermission(gmService, func(p *models.GMPermissions) bool { return p.CanJail }))
+					r.Post("/players/{characterId}/jail", gmHandler.JailCharacter)
+					r.Post("/players/{characterId}/unjail", gmHandler.UnjailCharacter)
+				})
+
 				r.Get("/tickets", gmHandler.GetAllTickets)
 				r.Get("/tickets/{id}", gmHandler.GetTicket)
 				r.Get("/tickets/{id}/responses", gmHandler.GetTicketResponses)
@@ -134,6 +366,8 @@ func main() {
 					r.Get("/mutes", gmHandler.GetMutes)
 					r.Post("/mutes", gmHandler.MuteCharacter)
 					r.Delete("/mutes/{id}", gmHandler.UnmuteCharacter)
+					r.Get("/suspicious", gmHandler.GetSuspiciousActivity)
+					r.Patch("/suspicious/{id}/review", gmHandler.ReviewSuspiciousActivity)
 				})
 
 				// Game Master level (3+)
@@ -173,6 +407,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -15,6 +15,8 @@ type Config struct {
 	SupabaseKey    string
 	JWTSecret      string
 	JWTExpiry      time.Duration
+	// Shared secret the game server sends on internal endpoints
+	InternalAPIKey string
 }
 
 func Load() (*Config, error) {
@@ -34,6 +36,7 @@ func Load() (*Config, error) {
 		SupabaseKey:    getEnv("SUPABASE_ANON_KEY", ""),
 		JWTSecret:      getEnv("JWT_SECRET", "default-secret-change-me"),
 		JWTExpiry:      expiry,
+		InternalAPIKey: getEnv("INTERNAL_API_KEY", ""),
 	}, nil
 }
 
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+
+	"github.com/google/uuid"
+)
+
+type CaravanHandler struct {
+	caravanService *services.CaravanService
+}
+
+func NewCaravanHandler(caravanService *services.CaravanService) *CaravanHandler {
+	return &CaravanHandler{caravanService: caravanService}
+}
+
+func caravanError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrCaravanNotFound),
+		errors.Is(err, services.ErrCaravanTypeNotFound),
+		errors.Is(err, services.ErrCaravanRouteNotFound),
+		errors.Is(err, services.ErrProtectorNotFound):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrCaravanActive),
+		errors.Is(err, services.ErrCaravanNotPreparing),
+		errors.Is(err, services.ErrCaravanNotTraveling),
+		errors.Is(err, services.ErrCaravanNotAttackable),
+		errors.Is(err, services.ErrAlreadyAttacking),
+		errors.Is(err, services.ErrAlreadyGuarding),
+		errors.Is(err, services.ErrCaravanGuardsFull),
+		errors.Is(err, services.ErrCaravanGuardsLocked),
+		errors.Is(err, services.ErrProtectorUnavailable):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrCaravanLevelTooLow),
+		errors.Is(err, services.ErrNotRedFlag),
+		errors.Is(err, services.ErrNotBlueFlag),
+		errors.Is(err, services.ErrInPrison):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrInsufficientGold),
+		errors.Is(err, services.ErrCaravanOwnCaravan),
+		errors.Is(err, services.ErrCaravanGuardCannotHit),
+		errors.Is(err, services.ErrInvalidGuardTier),
+		errors.Is(err, services.ErrInvalidHourlyFee),
+		errors.Is(err, services.ErrCannotContractSelf),
+		errors.Is(err, services.ErrCaravanBelowProtector):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *CaravanHandler) GetTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := h.caravanService.GetTypes(r.Context())
+	if err != nil {
+		InternalError(w, "failed to get caravan types")
+		return
+	}
+
+	if types == nil {
+		types = []*models.CaravanType{}
+	}
+
+	Success(w, types)
+}
+
+func (h *CaravanHandler) GetRoutes(w http.ResponseWriter, r *http.Request) {
+	routes, err := h.caravanService.GetRoutes(r.Context())
+	if err != nil {
+		InternalError(w, "failed to get caravan routes")
+		return
+	}
+
+	if routes == nil {
+		routes = []*models.CaravanRoute{}
+	}
+
+	Success(w, routes)
+}
+
+func (h *CaravanHandler) Create(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateCaravanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.CaravanTypeID <= 0 || req.RouteID <= 0 {
+		BadRequest(w, "caravan_type_id and route_id are required")
+		return
+	}
+
+	caravan, err := h.caravanService.Create(r.Context(), accountID, characterID, &req)
+	if err != nil {
+		caravanError(w, err, "failed to create caravan")
+		return
+	}
+
+	Created(w, caravan)
+}
+
+func (h *CaravanHandler) ListMine(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	caravans, err := h.caravanService.ListMine(r.Context(), accountID, characterID, limit, offset)
+	if err != nil {
+		caravanError(w, err, "failed to get caravans")
+		return
+	}
+
+	if caravans == nil {
+		caravans = []*models.Caravan{}
+	}
+
+	Success(w, caravans)
+}
+
+func (h *CaravanHandler) ListActive(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	routeID, ok := optionalInt(r, "route_id")
+	if !ok {
+		BadRequest(w, "invalid route_id")
+		return
+	}
+
+	limit, offset := pagination(r)
+	caravans, err := h.caravanService.ListActive(r.Context(), accountID, characterID, routeID, limit, offset)
+	if err != nil {
+		caravanError(w, err, "failed to get caravans")
+		return
+	}
+
+	if caravans == nil {
+		caravans = []*models.Caravan{}
+	}
+
+	Success(w, caravans)
+}
+
+func (h *CaravanHandler) Get(w http.ResponseWriter, r *http.Request) {
+	h.withCaravan(w, r, "failed to get caravan", func(ctx context.Context, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error) {
+		return h.caravanService.Get(ctx, caravanID)
+	})
+}
+
+func (h *CaravanHandler) Depart(w http.ResponseWriter, r *http.Request) {
+	h.withCaravan(w, r, "failed to depart caravan", h.caravanService.Depart)
+}
+
+func (h *CaravanHandler) Abandon(w http.ResponseWriter, r *http.Request) {
+	h.withCaravan(w, r, "failed to abandon caravan", h.caravanService.Abandon)
+}
+
+func (h *CaravanHandler) Attack(w http.ResponseWriter, r *http.Request) {
+	h.withCaravan(w, r, "failed to attack caravan", h.caravanService.Attack)
+}
+
+func (h *CaravanHandler) Defend(w http.ResponseWriter, r *http.Request) {
+	h.withCaravan(w, r, "failed to defend caravan", h.caravanService.Defend)
+}
+
+func (h *CaravanHandler) GetAttacks(w http.ResponseWriter, r *http.Request) {
+	caravanID, ok := uuidParam(w, r, "id", "caravan id")
+	if !ok {
+		return
+	}
+
+	attacks, err := h.caravanService.GetAttacks(r.Context(), caravanID)
+	if err != nil {
+		caravanError(w, err, "failed to get caravan attacks")
+		return
+	}
+
+	if attacks == nil {
+		attacks = []*models.CaravanAttack{}
+	}
+
+	Success(w, attacks)
+}
+
+func (h *CaravanHandler) GetGuards(w http.ResponseWriter, r *http.Request) {
+	caravanID, ok := uuidParam(w, r, "id", "caravan id")
+	if !ok {
+		return
+	}
+
+	guards, err := h.caravanService.GetGuards(r.Context(), caravanID)
+	if err != nil {
+		caravanError(w, err, "failed to get caravan guards")
+		return
+	}
+
+	if guards == nil {
+		guards = []*models.CaravanGuard{}
+	}
+
+	Success(w, guards)
+}
+
+func (h *CaravanHandler) GetGuardTiers(w http.ResponseWriter, r *http.Request) {
+	tiers := make([]models.NPCGuardTier, 0, len(models.NPCGuardTiers))
+	for _, tier := range models.NPCGuardTiers {
+		tiers = append(tiers, tier)
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Tier < tiers[j].Tier })
+
+	Success(w, tiers)
+}
+
+func (h *CaravanHandler) HireNPCGuard(w http.ResponseWriter, r *http.Request) {
+	var req models.HireNPCGuardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	h.withCaravan(w, r, "failed to hire guard", func(ctx context.Context, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error) {
+		return h.caravanService.HireNPCGuard(ctx, accountID, characterID, caravanID, req.Tier)
+	})
+}
+
+func (h *CaravanHandler) ContractProtector(w http.ResponseWriter, r *http.Request) {
+	var req models.ContractProtectorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.ListingID == uuid.Nil {
+		BadRequest(w, "listing_id is required")
+		return
+	}
+
+	h.withCaravan(w, r, "failed to contract protector", func(ctx context.Context, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error) {
+		return h.caravanService.ContractProtector(ctx, accountID, characterID, caravanID, req.ListingID)
+	})
+}
+
+func (h *CaravanHandler) SearchProtectors(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var filter models.ProtectorSearchFilter
+	var ok1, ok2, ok3 bool
+	filter.RouteID, ok1 = optionalInt(r, "route_id")
+	filter.CaravanTypeID, ok2 = optionalInt(r, "caravan_type_id")
+	filter.MaxFee, ok3 = optionalInt64(r, "max_fee")
+	if !(ok1 && ok2 && ok3) {
+		BadRequest(w, "invalid search filter")
+		return
+	}
+	filter.Limit, filter.Offset = pagination(r)
+
+	listings, err := h.caravanService.SearchProtectors(r.Context(), accountID, characterID, &filter)
+	if err != nil {
+		caravanError(w, err, "failed to search protectors")
+		return
+	}
+
+	if listings == nil {
+		listings = []*models.ProtectorListing{}
+	}
+
+	Success(w, listings)
+}
+
+func (h *CaravanHandler) GetMyListing(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	listing, err := h.caravanService.GetMyListing(r.Context(), accountID, characterID)
+	if err != nil {
+		caravanError(w, err, "failed to get protector listing")
+		return
+	}
+
+	Success(w, listing)
+}
+
+func (h *CaravanHandler) UpsertListing(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpsertProtectorListingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	listing, err := h.caravanService.UpsertListing(r.Context(), accountID, characterID, &req)
+	if err != nil {
+		caravanError(w, err, "failed to save protector listing")
+		return
+	}
+
+	Success(w, listing)
+}
+
+func (h *CaravanHandler) DeactivateListing(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.caravanService.DeactivateListing(r.Context(), accountID, characterID); err != nil {
+		caravanError(w, err, "failed to remove protector listing")
+		return
+	}
+
+	Success(w, map[string]bool{"deactivated": true})
+}
+
+// withCaravan resolves the acting character and the {id} caravan param, then
+// writes the caravan returned by fn.
+func (h *CaravanHandler) withCaravan(w http.ResponseWriter, r *http.Request, fallback string, fn func(ctx context.Context, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error)) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	caravanID, ok := uuidParam(w, r, "id", "caravan id")
+	if !ok {
+		return
+	}
+
+	caravan, err := fn(r.Context(), accountID, characterID, caravanID)
+	if err != nil {
+		caravanError(w, err, fallback)
+		return
+	}
+
+	Success(w, caravan)
+}
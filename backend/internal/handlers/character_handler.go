@@ -54,6 +54,8 @@ func (h *CharacterHandler) Create(w http.ResponseWriter, r *http.Request) {
 			BadRequest(w, "invalid class")
 		case errors.Is(err, services.ErrMaxCharacters):
 			BadRequest(w, "maximum characters reached (5)")
+		case errors.Is(err, services.ErrInvalidServer):
+			BadRequest(w, "server is not open for new characters")
 		default:
 			InternalError(w, "failed to create character")
 		}
@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+)
+
+type DungeonHandler struct {
+	dungeonService *services.DungeonService
+}
+
+func NewDungeonHandler(dungeonService *services.DungeonService) *DungeonHandler {
+	return &DungeonHandler{dungeonService: dungeonService}
+}
+
+func dungeonError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrDungeonNotFound),
+		errors.Is(err, services.ErrDungeonInstanceNotFound),
+		errors.Is(err, services.ErrNotQueued),
+		errors.Is(err, services.ErrDungeonMatchNotFound),
+		errors.Is(err, services.ErrSeasonNotFound),
+		errors.Is(err, services.ErrNoActiveSeason):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrAlreadyInDungeon),
+		errors.Is(err, services.ErrDungeonPartyFull),
+		errors.Is(err, services.ErrDungeonClassTaken),
+		errors.Is(err, services.ErrDungeonPartyIncomplete),
+		errors.Is(err, services.ErrDungeonPartyChanged),
+		errors.Is(err, services.ErrDungeonNotForming),
+		errors.Is(err, services.ErrDungeonNotInProgress),
+		errors.Is(err, services.ErrDungeonTimeUp),
+		errors.Is(err, services.ErrDungeonAttackCooldown),
+		errors.Is(err, services.ErrDungeonEntriesExhausted),
+		errors.Is(err, services.ErrAlreadyQueued),
+		errors.Is(err, services.ErrDungeonQueuePenalty),
+		errors.Is(err, services.ErrDungeonQueueChanged),
+		errors.Is(err, services.ErrReadyCheckOver),
+		errors.Is(err, services.ErrPartyNotFound):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrNotDungeonLeader),
+		errors.Is(err, services.ErrNotDungeonParticipant),
+		errors.Is(err, services.ErrDungeonLevelTooLow),
+		errors.Is(err, services.ErrDungeonGearScoreTooLow),
+		errors.Is(err, services.ErrInPrison),
+		errors.Is(err, services.ErrNotPartyLeader),
+		errors.Is(err, services.ErrDungeonPartyOnly):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrInvalidDifficulty),
+		errors.Is(err, services.ErrDifficultyUnavailable),
+		errors.Is(err, services.ErrDungeonWithoutBosses):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *DungeonHandler) List(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	dungeons, err := h.dungeonService.ListDungeons(r.Context(), accountID, characterID)
+	if err != nil {
+		dungeonError(w, err, "failed to get dungeons")
+		return
+	}
+
+	if dungeons == nil {
+		dungeons = []*models.Dungeon{}
+	}
+
+	Success(w, dungeons)
+}
+
+func (h *DungeonHandler) Get(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	dungeonID, ok := intParam(w, r, "id", "dungeon id")
+	if !ok {
+		return
+	}
+
+	dungeon, err := h.dungeonService.GetDungeon(r.Context(), accountID, characterID, dungeonID)
+	if err != nil {
+		dungeonError(w, err, "failed to get dungeon")
+		return
+	}
+
+	Success(w, dungeon)
+}
+
+func (h *DungeonHandler) ListInstances(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	dungeonID, ok := optionalInt(r, "dungeon_id")
+	if !ok {
+		BadRequest(w, "invalid dungeon_id")
+		return
+	}
+
+	limit, offset := pagination(r)
+	instances, err := h.dungeonService.ListInstances(r.Context(), accountID, characterID, dungeonID, limit, offset)
+	if err != nil {
+		dungeonError(w, err, "failed to get dungeon parties")
+		return
+	}
+
+	if instances == nil {
+		instances = []*models.DungeonInstance{}
+	}
+
+	Success(w, instances)
+}
+
+func (h *DungeonHandler) GetInstance(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	instanceID, ok := uuidParam(w, r, "id", "instance id")
+	if !ok {
+		return
+	}
+
+	instance, err := h.dungeonService.GetInstance(r.Context(), accountID, characterID, instanceID)
+	if err != nil {
+		dungeonError(w, err, "failed to get dungeon instance")
+		return
+	}
+
+	Success(w, instance)
+}
+
+func (h *DungeonHandler) Create(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateDungeonInstanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+	if req.DungeonID <= 0 {
+		BadRequest(w, "dungeon_id is required")
+		return
+	}
+	if req.Difficulty == "" {
+		req.Difficulty = models.DifficultyNormal
+	}
+
+	instance, err := h.dungeonService.Create(r.Context(), accountID, characterID, req.DungeonID, req.Difficulty)
+	if err != nil {
+		dungeonError(w, err, "failed to create dungeon party")
+		return
+	}
+
+	Created(w, instance)
+}
+
+func (h *DungeonHandler) Join(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	instanceID, ok := uuidParam(w, r, "id", "instance id")
+	if !ok {
+		return
+	}
+
+	instance, err := h.dungeonService.Join(r.Context(), accountID, characterID, instanceID)
+	if err != nil {
+		dungeonError(w, err, "failed to join dungeon party")
+		return
+	}
+
+	Success(w, instance)
+}
+
+func (h *DungeonHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	instanceID, ok := uuidParam(w, r, "id", "instance id")
+	if !ok {
+		return
+	}
+
+	if err := h.dungeonService.Leave(r.Context(), accountID, characterID, instanceID); err != nil {
+		dungeonError(w, err, "failed to leave dungeon")
+		return
+	}
+
+	Success(w, map[string]bool{"left": true})
+}
+
+func (h *DungeonHandler) Start(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	instanceID, ok := uuidParam(w, r, "id", "instance id")
+	if !ok {
+		return
+	}
+
+	instance, err := h.dungeonService.Start(r.Context(), accountID, characterID, instanceID)
+	if err != nil {
+		dungeonError(w, err, "failed to start dungeon")
+		return
+	}
+
+	Success(w, instance)
+}
+
+func (h *DungeonHandler) Attack(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	instanceID, ok := uuidParam(w, r, "id", "instance id")
+	if !ok {
+		return
+	}
+
+	attack, err := h.dungeonService.Attack(r.Context(), accountID, characterID, instanceID)
+	if err != nil {
+		dungeonError(w, err, "failed to attack boss")
+		return
+	}
+
+	Success(w, attack)
+}
+
+func (h *DungeonHandler) ListLoot(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	instanceID, ok := uuidParam(w, r, "id", "instance id")
+	if !ok {
+		return
+	}
+
+	wonOnly := r.URL.Query().Get("won") == "true"
+	loot, err := h.dungeonService.ListLoot(r.Context(), accountID, characterID, instanceID, wonOnly)
+	if err != nil {
+		dungeonError(w, err, "failed to get dungeon loot")
+		return
+	}
+
+	if loot == nil {
+		loot = []*models.DungeonLoot{}
+	}
+
+	Success(w, loot)
+}
+
+func (h *DungeonHandler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := h.dungeonService.GetQueue(r.Context(), accountID, characterID)
+	if err != nil {
+		dungeonError(w, err, "failed to get dungeon queue")
+		return
+	}
+
+	Success(w, entry)
+}
+
+func (h *DungeonHandler) JoinQueue(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.JoinDungeonQueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+	if req.DungeonID <= 0 {
+		BadRequest(w, "dungeon_id is required")
+		return
+	}
+	if req.Difficulty == "" {
+		req.Difficulty = models.DifficultyNormal
+	}
+
+	entry, err := h.dungeonService.JoinQueue(r.Context(), accountID, characterID, req.DungeonID, req.Difficulty)
+	if err != nil {
+		dungeonError(w, err, "failed to join dungeon queue")
+		return
+	}
+
+	Created(w, entry)
+}
+
+func (h *DungeonHandler) LeaveQueue(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.dungeonService.LeaveQueue(r.Context(), accountID, characterID); err != nil {
+		dungeonError(w, err, "failed to leave dungeon queue")
+		return
+	}
+
+	Success(w, map[string]bool{"left": true})
+}
+
+func (h *DungeonHandler) GetMatch(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	matchID, ok := uuidParam(w, r, "id", "match id")
+	if !ok {
+		return
+	}
+
+	match, err := h.dungeonService.GetMatch(r.Context(), accountID, characterID, matchID)
+	if err != nil {
+		dungeonError(w, err, "failed to get dungeon match")
+		return
+	}
+
+	Success(w, match)
+}
+
+func (h *DungeonHandler) AcceptMatch(w http.ResponseWriter, r *http.Request) {
+	h.respondReadyCheck(w, r, true)
+}
+
+func (h *DungeonHandler) DeclineMatch(w http.ResponseWriter, r *http.Request) {
+	h.respondReadyCheck(w, r, false)
+}
+
+func (h *DungeonHandler) respondReadyCheck(w http.ResponseWriter, r *http.Request, accept bool) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	matchID, ok := uuidParam(w, r, "id", "match id")
+	if !ok {
+		return
+	}
+
+	match, err := h.dungeonService.RespondReadyCheck(r.Context(), accountID, characterID, matchID, accept)
+	if err != nil {
+		dungeonError(w, err, "failed to answer ready check")
+		return
+	}
+
+	Success(w, match)
+}
+
+func (h *DungeonHandler) GetCrossServerRankings(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	previous := r.URL.Query().Get("week") == "previous"
+	limit, offset := pagination(r)
+	rankings, err := h.dungeonService.GetCrossServerRankings(r.Context(), accountID, characterID, previous, limit, offset)
+	if err != nil {
+		dungeonError(w, err, "failed to get cross-server rankings")
+		return
+	}
+
+	if rankings == nil {
+		rankings = []*models.CrossServerRanking{}
+	}
+
+	Success(w, rankings)
+}
+
+func (h *DungeonHandler) GetCrossServerSeason(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	seasonID, ok := optionalInt(r, "season_id")
+	if !ok {
+		BadRequest(w, "invalid season_id")
+		return
+	}
+
+	limit, offset := pagination(r)
+	season, err := h.dungeonService.GetCrossServerSeason(r.Context(), accountID, characterID, seasonID, limit, offset)
+	if err != nil {
+		dungeonError(w, err, "failed to get cross-server season")
+		return
+	}
+
+	Success(w, season)
+}
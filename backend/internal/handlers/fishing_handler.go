@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+)
+
+type FishingHandler struct {
+	fishingService *services.FishingService
+}
+
+func NewFishingHandler(fishingService *services.FishingService) *FishingHandler {
+	return &FishingHandler{fishingService: fishingService}
+}
+
+func fishingError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrFishingSpotNotFound):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrAlreadyFishing),
+		errors.Is(err, services.ErrNotFishing),
+		errors.Is(err, services.ErrFishBagFull),
+		errors.Is(err, services.ErrNoFishToSell):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrPrisonSpot),
+		errors.Is(err, services.ErrConfinedToPrison),
+		errors.Is(err, services.ErrFishingNoPvP):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrCannotAttackSelf):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *FishingHandler) GetSpots(w http.ResponseWriter, r *http.Request) {
+	mapID, ok := optionalInt(r, "map_id")
+	if !ok {
+		BadRequest(w, "invalid map_id")
+		return
+	}
+
+	spots, err := h.fishingService.GetSpots(r.Context(), mapID)
+	if err != nil {
+		InternalError(w, "failed to get fishing spots")
+		return
+	}
+
+	if spots == nil {
+		spots = []*models.FishingSpot{}
+	}
+
+	Success(w, spots)
+}
+
+func (h *FishingHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.fishingService.GetStatus(r.Context(), accountID, characterID)
+	if err != nil {
+		fishingError(w, err, "failed to get fishing status")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *FishingHandler) Start(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.StartFishingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.SpotID <= 0 {
+		BadRequest(w, "spot_id is required")
+		return
+	}
+
+	status, err := h.fishingService.Start(r.Context(), accountID, characterID, req.SpotID)
+	if err != nil {
+		fishingError(w, err, "failed to start fishing")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *FishingHandler) Stop(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.fishingService.Stop(r.Context(), accountID, characterID)
+	if err != nil {
+		fishingError(w, err, "failed to stop fishing")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *FishingHandler) GetCatches(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	catches, err := h.fishingService.GetCatches(r.Context(), accountID, characterID, limit, offset)
+	if err != nil {
+		fishingError(w, err, "failed to get catches")
+		return
+	}
+
+	if catches == nil {
+		catches = []*models.FishCatch{}
+	}
+
+	Success(w, catches)
+}
+
+func (h *FishingHandler) Sell(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SellFishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	sale, err := h.fishingService.Sell(r.Context(), accountID, characterID, req.CatchIDs)
+	if err != nil {
+		fishingError(w, err, "failed to sell fish")
+		return
+	}
+
+	Success(w, sale)
+}
+
+func (h *FishingHandler) AttackFisher(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	fisherID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	stats, err := h.fishingService.AttackFisher(r.Context(), accountID, characterID, fisherID)
+	if err != nil {
+		fishingError(w, err, "failed to attack fisher")
+		return
+	}
+
+	Success(w, stats)
+}
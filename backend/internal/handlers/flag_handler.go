@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+)
+
+type FlagHandler struct {
+	flagService *services.FlagService
+}
+
+func NewFlagHandler(flagService *services.FlagService) *FlagHandler {
+	return &FlagHandler{flagService: flagService}
+}
+
+func flagError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrFlagTargetNotFound):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrFlagAlreadyActive),
+		errors.Is(err, services.ErrFlagOnCooldown):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrRedFlagInCity),
+		errors.Is(err, services.ErrAttackNotAllowed),
+		errors.Is(err, services.ErrInPrison),
+		errors.Is(err, services.ErrFishingNoPvP):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrInvalidFlag),
+		errors.Is(err, services.ErrNoFlag):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *FlagHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.flagService.GetStatus(r.Context(), accountID, characterID)
+	if err != nil {
+		flagError(w, err, "failed to get flag")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *FlagHandler) Take(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TakeFlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	status, err := h.flagService.Take(r.Context(), accountID, characterID, req.Flag)
+	if err != nil {
+		flagError(w, err, "failed to take flag")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *FlagHandler) Drop(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.flagService.Drop(r.Context(), accountID, characterID)
+	if err != nil {
+		flagError(w, err, "failed to drop flag")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *FlagHandler) ListRed(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	mapID, ok := optionalInt(r, "map_id")
+	if !ok {
+		BadRequest(w, "invalid map_id")
+		return
+	}
+
+	limit, offset := pagination(r)
+	carriers, err := h.flagService.ListRedCarriers(r.Context(), accountID, characterID, mapID, limit, offset)
+	if err != nil {
+		flagError(w, err, "failed to get flag carriers")
+		return
+	}
+
+	if carriers == nil {
+		carriers = []*models.FlagCarrier{}
+	}
+
+	Success(w, carriers)
+}
+
+func (h *FlagHandler) Inspect(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	status, err := h.flagService.Inspect(r.Context(), accountID, characterID, targetID)
+	if err != nil {
+		flagError(w, err, "failed to inspect flag")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *FlagHandler) CheckAttack(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	check, err := h.flagService.CheckAttack(r.Context(), accountID, characterID, targetID)
+	if err != nil {
+		flagError(w, err, "failed to check attack")
+		return
+	}
+
+	Success(w, check)
+}
+
+func (h *FlagHandler) Attack(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	result, err := h.flagService.Attack(r.Context(), accountID, characterID, targetID)
+	if err != nil {
+		flagError(w, err, "failed to attack")
+		return
+	}
+
+	Success(w, result)
+}
@@ -216,6 +216,46 @@ func (h *GMHandler) GetMutes(w http.ResponseWriter, r *http.Request) {
 	Success(w, mutes)
 }
 
+// Suspicious Activity Review Queue
+func (h *GMHandler) GetSuspiciousActivity(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pagination(r)
+	reviewed := r.URL.Query().Get("reviewed") == "true"
+
+	logs, err := h.gmService.GetSuspiciousActivity(r.Context(), r.URL.Query().Get("severity"), r.URL.Query().Get("type"), reviewed, limit, offset)
+	if err != nil {
+		InternalError(w, "failed to get suspicious activity")
+		return
+	}
+
+	if logs == nil {
+		logs = []*models.SuspiciousActivity{}
+	}
+
+	Success(w, logs)
+}
+
+func (h *GMHandler) ReviewSuspiciousActivity(w http.ResponseWriter, r *http.Request) {
+	gmID, _ := middleware.GetGMID(r.Context())
+
+	logID, ok := uuidParam(w, r, "id", "activity id")
+	if !ok {
+		return
+	}
+
+	var req models.ReviewSuspiciousRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if err := h.gmService.ReviewSuspiciousActivity(r.Context(), gmID, logID, req.Result); err != nil {
+		BadRequest(w, err.Error())
+		return
+	}
+
+	Success(w, map[string]bool{"reviewed": true})
+}
+
 // Announcement Management
 func (h *GMHandler) CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
 	gmID, _ := middleware.GetGMID(r.Context())
@@ -485,6 +525,73 @@ func (h *GMHandler) KickCharacter(w http.ResponseWriter, r *http.Request) {
 	Success(w, map[string]bool{"kicked": true})
 }
 
+// JailCharacter sends a player to prison
+func (h *GMHandler) JailCharacter(w http.ResponseWriter, r *http.Request) {
+	gmID, _ := middleware.GetGMID(r.Context())
+
+	charID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	var req models.JailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.Reason == "" {
+		BadRequest(w, "reason is required")
+		return
+	}
+
+	record, err := h.gmService.JailCharacter(r.Context(), gmID, charID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCharacterNotFound):
+			NotFound(w, err.Error())
+		case errors.Is(err, services.ErrInvalidPrisonReason),
+			errors.Is(err, services.ErrInvalidSentence),
+			errors.Is(err, services.ErrCheatSentenceTooLow):
+			BadRequest(w, err.Error())
+		default:
+			InternalError(w, "failed to jail character")
+		}
+		return
+	}
+
+	Created(w, record)
+}
+
+// UnjailCharacter releases a player from prison early
+func (h *GMHandler) UnjailCharacter(w http.ResponseWriter, r *http.Request) {
+	gmID, _ := middleware.GetGMID(r.Context())
+
+	charID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.Reason == "" {
+		req.Reason = "Released by GM"
+	}
+
+	if err := h.gmService.UnjailCharacter(r.Context(), gmID, charID, req.Reason); err != nil {
+		if errors.Is(err, services.ErrNotInPrison) {
+			Conflict(w, err.Error())
+			return
+		}
+		InternalError(w, "failed to release character")
+		return
+	}
+
+	Success(w, map[string]bool{"released": true})
+}
+
 // SendGMMessage sends a GM message to a player
 func (h *GMHandler) SendGMMessage(w http.ResponseWriter, r *http.Request) {
 	gmID, _ := middleware.GetGMID(r.Context())
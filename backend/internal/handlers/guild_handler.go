@@ -0,0 +1,890 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+
+	"github.com/google/uuid"
+)
+
+type GuildHandler struct {
+	guildService *services.GuildService
+}
+
+func NewGuildHandler(guildService *services.GuildService) *GuildHandler {
+	return &GuildHandler{guildService: guildService}
+}
+
+func guildError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrGuildNotFound),
+		errors.Is(err, services.ErrApplicationNotFound),
+		errors.Is(err, services.ErrInviteNotFound),
+		errors.Is(err, services.ErrRelationNotFound),
+		errors.Is(err, services.ErrRelationTargetNotFound),
+		errors.Is(err, services.ErrVoteNotFound),
+		errors.Is(err, services.ErrStorageItemNotFound):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrGuildSpecTaken),
+		errors.Is(err, services.ErrGuildNameTaken),
+		errors.Is(err, services.ErrAlreadyInGuild),
+		errors.Is(err, services.ErrNotInGuild),
+		errors.Is(err, services.ErrNotGuildMember),
+		errors.Is(err, services.ErrGuildFull),
+		errors.Is(err, services.ErrGuildNotRecruiting),
+		errors.Is(err, services.ErrApplicationPending),
+		errors.Is(err, services.ErrAlreadyInvited),
+		errors.Is(err, services.ErrAlreadyGuildLeader),
+		errors.Is(err, services.ErrLeaderCannotLeave),
+		errors.Is(err, services.ErrRelationExists),
+		errors.Is(err, services.ErrAllianceExists),
+		errors.Is(err, services.ErrTooManyEnemies),
+		errors.Is(err, services.ErrRelationLocked),
+		errors.Is(err, services.ErrRelationNotActive),
+		errors.Is(err, services.ErrNoAlliance),
+		errors.Is(err, services.ErrVoteClosed),
+		errors.Is(err, services.ErrVoteInProgress),
+		errors.Is(err, services.ErrAlreadyVoted),
+		errors.Is(err, services.ErrGuildStorageFull),
+		errors.Is(err, services.ErrWithdrawalLimit):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrNotGuildLeader),
+		errors.Is(err, services.ErrInsufficientGuildRank),
+		errors.Is(err, services.ErrGuildLevelTooLow),
+		errors.Is(err, services.ErrNotDeclaringGuild),
+		errors.Is(err, services.ErrNotEligibleVoter),
+		errors.Is(err, services.ErrGuildStorageLocked),
+		errors.Is(err, services.ErrGuildChatLocked):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrInvalidGuildName),
+		errors.Is(err, services.ErrInvalidSpecialization),
+		errors.Is(err, services.ErrInvalidGuildRank),
+		errors.Is(err, services.ErrInvalidGuildSettings),
+		errors.Is(err, services.ErrInvalidRelationTarget),
+		errors.Is(err, services.ErrInvalidChatChannel),
+		errors.Is(err, services.ErrInvalidChatMessage),
+		errors.Is(err, services.ErrGuildLogActionFilter),
+		errors.Is(err, services.ErrInsufficientGold),
+		errors.Is(err, services.ErrInvalidAmount),
+		errors.Is(err, services.ErrInvalidQuantity),
+		errors.Is(err, services.ErrItemNotFound),
+		errors.Is(err, services.ErrItemNotTradeable),
+		errors.Is(err, services.ErrItemInTrade),
+		errors.Is(err, services.ErrInventoryFull):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *GuildHandler) List(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	guilds, err := h.guildService.ListGuilds(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guilds")
+		return
+	}
+
+	if guilds == nil {
+		guilds = []*models.Guild{}
+	}
+
+	Success(w, guilds)
+}
+
+func (h *GuildHandler) Found(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.FoundGuildRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	guild, err := h.guildService.Found(r.Context(), accountID, characterID, &req)
+	if err != nil {
+		guildError(w, err, "failed to found guild")
+		return
+	}
+
+	Created(w, guild)
+}
+
+func (h *GuildHandler) Get(w http.ResponseWriter, r *http.Request) {
+	guildID, ok := uuidParam(w, r, "id", "guild id")
+	if !ok {
+		return
+	}
+
+	guild, err := h.guildService.GetGuild(r.Context(), guildID)
+	if err != nil {
+		guildError(w, err, "failed to get guild")
+		return
+	}
+
+	Success(w, guild)
+}
+
+func (h *GuildHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	guildID, ok := uuidParam(w, r, "id", "guild id")
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	members, err := h.guildService.GetMembers(r.Context(), guildID, limit, offset)
+	if err != nil {
+		guildError(w, err, "failed to get guild members")
+		return
+	}
+
+	if members == nil {
+		members = []*models.GuildMember{}
+	}
+
+	Success(w, members)
+}
+
+func (h *GuildHandler) Apply(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	guildID, ok := uuidParam(w, r, "id", "guild id")
+	if !ok {
+		return
+	}
+
+	var req models.GuildApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	application, err := h.guildService.Apply(r.Context(), accountID, characterID, guildID, req.Message)
+	if err != nil {
+		guildError(w, err, "failed to apply to guild")
+		return
+	}
+
+	Created(w, application)
+}
+
+func (h *GuildHandler) GetMine(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	guild, err := h.guildService.GetMyGuild(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guild")
+		return
+	}
+
+	Success(w, guild)
+}
+
+func (h *GuildHandler) ListApplications(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	applications, err := h.guildService.ListApplications(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guild applications")
+		return
+	}
+
+	if applications == nil {
+		applications = []*models.GuildApplication{}
+	}
+
+	Success(w, applications)
+}
+
+func (h *GuildHandler) AcceptApplication(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	applicationID, ok := uuidParam(w, r, "id", "application id")
+	if !ok {
+		return
+	}
+
+	application, err := h.guildService.AcceptApplication(r.Context(), accountID, characterID, applicationID)
+	if err != nil {
+		guildError(w, err, "failed to accept application")
+		return
+	}
+
+	Success(w, application)
+}
+
+func (h *GuildHandler) RejectApplication(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	applicationID, ok := uuidParam(w, r, "id", "application id")
+	if !ok {
+		return
+	}
+
+	application, err := h.guildService.RejectApplication(r.Context(), accountID, characterID, applicationID)
+	if err != nil {
+		guildError(w, err, "failed to reject application")
+		return
+	}
+
+	Success(w, application)
+}
+
+func (h *GuildHandler) CancelApplication(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	applicationID, ok := uuidParam(w, r, "id", "application id")
+	if !ok {
+		return
+	}
+
+	if err := h.guildService.CancelApplication(r.Context(), accountID, characterID, applicationID); err != nil {
+		guildError(w, err, "failed to cancel application")
+		return
+	}
+
+	Success(w, map[string]bool{"cancelled": true})
+}
+
+func (h *GuildHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.GuildInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.CharacterID == uuid.Nil {
+		BadRequest(w, "character_id is required")
+		return
+	}
+
+	invite, err := h.guildService.Invite(r.Context(), accountID, characterID, req.CharacterID)
+	if err != nil {
+		guildError(w, err, "failed to invite to guild")
+		return
+	}
+
+	Created(w, invite)
+}
+
+func (h *GuildHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	invites, err := h.guildService.ListMyInvites(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guild invites")
+		return
+	}
+
+	if invites == nil {
+		invites = []*models.GuildInvite{}
+	}
+
+	Success(w, invites)
+}
+
+func (h *GuildHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	inviteID, ok := uuidParam(w, r, "id", "invite id")
+	if !ok {
+		return
+	}
+
+	guild, err := h.guildService.AcceptInvite(r.Context(), accountID, characterID, inviteID)
+	if err != nil {
+		guildError(w, err, "failed to accept invite")
+		return
+	}
+
+	Success(w, guild)
+}
+
+func (h *GuildHandler) DeclineInvite(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	inviteID, ok := uuidParam(w, r, "id", "invite id")
+	if !ok {
+		return
+	}
+
+	if err := h.guildService.DeclineInvite(r.Context(), accountID, characterID, inviteID); err != nil {
+		guildError(w, err, "failed to decline invite")
+		return
+	}
+
+	Success(w, map[string]bool{"declined": true})
+}
+
+func (h *GuildHandler) Kick(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	if err := h.guildService.Kick(r.Context(), accountID, characterID, targetID); err != nil {
+		guildError(w, err, "failed to kick member")
+		return
+	}
+
+	Success(w, map[string]bool{"kicked": true})
+}
+
+func (h *GuildHandler) SetRank(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	var req models.SetGuildRankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if err := h.guildService.SetRank(r.Context(), accountID, characterID, targetID, req.Rank); err != nil {
+		guildError(w, err, "failed to set guild rank")
+		return
+	}
+
+	Success(w, map[string]bool{"updated": true})
+}
+
+func (h *GuildHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.guildService.Leave(r.Context(), accountID, characterID); err != nil {
+		guildError(w, err, "failed to leave guild")
+		return
+	}
+
+	Success(w, map[string]bool{"left": true})
+}
+
+func (h *GuildHandler) Transfer(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TransferGuildRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.CharacterID == uuid.Nil {
+		BadRequest(w, "character_id is required")
+		return
+	}
+
+	guild, err := h.guildService.Transfer(r.Context(), accountID, characterID, req.CharacterID)
+	if err != nil {
+		guildError(w, err, "failed to transfer guild")
+		return
+	}
+
+	Success(w, guild)
+}
+
+func (h *GuildHandler) Disband(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.guildService.Disband(r.Context(), accountID, characterID); err != nil {
+		guildError(w, err, "failed to disband guild")
+		return
+	}
+
+	Success(w, map[string]bool{"disbanded": true})
+}
+
+func (h *GuildHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.GuildSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	guild, err := h.guildService.UpdateSettings(r.Context(), accountID, characterID, &req)
+	if err != nil {
+		guildError(w, err, "failed to update guild settings")
+		return
+	}
+
+	Success(w, guild)
+}
+
+func (h *GuildHandler) ListRelations(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	relations, err := h.guildService.ListRelations(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guild relations")
+		return
+	}
+
+	if relations == nil {
+		relations = []*models.GuildRelation{}
+	}
+
+	Success(w, relations)
+}
+
+// decodeRelationTarget reads the target guild of a relation proposal
+func decodeRelationTarget(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	var req models.GuildRelationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return uuid.Nil, false
+	}
+
+	if req.TargetGuildID == uuid.Nil {
+		BadRequest(w, "target_guild_id is required")
+		return uuid.Nil, false
+	}
+	return req.TargetGuildID, true
+}
+
+func (h *GuildHandler) ProposeAlliance(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, ok := decodeRelationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	vote, err := h.guildService.ProposeAlliance(r.Context(), accountID, characterID, targetID)
+	if err != nil {
+		guildError(w, err, "failed to propose alliance")
+		return
+	}
+
+	Created(w, vote)
+}
+
+func (h *GuildHandler) DeclareEnemy(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, ok := decodeRelationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	vote, err := h.guildService.DeclareEnemy(r.Context(), accountID, characterID, targetID)
+	if err != nil {
+		guildError(w, err, "failed to declare enemy")
+		return
+	}
+
+	Created(w, vote)
+}
+
+func (h *GuildHandler) CancelRelation(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	relationID, ok := uuidParam(w, r, "id", "relation id")
+	if !ok {
+		return
+	}
+
+	vote, err := h.guildService.CancelRelation(r.Context(), accountID, characterID, relationID)
+	if err != nil {
+		guildError(w, err, "failed to cancel guild relation")
+		return
+	}
+
+	Created(w, vote)
+}
+
+func (h *GuildHandler) ListVotes(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	openOnly := r.URL.Query().Get("open") == "true"
+	limit, offset := pagination(r)
+	votes, err := h.guildService.ListVotes(r.Context(), accountID, characterID, openOnly, limit, offset)
+	if err != nil {
+		guildError(w, err, "failed to get guild votes")
+		return
+	}
+
+	if votes == nil {
+		votes = []*models.GuildVote{}
+	}
+
+	Success(w, votes)
+}
+
+func (h *GuildHandler) GetVote(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	voteID, ok := uuidParam(w, r, "id", "vote id")
+	if !ok {
+		return
+	}
+
+	vote, err := h.guildService.GetVote(r.Context(), accountID, characterID, voteID)
+	if err != nil {
+		guildError(w, err, "failed to get guild vote")
+		return
+	}
+
+	Success(w, vote)
+}
+
+func (h *GuildHandler) CastBallot(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	voteID, ok := uuidParam(w, r, "id", "vote id")
+	if !ok {
+		return
+	}
+
+	var req models.CastBallotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	vote, err := h.guildService.CastBallot(r.Context(), accountID, characterID, voteID, req.Approve)
+	if err != nil {
+		guildError(w, err, "failed to cast ballot")
+		return
+	}
+
+	Success(w, vote)
+}
+
+func (h *GuildHandler) GetChat(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	channel := models.GuildChatChannel(r.URL.Query().Get("channel"))
+	if channel == "" {
+		channel = models.GuildChatGuild
+	}
+
+	limit, offset := pagination(r)
+	messages, err := h.guildService.GetChat(r.Context(), accountID, characterID, channel, limit, offset)
+	if err != nil {
+		guildError(w, err, "failed to get guild chat")
+		return
+	}
+
+	if messages == nil {
+		messages = []*models.GuildChatMessage{}
+	}
+
+	Success(w, messages)
+}
+
+func (h *GuildHandler) SendChat(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.GuildChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.Channel == "" {
+		req.Channel = models.GuildChatGuild
+	}
+
+	message, err := h.guildService.SendChat(r.Context(), accountID, characterID, req.Channel, req.Message)
+	if err != nil {
+		guildError(w, err, "failed to send guild chat")
+		return
+	}
+
+	Created(w, message)
+}
+
+func (h *GuildHandler) GetStorage(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	storage, err := h.guildService.GetStorage(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guild storage")
+		return
+	}
+
+	Success(w, storage)
+}
+
+func (h *GuildHandler) DepositItem(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.GuildStorageDepositRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	storage, err := h.guildService.DepositItem(r.Context(), accountID, characterID, &req)
+	if err != nil {
+		guildError(w, err, "failed to deposit item")
+		return
+	}
+
+	Success(w, storage)
+}
+
+func (h *GuildHandler) WithdrawItem(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	itemID, ok := uuidParam(w, r, "id", "storage item id")
+	if !ok {
+		return
+	}
+
+	var req models.GuildStorageWithdrawRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	storage, err := h.guildService.WithdrawItem(r.Context(), accountID, characterID, itemID, req.Quantity)
+	if err != nil {
+		guildError(w, err, "failed to withdraw item")
+		return
+	}
+
+	Success(w, storage)
+}
+
+func (h *GuildHandler) GetTreasury(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	treasury, err := h.guildService.GetTreasury(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guild treasury")
+		return
+	}
+
+	Success(w, treasury)
+}
+
+func (h *GuildHandler) DonateGold(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.GuildTreasuryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	treasury, err := h.guildService.DonateGold(r.Context(), accountID, characterID, req.Amount)
+	if err != nil {
+		guildError(w, err, "failed to donate gold")
+		return
+	}
+
+	Success(w, treasury)
+}
+
+func (h *GuildHandler) WithdrawGold(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.GuildTreasuryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	treasury, err := h.guildService.WithdrawGold(r.Context(), accountID, characterID, req.Amount)
+	if err != nil {
+		guildError(w, err, "failed to withdraw gold")
+		return
+	}
+
+	Success(w, treasury)
+}
+
+// GetLogs pages through the guild log. ?action= takes a comma separated
+// list of actions to keep.
+func (h *GuildHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var actions []string
+	for _, a := range strings.Split(r.URL.Query().Get("action"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			actions = append(actions, a)
+		}
+	}
+	limit, offset := pagination(r)
+	entries, err := h.guildService.GetLogs(r.Context(), accountID, characterID, actions, limit, offset)
+	if err != nil {
+		guildError(w, err, "failed to get guild logs")
+		return
+	}
+
+	if entries == nil {
+		entries = []*models.GuildLogEntry{}
+	}
+
+	Success(w, entries)
+}
+
+func (h *GuildHandler) GetLevel(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	info, err := h.guildService.GetLevel(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guild level")
+		return
+	}
+
+	Success(w, info)
+}
+
+func (h *GuildHandler) ListQuests(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	quests, err := h.guildService.ListQuests(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guild quests")
+		return
+	}
+
+	if quests == nil {
+		quests = []*models.GuildQuest{}
+	}
+
+	Success(w, quests)
+}
+
+func (h *GuildHandler) GetBonuses(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	bonuses, err := h.guildService.GetBonuses(r.Context(), accountID, characterID)
+	if err != nil {
+		guildError(w, err, "failed to get guild bonuses")
+		return
+	}
+
+	Success(w, bonuses)
+}
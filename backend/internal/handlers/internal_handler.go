@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+)
+
+// InternalHandler takes reports from the game server, which resolves
+// real-time combat and movement
+type InternalHandler struct {
+	prisonService *services.PrisonService
+	flagService   *services.FlagService
+	partyService  *services.PartyService
+}
+
+func NewInternalHandler(prisonService *services.PrisonService, flagService *services.FlagService, partyService *services.PartyService) *InternalHandler {
+	return &InternalHandler{prisonService: prisonService, flagService: flagService, partyService: partyService}
+}
+
+func internalError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrMapNotFound):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrConfinedToPrison),
+		errors.Is(err, services.ErrRedFlagInCity),
+		errors.Is(err, services.ErrInPrison):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrInvalidPvPResult),
+		errors.Is(err, services.ErrInvalidKillReport):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *InternalHandler) ReportPvP(w http.ResponseWriter, r *http.Request) {
+	var req models.PvPResult
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if err := h.prisonService.RecordPvPResult(r.Context(), &req); err != nil {
+		internalError(w, err, "failed to record pvp result")
+		return
+	}
+
+	Success(w, map[string]bool{"recorded": true})
+}
+
+func (h *InternalHandler) ReportDeath(w http.ResponseWriter, r *http.Request) {
+	characterID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	if err := h.prisonService.RecordDeath(r.Context(), characterID); err != nil {
+		internalError(w, err, "failed to record death")
+		return
+	}
+
+	Success(w, map[string]bool{"recorded": true})
+}
+
+func (h *InternalHandler) EnterMap(w http.ResponseWriter, r *http.Request) {
+	characterID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	var req models.EnterMapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if err := h.flagService.EnterMap(r.Context(), characterID, &req); err != nil {
+		internalError(w, err, "failed to move character")
+		return
+	}
+
+	Success(w, map[string]bool{"moved": true})
+}
+
+func (h *InternalHandler) ReportKill(w http.ResponseWriter, r *http.Request) {
+	characterID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	var req models.KillReport
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	rewards, err := h.partyService.RewardKill(r.Context(), characterID, &req)
+	if err != nil {
+		internalError(w, err, "failed to reward kill")
+		return
+	}
+
+	Success(w, rewards)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+)
+
+type KarmaHandler struct {
+	karmaService *services.KarmaService
+}
+
+func NewKarmaHandler(karmaService *services.KarmaService) *KarmaHandler {
+	return &KarmaHandler{karmaService: karmaService}
+}
+
+func (h *KarmaHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	profile, err := h.karmaService.GetProfile(r.Context(), accountID, characterID)
+	if err != nil {
+		if !characterError(w, err) {
+			InternalError(w, "failed to get karma")
+		}
+		return
+	}
+
+	Success(w, profile)
+}
+
+func (h *KarmaHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	logs, err := h.karmaService.GetHistory(r.Context(), accountID, characterID, limit, offset)
+	if err != nil {
+		if !characterError(w, err) {
+			InternalError(w, "failed to get karma history")
+		}
+		return
+	}
+
+	if logs == nil {
+		logs = []*models.KarmaLog{}
+	}
+
+	Success(w, logs)
+}
+
+func (h *KarmaHandler) ListWanted(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	profiles, err := h.karmaService.ListWanted(r.Context(), accountID, characterID, limit, offset)
+	if err != nil {
+		if !characterError(w, err) {
+			InternalError(w, "failed to get wanted list")
+		}
+		return
+	}
+
+	if profiles == nil {
+		profiles = []*models.KarmaProfile{}
+	}
+
+	Success(w, profiles)
+}
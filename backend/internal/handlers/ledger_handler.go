@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+)
+
+type LedgerHandler struct {
+	ledgerService *services.LedgerService
+}
+
+func NewLedgerHandler(ledgerService *services.LedgerService) *LedgerHandler {
+	return &LedgerHandler{ledgerService: ledgerService}
+}
+
+func (h *LedgerHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	entries, err := h.ledgerService.GetHistory(r.Context(), accountID, characterID, r.URL.Query().Get("currency"), limit, offset)
+	if err != nil {
+		if !characterError(w, err) {
+			InternalError(w, "failed to get economy history")
+		}
+		return
+	}
+
+	if entries == nil {
+		entries = []*models.LedgerEntry{}
+	}
+
+	Success(w, entries)
+}
+
+// GetEconomySummary - GM dashboard faucet/sink totals over the last ?days (default 1)
+func (h *LedgerHandler) GetEconomySummary(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 || days > 90 {
+		days = 1
+	}
+
+	summary, err := h.ledgerService.GetEconomySummary(r.Context(), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		InternalError(w, "failed to get economy summary")
+		return
+	}
+
+	Success(w, summary)
+}
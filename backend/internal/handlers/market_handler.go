@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+
+	"github.com/google/uuid"
+)
+
+type MarketHandler struct {
+	marketService *services.MarketService
+}
+
+func NewMarketHandler(marketService *services.MarketService) *MarketHandler {
+	return &MarketHandler{marketService: marketService}
+}
+
+func marketError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrListingNotFound):
+		NotFound(w, "listing not found")
+	case errors.Is(err, services.ErrListingUnavailable):
+		Conflict(w, "listing is no longer available")
+	case errors.Is(err, services.ErrMarketLocked):
+		Forbidden(w, "market unlocks at level 20")
+	case errors.Is(err, services.ErrInsufficientGold),
+		errors.Is(err, services.ErrCannotBuyOwnListing),
+		errors.Is(err, services.ErrTooManyListings),
+		errors.Is(err, services.ErrInvalidPrice),
+		errors.Is(err, services.ErrInvalidDuration),
+		errors.Is(err, services.ErrInvalidQuantity),
+		errors.Is(err, services.ErrInvalidCursor),
+		errors.Is(err, services.ErrItemNotFound),
+		errors.Is(err, services.ErrItemNotTradeable),
+		errors.Is(err, services.ErrItemInTrade),
+		errors.Is(err, services.ErrInventoryFull):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *MarketHandler) Search(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var filter models.MarketSearchFilter
+	var ok1, ok2, ok3, ok4, ok5, ok6 bool
+	filter.ItemDefinitionID, ok1 = optionalInt(r, "item_id")
+	filter.MinUpgradeLevel, ok2 = optionalInt(r, "min_upgrade")
+	filter.MaxUpgradeLevel, ok3 = optionalInt(r, "max_upgrade")
+	filter.GemID, ok4 = optionalInt(r, "gem_id")
+	filter.MinPrice, ok5 = optionalInt64(r, "min_price")
+	filter.MaxPrice, ok6 = optionalInt64(r, "max_price")
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6) {
+		BadRequest(w, "invalid search filter")
+		return
+	}
+	filter.Cursor = r.URL.Query().Get("cursor")
+	filter.Limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 50
+	}
+
+	result, err := h.marketService.Search(r.Context(), accountID, characterID, &filter)
+	if err != nil {
+		marketError(w, err, "failed to search market")
+		return
+	}
+
+	Success(w, result)
+}
+
+func (h *MarketHandler) MyListings(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	listings, err := h.marketService.GetMyListings(r.Context(), accountID, characterID, r.URL.Query().Get("status"), limit, offset)
+	if err != nil {
+		marketError(w, err, "failed to get listings")
+		return
+	}
+
+	if listings == nil {
+		listings = []*models.MarketListing{}
+	}
+
+	Success(w, listings)
+}
+
+func (h *MarketHandler) CreateListing(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateListingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.InventoryItemID == uuid.Nil || req.Quantity <= 0 || req.PricePerUnit <= 0 {
+		BadRequest(w, "inventory_item_id, quantity and price_per_unit are required")
+		return
+	}
+
+	listing, err := h.marketService.CreateListing(r.Context(), accountID, characterID, &req)
+	if err != nil {
+		marketError(w, err, "failed to create listing")
+		return
+	}
+
+	Created(w, listing)
+}
+
+func (h *MarketHandler) Buy(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	listingID, ok := uuidParam(w, r, "id", "listing id")
+	if !ok {
+		return
+	}
+
+	purchase, err := h.marketService.Buy(r.Context(), accountID, characterID, listingID)
+	if err != nil {
+		marketError(w, err, "failed to buy listing")
+		return
+	}
+
+	Success(w, purchase)
+}
+
+func (h *MarketHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	listingID, ok := uuidParam(w, r, "id", "listing id")
+	if !ok {
+		return
+	}
+
+	listing, err := h.marketService.Cancel(r.Context(), accountID, characterID, listingID)
+	if err != nil {
+		marketError(w, err, "failed to cancel listing")
+		return
+	}
+
+	Success(w, listing)
+}
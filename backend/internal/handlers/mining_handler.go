@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+)
+
+type MiningHandler struct {
+	miningService *services.MiningService
+}
+
+func NewMiningHandler(miningService *services.MiningService) *MiningHandler {
+	return &MiningHandler{miningService: miningService}
+}
+
+func miningError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrMiningNodeNotFound):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrAlreadyMining),
+		errors.Is(err, services.ErrNotMining),
+		errors.Is(err, services.ErrNodeDepleted),
+		errors.Is(err, services.ErrOreBagFull),
+		errors.Is(err, services.ErrNoOreToSell):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrPrisonNode),
+		errors.Is(err, services.ErrConfinedToPrison):
+		Forbidden(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *MiningHandler) GetNodes(w http.ResponseWriter, r *http.Request) {
+	mapID, ok := optionalInt(r, "map_id")
+	if !ok {
+		BadRequest(w, "invalid map_id")
+		return
+	}
+
+	nodes, err := h.miningService.GetNodes(r.Context(), mapID)
+	if err != nil {
+		InternalError(w, "failed to get mining nodes")
+		return
+	}
+
+	if nodes == nil {
+		nodes = []*models.MiningNode{}
+	}
+
+	Success(w, nodes)
+}
+
+func (h *MiningHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.miningService.GetStatus(r.Context(), accountID, characterID)
+	if err != nil {
+		miningError(w, err, "failed to get mining status")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *MiningHandler) Start(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.StartMiningRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.NodeID <= 0 {
+		BadRequest(w, "node_id is required")
+		return
+	}
+
+	status, err := h.miningService.Start(r.Context(), accountID, characterID, req.NodeID)
+	if err != nil {
+		miningError(w, err, "failed to start mining")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *MiningHandler) Stop(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.miningService.Stop(r.Context(), accountID, characterID)
+	if err != nil {
+		miningError(w, err, "failed to stop mining")
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *MiningHandler) GetOre(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	ore, err := h.miningService.GetOre(r.Context(), accountID, characterID, limit, offset)
+	if err != nil {
+		miningError(w, err, "failed to get ore")
+		return
+	}
+
+	if ore == nil {
+		ore = []*models.OreExtraction{}
+	}
+
+	Success(w, ore)
+}
+
+func (h *MiningHandler) Sell(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SellOreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	sale, err := h.miningService.Sell(r.Context(), accountID, characterID, req.ExtractionIDs)
+	if err != nil {
+		miningError(w, err, "failed to sell ore")
+		return
+	}
+
+	Success(w, sale)
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+
+	"github.com/google/uuid"
+)
+
+type PartyHandler struct {
+	partyService *services.PartyService
+}
+
+func NewPartyHandler(partyService *services.PartyService) *PartyHandler {
+	return &PartyHandler{partyService: partyService}
+}
+
+func partyError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrPartyNotFound),
+		errors.Is(err, services.ErrNotInParty),
+		errors.Is(err, services.ErrPartyInviteNotFound):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrAlreadyInParty),
+		errors.Is(err, services.ErrPartyFull),
+		errors.Is(err, services.ErrAlreadyInvitedToParty),
+		errors.Is(err, services.ErrAlreadyPartyLeader):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrNotPartyLeader),
+		errors.Is(err, services.ErrPartyNotPublic):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrNotPartyMember),
+		errors.Is(err, services.ErrPartyKickSelf),
+		errors.Is(err, services.ErrInvalidLootMode),
+		errors.Is(err, services.ErrInvalidRollRarity),
+		errors.Is(err, services.ErrInvalidChatMessage):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *PartyHandler) Get(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	party, err := h.partyService.GetMyParty(r.Context(), accountID, characterID)
+	if err != nil {
+		partyError(w, err, "failed to get party")
+		return
+	}
+
+	Success(w, party)
+}
+
+func (h *PartyHandler) ListPublic(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	parties, err := h.partyService.ListPublic(r.Context(), accountID, characterID, limit, offset)
+	if err != nil {
+		partyError(w, err, "failed to get parties")
+		return
+	}
+
+	if parties == nil {
+		parties = []*models.Party{}
+	}
+
+	Success(w, parties)
+}
+
+func (h *PartyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreatePartyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	party, err := h.partyService.Create(r.Context(), accountID, characterID, &req)
+	if err != nil {
+		partyError(w, err, "failed to create party")
+		return
+	}
+
+	Created(w, party)
+}
+
+func (h *PartyHandler) Join(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	partyID, ok := uuidParam(w, r, "id", "party id")
+	if !ok {
+		return
+	}
+
+	party, err := h.partyService.Join(r.Context(), accountID, characterID, partyID)
+	if err != nil {
+		partyError(w, err, "failed to join party")
+		return
+	}
+
+	Success(w, party)
+}
+
+func (h *PartyHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.PartySettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	party, err := h.partyService.UpdateSettings(r.Context(), accountID, characterID, &req)
+	if err != nil {
+		partyError(w, err, "failed to update party settings")
+		return
+	}
+
+	Success(w, party)
+}
+
+func (h *PartyHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.PartyInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.CharacterID == uuid.Nil {
+		BadRequest(w, "character_id is required")
+		return
+	}
+
+	invite, err := h.partyService.Invite(r.Context(), accountID, characterID, req.CharacterID)
+	if err != nil {
+		partyError(w, err, "failed to invite to party")
+		return
+	}
+
+	Created(w, invite)
+}
+
+func (h *PartyHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	invites, err := h.partyService.ListMyInvites(r.Context(), accountID, characterID)
+	if err != nil {
+		partyError(w, err, "failed to get party invites")
+		return
+	}
+
+	if invites == nil {
+		invites = []*models.PartyInvite{}
+	}
+
+	Success(w, invites)
+}
+
+func (h *PartyHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	inviteID, ok := uuidParam(w, r, "id", "invite id")
+	if !ok {
+		return
+	}
+
+	party, err := h.partyService.AcceptInvite(r.Context(), accountID, characterID, inviteID)
+	if err != nil {
+		partyError(w, err, "failed to accept party invite")
+		return
+	}
+
+	Success(w, party)
+}
+
+func (h *PartyHandler) DeclineInvite(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	inviteID, ok := uuidParam(w, r, "id", "invite id")
+	if !ok {
+		return
+	}
+
+	if err := h.partyService.DeclineInvite(r.Context(), accountID, characterID, inviteID); err != nil {
+		partyError(w, err, "failed to decline party invite")
+		return
+	}
+
+	Success(w, map[string]bool{"declined": true})
+}
+
+func (h *PartyHandler) Kick(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	party, err := h.partyService.Kick(r.Context(), accountID, characterID, targetID)
+	if err != nil {
+		partyError(w, err, "failed to kick party member")
+		return
+	}
+
+	Success(w, party)
+}
+
+func (h *PartyHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.partyService.Leave(r.Context(), accountID, characterID); err != nil {
+		partyError(w, err, "failed to leave party")
+		return
+	}
+
+	Success(w, map[string]bool{"left": true})
+}
+
+func (h *PartyHandler) Transfer(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TransferPartyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.CharacterID == uuid.Nil {
+		BadRequest(w, "character_id is required")
+		return
+	}
+
+	party, err := h.partyService.Transfer(r.Context(), accountID, characterID, req.CharacterID)
+	if err != nil {
+		partyError(w, err, "failed to transfer party")
+		return
+	}
+
+	Success(w, party)
+}
+
+func (h *PartyHandler) GetChat(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	messages, err := h.partyService.GetChat(r.Context(), accountID, characterID, limit, offset)
+	if err != nil {
+		partyError(w, err, "failed to get party chat")
+		return
+	}
+
+	if messages == nil {
+		messages = []*models.PartyChatMessage{}
+	}
+
+	Success(w, messages)
+}
+
+func (h *PartyHandler) SendChat(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.PartyChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	message, err := h.partyService.SendChat(r.Context(), accountID, characterID, req.Message)
+	if err != nil {
+		partyError(w, err, "failed to send party chat")
+		return
+	}
+
+	Created(w, message)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PrisonHandler struct {
+	prisonService *services.PrisonService
+}
+
+func NewPrisonHandler(prisonService *services.PrisonService) *PrisonHandler {
+	return &PrisonHandler{prisonService: prisonService}
+}
+
+func prisonError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrPrisonEventNotFound),
+		errors.Is(err, services.ErrNoOpenPrisonEvent),
+		errors.Is(err, services.ErrNotInCourtyard):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrAlreadyJoinedEvent):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrNotInPrison):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrInvalidPrisonEvent):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *PrisonHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.prisonService.GetStatus(r.Context(), accountID, characterID)
+	if err != nil {
+		if !characterError(w, err) {
+			InternalError(w, "failed to get prison status")
+		}
+		return
+	}
+
+	Success(w, status)
+}
+
+func (h *PrisonHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	records, err := h.prisonService.GetHistory(r.Context(), accountID, characterID, limit, offset)
+	if err != nil {
+		if !characterError(w, err) {
+			InternalError(w, "failed to get prison history")
+		}
+		return
+	}
+
+	if records == nil {
+		records = []*models.PrisonRecord{}
+	}
+
+	Success(w, records)
+}
+
+func (h *PrisonHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.prisonService.GetEvents(r.Context(), accountID, characterID)
+	if err != nil {
+		prisonError(w, err, "failed to get prison events")
+		return
+	}
+
+	Success(w, schedule)
+}
+
+func (h *PrisonHandler) JoinEvent(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	eventType := models.PrisonEventType(chi.URLParam(r, "type"))
+	event, err := h.prisonService.JoinEvent(r.Context(), accountID, characterID, eventType)
+	if err != nil {
+		prisonError(w, err, "failed to join prison event")
+		return
+	}
+
+	Success(w, event)
+}
+
+func (h *PrisonHandler) GetEventResults(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := uuidParam(w, r, "id", "event id")
+	if !ok {
+		return
+	}
+
+	eventType := models.PrisonEventType(chi.URLParam(r, "type"))
+	entries, err := h.prisonService.GetEventResults(r.Context(), eventType, eventID)
+	if err != nil {
+		prisonError(w, err, "failed to get event results")
+		return
+	}
+
+	if entries == nil {
+		entries = []*models.PrisonEventEntry{}
+	}
+
+	Success(w, entries)
+}
+
+func (h *PrisonHandler) GetRankings(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	previous := r.URL.Query().Get("week") == "previous"
+	limit, offset := pagination(r)
+	rankings, err := h.prisonService.GetRankings(r.Context(), accountID, characterID, previous, limit, offset)
+	if err != nil {
+		prisonError(w, err, "failed to get prison rankings")
+		return
+	}
+
+	if rankings == nil {
+		rankings = []*models.PrisonRanking{}
+	}
+
+	Success(w, rankings)
+}
+
+func (h *PrisonHandler) CourtyardFight(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	result, err := h.prisonService.CourtyardFight(r.Context(), accountID, characterID, targetID)
+	if err != nil {
+		prisonError(w, err, "failed to fight in the courtyard")
+		return
+	}
+
+	Success(w, result)
+}
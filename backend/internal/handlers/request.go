@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"realm-of-conquest/internal/middleware"
+	"realm-of-conquest/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// requireCharacter returns the authenticated account and the acting character
+// from the X-Character-ID header, writing an error response if either is missing.
+func requireCharacter(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	accountID, ok := middleware.GetAccountID(r.Context())
+	if !ok {
+		Unauthorized(w, "unauthorized")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	characterID, ok := getCharacterID(r)
+	if !ok {
+		BadRequest(w, "X-Character-ID header is required")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return accountID, characterID, true
+}
+
+// characterError writes the response for the acting-character errors every
+// game service can return. It reports whether err was handled.
+func characterError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrCharacterNotFound):
+		NotFound(w, "character not found")
+	case errors.Is(err, services.ErrNotCharacterOwner):
+		Forbidden(w, "character does not belong to this account")
+	default:
+		return false
+	}
+	return true
+}
+
+// uuidParam parses a UUID route parameter, writing a 400 if it is malformed
+func uuidParam(w http.ResponseWriter, r *http.Request, name, label string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, name))
+	if err != nil {
+		BadRequest(w, "invalid "+label)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// pagination reads limit/offset query params with the usual 50/100 defaults
+func pagination(r *http.Request) (int, int) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// optionalInt parses an optional integer query param
+func optionalInt(r *http.Request, name string) (*int, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, true
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, false
+	}
+	return &v, true
+}
+
+// optionalInt64 parses an optional 64-bit integer query param
+func optionalInt64(r *http.Request, name string) (*int64, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, true
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &v, true
+}
+
+// intParam parses an integer route parameter, writing a 400 if it is malformed
+func intParam(w http.ResponseWriter, r *http.Request, name, label string) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil {
+		BadRequest(w, "invalid "+label)
+		return 0, false
+	}
+	return id, true
+}
@@ -49,3 +49,11 @@ func NotFound(w http.ResponseWriter, message string) {
 func InternalError(w http.ResponseWriter, message string) {
 	Error(w, http.StatusInternalServerError, message)
 }
+
+func Forbidden(w http.ResponseWriter, message string) {
+	Error(w, http.StatusForbidden, message)
+}
+
+func Conflict(w http.ResponseWriter, message string) {
+	Error(w, http.StatusConflict, message)
+}
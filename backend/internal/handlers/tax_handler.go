@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/services"
+)
+
+type TaxHandler struct {
+	taxService *services.TaxService
+}
+
+func NewTaxHandler(taxService *services.TaxService) *TaxHandler {
+	return &TaxHandler{taxService: taxService}
+}
+
+func (h *TaxHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	days, ok := optionalInt(r, "days")
+	if !ok {
+		BadRequest(w, "invalid days")
+		return
+	}
+	period := 0
+	if days != nil {
+		period = *days
+	}
+
+	report, err := h.taxService.GetReport(r.Context(), accountID, characterID, period)
+	if err != nil {
+		if characterError(w, err) {
+			return
+		}
+		if errors.Is(err, services.ErrNotGuildLeader) {
+			Forbidden(w, err.Error())
+			return
+		}
+		InternalError(w, "failed to get tax report")
+		return
+	}
+
+	Success(w, report)
+}
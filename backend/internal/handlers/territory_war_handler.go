@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+)
+
+type TerritoryWarHandler struct {
+	warService *services.TerritoryWarService
+}
+
+func NewTerritoryWarHandler(warService *services.TerritoryWarService) *TerritoryWarHandler {
+	return &TerritoryWarHandler{warService: warService}
+}
+
+func territoryWarError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrWarNotFound),
+		errors.Is(err, services.ErrZoneNotFound),
+		errors.Is(err, services.ErrGuildNotFound):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrNotInGuild),
+		errors.Is(err, services.ErrOwnZone),
+		errors.Is(err, services.ErrCannotAttackAlly),
+		errors.Is(err, services.ErrWarAlreadyDeclared),
+		errors.Is(err, services.ErrZoneWarDeclared),
+		errors.Is(err, services.ErrWarNotScheduled),
+		errors.Is(err, services.ErrWarNotInProgress),
+		errors.Is(err, services.ErrWarClosed),
+		errors.Is(err, services.ErrAlreadyJoinedWar),
+		errors.Is(err, services.ErrNotOnCapturePoint),
+		errors.Is(err, services.ErrNotOnWarMap):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrInsufficientGuildRank),
+		errors.Is(err, services.ErrNotWarGuild),
+		errors.Is(err, services.ErrNotWarParticipant),
+		errors.Is(err, services.ErrNotDeclaringAttacker),
+		errors.Is(err, services.ErrNotWarEnemy),
+		errors.Is(err, services.ErrInPrison):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrZoneNotControllable):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *TerritoryWarHandler) ListZones(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	zones, err := h.warService.ListZones(r.Context(), accountID, characterID)
+	if err != nil {
+		territoryWarError(w, err, "failed to get zones")
+		return
+	}
+
+	if zones == nil {
+		zones = []*models.TerritoryZone{}
+	}
+
+	Success(w, zones)
+}
+
+func (h *TerritoryWarHandler) List(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active") == "true"
+	limit, offset := pagination(r)
+	wars, err := h.warService.ListWars(r.Context(), accountID, characterID, activeOnly, limit, offset)
+	if err != nil {
+		territoryWarError(w, err, "failed to get territory wars")
+		return
+	}
+
+	if wars == nil {
+		wars = []*models.TerritoryWar{}
+	}
+
+	Success(w, wars)
+}
+
+func (h *TerritoryWarHandler) Get(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	warID, ok := uuidParam(w, r, "id", "war id")
+	if !ok {
+		return
+	}
+
+	war, err := h.warService.GetWar(r.Context(), accountID, characterID, warID)
+	if err != nil {
+		territoryWarError(w, err, "failed to get territory war")
+		return
+	}
+
+	Success(w, war)
+}
+
+func (h *TerritoryWarHandler) Declare(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.DeclareWarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+	if req.ZoneID <= 0 {
+		BadRequest(w, "zone_id is required")
+		return
+	}
+
+	war, err := h.warService.Declare(r.Context(), accountID, characterID, req.ZoneID)
+	if err != nil {
+		territoryWarError(w, err, "failed to declare war")
+		return
+	}
+
+	Created(w, war)
+}
+
+func (h *TerritoryWarHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	warID, ok := uuidParam(w, r, "id", "war id")
+	if !ok {
+		return
+	}
+
+	if err := h.warService.Cancel(r.Context(), accountID, characterID, warID); err != nil {
+		territoryWarError(w, err, "failed to cancel war")
+		return
+	}
+
+	Success(w, map[string]bool{"cancelled": true})
+}
+
+func (h *TerritoryWarHandler) Join(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	warID, ok := uuidParam(w, r, "id", "war id")
+	if !ok {
+		return
+	}
+
+	war, err := h.warService.Join(r.Context(), accountID, characterID, warID)
+	if err != nil {
+		territoryWarError(w, err, "failed to join war")
+		return
+	}
+
+	Success(w, war)
+}
+
+func (h *TerritoryWarHandler) ReportPresence(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	warID, ok := uuidParam(w, r, "id", "war id")
+	if !ok {
+		return
+	}
+
+	var req models.WarPointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	war, err := h.warService.ReportPresence(r.Context(), accountID, characterID, warID, req.OnPoint)
+	if err != nil {
+		territoryWarError(w, err, "failed to update capture point")
+		return
+	}
+
+	Success(w, war)
+}
+
+func (h *TerritoryWarHandler) Attack(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	warID, ok := uuidParam(w, r, "id", "war id")
+	if !ok {
+		return
+	}
+
+	targetID, ok := uuidParam(w, r, "characterId", "character id")
+	if !ok {
+		return
+	}
+
+	fight, err := h.warService.Attack(r.Context(), accountID, characterID, warID, targetID)
+	if err != nil {
+		territoryWarError(w, err, "failed to attack")
+		return
+	}
+
+	Success(w, fight)
+}
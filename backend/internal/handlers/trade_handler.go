@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"realm-of-conquest/internal/models"
+	"realm-of-conquest/internal/services"
+
+	"github.com/google/uuid"
+)
+
+type TradeHandler struct {
+	tradeService *services.TradeService
+}
+
+func NewTradeHandler(tradeService *services.TradeService) *TradeHandler {
+	return &TradeHandler{tradeService: tradeService}
+}
+
+func tradeError(w http.ResponseWriter, err error, fallback string) {
+	if characterError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrTradeNotFound),
+		errors.Is(err, services.ErrTradeItemNotFound):
+		NotFound(w, err.Error())
+	case errors.Is(err, services.ErrTradeNotPending),
+		errors.Is(err, services.ErrAlreadyTrading),
+		errors.Is(err, services.ErrTradeAlreadyStarted):
+		Conflict(w, err.Error())
+	case errors.Is(err, services.ErrTradeTrustTooLow),
+		errors.Is(err, services.ErrTradeRateLimited):
+		Forbidden(w, err.Error())
+	case errors.Is(err, services.ErrCannotTradeSelf),
+		errors.Is(err, services.ErrTradeNotAccepted),
+		errors.Is(err, services.ErrTradeOfferLocked),
+		errors.Is(err, services.ErrTradeNotLocked),
+		errors.Is(err, services.ErrTooManyTradeItems),
+		errors.Is(err, services.ErrInvalidGoldAmount),
+		errors.Is(err, services.ErrInsufficientGold),
+		errors.Is(err, services.ErrInvalidQuantity),
+		errors.Is(err, services.ErrItemNotFound),
+		errors.Is(err, services.ErrItemNotTradeable),
+		errors.Is(err, services.ErrItemInTrade):
+		BadRequest(w, err.Error())
+	default:
+		InternalError(w, fallback)
+	}
+}
+
+func (h *TradeHandler) Create(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateTradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.TargetCharacterID == uuid.Nil {
+		BadRequest(w, "target_character_id is required")
+		return
+	}
+
+	trade, err := h.tradeService.Invite(r.Context(), accountID, characterID, &req)
+	if err != nil {
+		tradeError(w, err, "failed to create trade")
+		return
+	}
+
+	Created(w, trade)
+}
+
+func (h *TradeHandler) List(w http.ResponseWriter, r *http.Request) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	trades, err := h.tradeService.List(r.Context(), accountID, characterID, r.URL.Query().Get("status"), limit, offset)
+	if err != nil {
+		tradeError(w, err, "failed to get trades")
+		return
+	}
+
+	if trades == nil {
+		trades = []*models.PlayerTrade{}
+	}
+
+	Success(w, trades)
+}
+
+func (h *TradeHandler) Get(w http.ResponseWriter, r *http.Request) {
+	h.withTrade(w, r, "failed to get trade", h.tradeService.Get)
+}
+
+func (h *TradeHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	h.withTrade(w, r, "failed to accept trade", h.tradeService.Accept)
+}
+
+func (h *TradeHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	h.withTrade(w, r, "failed to cancel trade", h.tradeService.Cancel)
+}
+
+func (h *TradeHandler) Lock(w http.ResponseWriter, r *http.Request) {
+	h.withTrade(w, r, "failed to lock trade", func(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+		return h.tradeService.SetLocked(ctx, accountID, characterID, tradeID, true)
+	})
+}
+
+func (h *TradeHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	h.withTrade(w, r, "failed to unlock trade", func(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+		return h.tradeService.SetLocked(ctx, accountID, characterID, tradeID, false)
+	})
+}
+
+func (h *TradeHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	h.withTrade(w, r, "failed to confirm trade", h.tradeService.Confirm)
+}
+
+func (h *TradeHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	var req models.AddTradeItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	if req.InventoryItemID == uuid.Nil {
+		BadRequest(w, "inventory_item_id is required")
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	h.withTrade(w, r, "failed to add trade item", func(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+		return h.tradeService.AddItem(ctx, accountID, characterID, tradeID, &req)
+	})
+}
+
+func (h *TradeHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := uuidParam(w, r, "itemId", "trade item id")
+	if !ok {
+		return
+	}
+
+	h.withTrade(w, r, "failed to remove trade item", func(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+		return h.tradeService.RemoveItem(ctx, accountID, characterID, tradeID, itemID)
+	})
+}
+
+func (h *TradeHandler) SetGold(w http.ResponseWriter, r *http.Request) {
+	var req models.SetTradeGoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		BadRequest(w, "invalid request body")
+		return
+	}
+
+	h.withTrade(w, r, "failed to set trade gold", func(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+		return h.tradeService.SetGold(ctx, accountID, characterID, tradeID, req.Gold)
+	})
+}
+
+// withTrade resolves the acting character and the {id} trade param, then
+// writes the trade returned by fn.
+func (h *TradeHandler) withTrade(w http.ResponseWriter, r *http.Request, fallback string, fn func(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error)) {
+	accountID, characterID, ok := requireCharacter(w, r)
+	if !ok {
+		return
+	}
+
+	tradeID, ok := uuidParam(w, r, "id", "trade id")
+	if !ok {
+		return
+	}
+
+	trade, err := fn(r.Context(), accountID, characterID, tradeID)
+	if err != nil {
+		tradeError(w, err, fallback)
+		return
+	}
+
+	Success(w, trade)
+}
@@ -76,6 +76,26 @@ func RequireGMRole(minRole models.GMRole) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireGMPermission checks the GM's permission flags with allowed, e.g.
+// func(p *models.GMPermissions) bool { return p.CanJail }
+func RequireGMPermission(gmService *services.GMService, allowed func(*models.GMPermissions) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gmID, ok := GetGMID(r.Context())
+			if !ok {
+				http.Error(w, `{"error": "insufficient permissions"}`, http.StatusForbidden)
+				return
+			}
+			gm, err := gmService.GetGMByID(r.Context(), gmID)
+			if err != nil || gm.Permissions == nil || !allowed(gm.Permissions) {
+				http.Error(w, `{"error": "insufficient permissions"}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func GetGMID(ctx context.Context) (uuid.UUID, bool) {
 	id, ok := ctx.Value(GMIDKey).(uuid.UUID)
 	return id, ok
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// InternalAPIKeyHeader carries the game server's shared secret
+const InternalAPIKeyHeader = "X-Internal-Key"
+
+// InternalAuth only lets through requests from the game server, which
+// report combat and movement resolved outside this API. With no key
+// configured the internal endpoints stay closed.
+func InternalAuth(key string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given := r.Header.Get(InternalAPIKeyHeader)
+			if key == "" || subtle.ConstantTimeCompare([]byte(given), []byte(key)) != 1 {
+				http.Error(w, `{"error": "invalid internal key"}`, http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CaravanStatus string
+
+const (
+	CaravanPreparing   CaravanStatus = "preparing"
+	CaravanTraveling   CaravanStatus = "traveling"
+	CaravanUnderAttack CaravanStatus = "under_attack"
+	CaravanCompleted   CaravanStatus = "completed"
+	CaravanFailed      CaravanStatus = "failed"
+	CaravanDestroyed   CaravanStatus = "destroyed"
+)
+
+// CaravanType - DB: caravan_types
+type CaravanType struct {
+	ID               int     `json:"id"`
+	Name             string  `json:"name"`
+	InvestmentCost   int64   `json:"investment_cost"`
+	SuccessReward    int64   `json:"success_reward"`
+	ProfitPercentage float64 `json:"profit_percentage"`
+	BaseHP           int     `json:"base_hp"`
+	BaseDefense      int     `json:"base_defense"`
+	MaxGuards        int     `json:"max_guards"`
+	MinLevel         int     `json:"min_level"`
+	Icon             *string `json:"icon,omitempty"`
+}
+
+// CaravanRoute - DB: caravan_routes
+type CaravanRoute struct {
+	ID                  int     `json:"id"`
+	Name                string  `json:"name"`
+	StartMapID          int     `json:"start_map_id"`
+	EndMapID            int     `json:"end_map_id"`
+	MinLevel            int     `json:"min_level"`
+	BaseDurationMinutes int     `json:"base_duration_minutes"`
+	DangerLevel         int     `json:"danger_level"`
+	ProfitMultiplier    float64 `json:"profit_multiplier"`
+}
+
+// Caravan - DB: caravans
+type Caravan struct {
+	ID               uuid.UUID     `json:"id"`
+	ServerID         int           `json:"server_id"`
+	OwnerID          uuid.UUID     `json:"owner_id"`
+	OwnerName        string        `json:"owner_name"`
+	CaravanTypeID    int           `json:"caravan_type_id"`
+	CaravanTypeName  string        `json:"caravan_type_name"`
+	RouteID          int           `json:"route_id"`
+	RouteName        string        `json:"route_name"`
+	DangerLevel      int           `json:"danger_level"`
+	Status           CaravanStatus `json:"status"`
+	CurrentHP        int           `json:"current_hp"`
+	MaxHP            int           `json:"max_hp"`
+	MaxGuards        int           `json:"max_guards"`
+	BaseDefense      int           `json:"base_defense"`
+	ProgressPercent  float64       `json:"progress_percent"`
+	CurrentMapID     *int          `json:"current_map_id,omitempty"`
+	Investment       int64         `json:"investment"`
+	ExpectedReward   int64         `json:"expected_reward"`
+	Payout           *int64        `json:"payout,omitempty"`
+	IsInsured        bool          `json:"is_insured"`
+	InsuranceCost    int64         `json:"insurance_cost"`
+	DurationSeconds  *int          `json:"duration_seconds,omitempty"`
+	PausedSeconds    int           `json:"paused_seconds"`
+	StartedAt        *time.Time    `json:"started_at,omitempty"`
+	EstimatedArrival *time.Time    `json:"estimated_arrival,omitempty"`
+	CompletedAt      *time.Time    `json:"completed_at,omitempty"`
+	LastAttackAt     *time.Time    `json:"last_attack_at,omitempty"`
+	AttackEndsAt     *time.Time    `json:"attack_ends_at,omitempty"`
+	FailureReason    *string       `json:"failure_reason,omitempty"`
+	CreatedAt        time.Time     `json:"created_at"`
+}
+
+type CreateCaravanRequest struct {
+	CaravanTypeID int  `json:"caravan_type_id"`
+	RouteID       int  `json:"route_id"`
+	Insured       bool `json:"insured"`
+}
+
+// CaravanAttack - DB: caravan_attacks. One row per attacker per engagement.
+type CaravanAttack struct {
+	ID             uuid.UUID  `json:"id"`
+	CaravanID      uuid.UUID  `json:"caravan_id"`
+	AttackerID     uuid.UUID  `json:"attacker_id"`
+	AttackerName   string     `json:"attacker_name"`
+	Success        *bool      `json:"success"`
+	DamageDealt    int        `json:"damage_dealt"`
+	LootObtained   int64      `json:"loot_obtained"`
+	GuardsKilled   int        `json:"guards_killed"`
+	AttackerDeaths int        `json:"attacker_deaths"`
+	StartedAt      time.Time  `json:"started_at"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+}
+
+// CaravanGuard - DB: caravan_guards. Either a player (CharacterID) or an
+// NPC guard (NPCGuardType).
+type CaravanGuard struct {
+	ID            uuid.UUID  `json:"id"`
+	CaravanID     uuid.UUID  `json:"caravan_id"`
+	CharacterID   *uuid.UUID `json:"character_id,omitempty"`
+	CharacterName *string    `json:"character_name,omitempty"`
+	NPCGuardType  *int       `json:"npc_guard_type,omitempty"`
+	ListingID     *uuid.UUID `json:"listing_id,omitempty"`
+	Hours         int        `json:"hours"`
+	FeeAmount     int64      `json:"fee_amount"`
+	FeePaid       bool       `json:"fee_paid"`
+	RewardEarned  int64      `json:"reward_earned"`
+	IsActive      bool       `json:"is_active"`
+	DamageDealt   int64      `json:"damage_dealt"`
+	Kills         int        `json:"kills"`
+	Deaths        int        `json:"deaths"`
+	JoinedAt      time.Time  `json:"joined_at"`
+}
+
+// NPCGuardTier describes a hireable NPC guard (6.4)
+type NPCGuardTier struct {
+	Tier      int      `json:"tier"`
+	Name      string   `json:"name"`
+	Power     int      `json:"power"`
+	HourlyFee int64    `json:"hourly_fee"`
+	Abilities []string `json:"abilities"`
+}
+
+// NPC guard abilities
+const (
+	GuardAbilityStun  = "stun"
+	GuardAbilityAoE   = "aoe"
+	GuardAbilityTaunt = "taunt"
+	GuardAbilityHeal  = "heal"
+)
+
+var NPCGuardTiers = map[int]NPCGuardTier{
+	1: {Tier: 1, Name: "Çaylak Muhafız", Power: 150, HourlyFee: 500, Abilities: []string{}},
+	2: {Tier: 2, Name: "Deneyimli Muhafız", Power: 400, HourlyFee: 2000, Abilities: []string{GuardAbilityStun}},
+	3: {Tier: 3, Name: "Elit Muhafız", Power: 1000, HourlyFee: 8000, Abilities: []string{GuardAbilityAoE}},
+	4: {Tier: 4, Name: "Şövalye", Power: 2500, HourlyFee: 25000, Abilities: []string{GuardAbilityTaunt, GuardAbilityHeal}},
+	5: {Tier: 5, Name: "Kraliyet Muhafızı", Power: 6000, HourlyFee: 100000,
+		Abilities: []string{GuardAbilityStun, GuardAbilityAoE, GuardAbilityTaunt, GuardAbilityHeal}},
+}
+
+// ProtectorListing - DB: guard_listings. A blue flag player offering
+// protection on the board (6.5).
+type ProtectorListing struct {
+	ID                    uuid.UUID       `json:"id"`
+	CharacterID           uuid.UUID       `json:"character_id"`
+	CharacterName         string          `json:"character_name"`
+	Level                 int             `json:"level"`
+	Class                 CharacterClass  `json:"class"`
+	IsOnline              bool            `json:"is_online"`
+	ServerID              int             `json:"server_id"`
+	MinCaravanType        int             `json:"min_caravan_type"`
+	PreferredRoutes       []int32         `json:"preferred_routes"`
+	HourlyFee             int64           `json:"hourly_fee"`
+	AvailableHours        json.RawMessage `json:"available_hours,omitempty"`
+	TotalProtections      int             `json:"total_protections"`
+	SuccessfulProtections int             `json:"successful_protections"`
+	SuccessRate           float64         `json:"success_rate"`
+	IsActive              bool            `json:"is_active"`
+	IsAvailable           bool            `json:"is_available"`
+	Rating                float64         `json:"rating"`
+	RatingCount           int             `json:"rating_count"`
+	CreatedAt             time.Time       `json:"created_at"`
+	UpdatedAt             time.Time       `json:"updated_at"`
+}
+
+type UpsertProtectorListingRequest struct {
+	HourlyFee       int64           `json:"hourly_fee"`
+	MinCaravanType  int             `json:"min_caravan_type"`
+	PreferredRoutes []int32         `json:"preferred_routes"`
+	AvailableHours  json.RawMessage `json:"available_hours"`
+}
+
+type ProtectorSearchFilter struct {
+	RouteID       *int
+	CaravanTypeID *int
+	MaxFee        *int64
+	Limit         int
+	Offset        int
+}
+
+type HireNPCGuardRequest struct {
+	Tier int `json:"tier"`
+}
+
+type ContractProtectorRequest struct {
+	ListingID uuid.UUID `json:"listing_id"`
+}
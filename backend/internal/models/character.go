@@ -77,6 +77,11 @@ type Character struct {
 	Gold        int64 `json:"gold"`
 	PremiumGems int   `json:"premium_gems"` // DB: premium_currency
 
+	// Karma
+	Karma    int  `json:"karma"`
+	Infamy   int  `json:"infamy"`
+	IsWanted bool `json:"is_wanted"`
+
 	// Status
 	IsOnline  bool       `json:"is_online"`
 	CreatedAt time.Time  `json:"created_at"`
@@ -85,9 +90,10 @@ type Character struct {
 }
 
 type CreateCharacterRequest struct {
-	Name   string         `json:"name"`
-	Class  CharacterClass `json:"class"`
-	Gender string         `json:"gender,omitempty"`
+	Name     string         `json:"name"`
+	Class    CharacterClass `json:"class"`
+	Gender   string         `json:"gender,omitempty"`
+	ServerID int            `json:"server_id,omitempty"` // home server, DefaultServerID if unset
 }
 
 // Base stats for each class
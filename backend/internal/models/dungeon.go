@@ -0,0 +1,341 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DungeonDifficulty - DB: dungeon_difficulty
+type DungeonDifficulty string
+
+const (
+	DifficultyNormal    DungeonDifficulty = "normal"
+	DifficultyHard      DungeonDifficulty = "hard"
+	DifficultyNightmare DungeonDifficulty = "nightmare"
+	DifficultyHell      DungeonDifficulty = "hell"
+)
+
+// DungeonDifficulties lists the difficulties from easiest to hardest
+var DungeonDifficulties = []DungeonDifficulty{DifficultyNormal, DifficultyHard, DifficultyNightmare, DifficultyHell}
+
+// DifficultyModifier is how a difficulty scales a dungeon (5.3). MobPower
+// multiplies boss stats and ExpMultiplier the EXP reward. Loot below
+// MinRarity does not drop.
+type DifficultyModifier struct {
+	MobPower      float64 `json:"mob_power"`
+	ExpMultiplier float64 `json:"exp_multiplier"`
+	MinRarity     string  `json:"min_rarity"`
+}
+
+var DifficultyModifiers = map[DungeonDifficulty]DifficultyModifier{
+	DifficultyNormal:    {MobPower: 1.0, ExpMultiplier: 1.0, MinRarity: "common"},
+	DifficultyHard:      {MobPower: 1.5, ExpMultiplier: 1.2, MinRarity: "uncommon"},
+	DifficultyNightmare: {MobPower: 2.5, ExpMultiplier: 1.5, MinRarity: "rare"},
+	DifficultyHell:      {MobPower: 4.0, ExpMultiplier: 2.0, MinRarity: "epic"},
+}
+
+func (d DungeonDifficulty) Valid() bool {
+	_, ok := DifficultyModifiers[d]
+	return ok
+}
+
+// DungeonClasses are the classes a dungeon party needs exactly one of (5.1)
+var DungeonClasses = []CharacterClass{ClassWarrior, ClassArcher, ClassMage, ClassHealer, ClassNinja}
+
+// DungeonRoles - DB: dungeon_participants.role, by class
+var DungeonRoles = map[CharacterClass]string{
+	ClassWarrior: "tank",
+	ClassArcher:  "dps",
+	ClassMage:    "dps",
+	ClassHealer:  "healer",
+	ClassNinja:   "support",
+}
+
+// CrossServerMinLevel is the level cross-server dungeons open at (5.5)
+const CrossServerMinLevel = 110
+
+// Dungeon - DB: dungeon_definitions. The entry fields are the acting
+// character's; WeeklyEntriesLeft is only set for dungeons with a weekly cap.
+type Dungeon struct {
+	ID                 int                 `json:"id"`
+	Name               string              `json:"name"`
+	Description        *string             `json:"description,omitempty"`
+	MinLevel           int                 `json:"min_level"`
+	MinGearScore       int                 `json:"min_gear_score"`
+	Difficulties       []DungeonDifficulty `json:"difficulties"`
+	RequiredPlayers    int                 `json:"required_players"`
+	RequiresAllClasses bool                `json:"requires_all_classes"`
+	DailyEntries       int                 `json:"daily_entries"`
+	WeeklyEntries      *int                `json:"weekly_entries,omitempty"`
+	TimeLimitMinutes   int                 `json:"time_limit_minutes"`
+	BaseExpReward      int                 `json:"base_exp_reward"`
+	BaseGoldReward     int                 `json:"base_gold_reward"`
+	IsCrossServer      bool                `json:"is_cross_server"`
+	MapID              *int                `json:"map_id,omitempty"`
+
+	DailyEntriesLeft  int  `json:"daily_entries_left"`
+	WeeklyEntriesLeft *int `json:"weekly_entries_left,omitempty"`
+
+	Bosses []*DungeonBoss `json:"bosses,omitempty"`
+}
+
+// HasDifficulty reports whether the dungeon can be run at d
+func (d *Dungeon) HasDifficulty(difficulty DungeonDifficulty) bool {
+	for _, have := range d.Difficulties {
+		if have == difficulty {
+			return true
+		}
+	}
+	return false
+}
+
+// DungeonBoss - DB: dungeon_bosses. Stats are at normal difficulty.
+type DungeonBoss struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+	HP          int64   `json:"hp"`      // DB: base_hp
+	Attack      int     `json:"attack"`  // DB: base_attack
+	Defense     int     `json:"defense"` // DB: base_defense
+	Speed       int     `json:"speed"`   // DB: base_speed
+	BossOrder   int     `json:"boss_order"`
+	IsFinalBoss bool    `json:"is_final_boss"`
+	LootTableID *int    `json:"loot_table_id,omitempty"`
+}
+
+// Scaled returns the boss at a difficulty
+func (b *DungeonBoss) Scaled(difficulty DungeonDifficulty) *DungeonBoss {
+	power := DifficultyModifiers[difficulty].MobPower
+	scaled := *b
+	scaled.HP = int64(float64(b.HP) * power)
+	scaled.Attack = int(float64(b.Attack) * power)
+	scaled.Defense = int(float64(b.Defense) * power)
+	return &scaled
+}
+
+// DungeonInstanceStatus - DB: dungeon_instances.status
+type DungeonInstanceStatus string
+
+const (
+	DungeonForming    DungeonInstanceStatus = "forming"
+	DungeonInProgress DungeonInstanceStatus = "in_progress"
+	DungeonCompleted  DungeonInstanceStatus = "completed"
+	DungeonFailed     DungeonInstanceStatus = "failed"
+	DungeonAbandoned  DungeonInstanceStatus = "abandoned"
+)
+
+// DungeonInstance - DB: dungeon_instances. A forming instance expires if it
+// does not start in time; a running one when its time limit runs out.
+// CurrentBoss is scaled to the difficulty and BossHP is what it has left.
+type DungeonInstance struct {
+	ID               uuid.UUID             `json:"id"`
+	DungeonID        int                   `json:"dungeon_id"`
+	DungeonName      string                `json:"dungeon_name"`
+	ServerID         int                   `json:"server_id"`
+	Difficulty       DungeonDifficulty     `json:"difficulty"`
+	Status           DungeonInstanceStatus `json:"status"`
+	CreatedAt        time.Time             `json:"created_at"`
+	StartedAt        *time.Time            `json:"started_at,omitempty"`
+	CompletedAt      *time.Time            `json:"completed_at,omitempty"`
+	ExpiresAt        *time.Time            `json:"expires_at,omitempty"`
+	LastActivityAt   *time.Time            `json:"last_activity_at,omitempty"`
+	CurrentBossOrder int                   `json:"current_boss_order"`
+	BossesDefeated   int                   `json:"bosses_defeated"`
+	TotalBosses      int                   `json:"total_bosses"`
+	LeaderID         *uuid.UUID            `json:"leader_id,omitempty"`
+	IsCrossServer    bool                  `json:"is_cross_server"`
+	BossHP           *int64                `json:"boss_hp,omitempty"`
+	BossMaxHP        *int64                `json:"boss_max_hp,omitempty"`
+
+	CurrentBoss  *DungeonBoss          `json:"current_boss,omitempty"`
+	Participants []*DungeonParticipant `json:"participants,omitempty"`
+}
+
+// OpenTo reports whether characters of a server can see and join the
+// instance. Cross-server instances are open to all servers (5.5).
+func (i *DungeonInstance) OpenTo(serverID int) bool {
+	return i.IsCrossServer || i.ServerID == serverID
+}
+
+// DungeonParticipant - DB: dungeon_participants. ServerID is the
+// character's home server, which may differ from the instance's in
+// cross-server dungeons.
+type DungeonParticipant struct {
+	CharacterID    uuid.UUID       `json:"character_id"`
+	Name           string          `json:"name"`
+	ServerID       int             `json:"server_id"`
+	Level          int             `json:"level"`
+	Class          CharacterClass  `json:"class"`
+	Specialization *Specialization `json:"specialization,omitempty"`
+	Role           *string         `json:"role,omitempty"`
+	DamageDealt    int64           `json:"damage_dealt"`
+	DamageTaken    int64           `json:"damage_taken"`
+	Deaths         int             `json:"deaths"`
+	ItemsReceived  int             `json:"items_received"`
+	ExpReceived    int             `json:"exp_received"`
+	GoldReceived   int             `json:"gold_received"`
+	IsActive       bool            `json:"is_active"`
+	LeftAt         *time.Time      `json:"left_at,omitempty"`
+	JoinedAt       time.Time       `json:"joined_at"`
+}
+
+// DungeonAttack is the outcome of one attack on the current boss. Loot is
+// what the attacker won from a boss that fell.
+type DungeonAttack struct {
+	Damage        int64            `json:"damage"`
+	CounterDamage int64            `json:"counter_damage"`
+	Critical      bool             `json:"critical"`
+	BossDefeated  bool             `json:"boss_defeated"`
+	Loot          []*DungeonLoot   `json:"loot,omitempty"`
+	Instance      *DungeonInstance `json:"instance"`
+}
+
+// DungeonLoot - DB: dungeon_loot_rolls. Each participant rolls every loot
+// table entry of a fallen boss; a roll below Chance wins. Guaranteed rolls
+// are the rare drop every boss gives (5.4).
+type DungeonLoot struct {
+	ID                  uuid.UUID         `json:"id"`
+	BossID              int               `json:"boss_id"`
+	BossName            string            `json:"boss_name"`
+	ItemDefinitionID    *int              `json:"item_id,omitempty"`
+	ItemName            *string           `json:"item_name,omitempty"`
+	Rarity              *string           `json:"rarity,omitempty"`
+	BaseChance          float64           `json:"base_chance"`
+	Chance              float64           `json:"chance"`
+	Roll                float64           `json:"roll"`
+	Won                 bool              `json:"won"`
+	Quantity            int               `json:"quantity"`
+	IsGuaranteed        bool              `json:"is_guaranteed"`
+	Difficulty          DungeonDifficulty `json:"difficulty"`
+	TeamBonus           float64           `json:"team_bonus"`
+	SpecializationBonus float64           `json:"specialization_bonus"`
+	GuildBonus          float64           `json:"guild_bonus"`
+	DeliveredTo         *string           `json:"delivered_to,omitempty"`
+	CreatedAt           time.Time         `json:"created_at"`
+}
+
+type CreateDungeonInstanceRequest struct {
+	DungeonID  int               `json:"dungeon_id"`
+	Difficulty DungeonDifficulty `json:"difficulty"`
+}
+
+// DungeonQueueStatus - DB: dungeon_queue_entries.status
+type DungeonQueueStatus string
+
+const (
+	QueueWaiting    DungeonQueueStatus = "queued"
+	QueueReadyCheck DungeonQueueStatus = "ready_check"
+	QueueMatched    DungeonQueueStatus = "matched"
+	QueueLeft       DungeonQueueStatus = "left"
+	QueueDeclined   DungeonQueueStatus = "declined"
+	QueueExpired    DungeonQueueStatus = "expired"
+)
+
+// DungeonQueueEntry - DB: dungeon_queue_entries. A solo player or a party
+// waits in the queue as one entry; GearScore is its members' average.
+type DungeonQueueEntry struct {
+	ID          uuid.UUID             `json:"id"`
+	DungeonID   int                   `json:"dungeon_id"`
+	DungeonName string                `json:"dungeon_name"`
+	Difficulty  DungeonDifficulty     `json:"difficulty"`
+	LeaderID    uuid.UUID             `json:"leader_id"`
+	PartyID     *uuid.UUID            `json:"party_id,omitempty"`
+	GearScore   int                   `json:"gear_score"`
+	Status      DungeonQueueStatus    `json:"status"`
+	QueuedAt    time.Time             `json:"queued_at"`
+	Members     []*DungeonQueueMember `json:"members"`
+	Match       *DungeonMatch         `json:"match,omitempty"`
+}
+
+// DungeonQueueMember - DB: dungeon_queue_members
+type DungeonQueueMember struct {
+	CharacterID uuid.UUID      `json:"character_id"`
+	Name        string         `json:"name"`
+	Level       int            `json:"level"`
+	Class       CharacterClass `json:"class"`
+	GearScore   int            `json:"gear_score"`
+	IsReady     bool           `json:"is_ready"`
+}
+
+// DungeonMatchStatus - DB: dungeon_queue_matches.status
+type DungeonMatchStatus string
+
+const (
+	MatchReadyCheck DungeonMatchStatus = "ready_check"
+	MatchAccepted   DungeonMatchStatus = "accepted"
+	MatchCancelled  DungeonMatchStatus = "cancelled"
+)
+
+// DungeonMatch - DB: dungeon_queue_matches. A group the queue put together
+// waits on a ready check until ExpiresAt; InstanceID is the run it started
+// once everyone accepted.
+type DungeonMatch struct {
+	ID         uuid.UUID             `json:"id"`
+	DungeonID  int                   `json:"dungeon_id"`
+	Difficulty DungeonDifficulty     `json:"difficulty"`
+	Status     DungeonMatchStatus    `json:"status"`
+	InstanceID *uuid.UUID            `json:"instance_id,omitempty"`
+	CreatedAt  time.Time             `json:"created_at"`
+	ExpiresAt  time.Time             `json:"expires_at"`
+	Members    []*DungeonQueueMember `json:"members"`
+}
+
+type JoinDungeonQueueRequest struct {
+	DungeonID  int               `json:"dungeon_id"`
+	Difficulty DungeonDifficulty `json:"difficulty"`
+}
+
+// CrossServerClearPoints is the ranking score of a cross-server clear by
+// difficulty, before the speed bonus
+var CrossServerClearPoints = map[DungeonDifficulty]int{
+	DifficultyNormal:    100,
+	DifficultyHard:      150,
+	DifficultyNightmare: 250,
+	DifficultyHell:      400,
+}
+
+// CrossServerRanking - DB: cross_server_dungeon_rankings. One row per
+// character, week and season; Rank and RewardGold are set once the week
+// is over.
+type CrossServerRanking struct {
+	CharacterID      uuid.UUID      `json:"character_id"`
+	Name             string         `json:"name"`
+	Level            int            `json:"level"`
+	Class            CharacterClass `json:"class"`
+	ServerID         int            `json:"server_id"`
+	ServerName       string         `json:"server_name"`
+	SeasonID         *int           `json:"season_id,omitempty"`
+	WeekStart        time.Time      `json:"week_start"`
+	Score            int            `json:"score"`
+	Clears           int            `json:"clears"`
+	BestClearSeconds *int           `json:"best_clear_seconds,omitempty"`
+	Rank             *int           `json:"rank,omitempty"`
+	RewardGold       *int64         `json:"reward_gold,omitempty"`
+}
+
+// CrossServerSeason is a season's cross-server standings. They are live
+// while the season runs and final, with rewards, once it is closed.
+type CrossServerSeason struct {
+	ID        int                          `json:"id"`
+	Name      string                       `json:"name"`
+	StartsAt  time.Time                    `json:"starts_at"`
+	EndsAt    time.Time                    `json:"ends_at"`
+	ClosedAt  *time.Time                   `json:"closed_at,omitempty"`
+	Standings []*CrossServerSeasonStanding `json:"standings"`
+}
+
+// CrossServerSeasonStanding - DB: cross_server_season_results once the
+// season is closed
+type CrossServerSeasonStanding struct {
+	Rank        int            `json:"rank"`
+	CharacterID uuid.UUID      `json:"character_id"`
+	Name        string         `json:"name"`
+	Level       int            `json:"level"`
+	Class       CharacterClass `json:"class"`
+	ServerID    int            `json:"server_id"`
+	ServerName  string         `json:"server_name"`
+	Score       int            `json:"score"`
+	Clears      int            `json:"clears"`
+	RewardGold  *int64         `json:"reward_gold,omitempty"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Currency string
+
+const (
+	CurrencyGold Currency = "gold"
+	CurrencyGems Currency = "gems" // DB: characters.premium_currency
+)
+
+// LedgerEntry - DB: economy_logs. Each posting writes two entries sharing EntryID.
+type LedgerEntry struct {
+	ID              uuid.UUID       `json:"id"`
+	EntryID         *uuid.UUID      `json:"entry_id,omitempty"`
+	ServerID        int             `json:"server_id"`
+	CharacterID     *uuid.UUID      `json:"character_id,omitempty"`
+	Account         string          `json:"account"`
+	Counterparty    string          `json:"counterparty"`
+	Currency        Currency        `json:"currency"`
+	TransactionType string          `json:"transaction_type"`
+	Change          int64           `json:"change"`
+	BalanceBefore   *int64          `json:"balance_before,omitempty"`
+	BalanceAfter    *int64          `json:"balance_after,omitempty"`
+	ReferenceType   *string         `json:"reference_type,omitempty"`
+	ReferenceID     *uuid.UUID      `json:"reference_id,omitempty"`
+	Details         json.RawMessage `json:"details,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// EconomyFlow totals one system account. Faucet is currency it created,
+// Sink is currency it removed.
+type EconomyFlow struct {
+	Account  string   `json:"account"`
+	Currency Currency `json:"currency"`
+	Faucet   int64    `json:"faucet"`
+	Sink     int64    `json:"sink"`
+}
+
+type EconomySummary struct {
+	Since             time.Time      `json:"since"`
+	Flows             []*EconomyFlow `json:"flows"`
+	GoldFaucet        int64          `json:"gold_faucet"`
+	GoldSink          int64          `json:"gold_sink"`
+	GemsFaucet        int64          `json:"gems_faucet"`
+	GemsSink          int64          `json:"gems_sink"`
+	GoldInCirculation int64          `json:"gold_in_circulation"`
+	GemsInCirculation int64          `json:"gems_in_circulation"`
+	GoldInTreasuries  int64          `json:"gold_in_treasuries"`
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GatheringZone is the PvP tier of a fishing spot or mining node (9.1.1)
+type GatheringZone string
+
+const (
+	GatheringZoneSafe      GatheringZone = "safe"
+	GatheringZoneContested GatheringZone = "contested"
+	GatheringZoneWild      GatheringZone = "wild"
+	GatheringZoneDark      GatheringZone = "dark"
+)
+
+// GatheringZoneDebuffPercent is how much of the Treacherous Attack debuff an
+// attacker takes per zone. Safe waters have no PvP and the Dark Sea has no
+// debuff.
+var GatheringZoneDebuffPercent = map[GatheringZone]int{
+	GatheringZoneSafe:      0,
+	GatheringZoneContested: 100,
+	GatheringZoneWild:      50,
+	GatheringZoneDark:      0,
+}
+
+// TreacherousAttack is the debuff on whoever attacks a fisher (9.1.2)
+var TreacherousAttack = StatModifier{
+	Source:   "treacherous_attack",
+	Attack:   -25,
+	Defense:  -20,
+	Speed:    -30,
+	CritRate: -50,
+}
+
+// FishingSpot - DB: fishing_spots
+type FishingSpot struct {
+	ID              int           `json:"id"`
+	MapID           int           `json:"map_id"`
+	Name            string        `json:"name"`
+	X               int           `json:"x"`
+	Y               int           `json:"y"`
+	Radius          int           `json:"radius"`
+	ZoneType        GatheringZone `json:"zone_type"`
+	MinRarity       string        `json:"min_rarity"`
+	MaxRarity       string        `json:"max_rarity"`
+	RareChanceBonus float64       `json:"rare_chance_bonus"`
+	IsPrison        bool          `json:"is_prison"`
+}
+
+// FishingStatus - DB: character_fishing
+type FishingStatus struct {
+	CharacterID         uuid.UUID    `json:"character_id"`
+	FishingLevel        int          `json:"fishing_level"`
+	FishingExp          int          `json:"fishing_exp"`
+	NextLevelExp        int          `json:"next_level_exp"`
+	TotalFishCaught     int          `json:"total_fish_caught"`
+	RareFishCaught      int          `json:"rare_fish_caught"`
+	LegendaryFishCaught int          `json:"legendary_fish_caught"`
+	IsFishing           bool         `json:"is_fishing"`
+	Spot                *FishingSpot `json:"spot,omitempty"`
+	FishingStartedAt    *time.Time   `json:"fishing_started_at,omitempty"`
+	NextCatchAt         *time.Time   `json:"next_catch_at,omitempty"`
+	BagCount            int          `json:"bag_count"`
+	BagSize             int          `json:"bag_size"`
+	// Catches landed while settling this request
+	NewCatches []*FishCatch `json:"new_catches,omitempty"`
+}
+
+// FishCatch - DB: fishing_catches joined with fish_definitions
+type FishCatch struct {
+	ID        uuid.UUID  `json:"id"`
+	FishID    int        `json:"fish_id"`
+	FishName  string     `json:"fish_name"`
+	Rarity    string     `json:"rarity"`
+	SpotID    int        `json:"spot_id"`
+	Quantity  int        `json:"quantity"`
+	SellPrice int64      `json:"sell_price"`
+	ExpEarned int        `json:"exp_earned"`
+	CaughtAt  time.Time  `json:"caught_at"`
+	SoldAt    *time.Time `json:"sold_at,omitempty"`
+	SoldFor   *int64     `json:"sold_for,omitempty"`
+}
+
+type StartFishingRequest struct {
+	SpotID int `json:"spot_id"`
+}
+
+// SellFishRequest sells the listed catches, or the whole bag when empty
+type SellFishRequest struct {
+	CatchIDs []uuid.UUID `json:"catch_ids"`
+}
+
+type FishSale struct {
+	Sold       int   `json:"sold"`
+	GoldEarned int64 `json:"gold_earned"`
+	// Zone tax taken back out of GoldEarned
+	TaxPaid int64 `json:"tax_paid"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type FlagType string
+
+const (
+	FlagRed  FlagType = "red"  // Bandit
+	FlagBlue FlagType = "blue" // Protector
+)
+
+// StatModifier is one source of percentage changes applied on top of a
+// character's stored stats. Sources stack multiplicatively.
+type StatModifier struct {
+	Source   string  `json:"source"`
+	Attack   float64 `json:"attack,omitempty"`
+	Defense  float64 `json:"defense,omitempty"`
+	Speed    float64 `json:"speed,omitempty"`
+	CritRate float64 `json:"crit_rate,omitempty"`
+}
+
+// CombatStats are a character's stats after flag, specialization and other
+// situational modifiers. Effects holds non-stat bonuses (e.g. caravan_damage)
+// for the systems that consume them.
+type CombatStats struct {
+	Attack    int                    `json:"attack"`
+	Defense   int                    `json:"defense"`
+	Speed     int                    `json:"speed"`
+	CritRate  float64                `json:"crit_rate"`
+	Modifiers []StatModifier         `json:"modifiers"`
+	Effects   map[string]interface{} `json:"effects"`
+}
+
+type FlagStatus struct {
+	CharacterID            uuid.UUID    `json:"character_id"`
+	Name                   string       `json:"name"`
+	Flag                   *FlagType    `json:"flag"`
+	FlagStartedAt          *time.Time   `json:"flag_started_at,omitempty"`
+	FlagExpiresAt          *time.Time   `json:"flag_expires_at,omitempty"`
+	ChangedAt              *time.Time   `json:"changed_at,omitempty"`
+	CooldownEndsAt         *time.Time   `json:"cooldown_ends_at,omitempty"`
+	CanChange              bool         `json:"can_change"`
+	DeathPenaltyMultiplier float64      `json:"death_penalty_multiplier"`
+	Stats                  *CombatStats `json:"stats,omitempty"`
+}
+
+// FlagCarrier is a red flag carrier as shown on the map
+type FlagCarrier struct {
+	CharacterID uuid.UUID      `json:"character_id"`
+	Name        string         `json:"name"`
+	Level       int            `json:"level"`
+	Class       CharacterClass `json:"class"`
+	MapID       int            `json:"map_id"`
+	PositionX   int            `json:"position_x"`
+	PositionY   int            `json:"position_y"`
+}
+
+type AttackCheck struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	// Attacker and target are in enemy guilds, so flags do not matter
+	EnemyGuild bool `json:"enemy_guild,omitempty"`
+}
+
+type TakeFlagRequest struct {
+	Flag FlagType `json:"flag"`
+}
+
+// EnterMapRequest is a map change reported by the game server
+type EnterMapRequest struct {
+	MapID     int `json:"map_id"`
+	PositionX int `json:"position_x"`
+	PositionY int `json:"position_y"`
+}
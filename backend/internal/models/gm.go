@@ -231,4 +231,5 @@ type DashboardStats struct {
 	OpenTickets      int `json:"open_tickets"`
 	TotalCharacters  int `json:"total_characters"`
 	ActiveMutes      int `json:"active_mutes"`
+	UnreviewedFlags  int `json:"unreviewed_flags"`
 }
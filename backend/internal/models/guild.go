@@ -0,0 +1,261 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GuildSpecialization is one of the ten fixed guilds of a server (8.1)
+type GuildSpecialization string
+
+const (
+	GuildWarrior   GuildSpecialization = "warrior_guild"
+	GuildProtector GuildSpecialization = "protector_guild"
+	GuildBandit    GuildSpecialization = "bandit_guild"
+	GuildDungeon   GuildSpecialization = "dungeon_guild"
+	GuildFisher    GuildSpecialization = "fisher_guild"
+	GuildMiner     GuildSpecialization = "miner_guild"
+	GuildCrafter   GuildSpecialization = "crafter_guild"
+	GuildMerchant  GuildSpecialization = "merchant_guild"
+	GuildPeace     GuildSpecialization = "peace_guild"
+	GuildPrisoner  GuildSpecialization = "prisoner_guild"
+)
+
+// GuildSpecializations lists the ten guild specializations in design order
+var GuildSpecializations = []GuildSpecialization{
+	GuildWarrior, GuildProtector, GuildBandit, GuildDungeon, GuildFisher,
+	GuildMiner, GuildCrafter, GuildMerchant, GuildPeace, GuildPrisoner,
+}
+
+func (s GuildSpecialization) Valid() bool {
+	for _, v := range GuildSpecializations {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// GuildRank is a member's rank. Lower RankOrder outranks higher.
+type GuildRank string
+
+const (
+	GuildRankLeader  GuildRank = "leader"
+	GuildRankOfficer GuildRank = "officer"
+	GuildRankVeteran GuildRank = "veteran"
+	GuildRankMember  GuildRank = "member"
+	GuildRankRecruit GuildRank = "recruit"
+)
+
+// GuildRankOrder - DB: guild_members.rank_order
+var GuildRankOrder = map[GuildRank]int{
+	GuildRankLeader:  1,
+	GuildRankOfficer: 10,
+	GuildRankVeteran: 50,
+	GuildRankMember:  100,
+	GuildRankRecruit: 200,
+}
+
+// Outranks reports whether r is strictly above other
+func (r GuildRank) Outranks(other GuildRank) bool {
+	a, ok := GuildRankOrder[r]
+	b, ok2 := GuildRankOrder[other]
+	return ok && ok2 && a < b
+}
+
+// GuildMaxLevel is the highest guild level (8.4)
+const GuildMaxLevel = 10
+
+// GuildMemberLimits is the member limit per guild level (8.4), index 0 is
+// level 1
+var GuildMemberLimits = [GuildMaxLevel]int{20, 30, 40, 50, 65, 80, 100, 120, 150, 200}
+
+// GuildMemberLimit returns the member limit at a guild level
+func GuildMemberLimit(level int) int {
+	level = min(max(level, 1), GuildMaxLevel)
+	return GuildMemberLimits[level-1]
+}
+
+// GuildStorageSize is the number of guild storage slots
+const GuildStorageSize = 100
+
+// GuildNoLimit marks a daily withdrawal cap that does not apply
+const GuildNoLimit = -1
+
+// GuildStorageRights is what a rank may do with the guild storage and
+// treasury. Withdrawal caps count storage withdrawals and gold per day.
+type GuildStorageRights struct {
+	Deposit              bool  `json:"deposit"`
+	Withdraw             bool  `json:"withdraw"`
+	DailyItemWithdrawals int   `json:"daily_item_withdrawals"`
+	DailyGoldWithdrawal  int64 `json:"daily_gold_withdrawal"`
+}
+
+var GuildStorageRightsByRank = map[GuildRank]GuildStorageRights{
+	GuildRankLeader:  {Deposit: true, Withdraw: true, DailyItemWithdrawals: GuildNoLimit, DailyGoldWithdrawal: GuildNoLimit},
+	GuildRankOfficer: {Deposit: true, Withdraw: true, DailyItemWithdrawals: 30, DailyGoldWithdrawal: 500_000},
+	GuildRankVeteran: {Deposit: true, Withdraw: true, DailyItemWithdrawals: 10, DailyGoldWithdrawal: 50_000},
+	GuildRankMember:  {Deposit: true, Withdraw: true, DailyItemWithdrawals: 3},
+	GuildRankRecruit: {},
+}
+
+// Guild - DB: guilds
+type Guild struct {
+	ID                  uuid.UUID           `json:"id"`
+	ServerID            int                 `json:"server_id"`
+	Name                string              `json:"name"`
+	Description         *string             `json:"description,omitempty"`
+	EmblemURL           *string             `json:"emblem_url,omitempty"`
+	Specialization      GuildSpecialization `json:"specialization"`
+	Level               int                 `json:"level"`
+	Exp                 int64               `json:"exp"`
+	MaxMembers          int                 `json:"max_members"`
+	CurrentMembers      int                 `json:"current_members"`
+	GoldTreasury        int64               `json:"gold_treasury"`
+	LeaderID            uuid.UUID           `json:"leader_id"`
+	LeaderName          string              `json:"leader_name"`
+	IsRecruiting        bool                `json:"is_recruiting"`
+	MinLevelRequirement int                 `json:"min_level_requirement"`
+	AutoAccept          bool                `json:"auto_accept"`
+	CreatedAt           time.Time           `json:"created_at"`
+}
+
+// GuildMember - DB: guild_members joined with characters
+type GuildMember struct {
+	CharacterID        uuid.UUID      `json:"character_id"`
+	Name               string         `json:"name"`
+	Level              int            `json:"level"`
+	Class              CharacterClass `json:"class"`
+	Rank               GuildRank      `json:"rank"`
+	WeeklyContribution int            `json:"weekly_contribution"`
+	TotalContribution  int64          `json:"total_contribution"`
+	LastActiveAt       *time.Time     `json:"last_active_at,omitempty"`
+	JoinedAt           time.Time      `json:"joined_at"`
+}
+
+// GuildApplication - DB: guild_applications
+type GuildApplication struct {
+	ID             uuid.UUID  `json:"id"`
+	GuildID        uuid.UUID  `json:"guild_id"`
+	GuildName      string     `json:"guild_name"`
+	CharacterID    uuid.UUID  `json:"character_id"`
+	CharacterName  string     `json:"character_name"`
+	CharacterLevel int        `json:"character_level"`
+	Message        *string    `json:"message,omitempty"`
+	Status         string     `json:"status"`
+	ReviewedBy     *uuid.UUID `json:"reviewed_by,omitempty"`
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// GuildInvite - DB: guild_invites
+type GuildInvite struct {
+	ID            uuid.UUID `json:"id"`
+	GuildID       uuid.UUID `json:"guild_id"`
+	GuildName     string    `json:"guild_name"`
+	CharacterID   uuid.UUID `json:"character_id"`
+	CharacterName string    `json:"character_name"`
+	InvitedBy     uuid.UUID `json:"invited_by"`
+	InvitedByName string    `json:"invited_by_name"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// GuildStorageItem - DB: guild_storage. Ranks below MinRankToWithdraw
+// cannot take the item out.
+type GuildStorageItem struct {
+	ID                uuid.UUID       `json:"id"`
+	SlotNumber        int             `json:"slot_number"`
+	ItemID            int             `json:"item_id"`
+	ItemName          string          `json:"item_name"`
+	Quantity          int             `json:"quantity"`
+	UpgradeLevel      int             `json:"upgrade_level"`
+	GemSlots          [4]*int         `json:"gem_slots"`
+	BonusStats        json.RawMessage `json:"bonus_stats,omitempty"`
+	MinRankToWithdraw GuildRank       `json:"min_rank_to_withdraw"`
+	DepositedBy       *uuid.UUID      `json:"deposited_by,omitempty"`
+	DepositedByName   *string         `json:"deposited_by_name,omitempty"`
+	DepositedAt       time.Time       `json:"deposited_at"`
+}
+
+// GuildStorage is the guild storage as seen by a member, with their rights
+// and what they have withdrawn today
+type GuildStorage struct {
+	GuildID             uuid.UUID           `json:"guild_id"`
+	Size                int                 `json:"size"`
+	Items               []*GuildStorageItem `json:"items"`
+	Rights              GuildStorageRights  `json:"rights"`
+	ItemsWithdrawnToday int                 `json:"items_withdrawn_today"`
+}
+
+// GuildTreasury is the guild's gold as seen by a member
+type GuildTreasury struct {
+	GuildID            uuid.UUID          `json:"guild_id"`
+	Gold               int64              `json:"gold"`
+	Rights             GuildStorageRights `json:"rights"`
+	GoldWithdrawnToday int64              `json:"gold_withdrawn_today"`
+}
+
+// GuildLogEntry - DB: guild_logs. TargetName is a character's or a guild's
+// name depending on the action.
+type GuildLogEntry struct {
+	ID         uuid.UUID       `json:"id"`
+	ActionType string          `json:"action_type"`
+	ActorID    *uuid.UUID      `json:"actor_id,omitempty"`
+	ActorName  *string         `json:"actor_name,omitempty"`
+	TargetID   *uuid.UUID      `json:"target_id,omitempty"`
+	TargetName *string         `json:"target_name,omitempty"`
+	Details    json.RawMessage `json:"details,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type FoundGuildRequest struct {
+	Name           string              `json:"name"`
+	Description    string              `json:"description"`
+	Specialization GuildSpecialization `json:"specialization"`
+}
+
+type GuildApplyRequest struct {
+	Message string `json:"message"`
+}
+
+type GuildInviteRequest struct {
+	CharacterID uuid.UUID `json:"character_id"`
+}
+
+type SetGuildRankRequest struct {
+	Rank GuildRank `json:"rank"`
+}
+
+type TransferGuildRequest struct {
+	CharacterID uuid.UUID `json:"character_id"`
+}
+
+// GuildSettingsRequest updates only the fields that are set
+type GuildSettingsRequest struct {
+	Description         *string `json:"description"`
+	IsRecruiting        *bool   `json:"is_recruiting"`
+	MinLevelRequirement *int    `json:"min_level_requirement"`
+	AutoAccept          *bool   `json:"auto_accept"`
+}
+
+// GuildStorageDepositRequest moves an inventory item into the guild
+// storage. MinRank defaults to member.
+type GuildStorageDepositRequest struct {
+	InventoryItemID uuid.UUID `json:"inventory_item_id"`
+	Quantity        int       `json:"quantity"`
+	MinRank         GuildRank `json:"min_rank"`
+}
+
+// GuildStorageWithdrawRequest takes Quantity units out, the whole stack when
+// zero
+type GuildStorageWithdrawRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+type GuildTreasuryRequest struct {
+	Amount int64 `json:"amount"`
+}
@@ -0,0 +1,93 @@
+package models
+
+// GuildBonus is a key of the guild_specialization_bonuses JSONB columns.
+// Values are percentages.
+type GuildBonus string
+
+const (
+	BonusFishingSpeed   GuildBonus = "fishing_speed"
+	BonusRareFishChance GuildBonus = "rare_fish_chance"
+	BonusFishSellPrice  GuildBonus = "fish_sell_price"
+	BonusFishingExp     GuildBonus = "fishing_exp"
+
+	BonusMiningSpeed   GuildBonus = "mining_speed"
+	BonusRareOreChance GuildBonus = "rare_ore_chance"
+	BonusOreSellPrice  GuildBonus = "ore_sell_price"
+	BonusMiningExp     GuildBonus = "mining_exp"
+
+	BonusCaravanProfit  GuildBonus = "caravan_profit"
+	BonusProtectionFee  GuildBonus = "protection_fee"
+	BonusRaidLoot       GuildBonus = "raid_loot"
+	BonusCaravanDefense GuildBonus = "caravan_defense"
+
+	BonusCraftSuccess   GuildBonus = "craft_success"
+	BonusMaterialSaving GuildBonus = "material_saving"
+	BonusCraftExp       GuildBonus = "craft_exp"
+
+	BonusDungeonExp   GuildBonus = "dungeon_exp"
+	BonusBossDamage   GuildBonus = "boss_damage"
+	BonusLootChance   GuildBonus = "loot_chance"
+	BonusExtraEntries GuildBonus = "extra_entries"
+)
+
+// BonusActivity is an activity whose rewards guild specializations improve
+type BonusActivity string
+
+const (
+	BonusActivityFishing  BonusActivity = "fishing"
+	BonusActivityMining   BonusActivity = "mining"
+	BonusActivityCaravan  BonusActivity = "caravan"
+	BonusActivityCrafting BonusActivity = "crafting"
+	BonusActivityDungeon  BonusActivity = "dungeon"
+)
+
+// BonusActivities lists the activities in display order
+var BonusActivities = []BonusActivity{
+	BonusActivityFishing, BonusActivityMining, BonusActivityCaravan, BonusActivityCrafting, BonusActivityDungeon,
+}
+
+// BonusActivityKeys lists the bonuses that apply to each activity
+var BonusActivityKeys = map[BonusActivity][]GuildBonus{
+	BonusActivityFishing:  {BonusFishingSpeed, BonusRareFishChance, BonusFishSellPrice, BonusFishingExp},
+	BonusActivityMining:   {BonusMiningSpeed, BonusRareOreChance, BonusOreSellPrice, BonusMiningExp},
+	BonusActivityCaravan:  {BonusCaravanProfit, BonusProtectionFee, BonusRaidLoot, BonusCaravanDefense},
+	BonusActivityCrafting: {BonusCraftSuccess, BonusMaterialSaving, BonusCraftExp},
+	BonusActivityDungeon:  {BonusDungeonExp, BonusBossDamage, BonusLootChance, BonusExtraEntries},
+}
+
+// GuildBonusTierLevels are the guild levels at which the next column of
+// guild_specialization_bonuses takes over
+var GuildBonusTierLevels = []int{1, 5, 10}
+
+// GuildBonusTier returns the bonus tier level in effect at a guild level
+func GuildBonusTier(level int) int {
+	tier := GuildBonusTierLevels[0]
+	for _, l := range GuildBonusTierLevels {
+		if level >= l {
+			tier = l
+		}
+	}
+	return tier
+}
+
+// ActivityBonus is what a character's guild adds to one activity. Characters
+// outside a guild get an empty bonus; a nil bonus is empty too.
+type ActivityBonus struct {
+	Activity       BonusActivity          `json:"activity"`
+	Specialization *GuildSpecialization   `json:"specialization,omitempty"`
+	GuildLevel     int                    `json:"guild_level,omitempty"`
+	Percent        map[GuildBonus]float64 `json:"percent"`
+}
+
+// Percentage returns bonus key in percent, 0 if the guild does not have it
+func (b *ActivityBonus) Percentage(key GuildBonus) float64 {
+	if b == nil {
+		return 0
+	}
+	return b.Percent[key]
+}
+
+// Multiplier returns 1 plus bonus key
+func (b *ActivityBonus) Multiplier(key GuildBonus) float64 {
+	return 1 + b.Percentage(key)/100
+}
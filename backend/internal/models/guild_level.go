@@ -0,0 +1,146 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GuildLevelExp is the total EXP a guild needs for each level (8.4), index 0
+// is level 1
+var GuildLevelExp = [GuildMaxLevel]int64{0, 10_000, 30_000, 70_000, 150_000, 300_000, 500_000, 800_000, 1_200_000, 2_000_000}
+
+// GuildLevelForExp returns the level a guild with exp total EXP has reached
+func GuildLevelForExp(exp int64) int {
+	level := 1
+	for i, need := range GuildLevelExp {
+		if exp >= need {
+			level = i + 1
+		}
+	}
+	return level
+}
+
+// GuildFeature is a guild feature unlocked by guild level (8.4)
+type GuildFeature string
+
+const (
+	GuildFeatureChat       GuildFeature = "chat"
+	GuildFeatureStorage    GuildFeature = "storage"
+	GuildFeatureBuilding   GuildFeature = "building"
+	GuildFeatureShop       GuildFeature = "shop"
+	GuildFeatureQuestsPlus GuildFeature = "quests_plus"
+	GuildFeatureArena      GuildFeature = "arena"
+	GuildFeatureEvents     GuildFeature = "events"
+)
+
+// GuildFeatures lists the guild features in unlock order
+var GuildFeatures = []GuildFeature{
+	GuildFeatureChat, GuildFeatureStorage, GuildFeatureBuilding, GuildFeatureShop,
+	GuildFeatureQuestsPlus, GuildFeatureArena, GuildFeatureEvents,
+}
+
+// GuildFeatureLevels is the guild level that unlocks each feature
+var GuildFeatureLevels = map[GuildFeature]int{
+	GuildFeatureChat:       2,
+	GuildFeatureStorage:    3,
+	GuildFeatureBuilding:   4,
+	GuildFeatureShop:       6,
+	GuildFeatureQuestsPlus: 7,
+	GuildFeatureArena:      8,
+	GuildFeatureEvents:     9,
+}
+
+// GuildFeatureUnlocked reports whether a guild at level has feature f
+func GuildFeatureUnlocked(level int, f GuildFeature) bool {
+	need, ok := GuildFeatureLevels[f]
+	return ok && level >= need
+}
+
+// GuildFeatureState is a feature and whether the guild has it yet
+type GuildFeatureState struct {
+	Feature  GuildFeature `json:"feature"`
+	Level    int          `json:"level"`
+	Unlocked bool         `json:"unlocked"`
+}
+
+// GuildLevelInfo is a guild's progress through the guild levels.
+// NextLevelExp is nil at the top level.
+type GuildLevelInfo struct {
+	GuildID      uuid.UUID            `json:"guild_id"`
+	Level        int                  `json:"level"`
+	Exp          int64                `json:"exp"`
+	NextLevelExp *int64               `json:"next_level_exp,omitempty"`
+	MemberLimit  int                  `json:"member_limit"`
+	Features     []*GuildFeatureState `json:"features"`
+}
+
+// GuildActivity is member activity that earns guild EXP and counts towards
+// guild quests of the same type
+type GuildActivity string
+
+const (
+	GuildActivityFishSold      GuildActivity = "fish_sold"
+	GuildActivityOreSold       GuildActivity = "ore_sold"
+	GuildActivityCaravans      GuildActivity = "caravans_delivered"
+	GuildActivityPrisonEvents  GuildActivity = "prison_events"
+	GuildActivityDungeonsClear GuildActivity = "dungeons_cleared"
+)
+
+// GuildActivityExp is the guild EXP earned per unit of activity
+var GuildActivityExp = map[GuildActivity]int{
+	GuildActivityFishSold:      2,
+	GuildActivityOreSold:       2,
+	GuildActivityCaravans:      50,
+	GuildActivityPrisonEvents:  10,
+	GuildActivityDungeonsClear: 100,
+}
+
+// GuildQuestTemplate is a guild quest the rotation can hand out
+type GuildQuestTemplate struct {
+	Type       GuildActivity
+	Target     int
+	RewardExp  int
+	RewardGold int
+}
+
+// GuildDailyQuests and GuildWeeklyQuests are the pools the quest rotation
+// draws from
+var GuildDailyQuests = []GuildQuestTemplate{
+	{Type: GuildActivityFishSold, Target: 300, RewardExp: 1500, RewardGold: 15_000},
+	{Type: GuildActivityOreSold, Target: 300, RewardExp: 1500, RewardGold: 15_000},
+	{Type: GuildActivityCaravans, Target: 10, RewardExp: 2000, RewardGold: 25_000},
+	{Type: GuildActivityPrisonEvents, Target: 15, RewardExp: 1000, RewardGold: 10_000},
+	{Type: GuildActivityDungeonsClear, Target: 10, RewardExp: 2500, RewardGold: 25_000},
+}
+
+var GuildWeeklyQuests = []GuildQuestTemplate{
+	{Type: GuildActivityFishSold, Target: 3000, RewardExp: 12_000, RewardGold: 150_000},
+	{Type: GuildActivityOreSold, Target: 3000, RewardExp: 12_000, RewardGold: 150_000},
+	{Type: GuildActivityCaravans, Target: 80, RewardExp: 15_000, RewardGold: 200_000},
+	{Type: GuildActivityPrisonEvents, Target: 100, RewardExp: 8000, RewardGold: 100_000},
+	{Type: GuildActivityDungeonsClear, Target: 70, RewardExp: 20_000, RewardGold: 200_000},
+}
+
+// GuildQuest - DB: guild_quests
+type GuildQuest struct {
+	ID             uuid.UUID                 `json:"id"`
+	QuestType      GuildActivity             `json:"quest_type"`
+	TargetCount    int                       `json:"target_count"`
+	CurrentCount   int                       `json:"current_count"`
+	RewardExp      int                       `json:"reward_exp"`
+	RewardGold     int                       `json:"reward_gold"`
+	IsWeekly       bool                      `json:"is_weekly"`
+	StartsAt       time.Time                 `json:"starts_at"`
+	ExpiresAt      time.Time                 `json:"expires_at"`
+	CompletedAt    *time.Time                `json:"completed_at,omitempty"`
+	MyContribution int                       `json:"my_contribution"`
+	Contributors   []*GuildQuestContribution `json:"contributors"`
+}
+
+// GuildQuestContribution - DB: guild_quest_contributions
+type GuildQuestContribution struct {
+	CharacterID uuid.UUID `json:"character_id"`
+	Name        string    `json:"name"`
+	Count       int       `json:"count"`
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GuildRelationType - DB: guild_relation_type
+type GuildRelationType string
+
+const (
+	GuildRelationAlly  GuildRelationType = "ally"
+	GuildRelationEnemy GuildRelationType = "enemy"
+)
+
+// GuildRelationStatus is where a relation is in its lifecycle. A cancelling
+// alliance stays in effect until EndsAt.
+type GuildRelationStatus string
+
+const (
+	GuildRelationPending    GuildRelationStatus = "pending"
+	GuildRelationActive     GuildRelationStatus = "active"
+	GuildRelationCancelling GuildRelationStatus = "cancelling"
+)
+
+// GuildVoteType is what a guild vote decides
+type GuildVoteType string
+
+const (
+	// Proposing guild chooses an ally, then the target guild accepts
+	GuildVoteAllyPropose  GuildVoteType = "ally_propose"
+	GuildVoteAllyAccept   GuildVoteType = "ally_accept"
+	GuildVoteAllyCancel   GuildVoteType = "ally_cancel"
+	GuildVoteEnemyDeclare GuildVoteType = "enemy_declare"
+	GuildVoteEnemyEnd     GuildVoteType = "enemy_end"
+)
+
+type GuildVoteStatus string
+
+const (
+	GuildVoteOpen      GuildVoteStatus = "open"
+	GuildVotePassed    GuildVoteStatus = "passed"
+	GuildVoteFailed    GuildVoteStatus = "failed"
+	GuildVoteCancelled GuildVoteStatus = "cancelled"
+)
+
+// GuildRelation - DB: guild_relations. GuildID is the guild that proposed or
+// declared it.
+type GuildRelation struct {
+	ID                uuid.UUID           `json:"id"`
+	GuildID           uuid.UUID           `json:"guild_id"`
+	GuildName         string              `json:"guild_name"`
+	TargetGuildID     uuid.UUID           `json:"target_guild_id"`
+	TargetGuildName   string              `json:"target_guild_name"`
+	RelationType      GuildRelationType   `json:"relation_type"`
+	Status            GuildRelationStatus `json:"status"`
+	VotesFor          int                 `json:"votes_for"`
+	VotesRequired     int                 `json:"votes_required"`
+	IsConfirmed       bool                `json:"is_confirmed"`
+	LockedUntil       *time.Time          `json:"locked_until,omitempty"`
+	CancelRequestedAt *time.Time          `json:"cancel_requested_at,omitempty"`
+	EndsAt            *time.Time          `json:"ends_at,omitempty"`
+	CreatedAt         time.Time           `json:"created_at"`
+	ConfirmedAt       *time.Time          `json:"confirmed_at,omitempty"`
+}
+
+// GuildVote - DB: guild_votes. VotesRequired is ApprovalPercent of the
+// members at the time the vote opened.
+type GuildVote struct {
+	ID              uuid.UUID       `json:"id"`
+	GuildID         uuid.UUID       `json:"guild_id"`
+	VoteType        GuildVoteType   `json:"vote_type"`
+	RelationID      *uuid.UUID      `json:"relation_id,omitempty"`
+	TargetGuildID   *uuid.UUID      `json:"target_guild_id,omitempty"`
+	TargetGuildName *string         `json:"target_guild_name,omitempty"`
+	ProposedBy      *uuid.UUID      `json:"proposed_by,omitempty"`
+	ApprovalPercent int             `json:"approval_percent"`
+	RequiresLeader  bool            `json:"requires_leader"`
+	LeaderApproved  bool            `json:"leader_approved"`
+	EligibleVoters  int             `json:"eligible_voters"`
+	VotesRequired   int             `json:"votes_required"`
+	VotesFor        int             `json:"votes_for"`
+	VotesAgainst    int             `json:"votes_against"`
+	Status          GuildVoteStatus `json:"status"`
+	Deadline        time.Time       `json:"deadline"`
+	CreatedAt       time.Time       `json:"created_at"`
+	ResolvedAt      *time.Time      `json:"resolved_at,omitempty"`
+	// The acting character's ballot, nil if they have not voted
+	MyBallot *bool `json:"my_ballot,omitempty"`
+}
+
+// GuildChatChannel is a guild chat room: the guild's own or the one shared
+// with its ally
+type GuildChatChannel string
+
+const (
+	GuildChatGuild    GuildChatChannel = "guild"
+	GuildChatAlliance GuildChatChannel = "alliance"
+)
+
+// GuildChatMessage - DB: chat_messages
+type GuildChatMessage struct {
+	ID         uuid.UUID        `json:"id"`
+	Channel    GuildChatChannel `json:"channel"`
+	SenderID   uuid.UUID        `json:"sender_id"`
+	SenderName string           `json:"sender_name"`
+	Message    string           `json:"message"`
+	SentAt     time.Time        `json:"sent_at"`
+}
+
+type GuildRelationRequest struct {
+	TargetGuildID uuid.UUID `json:"target_guild_id"`
+}
+
+type CastBallotRequest struct {
+	Approve bool `json:"approve"`
+}
+
+type GuildChatRequest struct {
+	Channel GuildChatChannel `json:"channel"`
+	Message string           `json:"message"`
+}
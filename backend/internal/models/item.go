@@ -0,0 +1,15 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// ItemStack describes an item moving between inventory, escrow, mail or storage.
+// JSON keys match the mail.attached_items format.
+type ItemStack struct {
+	ItemDefinitionID int             `json:"item_id"`
+	Quantity         int             `json:"quantity"`
+	UpgradeLevel     int             `json:"upgrade_level"`
+	GemSlots         [4]*int         `json:"gem_slots"`
+	BonusStats       json.RawMessage `json:"bonus_stats,omitempty"`
+}
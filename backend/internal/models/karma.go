@@ -0,0 +1,116 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KarmaReason is why a character's karma or infamy changed (9.3)
+type KarmaReason string
+
+const (
+	KarmaCaravanProtect KarmaReason = "caravan_protect"
+	KarmaBanditKill     KarmaReason = "bandit_kill"
+	KarmaCaravanAttack  KarmaReason = "caravan_attack"
+	KarmaInnocentKill   KarmaReason = "innocent_kill"
+	KarmaFisherAttack   KarmaReason = "fisher_attack"
+	KarmaInfamyDecay    KarmaReason = "infamy_decay"
+)
+
+// KarmaDeltas are the karma changes per reason. Negative deltas lower karma
+// and add the same amount of infamy.
+var KarmaDeltas = map[KarmaReason]int{
+	KarmaCaravanProtect: 10,
+	KarmaBanditKill:     5,
+	KarmaCaravanAttack:  -15,
+	KarmaInnocentKill:   -20,
+	KarmaFisherAttack:   -10,
+}
+
+// Infamy standings, lowest first
+type InfamyStatus string
+
+const (
+	InfamyClean      InfamyStatus = "clean"
+	InfamySuspicious InfamyStatus = "suspicious"
+	InfamyCriminal   InfamyStatus = "criminal"
+	InfamyWanted     InfamyStatus = "wanted"
+	InfamyDangerous  InfamyStatus = "dangerous"
+	InfamyNotorious  InfamyStatus = "notorious"
+)
+
+// Karma standings, lowest first
+type KarmaStanding string
+
+const (
+	KarmaOrdinary  KarmaStanding = "ordinary"
+	KarmaHelpful   KarmaStanding = "helpful"
+	KarmaProtector KarmaStanding = "protector"
+	KarmaHero      KarmaStanding = "hero"
+	KarmaLegend    KarmaStanding = "legend"
+	KarmaSaint     KarmaStanding = "saint"
+)
+
+// Infamy at which a character is wanted and is jailed on death
+const WantedInfamy = 200
+
+func InfamyStatusFor(infamy int) InfamyStatus {
+	switch {
+	case infamy >= 1000:
+		return InfamyNotorious
+	case infamy >= 500:
+		return InfamyDangerous
+	case infamy >= WantedInfamy:
+		return InfamyWanted
+	case infamy >= 100:
+		return InfamyCriminal
+	case infamy >= 50:
+		return InfamySuspicious
+	}
+	return InfamyClean
+}
+
+func KarmaStandingFor(karma int) KarmaStanding {
+	switch {
+	case karma >= 1000:
+		return KarmaSaint
+	case karma >= 500:
+		return KarmaLegend
+	case karma >= 200:
+		return KarmaHero
+	case karma >= 100:
+		return KarmaProtector
+	case karma >= 50:
+		return KarmaHelpful
+	}
+	return KarmaOrdinary
+}
+
+// KarmaProfile is a character's karma standing
+type KarmaProfile struct {
+	CharacterID  uuid.UUID     `json:"character_id"`
+	Name         string        `json:"name"`
+	Level        int           `json:"level"`
+	Karma        int           `json:"karma"`
+	Infamy       int           `json:"infamy"`
+	Standing     KarmaStanding `json:"standing"`
+	InfamyStatus InfamyStatus  `json:"infamy_status"`
+	IsWanted     bool          `json:"is_wanted"`
+	JailOnDeath  bool          `json:"jail_on_death"`
+	LastInfamyAt *time.Time    `json:"last_infamy_at,omitempty"`
+}
+
+// KarmaLog - DB: karma_logs
+type KarmaLog struct {
+	ID            uuid.UUID   `json:"id"`
+	CharacterID   uuid.UUID   `json:"character_id"`
+	Reason        KarmaReason `json:"reason"`
+	KarmaChange   int         `json:"karma_change"`
+	InfamyChange  int         `json:"infamy_change"`
+	KarmaAfter    int         `json:"karma_after"`
+	InfamyAfter   int         `json:"infamy_after"`
+	ReferenceType *string     `json:"reference_type,omitempty"`
+	ReferenceID   *uuid.UUID  `json:"reference_id,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
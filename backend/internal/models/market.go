@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ListingStatus string
+
+const (
+	ListingActive    ListingStatus = "active"
+	ListingSold      ListingStatus = "sold"
+	ListingCancelled ListingStatus = "cancelled"
+	ListingExpired   ListingStatus = "expired"
+)
+
+// MarketListing - DB: market_listings
+type MarketListing struct {
+	ID               uuid.UUID       `json:"id"`
+	ServerID         int             `json:"server_id"`
+	SellerID         uuid.UUID       `json:"seller_id"`
+	SellerName       string          `json:"seller_name"`
+	ItemDefinitionID int             `json:"item_definition_id"`
+	ItemName         string          `json:"item_name"`
+	Quantity         int             `json:"quantity"`
+	UpgradeLevel     int             `json:"upgrade_level"`
+	GemSlots         [4]*int         `json:"gem_slots"`
+	BonusStats       json.RawMessage `json:"bonus_stats,omitempty"`
+	PricePerUnit     int64           `json:"price_per_unit"`
+	TotalPrice       int64           `json:"total_price"`
+	ListingFee       int64           `json:"listing_fee"`
+	SalesTax         int64           `json:"sales_tax"`
+	Status           ListingStatus   `json:"status"`
+	ListedAt         time.Time       `json:"listed_at"`
+	ExpiresAt        time.Time       `json:"expires_at"`
+	SoldAt           *time.Time      `json:"sold_at,omitempty"`
+	BuyerID          *uuid.UUID      `json:"buyer_id,omitempty"`
+}
+
+type CreateListingRequest struct {
+	InventoryItemID uuid.UUID `json:"inventory_item_id"`
+	Quantity        int       `json:"quantity"`
+	PricePerUnit    int64     `json:"price_per_unit"`
+	DurationHours   int       `json:"duration_hours,omitempty"`
+}
+
+// MarketSearchFilter - every field is optional; Cursor comes from a previous NextCursor
+type MarketSearchFilter struct {
+	ItemDefinitionID *int
+	MinUpgradeLevel  *int
+	MaxUpgradeLevel  *int
+	GemID            *int
+	MinPrice         *int64
+	MaxPrice         *int64
+	Cursor           string
+	Limit            int
+}
+
+type MarketSearchResult struct {
+	Listings   []*MarketListing `json:"listings"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type MarketPurchase struct {
+	Listing    *MarketListing `json:"listing"`
+	GoldPaid   int64          `json:"gold_paid"`
+	SentToMail bool           `json:"sent_to_mail"`
+}
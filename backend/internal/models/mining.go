@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MiningNode - DB: mining_nodes. A node holds MaxResources units and refills
+// at RespawnAt once depleted.
+type MiningNode struct {
+	ID                 int           `json:"id"`
+	MapID              int           `json:"map_id"`
+	Name               string        `json:"name"`
+	X                  int           `json:"x"`
+	Y                  int           `json:"y"`
+	Radius             int           `json:"radius"`
+	ZoneType           GatheringZone `json:"zone_type"`
+	MinRarity          string        `json:"min_rarity"`
+	MaxRarity          string        `json:"max_rarity"`
+	RareChanceBonus    float64       `json:"rare_chance_bonus"`
+	RespawnTimeSeconds int           `json:"respawn_time_seconds"`
+	CurrentResources   int           `json:"current_resources"`
+	MaxResources       int           `json:"max_resources"`
+	DepletedAt         *time.Time    `json:"depleted_at,omitempty"`
+	RespawnAt          *time.Time    `json:"respawn_at,omitempty"`
+	IsPrison           bool          `json:"is_prison"`
+}
+
+// MiningStatus - DB: character_mining
+type MiningStatus struct {
+	CharacterID     uuid.UUID   `json:"character_id"`
+	MiningLevel     int         `json:"mining_level"`
+	MiningExp       int         `json:"mining_exp"`
+	NextLevelExp    int         `json:"next_level_exp"`
+	TotalOreMined   int         `json:"total_ore_mined"`
+	RareOreMined    int         `json:"rare_ore_mined"`
+	IsMining        bool        `json:"is_mining"`
+	Node            *MiningNode `json:"node,omitempty"`
+	MiningStartedAt *time.Time  `json:"mining_started_at,omitempty"`
+	NextMineAt      *time.Time  `json:"next_mine_at,omitempty"`
+	BagCount        int         `json:"bag_count"`
+	BagSize         int         `json:"bag_size"`
+	// Ore extracted while settling this request
+	NewOre []*OreExtraction `json:"new_ore,omitempty"`
+}
+
+// OreExtraction - DB: mining_extractions joined with ore_definitions. Prison
+// ores go straight to the inventory as their smelted item and never enter the
+// ore bag.
+type OreExtraction struct {
+	ID         uuid.UUID  `json:"id"`
+	OreID      int        `json:"ore_id"`
+	OreName    string     `json:"ore_name"`
+	Rarity     string     `json:"rarity"`
+	NodeID     int        `json:"node_id"`
+	Quantity   int        `json:"quantity"`
+	SellPrice  int64      `json:"sell_price"`
+	ExpEarned  int        `json:"exp_earned"`
+	PrisonOnly bool       `json:"prison_only"`
+	MinedAt    time.Time  `json:"mined_at"`
+	SoldAt     *time.Time `json:"sold_at,omitempty"`
+	SoldFor    *int64     `json:"sold_for,omitempty"`
+}
+
+type StartMiningRequest struct {
+	NodeID int `json:"node_id"`
+}
+
+// SellOreRequest sells the listed extractions, or the whole bag when empty
+type SellOreRequest struct {
+	ExtractionIDs []uuid.UUID `json:"extraction_ids"`
+}
+
+type OreSale struct {
+	Sold       int   `json:"sold"`
+	GoldEarned int64 `json:"gold_earned"`
+	// Zone tax taken back out of GoldEarned
+	TaxPaid int64 `json:"tax_paid"`
+}
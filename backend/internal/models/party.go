@@ -0,0 +1,140 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PartyLootMode - DB: parties.loot_distribution. Items of MinRollRarity or
+// better are rolled for among the members in range whatever the mode.
+type PartyLootMode string
+
+const (
+	LootFreeForAll PartyLootMode = "free_for_all"
+	LootRoundRobin PartyLootMode = "round_robin"
+	LootLeader     PartyLootMode = "leader"
+)
+
+func (m PartyLootMode) Valid() bool {
+	switch m {
+	case LootFreeForAll, LootRoundRobin, LootLeader:
+		return true
+	}
+	return false
+}
+
+// PartyMaxMembers is the most members a party can have
+const PartyMaxMembers = 5
+
+// Party - DB: parties
+type Party struct {
+	ID            uuid.UUID      `json:"id"`
+	ServerID      int            `json:"server_id"`
+	LeaderID      uuid.UUID      `json:"leader_id"`
+	LeaderName    string         `json:"leader_name"`
+	LootMode      PartyLootMode  `json:"loot_mode"`       // DB: loot_distribution
+	MinRollRarity string         `json:"min_roll_rarity"` // DB: min_item_rarity_for_roll
+	IsPublic      bool           `json:"is_public"`
+	MaxMembers    int            `json:"max_members"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Members       []*PartyMember `json:"members"`
+}
+
+// HasMember reports whether a character is in the party
+func (p *Party) HasMember(characterID uuid.UUID) bool {
+	for _, m := range p.Members {
+		if m.CharacterID == characterID {
+			return true
+		}
+	}
+	return false
+}
+
+// PartyMember - DB: party_members
+type PartyMember struct {
+	CharacterID    uuid.UUID       `json:"character_id"`
+	Name           string          `json:"name"`
+	Level          int             `json:"level"`
+	Class          CharacterClass  `json:"class"`
+	Specialization *Specialization `json:"specialization,omitempty"`
+	Role           *string         `json:"role,omitempty"`
+	GuildID        *uuid.UUID      `json:"guild_id,omitempty"`
+	MapID          *int            `json:"map_id,omitempty"`
+	IsOnline       bool            `json:"is_online"`
+	JoinedAt       time.Time       `json:"joined_at"`
+}
+
+// PartyInvite - DB: party_invites
+type PartyInvite struct {
+	ID            uuid.UUID `json:"id"`
+	PartyID       uuid.UUID `json:"party_id"`
+	LeaderName    string    `json:"leader_name"`
+	CharacterID   uuid.UUID `json:"character_id"`
+	CharacterName string    `json:"character_name"`
+	InvitedBy     uuid.UUID `json:"invited_by"`
+	InvitedByName string    `json:"invited_by_name"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// PartyExpShare is one member's cut of EXP shared in a party
+type PartyExpShare struct {
+	CharacterID uuid.UUID `json:"character_id"`
+	Exp         int       `json:"exp"`
+}
+
+// KillReport is a monster kill the game server reports. The EXP is shared
+// with the killer's party and each drop goes where its loot mode says.
+type KillReport struct {
+	Exp   int         `json:"exp"`
+	Drops []ItemStack `json:"drops"`
+}
+
+// LootAward is the member a dropped item went to
+type LootAward struct {
+	CharacterID uuid.UUID `json:"character_id"`
+	ItemID      int       `json:"item_id"`
+	Quantity    int       `json:"quantity"`
+	Mailed      bool      `json:"mailed"`
+}
+
+// KillRewards is how a reported kill was paid out
+type KillRewards struct {
+	Exp  []*PartyExpShare `json:"exp"`
+	Loot []*LootAward     `json:"loot"`
+}
+
+// PartyChatMessage - DB: chat_messages with channel_type 'party'
+type PartyChatMessage struct {
+	ID         uuid.UUID `json:"id"`
+	SenderID   uuid.UUID `json:"sender_id"`
+	SenderName string    `json:"sender_name"`
+	Message    string    `json:"message"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+type CreatePartyRequest struct {
+	LootMode PartyLootMode `json:"loot_mode"`
+	IsPublic bool          `json:"is_public"`
+}
+
+type PartyInviteRequest struct {
+	CharacterID uuid.UUID `json:"character_id"`
+}
+
+type TransferPartyRequest struct {
+	CharacterID uuid.UUID `json:"character_id"`
+}
+
+// PartySettingsRequest updates only the fields that are set
+type PartySettingsRequest struct {
+	LootMode      *PartyLootMode `json:"loot_mode"`
+	MinRollRarity *string        `json:"min_roll_rarity"`
+	IsPublic      *bool          `json:"is_public"`
+}
+
+type PartyChatRequest struct {
+	Message string `json:"message"`
+}
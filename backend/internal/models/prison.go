@@ -0,0 +1,133 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PrisonReason is why a character was jailed (9.2.1)
+type PrisonReason string
+
+const (
+	PrisonPvPLossStreak PrisonReason = "pvp_loss_streak"
+	PrisonCaravanFail   PrisonReason = "caravan_fail"
+	PrisonHighInfamy    PrisonReason = "high_infamy"
+	PrisonCityPvP       PrisonReason = "city_pvp"
+	PrisonCheat         PrisonReason = "cheat"
+)
+
+// PrisonRecord - DB: prison_records
+type PrisonRecord struct {
+	ID                uuid.UUID    `json:"id"`
+	CharacterID       uuid.UUID    `json:"character_id"`
+	ServerID          int          `json:"server_id"`
+	Reason            PrisonReason `json:"reason"`
+	ReasonDetails     *string      `json:"reason_details,omitempty"`
+	SentenceMinutes   int          `json:"sentence_minutes"`
+	TimeServedMinutes int          `json:"time_served_minutes"`
+	ReductionPercent  int          `json:"reduction_percent"`
+	JailedBy          *uuid.UUID   `json:"jailed_by,omitempty"`
+	ReleasedBy        *uuid.UUID   `json:"released_by,omitempty"`
+	EnteredAt         time.Time    `json:"entered_at"`
+	ReleaseAt         time.Time    `json:"release_at"`
+	ReleasedAt        *time.Time   `json:"released_at,omitempty"`
+	Escaped           bool         `json:"escaped"`
+}
+
+// PrisonStatus is a character's current standing with the prison
+type PrisonStatus struct {
+	CharacterID        uuid.UUID       `json:"character_id"`
+	InPrison           bool            `json:"in_prison"`
+	Reason             *PrisonReason   `json:"reason,omitempty"`
+	ReleaseAt          *time.Time      `json:"release_at,omitempty"`
+	RemainingSeconds   int64           `json:"remaining_seconds"`
+	PvPLossStreak      int             `json:"pvp_loss_streak"`
+	FreedomMedallions  int             `json:"freedom_medallions"`
+	TotalPrisonMinutes int             `json:"total_prison_minutes"`
+	Records            []*PrisonRecord `json:"records,omitempty"`
+}
+
+// PvPResult is the outcome of a fight between two characters, reported by
+// combat resolution.
+type PvPResult struct {
+	MapID           int        `json:"map_id"`
+	AttackerID      uuid.UUID  `json:"attacker_id"`
+	DefenderID      uuid.UUID  `json:"defender_id"`
+	WinnerID        *uuid.UUID `json:"winner_id,omitempty"`
+	DurationSeconds *int       `json:"duration_seconds,omitempty"`
+	TotalRounds     *int       `json:"total_rounds,omitempty"`
+}
+
+// JailRequest is a GM sentence. Minutes defaults to the reason's standard
+// sentence.
+type JailRequest struct {
+	Reason  PrisonReason `json:"reason"`
+	Minutes int          `json:"minutes"`
+	Details string       `json:"details"`
+}
+
+// PrisonEventType is a scheduled prison event (9.2.2)
+type PrisonEventType string
+
+const (
+	PrisonEventEscape PrisonEventType = "escape"
+	PrisonEventArena  PrisonEventType = "arena"
+	PrisonEventBoss   PrisonEventType = "boss"
+)
+
+// PrisonEvent is one run of a scheduled prison event. Sign-ups are open from
+// StartedAt until EndsAt, when the event is resolved.
+type PrisonEvent struct {
+	ID                uuid.UUID       `json:"id"`
+	ServerID          int             `json:"server_id"`
+	Type              PrisonEventType `json:"type"`
+	StartedAt         time.Time       `json:"started_at"`
+	EndsAt            time.Time       `json:"ends_at"`
+	ResolvedAt        *time.Time      `json:"resolved_at,omitempty"`
+	TotalParticipants int             `json:"total_participants"`
+	Joined            bool            `json:"joined"`
+
+	// Escape
+	SuccessfulEscapes *int `json:"successful_escapes,omitempty"`
+	// Arena
+	WinnerID   *uuid.UUID `json:"winner_id,omitempty"`
+	WinnerName *string    `json:"winner_name,omitempty"`
+	// Boss
+	BossHP      *int64 `json:"boss_hp,omitempty"`
+	DamageDealt *int64 `json:"damage_dealt,omitempty"`
+	Defeated    *bool  `json:"defeated,omitempty"`
+}
+
+// PrisonEventSchedule lists the open events and when the next ones begin
+type PrisonEventSchedule struct {
+	Open         []*PrisonEvent `json:"open"`
+	NextEscapeAt time.Time      `json:"next_escape_at"`
+	NextArenaAt  time.Time      `json:"next_arena_at"`
+	NextBossAt   time.Time      `json:"next_boss_at"`
+}
+
+// PrisonEventEntry is a participant's result in a prison event
+type PrisonEventEntry struct {
+	CharacterID  uuid.UUID `json:"character_id"`
+	Name         string    `json:"name"`
+	StageReached *int      `json:"stage_reached,omitempty"`
+	Success      *bool     `json:"success,omitempty"`
+	BossDefeated *bool     `json:"boss_defeated,omitempty"`
+	Wins         *int      `json:"wins,omitempty"`
+	Placement    *int      `json:"placement,omitempty"`
+	Damage       *int64    `json:"damage,omitempty"`
+	ExpEarned    int       `json:"exp_earned"`
+}
+
+// PrisonRanking - DB: prison_pvp_rankings
+type PrisonRanking struct {
+	CharacterID uuid.UUID `json:"character_id"`
+	Name        string    `json:"name"`
+	Level       int       `json:"level"`
+	Kills       int       `json:"kills"`
+	Deaths      int       `json:"deaths"`
+	WeekStart   time.Time `json:"week_start"`
+	Rank        *int      `json:"rank,omitempty"`
+	Title       *string   `json:"title,omitempty"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Severity string
+
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// SuspiciousActivity - DB: suspicious_activity_logs
+type SuspiciousActivity struct {
+	ID              uuid.UUID       `json:"id"`
+	AccountID       uuid.UUID       `json:"account_id"`
+	Username        string          `json:"username"`
+	TrustScore      int             `json:"trust_score"`
+	CharacterID     *uuid.UUID      `json:"character_id,omitempty"`
+	CharacterName   *string         `json:"character_name,omitempty"`
+	ActivityType    string          `json:"activity_type"`
+	Severity        Severity        `json:"severity"`
+	Description     *string         `json:"description,omitempty"`
+	Evidence        json.RawMessage `json:"evidence,omitempty"`
+	AutoActionTaken *string         `json:"auto_action_taken,omitempty"`
+	Reviewed        bool            `json:"reviewed"`
+	ReviewedBy      *string         `json:"reviewed_by,omitempty"`
+	ReviewResult    *string         `json:"review_result,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+type ReviewSuspiciousRequest struct {
+	Result string `json:"result"` // 'confirmed' or 'dismissed'
+}
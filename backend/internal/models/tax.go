@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TaxActivity is an income taxed in guild-controlled zones (8.3.2)
+type TaxActivity string
+
+const (
+	TaxMobFarm TaxActivity = "mob_farm"
+	TaxFishing TaxActivity = "fishing"
+	TaxMining  TaxActivity = "mining"
+	TaxDungeon TaxActivity = "dungeon"
+	TaxCaravan TaxActivity = "caravan"
+	TaxUpgrade TaxActivity = "upgrade"
+)
+
+// ZoneTaxRates is the percentage of each income paid to the controlling guild
+var ZoneTaxRates = map[TaxActivity]int{
+	TaxMobFarm: 5,
+	TaxFishing: 8,
+	TaxMining:  8,
+	TaxDungeon: 3,
+	TaxCaravan: 2,
+	TaxUpgrade: 10,
+}
+
+// TaxActivityTotal sums one activity's tax in a zone over a report period
+type TaxActivityTotal struct {
+	Activity    TaxActivity `json:"activity"`
+	Payments    int         `json:"payments"`
+	GrossAmount int64       `json:"gross_amount"`
+	TaxAmount   int64       `json:"tax_amount"`
+}
+
+// ZoneTaxSummary is one zone in a guild's tax report
+type ZoneTaxSummary struct {
+	ZoneID            int                 `json:"zone_id"`
+	ZoneName          string              `json:"zone_name"`
+	MapID             int                 `json:"map_id"`
+	Controlled        bool                `json:"controlled"`
+	ControlledSince   *time.Time          `json:"controlled_since,omitempty"`
+	TotalTaxCollected int64               `json:"total_tax_collected"`
+	PeriodTax         int64               `json:"period_tax"`
+	Activities        []*TaxActivityTotal `json:"activities"`
+}
+
+// ZoneTaxReport is the tax a guild collected from its zones since Since
+type ZoneTaxReport struct {
+	GuildID   uuid.UUID           `json:"guild_id"`
+	Since     time.Time           `json:"since"`
+	PeriodTax int64               `json:"period_tax"`
+	Rates     map[TaxActivity]int `json:"rates"`
+	Zones     []*ZoneTaxSummary   `json:"zones"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TerritoryWarStatus - DB: guild_wars.status
+type TerritoryWarStatus string
+
+const (
+	TerritoryWarScheduled  TerritoryWarStatus = "scheduled"
+	TerritoryWarInProgress TerritoryWarStatus = "in_progress"
+	TerritoryWarCompleted  TerritoryWarStatus = "completed"
+	TerritoryWarCancelled  TerritoryWarStatus = "cancelled"
+)
+
+// TerritoryWar - DB: guild_wars. A war on an uncontrolled zone has no
+// defender. HolderGuildID is the guild alone on the capture point and
+// CaptureAt when it wins if it holds on.
+type TerritoryWar struct {
+	ID                   uuid.UUID          `json:"id"`
+	ServerID             int                `json:"server_id"`
+	ZoneID               int                `json:"zone_id"`
+	ZoneName             string             `json:"zone_name"`
+	MapID                int                `json:"map_id"`
+	AttackerGuildID      uuid.UUID          `json:"attacker_guild_id"`
+	AttackerGuildName    string             `json:"attacker_guild_name"`
+	DefenderGuildID      *uuid.UUID         `json:"defender_guild_id,omitempty"`
+	DefenderGuildName    *string            `json:"defender_guild_name,omitempty"`
+	DeclaredBy           *uuid.UUID         `json:"declared_by,omitempty"`
+	DeclaredAt           time.Time          `json:"declared_at"`
+	ScheduledAt          time.Time          `json:"scheduled_at"`
+	EndsAt               time.Time          `json:"ends_at"`
+	StartedAt            *time.Time         `json:"started_at,omitempty"`
+	EndedAt              *time.Time         `json:"ended_at,omitempty"`
+	WinnerGuildID        *uuid.UUID         `json:"winner_guild_id,omitempty"`
+	AttackerScore        int                `json:"attacker_score"`
+	DefenderScore        int                `json:"defender_score"`
+	AttackerParticipants int                `json:"attacker_participants"`
+	DefenderParticipants int                `json:"defender_participants"`
+	Status               TerritoryWarStatus `json:"status"`
+	HolderGuildID        *uuid.UUID         `json:"holder_guild_id,omitempty"`
+	HeldSince            *time.Time         `json:"held_since,omitempty"`
+	CaptureAt            *time.Time         `json:"capture_at,omitempty"`
+
+	Participants []*TerritoryWarParticipant `json:"participants,omitempty"`
+}
+
+// TerritoryWarParticipant - DB: guild_war_participants
+type TerritoryWarParticipant struct {
+	CharacterID        uuid.UUID `json:"character_id"`
+	Name               string    `json:"name"`
+	GuildID            uuid.UUID `json:"guild_id"`
+	Kills              int       `json:"kills"`
+	Deaths             int       `json:"deaths"`
+	CaptureTimeSeconds int       `json:"capture_time_seconds"`
+	OnPoint            bool      `json:"on_point"`
+	JoinedAt           time.Time `json:"joined_at"`
+}
+
+// TerritoryZone is a controllable zone and who holds it on a server
+type TerritoryZone struct {
+	ZoneID           int        `json:"zone_id"`
+	ZoneName         string     `json:"zone_name"`
+	MapID            int        `json:"map_id"`
+	ZoneType         *string    `json:"zone_type,omitempty"`
+	GuildID          *uuid.UUID `json:"guild_id,omitempty"`
+	GuildName        *string    `json:"guild_name,omitempty"`
+	ControlledSince  *time.Time `json:"controlled_since,omitempty"`
+	ControlExpiresAt *time.Time `json:"control_expires_at,omitempty"`
+}
+
+type DeclareWarRequest struct {
+	ZoneID int `json:"zone_id"`
+}
+
+// WarPointRequest reports whether the character stands on the capture
+// point. Clients repeat it while they stay there.
+type WarPointRequest struct {
+	OnPoint bool `json:"on_point"`
+}
+
+// WarFight is a fight between the sides of a running war and the war after
+// the kill was counted
+type WarFight struct {
+	Result *PvPResult    `json:"result"`
+	War    *TerritoryWar `json:"war"`
+}
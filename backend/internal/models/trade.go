@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TradeStatus string
+
+const (
+	TradePending   TradeStatus = "pending"
+	TradeCompleted TradeStatus = "completed"
+	TradeCancelled TradeStatus = "cancelled"
+	TradeExpired   TradeStatus = "expired"
+)
+
+// PlayerTrade - DB: player_trades
+type PlayerTrade struct {
+	ID               uuid.UUID    `json:"id"`
+	Player1ID        uuid.UUID    `json:"player1_id"`
+	Player1Name      string       `json:"player1_name"`
+	Player2ID        uuid.UUID    `json:"player2_id"`
+	Player2Name      string       `json:"player2_name"`
+	Status           TradeStatus  `json:"status"`
+	Player1Locked    bool         `json:"player1_locked"`
+	Player2Locked    bool         `json:"player2_locked"`
+	Player1Confirmed bool         `json:"player1_confirmed"`
+	Player2Confirmed bool         `json:"player2_confirmed"`
+	Player1Gold      int64        `json:"player1_gold"`
+	Player2Gold      int64        `json:"player2_gold"`
+	Items            []*TradeItem `json:"items"`
+	CreatedAt        time.Time    `json:"created_at"`
+	AcceptedAt       *time.Time   `json:"accepted_at,omitempty"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+	CompletedAt      *time.Time   `json:"completed_at,omitempty"`
+	ExpiresAt        time.Time    `json:"expires_at"`
+}
+
+// TradeItem - DB: player_trade_items
+type TradeItem struct {
+	ID               uuid.UUID  `json:"id"`
+	OwnerID          uuid.UUID  `json:"owner_id"`
+	InventoryItemID  *uuid.UUID `json:"inventory_item_id,omitempty"`
+	ItemDefinitionID int        `json:"item_definition_id"`
+	ItemName         string     `json:"item_name"`
+	Quantity         int        `json:"quantity"`
+	UpgradeLevel     int        `json:"upgrade_level"`
+}
+
+type CreateTradeRequest struct {
+	TargetCharacterID uuid.UUID `json:"target_character_id"`
+}
+
+type AddTradeItemRequest struct {
+	InventoryItemID uuid.UUID `json:"inventory_item_id"`
+	Quantity        int       `json:"quantity"`
+}
+
+type SetTradeGoldRequest struct {
+	Gold int64 `json:"gold"`
+}
@@ -0,0 +1,721 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrNotRedFlag            = errors.New("only red flag carriers can attack caravans")
+	ErrNotBlueFlag           = errors.New("only blue flag carriers can defend caravans")
+	ErrCaravanNotAttackable  = errors.New("caravan cannot be attacked right now")
+	ErrCaravanOwnCaravan     = errors.New("cannot attack your own caravan")
+	ErrAlreadyAttacking      = errors.New("you are already attacking this caravan")
+	ErrAlreadyGuarding       = errors.New("you are already guarding this caravan")
+	ErrCaravanGuardsFull     = errors.New("caravan has no free guard slots")
+	ErrCaravanGuardCannotHit = errors.New("guards cannot attack the caravan they protect")
+)
+
+const (
+	// Attackers can join an engagement until it resolves
+	CaravanAttackDuration = 2 * time.Minute
+	CaravanAttackRounds   = 10
+	CaravanLootMinPercent = 40
+	CaravanLootMaxPercent = 60
+	// Share of the cargo value paid to player guards for a successful defense
+	CaravanDefenseRewardPercent = 10
+	CaravanFailedAttacksForJail = 3
+	CaravanMinWinChance         = 0.05
+	CaravanMaxWinChance         = 0.95
+	OfflineProtectorEfficiency  = 0.8
+	// NPC guard abilities
+	GuardStunPercent    = 10   // attacker power lost to stuns
+	GuardAoEPercent     = 20   // guard power gained against groups
+	GuardTauntReduction = 0.15 // caravan damage soaked by taunting
+	GuardHealPercent    = 10   // caravan max HP restored after a repelled attack
+)
+
+// System ledger accounts for caravan combat
+const (
+	SystemCaravanLoot    = "caravan_loot"
+	SystemCaravanDefense = "caravan_defense"
+)
+
+// Attack starts an attack on a traveling caravan, or joins the engagement
+// already under way. The caravan stops while under attack and the fight is
+// resolved once CaravanAttackDuration has passed.
+func (s *CaravanService) Attack(ctx context.Context, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		attacker, err := loadFlagState(ctx, tx, characterID, false)
+		if err != nil || attacker.AccountID != accountID {
+			return ErrCharacterNotFound
+		}
+		if flag := attacker.activeFlag(time.Now()); flag == nil || *flag != models.FlagRed {
+			return ErrNotRedFlag
+		}
+		if err := checkNotInPrison(ctx, tx, attacker.ID); err != nil {
+			return err
+		}
+
+		c, err := lockCaravan(ctx, tx, caravanID)
+		if err != nil {
+			return err
+		}
+		if c.ServerID != attacker.ServerID {
+			return ErrCaravanNotFound
+		}
+		if c.OwnerID == attacker.ID {
+			return ErrCaravanOwnCaravan
+		}
+
+		switch c.Status {
+		case models.CaravanTraveling:
+			if c.ProgressPercent >= 100 {
+				return ErrCaravanNotAttackable
+			}
+		case models.CaravanUnderAttack:
+			if c.AttackEndsAt != nil && !c.AttackEndsAt.After(time.Now()) {
+				return ErrCaravanNotAttackable
+			}
+		default:
+			return ErrCaravanNotAttackable
+		}
+
+		var conflict string
+		err = tx.QueryRow(ctx, `
+			SELECT CASE
+				WHEN EXISTS(SELECT 1 FROM caravan_attacks WHERE caravan_id = $1 AND attacker_id = $2 AND ended_at IS NULL) THEN 'attacking'
+				WHEN EXISTS(SELECT 1 FROM caravan_guards WHERE caravan_id = $1 AND character_id = $2 AND is_active = true) THEN 'guarding'
+				ELSE '' END
+		`, c.ID, attacker.ID).Scan(&conflict)
+		if err != nil {
+			return fmt.Errorf("failed to check attackers: %w", err)
+		}
+		switch conflict {
+		case "attacking":
+			return ErrAlreadyAttacking
+		case "guarding":
+			return ErrCaravanGuardCannotHit
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO caravan_attacks (caravan_id, attacker_id) VALUES ($1, $2)
+		`, c.ID, attacker.ID); err != nil {
+			return fmt.Errorf("failed to start attack: %w", err)
+		}
+
+		if c.Status == models.CaravanTraveling {
+			_, err = tx.Exec(ctx, `
+				UPDATE caravans SET status = 'under_attack', under_attack = true, last_attack_at = NOW()
+				WHERE id = $1
+			`, c.ID)
+			if err != nil {
+				return fmt.Errorf("failed to update caravan: %w", err)
+			}
+		}
+
+		return s.karma.Apply(ctx, tx, attacker.ID, models.KarmaCaravanAttack, "caravan", &c.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getCaravan(ctx, s.db.Pool, caravanID)
+}
+
+// Defend joins a blue flag carrier to a caravan's guards. Defending a
+// caravan counts as fighting back, so blue may join an attack in progress.
+func (s *CaravanService) Defend(ctx context.Context, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		guard, err := loadFlagState(ctx, tx, characterID, false)
+		if err != nil || guard.AccountID != accountID {
+			return ErrCharacterNotFound
+		}
+		if flag := guard.activeFlag(time.Now()); flag == nil || *flag != models.FlagBlue {
+			return ErrNotBlueFlag
+		}
+		if err := checkNotInPrison(ctx, tx, guard.ID); err != nil {
+			return err
+		}
+
+		c, err := lockCaravan(ctx, tx, caravanID)
+		if err != nil {
+			return err
+		}
+		if c.ServerID != guard.ServerID {
+			return ErrCaravanNotFound
+		}
+		if c.Status != models.CaravanPreparing && c.Status != models.CaravanTraveling && c.Status != models.CaravanUnderAttack {
+			return ErrCaravanNotTraveling
+		}
+
+		return addCaravanGuard(ctx, tx, c, &guardHire{CharacterID: &guard.ID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getCaravan(ctx, s.db.Pool, caravanID)
+}
+
+// guardHire is a new caravan_guards row: a player (with an optional board
+// contract) or an NPC guard tier.
+type guardHire struct {
+	CharacterID  *uuid.UUID
+	NPCGuardType *int
+	ListingID    *uuid.UUID
+	Hours        int
+	Fee          int64
+}
+
+// addCaravanGuard adds a player or NPC guard to a locked caravan, respecting
+// the caravan type's guard limit.
+func addCaravanGuard(ctx context.Context, tx pgx.Tx, c *models.Caravan, h *guardHire) error {
+	characterID := h.CharacterID
+	var active int
+	var alreadyGuarding bool
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE is_active),
+		       COALESCE(BOOL_OR(is_active AND character_id = $2), false)
+		FROM caravan_guards WHERE caravan_id = $1
+	`, c.ID, characterID).Scan(&active, &alreadyGuarding)
+	if err != nil {
+		return fmt.Errorf("failed to count guards: %w", err)
+	}
+	if alreadyGuarding {
+		return ErrAlreadyGuarding
+	}
+	if active >= c.MaxGuards {
+		return ErrCaravanGuardsFull
+	}
+
+	if characterID != nil {
+		var attacking bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM caravan_attacks WHERE caravan_id = $1 AND attacker_id = $2 AND ended_at IS NULL)
+		`, c.ID, *characterID).Scan(&attacking)
+		if err != nil {
+			return fmt.Errorf("failed to check attackers: %w", err)
+		}
+		if attacking {
+			return ErrAlreadyAttacking
+		}
+	}
+
+	// A player who left earlier rejoins on the same row
+	_, err = tx.Exec(ctx, `
+		INSERT INTO caravan_guards (caravan_id, character_id, npc_guard_type, listing_id, hours, fee_amount)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (caravan_id, character_id) DO UPDATE SET
+			is_active = true, joined_at = NOW(),
+			listing_id = COALESCE(EXCLUDED.listing_id, caravan_guards.listing_id),
+			hours = caravan_guards.hours + EXCLUDED.hours,
+			fee_amount = caravan_guards.fee_amount + EXCLUDED.fee_amount
+	`, c.ID, characterID, h.NPCGuardType, h.ListingID, h.Hours, h.Fee)
+	if err != nil {
+		return fmt.Errorf("failed to add guard: %w", err)
+	}
+	return nil
+}
+
+// combatant is one fighter in a caravan engagement
+type combatant struct {
+	RowID       uuid.UUID
+	CharacterID *uuid.UUID
+	Online      bool
+	Abilities   []string
+	Power       float64
+	Effects     map[string]interface{}
+}
+
+func (c *combatant) hasAbility(ability string) bool {
+	for _, a := range c.Abilities {
+		if a == ability {
+			return true
+		}
+	}
+	return false
+}
+
+func effectFloat(effects map[string]interface{}, key string) float64 {
+	if v, ok := effects[key].(float64); ok {
+		return v
+	}
+	return 0
+}
+
+// guardEfficiency scales a guard's power. Offline protectors are fought by
+// the AI at reduced strength.
+func guardEfficiency(g *combatant) float64 {
+	if g.CharacterID != nil && !g.Online {
+		return OfflineProtectorEfficiency
+	}
+	return 1
+}
+
+// resolveAttack settles the open engagement on a locked caravan. Attack power
+// is weighed against guards and the caravan's own defense, raised by the
+// owner's guild defense bonus; the winner is rolled from that ratio. Raiders
+// split 40-60% of the cargo and the caravan is destroyed; otherwise guards
+// share a defense reward and the caravan carries on with whatever HP it has
+// left.
+func (s *CaravanService) resolveAttack(ctx context.Context, tx pgx.Tx, c *models.Caravan) error {
+	attackers, err := s.loadAttackers(ctx, tx, c.ID)
+	if err != nil {
+		return err
+	}
+	guards, err := s.loadGuards(ctx, tx, c.ID)
+	if err != nil {
+		return err
+	}
+
+	var attackPower, vsGuards, caravanDamage float64
+	for _, a := range attackers {
+		attackPower += a.Power
+		guardMult := math.Max(1, effectFloat(a.Effects, "guard_damage"))
+		caravanMult := math.Max(1, math.Max(effectFloat(a.Effects, "caravan_damage"), effectFloat(a.Effects, "aoe_caravan_damage")))
+		vsGuards += a.Power * guardMult
+		caravanDamage += a.Power * caravanMult * CaravanAttackRounds
+	}
+
+	var guardPower, damageReduction, escapeChance float64
+	var stun, aoe, heal bool
+	for _, g := range guards {
+		power := g.Power * guardEfficiency(g)
+		if g.hasAbility(models.GuardAbilityAoE) && len(attackers) > 1 {
+			power *= 1 + GuardAoEPercent/100.0
+		}
+		guardPower += power
+		damageReduction = math.Max(damageReduction, effectFloat(g.Effects, "caravan_damage_reduction"))
+		escapeChance = math.Max(escapeChance, effectFloat(g.Effects, "caravan_dodge")/100)
+		if g.hasAbility(models.GuardAbilityTaunt) {
+			damageReduction = math.Max(damageReduction, GuardTauntReduction)
+		}
+		stun = stun || g.hasAbility(models.GuardAbilityStun)
+		aoe = aoe || g.hasAbility(models.GuardAbilityAoE)
+		heal = heal || g.hasAbility(models.GuardAbilityHeal)
+	}
+	if stun {
+		vsGuards *= 1 - GuardStunPercent/100.0
+		caravanDamage *= 1 - GuardStunPercent/100.0
+	}
+	caravanDamage *= 1 - damageReduction
+
+	// The owner's guild bonus strengthens the whole defense
+	bonus, err := s.bonuses.Resolve(ctx, c.OwnerID, models.BonusActivityCaravan)
+	if err != nil {
+		return err
+	}
+	defense := (guardPower + float64(c.BaseDefense)) * bonus.Multiplier(models.BonusCaravanDefense)
+
+	winChance := 0.0
+	if vsGuards > 0 {
+		winChance = vsGuards / (vsGuards + defense)
+		winChance = math.Max(CaravanMinWinChance, math.Min(CaravanMaxWinChance, winChance))
+	}
+	success := len(attackers) > 0 && rand.Float64() < winChance && rand.Float64() >= escapeChance
+
+	remainingHP := c.CurrentHP
+	if !success {
+		remainingHP -= int(caravanDamage * winChance)
+		// A caravan battered to nothing falls even if the guards held
+		if remainingHP <= 0 && len(attackers) > 0 {
+			success = true
+		}
+	}
+
+	// Per-attacker damage is proportional to power
+	damageOf := func(a *combatant) int {
+		if attackPower == 0 {
+			return 0
+		}
+		dealt := float64(c.CurrentHP)
+		if !success {
+			dealt = float64(c.CurrentHP - remainingHP)
+		}
+		return int(dealt * a.Power / attackPower)
+	}
+
+	if success {
+		return s.raidCaravan(ctx, tx, c, attackers, guards, damageOf)
+	}
+	if heal {
+		remainingHP = min(c.MaxHP, remainingHP+c.MaxHP*GuardHealPercent/100)
+	}
+	return s.repelAttack(ctx, tx, c, attackers, guards, guardPower, remainingHP, damageOf)
+}
+
+func (s *CaravanService) loadAttackers(ctx context.Context, tx pgx.Tx, caravanID uuid.UUID) ([]*combatant, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT id, attacker_id FROM caravan_attacks
+		WHERE caravan_id = $1 AND ended_at IS NULL
+		ORDER BY started_at
+		FOR UPDATE
+	`, caravanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attackers: %w", err)
+	}
+	var attackers []*combatant
+	for rows.Next() {
+		var a combatant
+		var id uuid.UUID
+		if err := rows.Scan(&a.RowID, &id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan attacker: %w", err)
+		}
+		a.CharacterID = &id
+		attackers = append(attackers, &a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range attackers {
+		st, err := loadFlagState(ctx, tx, *a.CharacterID, false)
+		if err != nil {
+			return nil, err
+		}
+		stats, err := combatStats(ctx, tx, st)
+		if err != nil {
+			return nil, err
+		}
+		a.Power = float64(stats.Attack)
+		a.Effects = stats.Effects
+	}
+	return attackers, nil
+}
+
+func (s *CaravanService) loadGuards(ctx context.Context, tx pgx.Tx, caravanID uuid.UUID) ([]*combatant, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT g.id, g.character_id, g.npc_guard_type, COALESCE(c.is_online, false)
+		FROM caravan_guards g
+		LEFT JOIN characters c ON c.id = g.character_id
+		WHERE g.caravan_id = $1 AND g.is_active = true
+		ORDER BY g.joined_at
+		FOR UPDATE OF g
+	`, caravanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guards: %w", err)
+	}
+	var guards []*combatant
+	var npcTypes []*int
+	for rows.Next() {
+		var g combatant
+		var npcType *int
+		if err := rows.Scan(&g.RowID, &g.CharacterID, &npcType, &g.Online); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan guard: %w", err)
+		}
+		guards = append(guards, &g)
+		npcTypes = append(npcTypes, npcType)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, g := range guards {
+		g.Effects = map[string]interface{}{}
+		if g.CharacterID == nil {
+			if npcTypes[i] != nil {
+				tier := models.NPCGuardTiers[*npcTypes[i]]
+				g.Power = float64(tier.Power)
+				g.Abilities = tier.Abilities
+			}
+			continue
+		}
+		// Offline protectors are left to the AI
+		if _, err := tx.Exec(ctx, "UPDATE caravan_guards SET is_afk = $1 WHERE id = $2", !g.Online, g.RowID); err != nil {
+			return nil, fmt.Errorf("failed to update guard: %w", err)
+		}
+		st, err := loadFlagState(ctx, tx, *g.CharacterID, false)
+		if err != nil {
+			return nil, err
+		}
+		stats, err := combatStats(ctx, tx, st)
+		if err != nil {
+			return nil, err
+		}
+		g.Power = float64(stats.Attack + stats.Defense)
+		g.Effects = stats.Effects
+	}
+	return guards, nil
+}
+
+// raidCaravan pays the raiders, each raised by their guild bonus, and
+// destroys the caravan
+func (s *CaravanService) raidCaravan(ctx context.Context, tx pgx.Tx, c *models.Caravan, attackers, guards []*combatant, damageOf func(*combatant) int) error {
+	lootPercent := CaravanLootMinPercent + rand.Intn(CaravanLootMaxPercent-CaravanLootMinPercent+1)
+	loot := percentOf(c.ExpectedReward, int64(lootPercent))
+	share := loot / int64(len(attackers))
+
+	for i, a := range attackers {
+		amount := share
+		if i == 0 {
+			amount += loot - share*int64(len(attackers))
+		}
+		bonus, err := s.bonuses.Resolve(ctx, *a.CharacterID, models.BonusActivityCaravan)
+		if err != nil {
+			return err
+		}
+		amount = int64(float64(amount) * bonus.Multiplier(models.BonusRaidLoot))
+		if amount > 0 {
+			err := s.ledger.Post(ctx, tx, &Posting{
+				ServerID:      c.ServerID,
+				Currency:      models.CurrencyGold,
+				Amount:        amount,
+				From:          SystemAccount(SystemCaravanLoot),
+				To:            CharacterAccount(*a.CharacterID),
+				Reason:        "caravan_loot",
+				ReferenceType: "caravan",
+				ReferenceID:   &c.ID,
+				Details:       map[string]interface{}{"loot_percent": lootPercent},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE caravan_attacks SET success = true, ended_at = NOW(), damage_dealt = $1,
+				loot_obtained = $2, loot_percent = $3, guards_killed = $4
+			WHERE id = $5
+		`, damageOf(a), amount, lootPercent, len(guards), a.RowID)
+		if err != nil {
+			return fmt.Errorf("failed to record attack: %w", err)
+		}
+		if _, err := tx.Exec(ctx, "UPDATE characters SET caravans_raided = caravans_raided + 1 WHERE id = $1", *a.CharacterID); err != nil {
+			return fmt.Errorf("failed to update caravan stats: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE caravan_guards SET is_active = false, deaths = deaths + 1
+		WHERE caravan_id = $1 AND is_active = true
+	`, c.ID); err != nil {
+		return fmt.Errorf("failed to update guards: %w", err)
+	}
+	// Player guards fall to the raiders in turn
+	i := 0
+	for _, g := range guards {
+		if g.CharacterID == nil {
+			continue
+		}
+		if err := s.caravanFighterDied(ctx, tx, c, *g.CharacterID, attackers[i%len(attackers)], true); err != nil {
+			return err
+		}
+		i++
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE caravans SET current_hp = 0 WHERE id = $1", c.ID); err != nil {
+		return fmt.Errorf("failed to update caravan: %w", err)
+	}
+	return s.closeCaravan(ctx, tx, c, models.CaravanDestroyed, "raided", true)
+}
+
+// repelAttack rewards the guards, jails repeat failures and sends the caravan
+// back on its way. Time spent under attack is added to the journey.
+func (s *CaravanService) repelAttack(ctx context.Context, tx pgx.Tx, c *models.Caravan, attackers, guards []*combatant, guardPower float64, remainingHP int, damageOf func(*combatant) int) error {
+	for i, a := range attackers {
+		_, err := tx.Exec(ctx, `
+			UPDATE caravan_attacks SET success = false, ended_at = NOW(), damage_dealt = $1, attacker_deaths = 1
+			WHERE id = $2
+		`, damageOf(a), a.RowID)
+		if err != nil {
+			return fmt.Errorf("failed to record attack: %w", err)
+		}
+
+		// Each fallen bandit is credited to a guard in turn
+		var killer *combatant
+		if len(guards) > 0 {
+			killer = guards[i%len(guards)]
+			if _, err := tx.Exec(ctx, "UPDATE caravan_guards SET kills = kills + 1 WHERE id = $1", killer.RowID); err != nil {
+				return fmt.Errorf("failed to update guard: %w", err)
+			}
+			if killer.CharacterID != nil {
+				if err := s.karma.Apply(ctx, tx, *killer.CharacterID, models.KarmaBanditKill, "caravan", &c.ID); err != nil {
+					return err
+				}
+			}
+		}
+		if err := s.caravanFighterDied(ctx, tx, c, *a.CharacterID, killer, false); err != nil {
+			return err
+		}
+
+		if err := s.checkFailedAttacks(ctx, tx, *a.CharacterID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.payGuards(ctx, tx, c, guards, guardPower); err != nil {
+		return err
+	}
+
+	// Resume the journey, pushing arrival back by the time spent fighting
+	_, err := tx.Exec(ctx, `
+		UPDATE caravans SET status = 'traveling', under_attack = false, current_hp = $1,
+			paused_seconds = paused_seconds + GREATEST(EXTRACT(EPOCH FROM NOW() - last_attack_at), 0)::int,
+			estimated_arrival = estimated_arrival + GREATEST(NOW() - last_attack_at, INTERVAL '0')
+		WHERE id = $2
+	`, remainingHP, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to resume caravan: %w", err)
+	}
+	c.Status = models.CaravanTraveling
+	return nil
+}
+
+// payGuards splits the defense reward between player guards by power and
+// credits them with the protection.
+func (s *CaravanService) payGuards(ctx context.Context, tx pgx.Tx, c *models.Caravan, guards []*combatant, guardPower float64) error {
+	var playerPower float64
+	for _, g := range guards {
+		if g.CharacterID != nil {
+			playerPower += g.Power * guardEfficiency(g)
+		}
+	}
+
+	reward := percentOf(c.ExpectedReward, CaravanDefenseRewardPercent)
+	for _, g := range guards {
+		if g.CharacterID == nil {
+			continue
+		}
+
+		var amount int64
+		if playerPower > 0 {
+			amount = int64(float64(reward) * g.Power * guardEfficiency(g) / playerPower)
+		}
+		if amount > 0 {
+			err := s.ledger.Post(ctx, tx, &Posting{
+				ServerID:      c.ServerID,
+				Currency:      models.CurrencyGold,
+				Amount:        amount,
+				From:          SystemAccount(SystemCaravanDefense),
+				To:            CharacterAccount(*g.CharacterID),
+				Reason:        "caravan_defense",
+				ReferenceType: "caravan",
+				ReferenceID:   &c.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE caravan_guards SET reward_earned = reward_earned + $1, damage_dealt = damage_dealt + $2
+			WHERE id = $3
+		`, amount, int64(g.Power*guardEfficiency(g)), g.RowID); err != nil {
+			return fmt.Errorf("failed to update guard: %w", err)
+		}
+		if _, err := tx.Exec(ctx, "UPDATE characters SET caravans_protected = caravans_protected + 1 WHERE id = $1", *g.CharacterID); err != nil {
+			return fmt.Errorf("failed to update caravan stats: %w", err)
+		}
+		if err := s.karma.Apply(ctx, tx, *g.CharacterID, models.KarmaCaravanProtect, "caravan", &c.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// caravanFighterDied records the death of a caravan fighter. Killed by a
+// player it is a fight between the raider and the guard, which can jail
+// either of them (9.2.1); otherwise it is a death outside PvP.
+func (s *CaravanService) caravanFighterDied(ctx context.Context, tx pgx.Tx, c *models.Caravan, victimID uuid.UUID, killer *combatant, raiderWon bool) error {
+	if killer == nil || killer.CharacterID == nil || *killer.CharacterID == victimID || c.CurrentMapID == nil {
+		return recordDeath(ctx, tx, s.ledger, victimID)
+	}
+	raiderID, guardID := victimID, *killer.CharacterID
+	if raiderWon {
+		raiderID, guardID = guardID, victimID
+	}
+	return recordPvPResult(ctx, tx, s.karma, s.ledger, &models.PvPResult{
+		MapID:      *c.CurrentMapID,
+		AttackerID: raiderID,
+		DefenderID: guardID,
+		WinnerID:   killer.CharacterID,
+	})
+}
+
+// checkFailedAttacks jails an attacker who has failed too many caravan
+// attacks today.
+func (s *CaravanService) checkFailedAttacks(ctx context.Context, tx pgx.Tx, attackerID uuid.UUID) error {
+	var failed int
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM caravan_attacks
+		WHERE attacker_id = $1 AND success = false AND ended_at >= date_trunc('day', NOW())
+	`, attackerID).Scan(&failed)
+	if err != nil {
+		return fmt.Errorf("failed to count failed attacks: %w", err)
+	}
+	if failed == 0 || failed%CaravanFailedAttacksForJail != 0 {
+		return nil
+	}
+	_, err = imprison(ctx, tx, attackerID, &jailOrder{
+		Reason:   models.PrisonCaravanFail,
+		Details:  fmt.Sprintf("%d failed caravan attacks today", failed),
+		Sentence: PrisonCaravanFailSentence,
+	})
+	return err
+}
+
+// GetAttacks returns the attack history of a caravan
+func (s *CaravanService) GetAttacks(ctx context.Context, caravanID uuid.UUID) ([]*models.CaravanAttack, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT a.id, a.caravan_id, a.attacker_id, c.name, a.success, a.damage_dealt, a.loot_obtained,
+		       a.guards_killed, a.attacker_deaths, a.started_at, a.ended_at
+		FROM caravan_attacks a
+		JOIN characters c ON c.id = a.attacker_id
+		WHERE a.caravan_id = $1
+		ORDER BY a.started_at DESC
+	`, caravanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caravan attacks: %w", err)
+	}
+	defer rows.Close()
+
+	var attacks []*models.CaravanAttack
+	for rows.Next() {
+		var a models.CaravanAttack
+		if err := rows.Scan(&a.ID, &a.CaravanID, &a.AttackerID, &a.AttackerName, &a.Success, &a.DamageDealt,
+			&a.LootObtained, &a.GuardsKilled, &a.AttackerDeaths, &a.StartedAt, &a.EndedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan caravan attack: %w", err)
+		}
+		attacks = append(attacks, &a)
+	}
+	return attacks, rows.Err()
+}
+
+// GetGuards returns everyone who has guarded a caravan
+func (s *CaravanService) GetGuards(ctx context.Context, caravanID uuid.UUID) ([]*models.CaravanGuard, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT g.id, g.caravan_id, g.character_id, c.name, g.npc_guard_type, g.listing_id, g.hours,
+		       g.fee_amount, g.fee_paid, g.reward_earned, g.is_active, g.damage_dealt, g.kills, g.deaths, g.joined_at
+		FROM caravan_guards g
+		LEFT JOIN characters c ON c.id = g.character_id
+		WHERE g.caravan_id = $1
+		ORDER BY g.joined_at
+	`, caravanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caravan guards: %w", err)
+	}
+	defer rows.Close()
+
+	var guards []*models.CaravanGuard
+	for rows.Next() {
+		var g models.CaravanGuard
+		if err := rows.Scan(&g.ID, &g.CaravanID, &g.CharacterID, &g.CharacterName, &g.NPCGuardType, &g.ListingID, &g.Hours,
+			&g.FeeAmount, &g.FeePaid, &g.RewardEarned, &g.IsActive, &g.DamageDealt, &g.Kills, &g.Deaths, &g.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan caravan guard: %w", err)
+		}
+		guards = append(guards, &g)
+	}
+	return guards, rows.Err()
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInvalidGuardTier      = errors.New("invalid guard tier")
+	ErrInvalidHourlyFee      = errors.New("hourly fee must be positive")
+	ErrProtectorNotFound     = errors.New("protector listing not found")
+	ErrProtectorUnavailable  = errors.New("protector is not available")
+	ErrCannotContractSelf    = errors.New("cannot contract yourself")
+	ErrCaravanBelowProtector = errors.New("protector does not take caravans of this type")
+	ErrCaravanGuardsLocked   = errors.New("guards can only be hired before or during travel")
+)
+
+const MaxProtectorHourlyFee = 10_000_000
+
+// System ledger accounts for guards
+const (
+	SystemGuardHire   = "guard_hire"
+	SystemGuardEscrow = "guard_escrow"
+	SystemGuardBonus  = "guard_bonus"
+)
+
+// guardOutcome is how a caravan ended, as far as its guards are concerned
+type guardOutcome int
+
+const (
+	guardOutcomeDelivered guardOutcome = iota // protectors earn their fee
+	guardOutcomeLost                          // fees go back to the owner
+	guardOutcomeCancelled                     // never left: every fee is refunded
+)
+
+// caravanHours is how many guard hours a trip on the caravan's route takes
+func caravanHours(ctx context.Context, q querier, c *models.Caravan) (int, error) {
+	var minutes int
+	if err := q.QueryRow(ctx, "SELECT base_duration_minutes FROM caravan_routes WHERE id = $1", c.RouteID).Scan(&minutes); err != nil {
+		return 0, ErrCaravanRouteNotFound
+	}
+	return max(1, (minutes+59)/60), nil
+}
+
+// lockHireableCaravan locks an owned caravan that can still take on guards
+func lockHireableCaravan(ctx context.Context, tx pgx.Tx, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error) {
+	c, err := lockOwnedCaravan(ctx, tx, accountID, characterID, caravanID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != models.CaravanPreparing && c.Status != models.CaravanTraveling {
+		return nil, ErrCaravanGuardsLocked
+	}
+	return c, nil
+}
+
+// HireNPCGuard rents an NPC guard for the whole trip. The rent is paid up
+// front by the hour, rounded up.
+func (s *CaravanService) HireNPCGuard(ctx context.Context, accountID, characterID, caravanID uuid.UUID, tier int) (*models.Caravan, error) {
+	guard, ok := models.NPCGuardTiers[tier]
+	if !ok {
+		return nil, ErrInvalidGuardTier
+	}
+
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockHireableCaravan(ctx, tx, accountID, characterID, caravanID)
+		if err != nil {
+			return err
+		}
+		hours, err := caravanHours(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+
+		fee := guard.HourlyFee * int64(hours)
+		if err := addCaravanGuard(ctx, tx, c, &guardHire{NPCGuardType: &tier, Hours: hours, Fee: fee}); err != nil {
+			return err
+		}
+		return s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      c.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        fee,
+			From:          CharacterAccount(c.OwnerID),
+			To:            SystemAccount(SystemGuardHire),
+			Reason:        "guard_hire",
+			ReferenceType: "caravan",
+			ReferenceID:   &c.ID,
+			Details:       map[string]interface{}{"tier": tier, "hours": hours},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getCaravan(ctx, s.db.Pool, caravanID)
+}
+
+// ContractProtector hires a player from the protector board. The fee is held
+// in escrow until the caravan arrives, and the protector is off the board
+// until then.
+func (s *CaravanService) ContractProtector(ctx context.Context, accountID, characterID, caravanID, listingID uuid.UUID) (*models.Caravan, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockHireableCaravan(ctx, tx, accountID, characterID, caravanID)
+		if err != nil {
+			return err
+		}
+
+		var protectorID uuid.UUID
+		var serverID, minType int
+		var hourlyFee int64
+		var active, available bool
+		err = tx.QueryRow(ctx, `
+			SELECT character_id, server_id, COALESCE(min_caravan_type, 1), hourly_fee,
+			       COALESCE(is_active, false), COALESCE(is_available, false)
+			FROM guard_listings WHERE id = $1
+			FOR UPDATE
+		`, listingID).Scan(&protectorID, &serverID, &minType, &hourlyFee, &active, &available)
+		if err != nil || serverID != c.ServerID || !active {
+			return ErrProtectorNotFound
+		}
+		if protectorID == c.OwnerID {
+			return ErrCannotContractSelf
+		}
+		if !available {
+			return ErrProtectorUnavailable
+		}
+		if c.CaravanTypeID < minType {
+			return ErrCaravanBelowProtector
+		}
+
+		protector, err := loadFlagState(ctx, tx, protectorID, false)
+		if err != nil {
+			return ErrProtectorNotFound
+		}
+		if flag := protector.activeFlag(time.Now()); flag == nil || *flag != models.FlagBlue {
+			return ErrProtectorUnavailable
+		}
+		if err := checkNotInPrison(ctx, tx, protectorID); err != nil {
+			return ErrProtectorUnavailable
+		}
+
+		hours, err := caravanHours(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+		fee := hourlyFee * int64(hours)
+		if err := addCaravanGuard(ctx, tx, c, &guardHire{CharacterID: &protectorID, ListingID: &listingID, Hours: hours, Fee: fee}); err != nil {
+			return err
+		}
+
+		err = s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      c.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        fee,
+			From:          CharacterAccount(c.OwnerID),
+			To:            SystemAccount(SystemGuardEscrow),
+			Reason:        "guard_contract_escrow",
+			ReferenceType: "caravan",
+			ReferenceID:   &c.ID,
+			Details:       map[string]interface{}{"protector_id": protectorID, "hours": hours},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE guard_listings SET is_available = false, total_protections = total_protections + 1, updated_at = NOW()
+			WHERE id = $1
+		`, listingID)
+		if err != nil {
+			return fmt.Errorf("failed to update listing: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getCaravan(ctx, s.db.Pool, caravanID)
+}
+
+// payProtectionBonus adds a protector's guild protection fee bonus on top of
+// the escrowed fee they were paid
+func (s *CaravanService) payProtectionBonus(ctx context.Context, tx pgx.Tx, c *models.Caravan, protectorID uuid.UUID, fee int64) error {
+	bonus, err := s.bonuses.Resolve(ctx, protectorID, models.BonusActivityCaravan)
+	if err != nil {
+		return err
+	}
+	extra := int64(float64(fee)*bonus.Multiplier(models.BonusProtectionFee)) - fee
+	if extra <= 0 {
+		return nil
+	}
+	return s.ledger.Post(ctx, tx, &Posting{
+		ServerID:      c.ServerID,
+		Currency:      models.CurrencyGold,
+		Amount:        extra,
+		From:          SystemAccount(SystemGuardBonus),
+		To:            CharacterAccount(protectorID),
+		Reason:        "guard_contract_bonus",
+		ReferenceType: "caravan",
+		ReferenceID:   &c.ID,
+		Details:       map[string]interface{}{"bonus_percent": bonus.Percentage(models.BonusProtectionFee)},
+	})
+}
+
+// settleGuards releases a finished caravan's guards. Escrowed protector fees
+// go to the protector on delivery, raised by their guild's protection fee
+// bonus, and back to the owner otherwise; NPC rent is only refunded if the
+// caravan never left.
+func (s *CaravanService) settleGuards(ctx context.Context, tx pgx.Tx, c *models.Caravan, outcome guardOutcome) error {
+	rows, err := tx.Query(ctx, `
+		SELECT id, character_id, listing_id, fee_amount FROM caravan_guards
+		WHERE caravan_id = $1 AND fee_amount > 0 AND fee_paid = false
+		FOR UPDATE
+	`, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get guard contracts: %w", err)
+	}
+	type contract struct {
+		ID          uuid.UUID
+		CharacterID *uuid.UUID
+		ListingID   *uuid.UUID
+		Fee         int64
+	}
+	var contracts []contract
+	for rows.Next() {
+		var ct contract
+		if err := rows.Scan(&ct.ID, &ct.CharacterID, &ct.ListingID, &ct.Fee); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan guard contract: %w", err)
+		}
+		contracts = append(contracts, ct)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ct := range contracts {
+		posting := &Posting{
+			ServerID:      c.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        ct.Fee,
+			ReferenceType: "caravan",
+			ReferenceID:   &c.ID,
+		}
+		switch {
+		case ct.CharacterID == nil && outcome != guardOutcomeCancelled:
+			// NPC rent has been used up
+			posting = nil
+		case ct.CharacterID == nil:
+			posting.From, posting.To, posting.Reason = SystemAccount(SystemGuardHire), CharacterAccount(c.OwnerID), "guard_hire_refund"
+		case outcome == guardOutcomeDelivered:
+			posting.From, posting.To, posting.Reason = SystemAccount(SystemGuardEscrow), CharacterAccount(*ct.CharacterID), "guard_contract_payout"
+		default:
+			posting.From, posting.To, posting.Reason = SystemAccount(SystemGuardEscrow), CharacterAccount(c.OwnerID), "guard_contract_refund"
+		}
+		if posting != nil {
+			if err := s.ledger.Post(ctx, tx, posting); err != nil {
+				return err
+			}
+		}
+		if ct.CharacterID != nil && outcome == guardOutcomeDelivered {
+			if err := s.payProtectionBonus(ctx, tx, c, *ct.CharacterID, ct.Fee); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(ctx, "UPDATE caravan_guards SET fee_paid = true WHERE id = $1", ct.ID); err != nil {
+			return fmt.Errorf("failed to settle guard contract: %w", err)
+		}
+
+		if ct.ListingID != nil {
+			delivered := 0
+			if outcome == guardOutcomeDelivered {
+				delivered = 1
+			}
+			_, err := tx.Exec(ctx, `
+				UPDATE guard_listings SET
+					is_available = true,
+					successful_protections = successful_protections + $1,
+					success_rate = ROUND((successful_protections + $1) * 100.0 / GREATEST(total_protections, 1), 2),
+					updated_at = NOW()
+				WHERE id = $2
+			`, delivered, *ct.ListingID)
+			if err != nil {
+				return fmt.Errorf("failed to update listing: %w", err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE caravan_guards SET is_active = false WHERE caravan_id = $1 AND is_active = true", c.ID); err != nil {
+		return fmt.Errorf("failed to release guards: %w", err)
+	}
+	return nil
+}
+
+const protectorListingColumns = `
+	gl.id, gl.character_id, c.name, c.level, c.class, c.is_online, gl.server_id,
+	COALESCE(gl.min_caravan_type, 1), COALESCE(gl.preferred_routes, '{}'), gl.hourly_fee, gl.available_hours,
+	gl.total_protections, gl.successful_protections, gl.success_rate,
+	gl.is_active, gl.is_available, gl.rating, gl.rating_count, gl.created_at, gl.updated_at`
+
+func scanProtectorListing(row pgx.Row) (*models.ProtectorListing, error) {
+	var l models.ProtectorListing
+	var hours []byte
+	err := row.Scan(&l.ID, &l.CharacterID, &l.CharacterName, &l.Level, &l.Class, &l.IsOnline, &l.ServerID,
+		&l.MinCaravanType, &l.PreferredRoutes, &l.HourlyFee, &hours,
+		&l.TotalProtections, &l.SuccessfulProtections, &l.SuccessRate,
+		&l.IsActive, &l.IsAvailable, &l.Rating, &l.RatingCount, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	l.AvailableHours = hours
+	return &l, nil
+}
+
+// GetMyListing returns the acting character's protector listing
+func (s *CaravanService) GetMyListing(ctx context.Context, accountID, characterID uuid.UUID) (*models.ProtectorListing, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	l, err := scanProtectorListing(s.db.Pool.QueryRow(ctx, `
+		SELECT `+protectorListingColumns+`
+		FROM guard_listings gl JOIN characters c ON c.id = gl.character_id
+		WHERE gl.character_id = $1
+	`, characterID))
+	if err != nil {
+		return nil, ErrProtectorNotFound
+	}
+	return l, nil
+}
+
+// UpsertListing publishes or updates the acting character's protector
+// listing. Only blue flag carriers may offer protection.
+func (s *CaravanService) UpsertListing(ctx context.Context, accountID, characterID uuid.UUID, req *models.UpsertProtectorListingRequest) (*models.ProtectorListing, error) {
+	if req.HourlyFee <= 0 || req.HourlyFee > MaxProtectorHourlyFee {
+		return nil, ErrInvalidHourlyFee
+	}
+	if req.MinCaravanType <= 0 {
+		req.MinCaravanType = 1
+	}
+	if req.PreferredRoutes == nil {
+		req.PreferredRoutes = []int32{}
+	}
+	var hours []byte
+	if len(req.AvailableHours) > 0 {
+		hours = req.AvailableHours
+	}
+
+	st, err := loadFlagState(ctx, s.db.Pool, characterID, false)
+	if err != nil || st.AccountID != accountID {
+		return nil, ErrCharacterNotFound
+	}
+	if flag := st.activeFlag(time.Now()); flag == nil || *flag != models.FlagBlue {
+		return nil, ErrNotBlueFlag
+	}
+
+	// Reactivating keeps availability off while a contract is running
+	_, err = s.db.Pool.Exec(ctx, `
+		INSERT INTO guard_listings (character_id, server_id, min_caravan_type, preferred_routes, hourly_fee, available_hours)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (character_id) DO UPDATE SET
+			min_caravan_type = EXCLUDED.min_caravan_type,
+			preferred_routes = EXCLUDED.preferred_routes,
+			hourly_fee = EXCLUDED.hourly_fee,
+			available_hours = EXCLUDED.available_hours,
+			is_active = true,
+			updated_at = NOW()
+	`, st.ID, st.ServerID, req.MinCaravanType, req.PreferredRoutes, req.HourlyFee, hours)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save protector listing: %w", err)
+	}
+	return s.GetMyListing(ctx, accountID, characterID)
+}
+
+// DeactivateListing takes the acting character off the protector board.
+// Running contracts are unaffected.
+func (s *CaravanService) DeactivateListing(ctx context.Context, accountID, characterID uuid.UUID) error {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return err
+	}
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE guard_listings SET is_active = false, updated_at = NOW()
+		WHERE character_id = $1 AND is_active = true
+	`, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate listing: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrProtectorNotFound
+	}
+	return nil
+}
+
+// SearchProtectors browses available blue flag protectors on the acting
+// character's server, best rated first.
+func (s *CaravanService) SearchProtectors(ctx context.Context, accountID, characterID uuid.UUID, filter *models.ProtectorSearchFilter) ([]*models.ProtectorListing, error) {
+	me, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + protectorListingColumns + `
+		FROM guard_listings gl JOIN characters c ON c.id = gl.character_id
+		WHERE gl.server_id = $1 AND gl.is_active = true AND gl.is_available = true
+		  AND c.deleted_at IS NULL AND c.flag = 'blue' AND gl.character_id <> $2`
+	args := []interface{}{me.ServerID, me.ID}
+	argIndex := 3
+
+	if filter.RouteID != nil {
+		query += fmt.Sprintf(" AND (COALESCE(cardinality(gl.preferred_routes), 0) = 0 OR $%d = ANY(gl.preferred_routes))", argIndex)
+		args = append(args, *filter.RouteID)
+		argIndex++
+	}
+	if filter.CaravanTypeID != nil {
+		query += fmt.Sprintf(" AND COALESCE(gl.min_caravan_type, 1) <= $%d", argIndex)
+		args = append(args, *filter.CaravanTypeID)
+		argIndex++
+	}
+	if filter.MaxFee != nil {
+		query += fmt.Sprintf(" AND gl.hourly_fee <= $%d", argIndex)
+		args = append(args, *filter.MaxFee)
+		argIndex++
+	}
+
+	query += fmt.Sprintf(" ORDER BY gl.rating DESC, gl.success_rate DESC, gl.hourly_fee LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search protectors: %w", err)
+	}
+	defer rows.Close()
+
+	var listings []*models.ProtectorListing
+	for rows.Next() {
+		l, err := scanProtectorListing(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan protector listing: %w", err)
+		}
+		listings = append(listings, l)
+	}
+	return listings, rows.Err()
+}
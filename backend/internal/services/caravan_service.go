@@ -0,0 +1,605 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrCaravanTypeNotFound  = errors.New("caravan type not found")
+	ErrCaravanRouteNotFound = errors.New("caravan route not found")
+	ErrCaravanLevelTooLow   = errors.New("level too low for this caravan")
+	ErrCaravanActive        = errors.New("you already have an active caravan")
+	ErrCaravanNotFound      = errors.New("caravan not found")
+	ErrCaravanNotPreparing  = errors.New("caravan has already departed")
+	ErrCaravanNotTraveling  = errors.New("caravan is not traveling")
+)
+
+const (
+	CaravanInsurancePercent       = 10 // of the investment, paid up front
+	CaravanInsuranceRefundPercent = 50 // of the investment, returned if the caravan is lost
+	CaravanPrepareTimeout         = 30 * time.Minute
+	CaravanSweepBatchSize         = 100
+)
+
+// System ledger accounts for caravans
+const (
+	SystemCaravanInvestment = "caravan_investment"
+	SystemCaravanReward     = "caravan_reward"
+	SystemCaravanInsurance  = "caravan_insurance"
+)
+
+type CaravanService struct {
+	db      *database.DB
+	ledger  *LedgerService
+	karma   *KarmaService
+	tax     *TaxService
+	guilds  *GuildService
+	bonuses *GuildBonusService
+}
+
+func NewCaravanService(db *database.DB, ledger *LedgerService, karma *KarmaService, tax *TaxService, guilds *GuildService, bonuses *GuildBonusService) *CaravanService {
+	return &CaravanService{db: db, ledger: ledger, karma: karma, tax: tax, guilds: guilds, bonuses: bonuses}
+}
+
+const caravanColumns = `
+	cv.id, cv.server_id, cv.owner_id, owner.name, cv.caravan_type_id, ct.name,
+	cv.route_id, cr.name, cr.danger_level, cv.status, cv.current_hp, cv.max_hp, ct.max_guards, ct.base_defense,
+	cv.current_map_id, cv.investment, cv.expected_reward, cv.payout, cv.is_insured, cv.insurance_cost,
+	cv.duration_seconds, cv.paused_seconds, cv.started_at, cv.estimated_arrival, cv.completed_at,
+	cv.last_attack_at, cv.failure_reason, cv.created_at`
+
+const caravanJoins = `
+	FROM caravans cv
+	JOIN characters owner ON owner.id = cv.owner_id
+	JOIN caravan_types ct ON ct.id = cv.caravan_type_id
+	JOIN caravan_routes cr ON cr.id = cv.route_id`
+
+// activeCaravanStatuses are the states in which a caravan is still on the map
+const activeCaravanStatuses = `('preparing', 'traveling', 'under_attack')`
+
+func scanCaravan(row pgx.Row) (*models.Caravan, error) {
+	var c models.Caravan
+	err := row.Scan(
+		&c.ID, &c.ServerID, &c.OwnerID, &c.OwnerName, &c.CaravanTypeID, &c.CaravanTypeName,
+		&c.RouteID, &c.RouteName, &c.DangerLevel, &c.Status, &c.CurrentHP, &c.MaxHP, &c.MaxGuards, &c.BaseDefense,
+		&c.CurrentMapID, &c.Investment, &c.ExpectedReward, &c.Payout, &c.IsInsured, &c.InsuranceCost,
+		&c.DurationSeconds, &c.PausedSeconds, &c.StartedAt, &c.EstimatedArrival, &c.CompletedAt,
+		&c.LastAttackAt, &c.FailureReason, &c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.ProgressPercent = caravanProgress(&c, time.Now())
+	if c.Status == models.CaravanUnderAttack && c.LastAttackAt != nil {
+		end := c.LastAttackAt.Add(CaravanAttackDuration)
+		c.AttackEndsAt = &end
+	}
+	return &c, nil
+}
+
+// caravanProgress derives travel progress from server time. Time spent under
+// attack does not count, so progress freezes at the moment the attack began.
+func caravanProgress(c *models.Caravan, now time.Time) float64 {
+	switch c.Status {
+	case models.CaravanCompleted:
+		return 100
+	case models.CaravanPreparing:
+		return 0
+	}
+	if c.StartedAt == nil || c.DurationSeconds == nil || *c.DurationSeconds <= 0 {
+		return 0
+	}
+
+	until := now
+	if c.Status == models.CaravanUnderAttack && c.LastAttackAt != nil {
+		until = *c.LastAttackAt
+	} else if c.CompletedAt != nil {
+		until = *c.CompletedAt
+	}
+
+	elapsed := until.Sub(*c.StartedAt).Seconds() - float64(c.PausedSeconds)
+	progress := elapsed / float64(*c.DurationSeconds) * 100
+	return math.Round(math.Max(0, math.Min(100, progress))*100) / 100
+}
+
+func getCaravan(ctx context.Context, q querier, caravanID uuid.UUID) (*models.Caravan, error) {
+	c, err := scanCaravan(q.QueryRow(ctx, "SELECT "+caravanColumns+caravanJoins+" WHERE cv.id = $1", caravanID))
+	if err != nil {
+		return nil, ErrCaravanNotFound
+	}
+	return c, nil
+}
+
+func lockCaravan(ctx context.Context, tx pgx.Tx, caravanID uuid.UUID) (*models.Caravan, error) {
+	c, err := scanCaravan(tx.QueryRow(ctx, "SELECT "+caravanColumns+caravanJoins+" WHERE cv.id = $1 FOR UPDATE OF cv", caravanID))
+	if err != nil {
+		return nil, ErrCaravanNotFound
+	}
+	return c, nil
+}
+
+func (s *CaravanService) GetTypes(ctx context.Context) ([]*models.CaravanType, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, name, investment_cost, success_reward, profit_percentage, base_hp, base_defense, max_guards, min_level, icon
+		FROM caravan_types ORDER BY investment_cost
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caravan types: %w", err)
+	}
+	defer rows.Close()
+
+	var types []*models.CaravanType
+	for rows.Next() {
+		var t models.CaravanType
+		if err := rows.Scan(&t.ID, &t.Name, &t.InvestmentCost, &t.SuccessReward, &t.ProfitPercentage,
+			&t.BaseHP, &t.BaseDefense, &t.MaxGuards, &t.MinLevel, &t.Icon); err != nil {
+			return nil, fmt.Errorf("failed to scan caravan type: %w", err)
+		}
+		types = append(types, &t)
+	}
+	return types, rows.Err()
+}
+
+func (s *CaravanService) GetRoutes(ctx context.Context) ([]*models.CaravanRoute, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, name, start_map_id, end_map_id, min_level, base_duration_minutes, danger_level, profit_multiplier
+		FROM caravan_routes WHERE is_active = true ORDER BY danger_level, id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caravan routes: %w", err)
+	}
+	defer rows.Close()
+
+	var routes []*models.CaravanRoute
+	for rows.Next() {
+		var r models.CaravanRoute
+		if err := rows.Scan(&r.ID, &r.Name, &r.StartMapID, &r.EndMapID, &r.MinLevel,
+			&r.BaseDurationMinutes, &r.DangerLevel, &r.ProfitMultiplier); err != nil {
+			return nil, fmt.Errorf("failed to scan caravan route: %w", err)
+		}
+		routes = append(routes, &r)
+	}
+	return routes, rows.Err()
+}
+
+// Create pays the investment (and insurance) and puts a caravan into the
+// preparing state, where guards can be hired before departure.
+func (s *CaravanService) Create(ctx context.Context, accountID, characterID uuid.UUID, req *models.CreateCaravanRequest) (*models.Caravan, error) {
+	var caravanID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		owner, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+
+		var t models.CaravanType
+		err = tx.QueryRow(ctx, `
+			SELECT id, investment_cost, success_reward, base_hp, min_level FROM caravan_types WHERE id = $1
+		`, req.CaravanTypeID).Scan(&t.ID, &t.InvestmentCost, &t.SuccessReward, &t.BaseHP, &t.MinLevel)
+		if err != nil {
+			return ErrCaravanTypeNotFound
+		}
+
+		var r models.CaravanRoute
+		err = tx.QueryRow(ctx, `
+			SELECT id, start_map_id, min_level, profit_multiplier FROM caravan_routes WHERE id = $1 AND is_active = true
+		`, req.RouteID).Scan(&r.ID, &r.StartMapID, &r.MinLevel, &r.ProfitMultiplier)
+		if err != nil {
+			return ErrCaravanRouteNotFound
+		}
+
+		if owner.Level < t.MinLevel || owner.Level < r.MinLevel {
+			return ErrCaravanLevelTooLow
+		}
+
+		var active bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM caravans WHERE owner_id = $1 AND status IN `+activeCaravanStatuses+`)
+		`, owner.ID).Scan(&active)
+		if err != nil {
+			return fmt.Errorf("failed to check active caravans: %w", err)
+		}
+		if active {
+			return ErrCaravanActive
+		}
+
+		caravanID = uuid.New()
+		err = s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      owner.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        t.InvestmentCost,
+			From:          CharacterAccount(owner.ID),
+			To:            SystemAccount(SystemCaravanInvestment),
+			Reason:        "caravan_investment",
+			ReferenceType: "caravan",
+			ReferenceID:   &caravanID,
+		})
+		if err != nil {
+			return err
+		}
+
+		var insuranceCost int64
+		if req.Insured {
+			insuranceCost = percentOf(t.InvestmentCost, CaravanInsurancePercent)
+			err = s.ledger.Post(ctx, tx, &Posting{
+				ServerID:      owner.ServerID,
+				Currency:      models.CurrencyGold,
+				Amount:        insuranceCost,
+				From:          CharacterAccount(owner.ID),
+				To:            SystemAccount(SystemCaravanInsurance),
+				Reason:        "caravan_insurance",
+				ReferenceType: "caravan",
+				ReferenceID:   &caravanID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		reward := int64(math.Round(float64(t.SuccessReward) * r.ProfitMultiplier))
+		_, err = tx.Exec(ctx, `
+			INSERT INTO caravans (
+				id, server_id, owner_id, caravan_type_id, route_id, status,
+				current_hp, max_hp, current_map_id, investment, expected_reward, is_insured, insurance_cost
+			) VALUES ($1, $2, $3, $4, $5, 'preparing', $6, $6, $7, $8, $9, $10, $11)
+		`, caravanID, owner.ServerID, owner.ID, t.ID, r.ID, t.BaseHP, r.StartMapID,
+			t.InvestmentCost, reward, req.Insured, insuranceCost)
+		if err != nil {
+			return fmt.Errorf("failed to create caravan: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getCaravan(ctx, s.db.Pool, caravanID)
+}
+
+// lockOwnedCaravan locks a caravan and checks the acting character owns it
+func lockOwnedCaravan(ctx context.Context, tx pgx.Tx, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error) {
+	if _, err := getOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+		return nil, err
+	}
+	c, err := lockCaravan(ctx, tx, caravanID)
+	if err != nil {
+		return nil, err
+	}
+	if c.OwnerID != characterID {
+		return nil, ErrCaravanNotFound
+	}
+	return c, nil
+}
+
+// Depart starts the journey. Duration comes from the route and is fixed from
+// here on; the client only ever reads the derived progress.
+func (s *CaravanService) Depart(ctx context.Context, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCaravan(ctx, tx, accountID, characterID, caravanID)
+		if err != nil {
+			return err
+		}
+		if c.Status != models.CaravanPreparing {
+			return ErrCaravanNotPreparing
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE caravans cv SET
+				status = 'traveling',
+				started_at = NOW(),
+				duration_seconds = cr.base_duration_minutes * 60,
+				estimated_arrival = NOW() + make_interval(mins => cr.base_duration_minutes)
+			FROM caravan_routes cr
+			WHERE cr.id = cv.route_id AND cv.id = $1
+		`, c.ID)
+		if err != nil {
+			return fmt.Errorf("failed to depart caravan: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getCaravan(ctx, s.db.Pool, caravanID)
+}
+
+// Abandon gives up on a caravan. Before departure the investment is refunded;
+// once on the road it is lost and insurance does not cover it.
+func (s *CaravanService) Abandon(ctx context.Context, accountID, characterID, caravanID uuid.UUID) (*models.Caravan, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCaravan(ctx, tx, accountID, characterID, caravanID)
+		if err != nil {
+			return err
+		}
+
+		switch c.Status {
+		case models.CaravanPreparing:
+			return s.cancelPreparing(ctx, tx, c, "cancelled")
+		case models.CaravanTraveling:
+			return s.closeCaravan(ctx, tx, c, models.CaravanFailed, "abandoned", false)
+		}
+		return ErrCaravanNotTraveling
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getCaravan(ctx, s.db.Pool, caravanID)
+}
+
+// cancelPreparing closes a caravan that never left and refunds what was paid
+func (s *CaravanService) cancelPreparing(ctx context.Context, tx pgx.Tx, c *models.Caravan, reason string) error {
+	refunds := []struct {
+		from   string
+		amount int64
+	}{
+		{SystemCaravanInvestment, c.Investment},
+		{SystemCaravanInsurance, c.InsuranceCost},
+	}
+	for _, refund := range refunds {
+		if refund.amount == 0 {
+			continue
+		}
+		err := s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      c.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        refund.amount,
+			From:          SystemAccount(refund.from),
+			To:            CharacterAccount(c.OwnerID),
+			Reason:        "caravan_refund",
+			ReferenceType: "caravan",
+			ReferenceID:   &c.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.closeCaravan(ctx, tx, c, models.CaravanFailed, reason, false)
+}
+
+// closeCaravan ends a caravan that did not arrive. Insured caravans that were
+// lost to the road (not abandoned) refund part of the investment.
+func (s *CaravanService) closeCaravan(ctx context.Context, tx pgx.Tx, c *models.Caravan, status models.CaravanStatus, reason string, insuredLoss bool) error {
+	if insuredLoss && c.IsInsured {
+		err := s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      c.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        percentOf(c.Investment, CaravanInsuranceRefundPercent),
+			From:          SystemAccount(SystemCaravanInsurance),
+			To:            CharacterAccount(c.OwnerID),
+			Reason:        "caravan_insurance_payout",
+			ReferenceType: "caravan",
+			ReferenceID:   &c.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	outcome := guardOutcomeLost
+	if c.Status == models.CaravanPreparing {
+		outcome = guardOutcomeCancelled
+	}
+	if err := s.settleGuards(ctx, tx, c, outcome); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE caravans SET status = $1, failure_reason = $2, under_attack = false, completed_at = NOW()
+		WHERE id = $3
+	`, status, reason, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to close caravan: %w", err)
+	}
+	// Caravans that never left do not count as lost
+	if c.Status != models.CaravanPreparing {
+		if _, err := tx.Exec(ctx, "UPDATE characters SET caravans_lost = caravans_lost + 1 WHERE id = $1", c.OwnerID); err != nil {
+			return fmt.Errorf("failed to update caravan stats: %w", err)
+		}
+	}
+	c.Status = status
+	return nil
+}
+
+// completeCaravan pays out a caravan that reached its destination. The
+// owner's guild bonus adds to the expected reward.
+func (s *CaravanService) completeCaravan(ctx context.Context, tx pgx.Tx, c *models.Caravan) error {
+	bonus, err := s.bonuses.Resolve(ctx, c.OwnerID, models.BonusActivityCaravan)
+	if err != nil {
+		return err
+	}
+	payout := int64(float64(c.ExpectedReward) * bonus.Multiplier(models.BonusCaravanProfit))
+
+	err = s.ledger.Post(ctx, tx, &Posting{
+		ServerID:      c.ServerID,
+		Currency:      models.CurrencyGold,
+		Amount:        payout,
+		From:          SystemAccount(SystemCaravanReward),
+		To:            CharacterAccount(c.OwnerID),
+		Reason:        "caravan_reward",
+		ReferenceType: "caravan",
+		ReferenceID:   &c.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Caravans pay passage to whoever controls the route where they arrive
+	var endMapID int
+	if err := tx.QueryRow(ctx, "SELECT end_map_id FROM caravan_routes WHERE id = $1", c.RouteID).Scan(&endMapID); err != nil {
+		return fmt.Errorf("failed to get caravan route: %w", err)
+	}
+	_, err = s.tax.Levy(ctx, tx, &TaxableIncome{
+		ServerID:      c.ServerID,
+		CharacterID:   c.OwnerID,
+		Activity:      models.TaxCaravan,
+		Amount:        payout,
+		MapID:         endMapID,
+		ZoneType:      ZoneTypeCaravanRoute,
+		ReferenceType: "caravan",
+		ReferenceID:   &c.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE caravans cv SET status = 'completed', payout = $1, completed_at = NOW(),
+			progress_percent = 100, current_map_id = cr.end_map_id
+		FROM caravan_routes cr
+		WHERE cr.id = cv.route_id AND cv.id = $2
+	`, payout, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to complete caravan: %w", err)
+	}
+	if err := s.settleGuards(ctx, tx, c, guardOutcomeDelivered); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE characters SET caravans_completed = caravans_completed + 1 WHERE id = $1", c.OwnerID); err != nil {
+		return fmt.Errorf("failed to update caravan stats: %w", err)
+	}
+	c.Status, c.Payout = models.CaravanCompleted, &payout
+	return s.guilds.RecordActivity(ctx, tx, c.OwnerID, models.GuildActivityCaravans, 1)
+}
+
+// attackDue reports whether an engagement on the caravan is ready to resolve
+func attackDue(c *models.Caravan) bool {
+	return c.Status == models.CaravanUnderAttack && c.AttackEndsAt != nil && !c.AttackEndsAt.After(time.Now())
+}
+
+// arrivalDue reports whether a traveling caravan has reached its destination
+func arrivalDue(c *models.Caravan) bool {
+	return c.Status == models.CaravanTraveling && c.ProgressPercent >= 100
+}
+
+// settle resolves a finished attack or pays out an arrived caravan.
+// It is safe to call repeatedly.
+func (s *CaravanService) settle(ctx context.Context, tx pgx.Tx, c *models.Caravan) error {
+	switch {
+	case attackDue(c):
+		return s.resolveAttack(ctx, tx, c)
+	case arrivalDue(c):
+		return s.completeCaravan(ctx, tx, c)
+	}
+	return nil
+}
+
+// Get returns a caravan, settling it first if it has arrived or an attack
+// on it has run its course
+func (s *CaravanService) Get(ctx context.Context, caravanID uuid.UUID) (*models.Caravan, error) {
+	c, err := getCaravan(ctx, s.db.Pool, caravanID)
+	if err != nil {
+		return nil, err
+	}
+	if attackDue(c) || arrivalDue(c) {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			c, err := lockCaravan(ctx, tx, caravanID)
+			if err != nil {
+				return err
+			}
+			return s.settle(ctx, tx, c)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return getCaravan(ctx, s.db.Pool, caravanID)
+	}
+	return c, nil
+}
+
+// ListMine returns the acting character's caravans, newest first
+func (s *CaravanService) ListMine(ctx context.Context, accountID, characterID uuid.UUID, limit, offset int) ([]*models.Caravan, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	return s.list(ctx, " WHERE cv.owner_id = $1 ORDER BY cv.created_at DESC LIMIT $2 OFFSET $3", characterID, limit, offset)
+}
+
+// ListActive returns caravans on the road on the acting character's server,
+// optionally filtered to one route.
+func (s *CaravanService) ListActive(ctx context.Context, accountID, characterID uuid.UUID, routeID *int, limit, offset int) ([]*models.Caravan, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	return s.list(ctx, `
+		WHERE cv.server_id = $1 AND cv.status IN ('traveling', 'under_attack')
+		  AND ($2::int IS NULL OR cv.route_id = $2)
+		ORDER BY cv.estimated_arrival
+		LIMIT $3 OFFSET $4`, c.ServerID, routeID, limit, offset)
+}
+
+func (s *CaravanService) list(ctx context.Context, where string, args ...interface{}) ([]*models.Caravan, error) {
+	rows, err := s.db.Pool.Query(ctx, "SELECT "+caravanColumns+caravanJoins+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caravans: %w", err)
+	}
+	defer rows.Close()
+
+	var caravans []*models.Caravan
+	for rows.Next() {
+		c, err := scanCaravan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan caravan: %w", err)
+		}
+		caravans = append(caravans, c)
+	}
+	return caravans, rows.Err()
+}
+
+// ProcessCaravans resolves finished attacks, pays out caravans that have
+// arrived and refunds ones left preparing too long. It returns how many
+// caravans were settled.
+func (s *CaravanService) ProcessCaravans(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM caravans
+		WHERE (status = 'traveling' AND estimated_arrival <= NOW())
+		   OR (status = 'under_attack' AND last_attack_at <= $1)
+		   OR (status = 'preparing' AND created_at <= $2)
+		ORDER BY created_at
+		LIMIT $3
+	`, time.Now().Add(-CaravanAttackDuration), time.Now().Add(-CaravanPrepareTimeout), CaravanSweepBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due caravans: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan due caravans: %w", err)
+	}
+
+	settled := 0
+	for _, id := range ids {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			c, err := lockCaravan(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			switch {
+			case attackDue(c) || arrivalDue(c):
+				settled++
+				return s.settle(ctx, tx, c)
+			case c.Status == models.CaravanPreparing && time.Since(c.CreatedAt) >= CaravanPrepareTimeout:
+				settled++
+				return s.cancelPreparing(ctx, tx, c, "expired")
+			}
+			return nil
+		})
+		if err != nil {
+			return settled, fmt.Errorf("failed to process caravan %s: %w", id, err)
+		}
+	}
+	return settled, nil
+}
+
+// RunSweeper processes due caravans every interval until ctx is cancelled
+func (s *CaravanService) RunSweeper(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "caravan sweeper", interval, s.ProcessCaravans)
+}
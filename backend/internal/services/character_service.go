@@ -11,6 +11,7 @@ import (
 	"realm-of-conquest/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 var (
@@ -19,17 +20,21 @@ var (
 	ErrInvalidClass         = errors.New("invalid class")
 	ErrMaxCharacters        = errors.New("maximum characters reached")
 	ErrCharacterNotFound    = errors.New("character not found")
+	ErrInvalidServer        = errors.New("server is not open for new characters")
 )
 
 const MaxCharactersPerAccount = 5
 const DefaultServerID = 1
+const DefaultMapID = 1 // Starting map
+const StartingGold = 1000
 
 type CharacterService struct {
-	db *database.DB
+	db     *database.DB
+	ledger *LedgerService
 }
 
-func NewCharacterService(db *database.DB) *CharacterService {
-	return &CharacterService{db: db}
+func NewCharacterService(db *database.DB, ledger *LedgerService) *CharacterService {
+	return &CharacterService{db: db, ledger: ledger}
 }
 
 func (s *CharacterService) Create(ctx context.Context, accountID uuid.UUID, req *models.CreateCharacterRequest) (*models.Character, error) {
@@ -76,11 +81,27 @@ func (s *CharacterService) Create(ctx context.Context, accountID uuid.UUID, req
 		gender = "male"
 	}
 
+	serverID := req.ServerID
+	if serverID == 0 {
+		serverID = DefaultServerID
+	}
+	var open bool
+	err = s.db.Pool.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM servers WHERE id = $1 AND is_active)",
+		serverID,
+	).Scan(&open)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check server: %w", err)
+	}
+	if !open {
+		return nil, ErrInvalidServer
+	}
+
 	// Create character with DB column names
 	character := &models.Character{
 		ID:         uuid.New(),
 		AccountID:  accountID,
-		ServerID:   DefaultServerID,
+		ServerID:   serverID,
 		Name:       req.Name,
 		Class:      req.Class,
 		Gender:     gender,
@@ -101,44 +122,59 @@ func (s *CharacterService) Create(ctx context.Context, accountID uuid.UUID, req
 		INT:        0,
 		VIT:        0,
 		WIS:        0,
-		MapID:      1, // Default starting map
+		MapID:      DefaultMapID,
 		PositionX:  100,
 		PositionY:  100,
-		Gold:       1000, // Starting gold
+		Gold:       StartingGold,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
 
-	// Insert with correct DB column names
-	_, err = s.db.Pool.Exec(ctx, `
-		INSERT INTO characters (
-			id, account_id, server_id, name, class, gender,
-			level, exp, cap_level,
-			current_hp, max_hp, current_mp, max_mp,
-			total_attack, total_defense, total_speed, total_crit_rate,
-			stat_points, str_points, agi_points, int_points, vit_points, wis_points,
-			current_map_id, position_x, position_y, gold,
-			created_at, updated_at
-		) VALUES (
-			$1, $2, $3, $4, $5, $6,
-			$7, $8, $9,
-			$10, $11, $12, $13,
-			$14, $15, $16, $17,
-			$18, $19, $20, $21, $22, $23,
-			$24, $25, $26, $27,
-			$28, $29
+	// Insert with correct DB column names. Gold starts at zero and the
+	// starting amount is credited through the ledger.
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO characters (
+				id, account_id, server_id, name, class, gender,
+				level, exp, cap_level,
+				current_hp, max_hp, current_mp, max_mp,
+				total_attack, total_defense, total_speed, total_crit_rate,
+				stat_points, str_points, agi_points, int_points, vit_points, wis_points,
+				current_map_id, position_x, position_y, gold,
+				created_at, updated_at
+			) VALUES (
+				$1, $2, $3, $4, $5, $6,
+				$7, $8, $9,
+				$10, $11, $12, $13,
+				$14, $15, $16, $17,
+				$18, $19, $20, $21, $22, $23,
+				$24, $25, $26, $27,
+				$28, $29
+			)
+		`,
+			character.ID, character.AccountID, character.ServerID, character.Name, character.Class, character.Gender,
+			character.Level, character.Experience, character.Cap,
+			character.HP, character.MaxHP, character.MP, character.MaxMP,
+			character.Attack, character.Defense, character.Speed, character.CritRate,
+			character.StatPoints, character.STR, character.AGI, character.INT, character.VIT, character.WIS,
+			character.MapID, character.PositionX, character.PositionY, 0,
+			character.CreatedAt, character.UpdatedAt,
 		)
-	`,
-		character.ID, character.AccountID, character.ServerID, character.Name, character.Class, character.Gender,
-		character.Level, character.Experience, character.Cap,
-		character.HP, character.MaxHP, character.MP, character.MaxMP,
-		character.Attack, character.Defense, character.Speed, character.CritRate,
-		character.StatPoints, character.STR, character.AGI, character.INT, character.VIT, character.WIS,
-		character.MapID, character.PositionX, character.PositionY, character.Gold,
-		character.CreatedAt, character.UpdatedAt,
-	)
+		if err != nil {
+			return fmt.Errorf("failed to create character: %w", err)
+		}
+
+		return s.ledger.Post(ctx, tx, &Posting{
+			ServerID: character.ServerID,
+			Currency: models.CurrencyGold,
+			Amount:   character.Gold,
+			From:     SystemAccount(SystemStartingGold),
+			To:       CharacterAccount(character.ID),
+			Reason:   "starting_gold",
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create character: %w", err)
+		return nil, err
 	}
 
 	return character, nil
@@ -152,6 +188,7 @@ func (s *CharacterService) GetByAccountID(ctx context.Context, accountID uuid.UU
 		       total_attack, total_defense, total_speed, total_crit_rate,
 		       stat_points, str_points, agi_points, int_points, vit_points, wis_points,
 		       current_map_id, position_x, position_y, gold, premium_currency,
+		       COALESCE(karma, 0), COALESCE(infamy, 0),
 		       is_online, created_at, updated_at
 		FROM characters
 		WHERE account_id = $1 AND deleted_at IS NULL
@@ -173,6 +210,7 @@ func (s *CharacterService) GetByAccountID(ctx context.Context, accountID uuid.UU
 			&c.Attack, &c.Defense, &c.Speed, &c.CritRate,
 			&c.StatPoints, &c.STR, &c.AGI, &c.INT, &c.VIT, &c.WIS,
 			&mapID, &c.PositionX, &c.PositionY, &c.Gold, &c.PremiumGems,
+			&c.Karma, &c.Infamy,
 			&c.IsOnline, &c.CreatedAt, &c.UpdatedAt,
 		)
 		if err != nil {
@@ -181,6 +219,7 @@ func (s *CharacterService) GetByAccountID(ctx context.Context, accountID uuid.UU
 		if mapID != nil {
 			c.MapID = *mapID
 		}
+		c.IsWanted = c.Infamy >= models.WantedInfamy
 		characters = append(characters, &c)
 	}
 
@@ -197,6 +236,7 @@ func (s *CharacterService) GetByID(ctx context.Context, characterID uuid.UUID) (
 		       total_attack, total_defense, total_speed, total_crit_rate,
 		       stat_points, str_points, agi_points, int_points, vit_points, wis_points,
 		       current_map_id, position_x, position_y, gold, premium_currency,
+		       COALESCE(karma, 0), COALESCE(infamy, 0),
 		       is_online, created_at, updated_at
 		FROM characters
 		WHERE id = $1 AND deleted_at IS NULL
@@ -207,6 +247,7 @@ func (s *CharacterService) GetByID(ctx context.Context, characterID uuid.UUID) (
 		&c.Attack, &c.Defense, &c.Speed, &c.CritRate,
 		&c.StatPoints, &c.STR, &c.AGI, &c.INT, &c.VIT, &c.WIS,
 		&mapID, &c.PositionX, &c.PositionY, &c.Gold, &c.PremiumGems,
+		&c.Karma, &c.Infamy,
 		&c.IsOnline, &c.CreatedAt, &c.UpdatedAt,
 	)
 	if err != nil {
@@ -215,6 +256,7 @@ func (s *CharacterService) GetByID(ctx context.Context, characterID uuid.UUID) (
 	if mapID != nil {
 		c.MapID = *mapID
 	}
+	c.IsWanted = c.Infamy >= models.WantedInfamy
 	return &c, nil
 }
 
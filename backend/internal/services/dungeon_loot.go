@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Personal loot (5.4). Every participant rolls a fallen boss's loot table
+// on their own. A party of all five classes gets DungeonLootTeamBonus
+// percent more loot chance, and DungeonLootSpecializationBonus more on top
+// when no two members share a specialization.
+const (
+	DungeonLootTeamBonus           = 20
+	DungeonLootSpecializationBonus = 10
+	// DungeonGuaranteedRarity is the least every boss drops to each member
+	DungeonGuaranteedRarity = "rare"
+)
+
+// lootEntry is a loot table entry with its drop chance multiplier at the
+// instance's difficulty
+type lootEntry struct {
+	ID         int
+	ItemID     int
+	ItemName   string
+	Rarity     string
+	DropChance float64
+	MinQty     int
+	MaxQty     int
+	Multiplier float64
+}
+
+// lootEntries returns the entries of a loot table that can drop at a
+// difficulty, leaving out items below its rarity floor
+func lootEntries(ctx context.Context, q querier, lootTableID int, difficulty models.DungeonDifficulty) ([]*lootEntry, error) {
+	rows, err := q.Query(ctx, `
+		SELECT e.id, e.item_definition_id, i.name, COALESCE(i.rarity, 'common')::text, e.drop_chance::float8,
+		       COALESCE(e.min_quantity, 1), COALESCE(e.max_quantity, 1),
+		       COALESCE(CASE $2
+		           WHEN 'hard' THEN e.hard_multiplier
+		           WHEN 'nightmare' THEN e.nightmare_multiplier
+		           WHEN 'hell' THEN e.hell_multiplier
+		           ELSE e.normal_multiplier
+		       END, 1)::float8
+		FROM loot_table_entries e
+		JOIN item_definitions i ON i.id = e.item_definition_id
+		WHERE e.loot_table_id = $1
+		ORDER BY e.id
+	`, lootTableID, difficulty)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get loot table: %w", err)
+	}
+	defer rows.Close()
+
+	floor := rarityOrder[models.DifficultyModifiers[difficulty].MinRarity]
+	var entries []*lootEntry
+	for rows.Next() {
+		var e lootEntry
+		if err := rows.Scan(&e.ID, &e.ItemID, &e.ItemName, &e.Rarity, &e.DropChance,
+			&e.MinQty, &e.MaxQty, &e.Multiplier); err != nil {
+			return nil, fmt.Errorf("failed to scan loot table entry: %w", err)
+		}
+		if rarityOrder[e.Rarity] >= floor {
+			entries = append(entries, &e)
+		}
+	}
+	return entries, rows.Err()
+}
+
+// partyLootBonus returns the team and specialization loot chance bonuses
+// of a party in percent
+func partyLootBonus(party []*models.DungeonParticipant) (float64, float64) {
+	classes := make(map[models.CharacterClass]bool, len(party))
+	for _, p := range party {
+		classes[p.Class] = true
+	}
+	for _, class := range models.DungeonClasses {
+		if !classes[class] {
+			return 0, 0
+		}
+	}
+
+	specs := make(map[models.Specialization]bool, len(party))
+	for _, p := range party {
+		if p.Specialization == nil || specs[*p.Specialization] {
+			return DungeonLootTeamBonus, 0
+		}
+		specs[*p.Specialization] = true
+	}
+	return DungeonLootTeamBonus, DungeonLootSpecializationBonus
+}
+
+// guaranteedEntry picks the guaranteed drop among entries of at least
+// DungeonGuaranteedRarity, weighted by their drop chance. It returns nil
+// when the table has none.
+func guaranteedEntry(entries []*lootEntry) *lootEntry {
+	var candidates []*lootEntry
+	total := 0.0
+	for _, e := range entries {
+		if isRareOrBetter(e.Rarity) {
+			candidates = append(candidates, e)
+			total += e.DropChance * e.Multiplier
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	pick := rand.Float64() * total
+	for _, e := range candidates {
+		pick -= e.DropChance * e.Multiplier
+		if pick < 0 {
+			return e
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+func lootQuantity(e *lootEntry) int {
+	if e.MaxQty <= e.MinQty {
+		return max(1, e.MinQty)
+	}
+	return e.MinQty + rand.Intn(e.MaxQty-e.MinQty+1)
+}
+
+// rollBossLoot rolls a fallen boss's loot for every member still in a
+// locked instance, delivers what they win and records each roll. Members
+// who won nothing rare get the guaranteed drop. It returns the won loot by
+// character.
+func (s *DungeonService) rollBossLoot(ctx context.Context, tx pgx.Tx, inst *models.DungeonInstance, boss *models.DungeonBoss, party []*models.DungeonParticipant) (map[uuid.UUID][]*models.DungeonLoot, error) {
+	won := make(map[uuid.UUID][]*models.DungeonLoot, len(party))
+	if boss.LootTableID == nil {
+		return won, nil
+	}
+	entries, err := lootEntries(ctx, tx, *boss.LootTableID, inst.Difficulty)
+	if err != nil {
+		return nil, err
+	}
+	teamBonus, specBonus := partyLootBonus(party)
+
+	for _, p := range party {
+		bonus, err := s.bonuses.Resolve(ctx, p.CharacterID, models.BonusActivityDungeon)
+		if err != nil {
+			return nil, err
+		}
+		base := models.DungeonLoot{
+			BossID:              boss.ID,
+			BossName:            boss.Name,
+			Difficulty:          inst.Difficulty,
+			TeamBonus:           teamBonus,
+			SpecializationBonus: specBonus,
+			GuildBonus:          bonus.Percentage(models.BonusLootChance),
+		}
+		multiplier := 1 + (base.TeamBonus+base.SpecializationBonus+base.GuildBonus)/100
+
+		gotRare := false
+		for _, e := range entries {
+			l := base
+			l.BaseChance = e.DropChance
+			l.Chance = math.Min(100, math.Round(e.DropChance*e.Multiplier*multiplier*1000)/1000)
+			l.Roll = math.Round(rand.Float64()*100*1000) / 1000
+			l.Won = l.Roll < l.Chance
+			if l.Won {
+				l.Quantity = lootQuantity(e)
+				gotRare = gotRare || isRareOrBetter(e.Rarity)
+			}
+			if err := s.awardLoot(ctx, tx, inst, p.CharacterID, *boss.LootTableID, e, &l); err != nil {
+				return nil, err
+			}
+			if l.Won {
+				won[p.CharacterID] = append(won[p.CharacterID], &l)
+			}
+		}
+
+		if !gotRare {
+			if e := guaranteedEntry(entries); e != nil {
+				l := base
+				l.BaseChance, l.Chance, l.Roll = e.DropChance, 100, 0
+				l.Won, l.IsGuaranteed, l.Quantity = true, true, 1
+				if err := s.awardLoot(ctx, tx, inst, p.CharacterID, *boss.LootTableID, e, &l); err != nil {
+					return nil, err
+				}
+				won[p.CharacterID] = append(won[p.CharacterID], &l)
+			}
+		}
+
+		if n := len(won[p.CharacterID]); n > 0 {
+			_, err := tx.Exec(ctx, `
+				UPDATE dungeon_participants SET items_received = COALESCE(items_received, 0) + $3
+				WHERE instance_id = $1 AND character_id = $2
+			`, inst.ID, p.CharacterID, n)
+			if err != nil {
+				return nil, fmt.Errorf("failed to count dungeon loot: %w", err)
+			}
+		}
+	}
+	return won, nil
+}
+
+// awardLoot delivers a won roll to the character's bag, or by mail when it
+// is full, and records the roll
+func (s *DungeonService) awardLoot(ctx context.Context, tx pgx.Tx, inst *models.DungeonInstance, characterID uuid.UUID, lootTableID int, e *lootEntry, l *models.DungeonLoot) error {
+	l.ItemDefinitionID, l.ItemName, l.Rarity = &e.ItemID, &e.ItemName, &e.Rarity
+	if l.Won {
+		mailed, err := deliverItem(ctx, tx, characterID, &models.ItemStack{ItemDefinitionID: e.ItemID, Quantity: l.Quantity},
+			"dungeon_loot", "Dungeon loot: "+e.ItemName)
+		if err != nil {
+			return err
+		}
+		to := "inventory"
+		if mailed {
+			to = "mail"
+		}
+		l.DeliveredTo = &to
+	}
+
+	err := tx.QueryRow(ctx, `
+		INSERT INTO dungeon_loot_rolls (instance_id, boss_id, character_id, loot_table_id, loot_table_entry_id,
+			item_definition_id, rarity, base_chance, chance, roll, won, quantity, is_guaranteed,
+			difficulty, team_bonus, specialization_bonus, guild_bonus, delivered_to)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::item_rarity, $8, $9, $10, $11, $12, $13,
+			$14::dungeon_difficulty, $15, $16, $17, $18)
+		RETURNING id, created_at
+	`, inst.ID, l.BossID, characterID, lootTableID, e.ID,
+		e.ItemID, e.Rarity, l.BaseChance, l.Chance, l.Roll, l.Won, l.Quantity, l.IsGuaranteed,
+		l.Difficulty, l.TeamBonus, l.SpecializationBonus, l.GuildBonus, l.DeliveredTo).Scan(&l.ID, &l.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record loot roll: %w", err)
+	}
+	return nil
+}
+
+// ListLoot returns the acting character's loot rolls in an instance, only
+// the won ones when wonOnly is set
+func (s *DungeonService) ListLoot(ctx context.Context, accountID, characterID, instanceID uuid.UUID, wonOnly bool) ([]*models.DungeonLoot, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	var participated bool
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM dungeon_participants WHERE instance_id = $1 AND character_id = $2)
+	`, instanceID, characterID).Scan(&participated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dungeon participant: %w", err)
+	}
+	if !participated {
+		return nil, ErrNotDungeonParticipant
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT r.id, r.boss_id, b.name, r.item_definition_id, i.name, r.rarity::text,
+		       r.base_chance::float8, r.chance::float8, r.roll::float8, r.won, COALESCE(r.quantity, 0),
+		       COALESCE(r.is_guaranteed, false), r.difficulty::text, COALESCE(r.team_bonus, 0)::float8,
+		       COALESCE(r.specialization_bonus, 0)::float8, COALESCE(r.guild_bonus, 0)::float8,
+		       r.delivered_to, r.created_at
+		FROM dungeon_loot_rolls r
+		JOIN dungeon_bosses b ON b.id = r.boss_id
+		LEFT JOIN item_definitions i ON i.id = r.item_definition_id
+		WHERE r.instance_id = $1 AND r.character_id = $2 AND (NOT $3 OR r.won)
+		ORDER BY r.created_at, r.id
+	`, instanceID, characterID, wonOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dungeon loot: %w", err)
+	}
+	defer rows.Close()
+
+	var loot []*models.DungeonLoot
+	for rows.Next() {
+		var l models.DungeonLoot
+		if err := rows.Scan(&l.ID, &l.BossID, &l.BossName, &l.ItemDefinitionID, &l.ItemName, &l.Rarity,
+			&l.BaseChance, &l.Chance, &l.Roll, &l.Won, &l.Quantity,
+			&l.IsGuaranteed, &l.Difficulty, &l.TeamBonus,
+			&l.SpecializationBonus, &l.GuildBonus,
+			&l.DeliveredTo, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan dungeon loot: %w", err)
+		}
+		loot = append(loot, &l)
+	}
+	return loot, rows.Err()
+}
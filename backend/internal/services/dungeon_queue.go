@@ -0,0 +1,864 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrAlreadyQueued        = errors.New("already in the dungeon queue")
+	ErrNotQueued            = errors.New("not in the dungeon queue")
+	ErrDungeonQueuePenalty  = errors.New("declined a ready check recently, cannot queue yet")
+	ErrDungeonQueueChanged  = errors.New("dungeon queue changed, try again")
+	ErrDungeonMatchNotFound = errors.New("dungeon match not found")
+	ErrReadyCheckOver       = errors.New("ready check is over")
+)
+
+// Matchmaking. Solo players and parties queue for a dungeon at a difficulty
+// and the queue fills the missing classes from entries of similar gear
+// score: the oldest entry that can be completed is matched with the
+// closest entries within DungeonQueueGearSpread of its gear score, a spread
+// that widens by DungeonQueueSpreadPerMinute for every minute it waited.
+// Everyone matched has DungeonReadyCheckTimeout to accept. Those who decline
+// or let it run out leave the queue with a DungeonDeclinePenalty; the rest
+// go back in at their old place.
+const (
+	DungeonQueueGearSpread      = 150
+	DungeonQueueSpreadPerMinute = 50
+	DungeonReadyCheckTimeout    = 30 * time.Second
+	DungeonDeclinePenalty       = 5 * time.Minute
+	// DungeonQueueBatchSize is how many waiting entries one match considers
+	DungeonQueueBatchSize = 200
+)
+
+// character_cooldowns type of the decline penalty
+const DungeonQueuePenaltyCooldown = "dungeon_queue_penalty"
+
+// inDungeonQueue reports whether a character is waiting in a queue or a
+// ready check
+func inDungeonQueue(ctx context.Context, q querier, characterID uuid.UUID) (bool, error) {
+	var queued bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM dungeon_queue_members WHERE character_id = $1 AND is_active)
+	`, characterID).Scan(&queued)
+	if err != nil {
+		return false, fmt.Errorf("failed to check dungeon queue: %w", err)
+	}
+	return queued, nil
+}
+
+// lockDungeonQueue serializes the queues of a dungeon on its definition
+// row. Queue entries, their members and matches only change under it.
+func lockDungeonQueue(ctx context.Context, tx pgx.Tx, dungeonID int) error {
+	var id int
+	err := tx.QueryRow(ctx, "SELECT id FROM dungeon_definitions WHERE id = $1 FOR UPDATE", dungeonID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrDungeonNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock dungeon queue: %w", err)
+	}
+	return nil
+}
+
+// checkQueuePenalty fails while a character's decline penalty runs
+func checkQueuePenalty(ctx context.Context, q querier, m *dungeonMember) error {
+	var penalized bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM character_cooldowns
+			WHERE character_id = $1 AND cooldown_type = $2 AND resets_at > NOW()
+		)
+	`, m.ID, DungeonQueuePenaltyCooldown).Scan(&penalized)
+	if err != nil {
+		return fmt.Errorf("failed to check queue penalty: %w", err)
+	}
+	if penalized {
+		return fmt.Errorf("%s: %w", m.Name, ErrDungeonQueuePenalty)
+	}
+	return nil
+}
+
+func penalizeQueueDecline(ctx context.Context, tx pgx.Tx, characterID uuid.UUID, now time.Time) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO character_cooldowns (character_id, cooldown_type, reference_id, last_used_at, resets_at)
+		VALUES ($1, $2, '', $3, $4)
+		ON CONFLICT (character_id, cooldown_type, reference_id) DO UPDATE SET
+			last_used_at = EXCLUDED.last_used_at,
+			resets_at = EXCLUDED.resets_at
+	`, characterID, DungeonQueuePenaltyCooldown, now, now.Add(DungeonDeclinePenalty))
+	if err != nil {
+		return fmt.Errorf("failed to apply queue penalty: %w", err)
+	}
+	return nil
+}
+
+// queuedEntry is a waiting entry as matching sees it
+type queuedEntry struct {
+	ID        uuid.UUID
+	ServerID  int
+	LeaderID  uuid.UUID
+	GearScore int
+	QueuedAt  time.Time
+	Classes   []string
+}
+
+// waitingEntries returns a queue's waiting entries of one server, or of
+// every server when serverID is nil
+func waitingEntries(ctx context.Context, q querier, serverID *int, dungeonID int, difficulty models.DungeonDifficulty) ([]*queuedEntry, error) {
+	rows, err := q.Query(ctx, `
+		SELECT e.id, e.server_id, e.leader_id, e.gear_score, e.queued_at, array_agg(m.class::text)
+		FROM dungeon_queue_entries e
+		JOIN dungeon_queue_members m ON m.entry_id = e.id AND m.is_active
+		WHERE ($1::int IS NULL OR e.server_id = $1) AND e.dungeon_id = $2 AND e.difficulty = $3::dungeon_difficulty AND e.status = 'queued'
+		GROUP BY e.id
+		ORDER BY e.queued_at, e.id
+		LIMIT $4
+	`, serverID, dungeonID, difficulty, DungeonQueueBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dungeon queue: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*queuedEntry
+	for rows.Next() {
+		var e queuedEntry
+		if err := rows.Scan(&e.ID, &e.ServerID, &e.LeaderID, &e.GearScore, &e.QueuedAt, &e.Classes); err != nil {
+			return nil, fmt.Errorf("failed to scan dungeon queue entry: %w", err)
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+func gearDistance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// pickMatch returns a group of waiting entries that makes up a full party,
+// oldest entry first, or nil when none can be made yet. Entries are given
+// in queue order.
+func pickMatch(entries []*queuedEntry, d *models.Dungeon, now time.Time) []*queuedEntry {
+	for _, anchor := range entries {
+		spread := DungeonQueueGearSpread + DungeonQueueSpreadPerMinute*int(now.Sub(anchor.QueuedAt).Minutes())
+		var candidates []*queuedEntry
+		for _, e := range entries {
+			if e != anchor && gearDistance(e.GearScore, anchor.GearScore) <= spread {
+				candidates = append(candidates, e)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return gearDistance(candidates[i].GearScore, anchor.GearScore) < gearDistance(candidates[j].GearScore, anchor.GearScore)
+		})
+
+		group := []*queuedEntry{anchor}
+		size := len(anchor.Classes)
+		classes := make(map[string]bool, d.RequiredPlayers)
+		for _, class := range anchor.Classes {
+			classes[class] = true
+		}
+	candidates:
+		for _, e := range candidates {
+			if size == d.RequiredPlayers {
+				break
+			}
+			if size+len(e.Classes) > d.RequiredPlayers {
+				continue
+			}
+			if d.RequiresAllClasses {
+				for _, class := range e.Classes {
+					if classes[class] {
+						continue candidates
+					}
+				}
+			}
+			for _, class := range e.Classes {
+				classes[class] = true
+			}
+			group = append(group, e)
+			size += len(e.Classes)
+		}
+		if size == d.RequiredPlayers {
+			return group
+		}
+	}
+	return nil
+}
+
+// matchQueue puts waiting entries of a locked queue into ready checks
+// until no more full parties can be made. It returns how many matches it
+// made. Cross-server dungeons match entries of all servers together and
+// host the match on the oldest entry's server.
+func matchQueue(ctx context.Context, tx pgx.Tx, serverID int, d *models.Dungeon, difficulty models.DungeonDifficulty, now time.Time) (int, error) {
+	server := &serverID
+	if d.IsCrossServer {
+		server = nil
+	}
+	matched := 0
+	for {
+		entries, err := waitingEntries(ctx, tx, server, d.ID, difficulty)
+		if err != nil {
+			return matched, err
+		}
+		group := pickMatch(entries, d, now)
+		if group == nil {
+			return matched, nil
+		}
+
+		var matchID uuid.UUID
+		err = tx.QueryRow(ctx, `
+			INSERT INTO dungeon_queue_matches (server_id, dungeon_id, difficulty, expires_at)
+			VALUES ($1, $2, $3::dungeon_difficulty, $4)
+			RETURNING id
+		`, group[0].ServerID, d.ID, difficulty, now.Add(DungeonReadyCheckTimeout)).Scan(&matchID)
+		if err != nil {
+			return matched, fmt.Errorf("failed to create dungeon match: %w", err)
+		}
+		ids := make([]uuid.UUID, 0, len(group))
+		for _, e := range group {
+			ids = append(ids, e.ID)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE dungeon_queue_entries SET status = 'ready_check', match_id = $2 WHERE id = ANY($1)
+		`, ids, matchID)
+		if err != nil {
+			return matched, fmt.Errorf("failed to match dungeon queue entries: %w", err)
+		}
+		matched++
+	}
+}
+
+const queueEntryColumns = `e.id, e.dungeon_id, d.name, e.difficulty::text, e.leader_id, e.party_id, e.gear_score,
+	COALESCE(e.status, 'queued'), e.queued_at, e.match_id`
+
+// activeQueueEntry returns the entry a character is waiting in, or nil
+func activeQueueEntry(ctx context.Context, q querier, characterID uuid.UUID) (*models.DungeonQueueEntry, *uuid.UUID, error) {
+	var e models.DungeonQueueEntry
+	var matchID *uuid.UUID
+	err := q.QueryRow(ctx, `
+		SELECT `+queueEntryColumns+`
+		FROM dungeon_queue_members m
+		JOIN dungeon_queue_entries e ON e.id = m.entry_id
+		JOIN dungeon_definitions d ON d.id = e.dungeon_id
+		WHERE m.character_id = $1 AND m.is_active
+	`, characterID).Scan(&e.ID, &e.DungeonID, &e.DungeonName, &e.Difficulty, &e.LeaderID, &e.PartyID, &e.GearScore,
+		&e.Status, &e.QueuedAt, &matchID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get dungeon queue entry: %w", err)
+	}
+	return &e, matchID, nil
+}
+
+func queueMembers(ctx context.Context, q querier, where string, arg any) ([]*models.DungeonQueueMember, error) {
+	rows, err := q.Query(ctx, `
+		SELECT m.character_id, c.name, c.level, m.class, m.gear_score, COALESCE(m.is_ready, false)
+		FROM dungeon_queue_members m
+		JOIN dungeon_queue_entries e ON e.id = m.entry_id
+		JOIN characters c ON c.id = m.character_id
+		WHERE `+where+`
+		ORDER BY e.queued_at, e.id, m.character_id
+	`, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dungeon queue members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []*models.DungeonQueueMember{}
+	for rows.Next() {
+		var m models.DungeonQueueMember
+		if err := rows.Scan(&m.CharacterID, &m.Name, &m.Level, &m.Class, &m.GearScore, &m.IsReady); err != nil {
+			return nil, fmt.Errorf("failed to scan dungeon queue member: %w", err)
+		}
+		members = append(members, &m)
+	}
+	return members, rows.Err()
+}
+
+func entryMembers(ctx context.Context, q querier, entryID uuid.UUID) ([]*models.DungeonQueueMember, error) {
+	return queueMembers(ctx, q, "m.entry_id = $1", entryID)
+}
+
+// matchMembers returns everyone in a match's entries
+func matchMembers(ctx context.Context, q querier, matchID uuid.UUID) ([]*models.DungeonQueueMember, error) {
+	return queueMembers(ctx, q, "e.match_id = $1", matchID)
+}
+
+func getDungeonMatch(ctx context.Context, q querier, matchID uuid.UUID, forUpdate bool) (*models.DungeonMatch, int, error) {
+	lock := ""
+	if forUpdate {
+		lock = "FOR UPDATE"
+	}
+	var m models.DungeonMatch
+	var serverID int
+	err := q.QueryRow(ctx, `
+		SELECT id, server_id, dungeon_id, difficulty::text, COALESCE(status, 'ready_check'), instance_id, created_at, expires_at
+		FROM dungeon_queue_matches WHERE id = $1
+		`+lock, matchID).Scan(&m.ID, &serverID, &m.DungeonID, &m.Difficulty, &m.Status, &m.InstanceID, &m.CreatedAt, &m.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, ErrDungeonMatchNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get dungeon match: %w", err)
+	}
+	return &m, serverID, nil
+}
+
+// lockDungeonMatch locks the characters of a match and any extra
+// characters, then the dungeon's queue and the match. It fails with
+// ErrDungeonQueueChanged if the match changed in between.
+func lockDungeonMatch(ctx context.Context, tx pgx.Tx, matchID uuid.UUID, extra ...uuid.UUID) (map[uuid.UUID]*characterRef, *models.DungeonMatch, int, error) {
+	match, _, err := getDungeonMatch(ctx, tx, matchID, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	members, err := matchMembers(ctx, tx, matchID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	ids := append([]uuid.UUID{}, extra...)
+	for _, m := range members {
+		ids = append(ids, m.CharacterID)
+	}
+
+	locked, err := lockCharacters(ctx, tx, ids...)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if err := lockDungeonQueue(ctx, tx, match.DungeonID); err != nil {
+		return nil, nil, 0, err
+	}
+	match, serverID, err := getDungeonMatch(ctx, tx, matchID, true)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if match.Members, err = matchMembers(ctx, tx, matchID); err != nil {
+		return nil, nil, 0, err
+	}
+	for _, m := range match.Members {
+		if _, ok := locked[m.CharacterID]; !ok {
+			return nil, nil, 0, ErrDungeonQueueChanged
+		}
+	}
+	return locked, match, serverID, nil
+}
+
+// endQueueEntries takes entries out of the queue for good
+func endQueueEntries(ctx context.Context, tx pgx.Tx, entryIDs []uuid.UUID, status models.DungeonQueueStatus) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE dungeon_queue_entries SET status = $2, ended_at = NOW() WHERE id = ANY($1)
+	`, entryIDs, status)
+	if err != nil {
+		return fmt.Errorf("failed to end dungeon queue entries: %w", err)
+	}
+	_, err = tx.Exec(ctx, "UPDATE dungeon_queue_members SET is_active = false WHERE entry_id = ANY($1)", entryIDs)
+	if err != nil {
+		return fmt.Errorf("failed to end dungeon queue entries: %w", err)
+	}
+	return nil
+}
+
+// matchEntryIDs returns the entries of a match in queue order
+func matchEntryIDs(ctx context.Context, q querier, matchID uuid.UUID) ([]uuid.UUID, []uuid.UUID, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, leader_id FROM dungeon_queue_entries WHERE match_id = $1 AND status = 'ready_check'
+		ORDER BY queued_at, id
+	`, matchID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get dungeon match entries: %w", err)
+	}
+	defer rows.Close()
+
+	var ids, leaders []uuid.UUID
+	for rows.Next() {
+		var id, leader uuid.UUID
+		if err := rows.Scan(&id, &leader); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan dungeon match entry: %w", err)
+		}
+		ids = append(ids, id)
+		leaders = append(leaders, leader)
+	}
+	return ids, leaders, rows.Err()
+}
+
+// cancelMatch ends a locked ready check. The entries of the dropped
+// characters leave the queue with status, their characters penalized when
+// penalize is set; the other entries go back to waiting at their old place
+// and the queue is matched again.
+func cancelMatch(ctx context.Context, tx pgx.Tx, match *models.DungeonMatch, serverID int, dropped map[uuid.UUID]bool, status models.DungeonQueueStatus, penalize bool, now time.Time) error {
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT m.entry_id FROM dungeon_queue_members m
+		JOIN dungeon_queue_entries e ON e.id = m.entry_id
+		WHERE e.match_id = $1 AND e.status = 'ready_check' AND m.character_id = ANY($2)
+	`, match.ID, mapKeys(dropped))
+	if err != nil {
+		return fmt.Errorf("failed to get dropped dungeon queue entries: %w", err)
+	}
+	droppedEntries, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return fmt.Errorf("failed to scan dropped dungeon queue entries: %w", err)
+	}
+	if err := endQueueEntries(ctx, tx, droppedEntries, status); err != nil {
+		return err
+	}
+	if penalize {
+		for id := range dropped {
+			if err := penalizeQueueDecline(ctx, tx, id, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE dungeon_queue_members SET is_ready = false, responded_at = NULL
+		WHERE entry_id IN (SELECT id FROM dungeon_queue_entries WHERE match_id = $1 AND status = 'ready_check')
+	`, match.ID)
+	if err != nil {
+		return fmt.Errorf("failed to requeue dungeon queue members: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE dungeon_queue_entries SET status = 'queued', match_id = NULL
+		WHERE match_id = $1 AND status = 'ready_check'
+	`, match.ID)
+	if err != nil {
+		return fmt.Errorf("failed to requeue dungeon queue entries: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE dungeon_queue_matches SET status = 'cancelled', resolved_at = NOW() WHERE id = $1
+	`, match.ID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel dungeon match: %w", err)
+	}
+
+	d, err := getDungeon(ctx, tx, match.DungeonID)
+	if err != nil {
+		return err
+	}
+	_, err = matchQueue(ctx, tx, serverID, d, match.Difficulty, now)
+	return err
+}
+
+func mapKeys(set map[uuid.UUID]bool) []uuid.UUID {
+	keys := make([]uuid.UUID, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startMatch opens the run of a locked match everyone accepted, led by the
+// leader of the oldest entry. Members who can no longer enter are dropped
+// without a penalty and the others go back to the queue.
+func (s *DungeonService) startMatch(ctx context.Context, tx pgx.Tx, match *models.DungeonMatch, serverID int, now time.Time) error {
+	d, err := getDungeon(ctx, tx, match.DungeonID)
+	if err != nil {
+		return err
+	}
+	members := make([]*dungeonMember, 0, len(match.Members))
+	ineligible := map[uuid.UUID]bool{}
+	for _, qm := range match.Members {
+		m, err := getDungeonMember(ctx, tx, qm.CharacterID)
+		if err != nil {
+			return err
+		}
+		err = s.checkDungeonEntry(ctx, tx, m, d)
+		if errors.Is(err, ErrDungeonLevelTooLow) || errors.Is(err, ErrDungeonGearScoreTooLow) ||
+			errors.Is(err, ErrDungeonEntriesExhausted) || errors.Is(err, ErrInPrison) {
+			ineligible[m.ID] = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		members = append(members, m)
+	}
+	if len(ineligible) > 0 {
+		return cancelMatch(ctx, tx, match, serverID, ineligible, models.QueueLeft, false, now)
+	}
+
+	entryIDs, leaders, err := matchEntryIDs(ctx, tx, match.ID)
+	if err != nil {
+		return err
+	}
+	instanceID, err := insertDungeonInstance(ctx, tx, d, serverID, match.Difficulty, leaders[0])
+	if err != nil {
+		return err
+	}
+	ids := make([]uuid.UUID, 0, len(members))
+	for _, m := range members {
+		if err := addDungeonParticipant(ctx, tx, instanceID, m); err != nil {
+			return err
+		}
+		ids = append(ids, m.ID)
+	}
+	inst, err := getDungeonInstance(ctx, tx, instanceID, true)
+	if err != nil {
+		return err
+	}
+	if err := s.beginDungeonRun(ctx, tx, inst, d, ids, now); err != nil {
+		return err
+	}
+
+	if err := endQueueEntries(ctx, tx, entryIDs, models.QueueMatched); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE dungeon_queue_matches SET status = 'accepted', instance_id = $2, resolved_at = NOW() WHERE id = $1
+	`, match.ID, instanceID)
+	if err != nil {
+		return fmt.Errorf("failed to accept dungeon match: %w", err)
+	}
+	return nil
+}
+
+// JoinQueue queues the acting character for a dungeon at a difficulty. A
+// party queues together and only its leader can queue it; every member
+// must be able to enter and, for dungeons that need all classes, play a
+// different class.
+func (s *DungeonService) JoinQueue(ctx context.Context, accountID, characterID uuid.UUID, dungeonID int, difficulty models.DungeonDifficulty) (*models.DungeonQueueEntry, error) {
+	if !difficulty.Valid() {
+		return nil, ErrInvalidDifficulty
+	}
+
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		ids := []uuid.UUID{characterID}
+		party, err := partyOf(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if party != nil {
+			for _, m := range party.Members {
+				if m.CharacterID != characterID {
+					ids = append(ids, m.CharacterID)
+				}
+			}
+		}
+		locked, err := lockCharacters(ctx, tx, ids...)
+		if err != nil {
+			return err
+		}
+		c := locked[characterID]
+		if c.AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+
+		var partyID *uuid.UUID
+		if party != nil {
+			p, err := lockParty(ctx, tx, party.ID)
+			if err != nil {
+				return err
+			}
+			if p.LeaderID != characterID {
+				return ErrNotPartyLeader
+			}
+			ids = ids[:0]
+			for _, m := range p.Members {
+				if _, ok := locked[m.CharacterID]; !ok {
+					return ErrDungeonPartyChanged
+				}
+				ids = append(ids, m.CharacterID)
+			}
+			partyID = &p.ID
+		}
+
+		d, err := getDungeon(ctx, tx, dungeonID)
+		if err != nil {
+			return err
+		}
+		if !d.HasDifficulty(difficulty) {
+			return ErrDifficultyUnavailable
+		}
+		if len(ids) > d.RequiredPlayers {
+			return ErrDungeonPartyFull
+		}
+
+		members := make([]*dungeonMember, 0, len(ids))
+		classes := make(map[models.CharacterClass]bool, len(ids))
+		gearScore := 0
+		for _, id := range ids {
+			if err := checkNotInDungeon(ctx, tx, id); err != nil {
+				return fmt.Errorf("%s: %w", locked[id].Name, err)
+			}
+			m, err := getDungeonMember(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if err := s.checkDungeonEntry(ctx, tx, m, d); err != nil {
+				return err
+			}
+			if err := checkQueuePenalty(ctx, tx, m); err != nil {
+				return err
+			}
+			if d.RequiresAllClasses && classes[m.Class] {
+				return ErrDungeonClassTaken
+			}
+			classes[m.Class] = true
+			gearScore += m.GearScore
+			members = append(members, m)
+		}
+
+		if err := lockDungeonQueue(ctx, tx, d.ID); err != nil {
+			return err
+		}
+		var entryID uuid.UUID
+		err = tx.QueryRow(ctx, `
+			INSERT INTO dungeon_queue_entries (server_id, dungeon_id, difficulty, leader_id, party_id, gear_score)
+			VALUES ($1, $2, $3::dungeon_difficulty, $4, $5, $6)
+			RETURNING id
+		`, c.ServerID, d.ID, difficulty, characterID, partyID, gearScore/len(members)).Scan(&entryID)
+		if err != nil {
+			return fmt.Errorf("failed to join dungeon queue: %w", err)
+		}
+		for _, m := range members {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO dungeon_queue_members (entry_id, character_id, class, gear_score) VALUES ($1, $2, $3, $4)
+			`, entryID, m.ID, m.Class, m.GearScore)
+			if _, ok := uniqueViolation(err); ok {
+				return fmt.Errorf("%s: %w", m.Name, ErrAlreadyQueued)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to join dungeon queue: %w", err)
+			}
+		}
+		_, err = matchQueue(ctx, tx, c.ServerID, d, difficulty, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetQueue(ctx, accountID, characterID)
+}
+
+// GetQueue returns the entry the acting character is waiting in with its
+// ready check, if it is in one
+func (s *DungeonService) GetQueue(ctx context.Context, accountID, characterID uuid.UUID) (*models.DungeonQueueEntry, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	e, matchID, err := activeQueueEntry(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, ErrNotQueued
+	}
+	if e.Members, err = entryMembers(ctx, s.db.Pool, e.ID); err != nil {
+		return nil, err
+	}
+	if matchID != nil {
+		if e.Match, _, err = getDungeonMatch(ctx, s.db.Pool, *matchID, false); err != nil {
+			return nil, err
+		}
+		if e.Match.Members, err = matchMembers(ctx, s.db.Pool, *matchID); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// GetMatch returns a match the acting character was put in, with the run
+// it started once everyone accepted
+func (s *DungeonService) GetMatch(ctx context.Context, accountID, characterID, matchID uuid.UUID) (*models.DungeonMatch, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	match, _, err := getDungeonMatch(ctx, s.db.Pool, matchID, false)
+	if err != nil {
+		return nil, err
+	}
+	if match.Members, err = matchMembers(ctx, s.db.Pool, matchID); err != nil {
+		return nil, err
+	}
+	for _, m := range match.Members {
+		if m.CharacterID == characterID {
+			return match, nil
+		}
+	}
+	return nil, ErrDungeonMatchNotFound
+}
+
+// LeaveQueue takes the acting character's entry, their whole party with
+// it, out of the queue. Leaving during a ready check declines it.
+func (s *DungeonService) LeaveQueue(ctx context.Context, accountID, characterID uuid.UUID) error {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return err
+	}
+	e, matchID, err := activeQueueEntry(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return ErrNotQueued
+	}
+	if e.Status == models.QueueReadyCheck && matchID != nil {
+		_, err := s.RespondReadyCheck(ctx, accountID, characterID, *matchID, false)
+		return err
+	}
+
+	return s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		if err := lockDungeonQueue(ctx, tx, e.DungeonID); err != nil {
+			return err
+		}
+		current, _, err := activeQueueEntry(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return ErrNotQueued
+		}
+		if current.ID != e.ID || current.Status != models.QueueWaiting {
+			return ErrDungeonQueueChanged
+		}
+		return endQueueEntries(ctx, tx, []uuid.UUID{e.ID}, models.QueueLeft)
+	})
+}
+
+// RespondReadyCheck accepts or declines a ready check for the acting
+// character. The run starts when the last member accepts; a decline
+// cancels the match and penalizes the decliner.
+func (s *DungeonService) RespondReadyCheck(ctx context.Context, accountID, characterID, matchID uuid.UUID, accept bool) (*models.DungeonMatch, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, match, serverID, err := lockDungeonMatch(ctx, tx, matchID, characterID)
+		if err != nil {
+			return err
+		}
+		if locked[characterID].AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		var me *models.DungeonQueueMember
+		for _, m := range match.Members {
+			if m.CharacterID == characterID {
+				me = m
+			}
+		}
+		if me == nil {
+			return ErrDungeonMatchNotFound
+		}
+		now := time.Now()
+		if match.Status != models.MatchReadyCheck || !now.Before(match.ExpiresAt) {
+			return ErrReadyCheckOver
+		}
+
+		if !accept {
+			return cancelMatch(ctx, tx, match, serverID, map[uuid.UUID]bool{characterID: true}, models.QueueDeclined, true, now)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE dungeon_queue_members SET is_ready = true, responded_at = $2
+			WHERE character_id = $1 AND is_active
+		`, characterID, now)
+		if err != nil {
+			return fmt.Errorf("failed to accept ready check: %w", err)
+		}
+		me.IsReady = true
+		for _, m := range match.Members {
+			if !m.IsReady {
+				return nil
+			}
+		}
+		return s.startMatch(ctx, tx, match, serverID, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMatch(ctx, accountID, characterID, matchID)
+}
+
+// ProcessQueue times out ready checks, dropping and penalizing whoever did
+// not accept in time, and matches the waiting queues again as their gear
+// score spreads widen
+func (s *DungeonService) ProcessQueue(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM dungeon_queue_matches
+		WHERE status = 'ready_check' AND expires_at <= NOW()
+		ORDER BY expires_at
+		LIMIT $1
+	`, DungeonBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired ready checks: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan expired ready checks: %w", err)
+	}
+
+	processed := 0
+	for _, id := range ids {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			_, match, serverID, err := lockDungeonMatch(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			if match.Status != models.MatchReadyCheck || now.Before(match.ExpiresAt) {
+				return nil
+			}
+			idle := map[uuid.UUID]bool{}
+			for _, m := range match.Members {
+				if !m.IsReady {
+					idle[m.CharacterID] = true
+				}
+			}
+			processed++
+			return cancelMatch(ctx, tx, match, serverID, idle, models.QueueExpired, true, now)
+		})
+		if err != nil {
+			return processed, fmt.Errorf("failed to time out ready check %s: %w", id, err)
+		}
+	}
+
+	type queueKey struct {
+		ServerID   int
+		DungeonID  int
+		Difficulty models.DungeonDifficulty
+	}
+	rows, err = s.db.Pool.Query(ctx, `
+		SELECT DISTINCT server_id, dungeon_id, difficulty::text FROM dungeon_queue_entries WHERE status = 'queued'
+	`)
+	if err != nil {
+		return processed, fmt.Errorf("failed to find dungeon queues: %w", err)
+	}
+	queues, err := pgx.CollectRows(rows, pgx.RowToStructByPos[queueKey])
+	if err != nil {
+		return processed, fmt.Errorf("failed to scan dungeon queues: %w", err)
+	}
+	for _, k := range queues {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			if err := lockDungeonQueue(ctx, tx, k.DungeonID); err != nil {
+				return err
+			}
+			d, err := getDungeon(ctx, tx, k.DungeonID)
+			if err != nil {
+				return err
+			}
+			n, err := matchQueue(ctx, tx, k.ServerID, d, k.Difficulty, time.Now())
+			processed += n
+			return err
+		})
+		if err != nil {
+			return processed, fmt.Errorf("failed to match dungeon queue %d: %w", k.DungeonID, err)
+		}
+	}
+	return processed, nil
+}
+
+// RunMatchmaker processes the dungeon queues every interval until ctx is
+// cancelled
+func (s *DungeonService) RunMatchmaker(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "dungeon matchmaker", interval, s.ProcessQueue)
+}
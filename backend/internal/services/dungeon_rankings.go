@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrSeasonNotFound = errors.New("season not found")
+	ErrNoActiveSeason = errors.New("no season is running")
+)
+
+// System ledger account cross-server ranking rewards are paid from
+const SystemCrossServerReward = "cross_server_reward"
+
+// CrossServerWeeklyRewards and CrossServerSeasonRewards are the gold the
+// top of each cross-server ranking gets, by rank
+var (
+	CrossServerWeeklyRewards = []int64{500000, 300000, 200000, 100000, 100000, 50000, 50000, 50000, 50000, 50000}
+	CrossServerSeasonRewards = []int64{5000000, 3000000, 2000000, 1000000, 1000000, 500000, 500000, 500000, 500000, 500000}
+)
+
+// seasonAt is a subquery for the season running at a time expression
+func seasonAt(at string) string {
+	return `(SELECT id FROM seasons WHERE starts_at <= ` + at + ` AND ends_at > ` + at + ` ORDER BY starts_at DESC LIMIT 1)`
+}
+
+// recordCrossServerClear counts a cross-server clear in this week's
+// ranking of the running season. Faster clears score up to half again the
+// difficulty's points.
+func recordCrossServerClear(ctx context.Context, tx pgx.Tx, inst *models.DungeonInstance, d *models.Dungeon, party []*models.DungeonParticipant) error {
+	points := models.CrossServerClearPoints[inst.Difficulty]
+	var seconds *int
+	if inst.StartedAt != nil {
+		elapsed := int(time.Since(*inst.StartedAt).Seconds())
+		seconds = &elapsed
+		if limit := d.TimeLimitMinutes * 60; elapsed < limit {
+			points += points * (limit - elapsed) / (2 * limit)
+		}
+	}
+
+	for _, p := range party {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO cross_server_dungeon_rankings (season_id, week_start, character_id, server_id, score, clears, best_clear_seconds)
+			VALUES (`+seasonAt("NOW()")+`, date_trunc('week', NOW())::date, $1, $2, $3, 1, $4)
+			ON CONFLICT (character_id, week_start, (COALESCE(season_id, 0))) DO UPDATE SET
+				score = cross_server_dungeon_rankings.score + EXCLUDED.score,
+				clears = cross_server_dungeon_rankings.clears + 1,
+				best_clear_seconds = LEAST(cross_server_dungeon_rankings.best_clear_seconds, EXCLUDED.best_clear_seconds)
+		`, p.CharacterID, p.ServerID, points, seconds)
+		if err != nil {
+			return fmt.Errorf("failed to update cross-server ranking: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetCrossServerRankings returns the cross-server dungeon ranking of all
+// servers for the current week, or the finished previous week. A new
+// season starts a new ranking even mid-week.
+func (s *DungeonService) GetCrossServerRankings(ctx context.Context, accountID, characterID uuid.UUID, previous bool, limit, offset int) ([]*models.CrossServerRanking, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	week, at := "date_trunc('week', NOW())::date", "NOW()"
+	if previous {
+		week = "(date_trunc('week', NOW()) - INTERVAL '7 days')::date"
+		at = "(date_trunc('week', NOW()) - INTERVAL '1 second')"
+	}
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT r.character_id, c.name, c.level, c.class, r.server_id, sv.name, r.season_id,
+		       r.week_start::timestamptz, r.score, r.clears, r.best_clear_seconds, r.current_rank, r.reward_gold
+		FROM cross_server_dungeon_rankings r
+		JOIN characters c ON c.id = r.character_id
+		JOIN servers sv ON sv.id = r.server_id
+		WHERE r.week_start = `+week+` AND r.season_id IS NOT DISTINCT FROM `+seasonAt(at)+`
+		ORDER BY r.current_rank NULLS LAST, r.score DESC, r.clears DESC, r.best_clear_seconds NULLS LAST, c.name
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cross-server rankings: %w", err)
+	}
+	defer rows.Close()
+
+	var rankings []*models.CrossServerRanking
+	for rows.Next() {
+		var r models.CrossServerRanking
+		if err := rows.Scan(&r.CharacterID, &r.Name, &r.Level, &r.Class, &r.ServerID, &r.ServerName, &r.SeasonID,
+			&r.WeekStart, &r.Score, &r.Clears, &r.BestClearSeconds, &r.Rank, &r.RewardGold); err != nil {
+			return nil, fmt.Errorf("failed to scan cross-server ranking: %w", err)
+		}
+		rankings = append(rankings, &r)
+	}
+	return rankings, rows.Err()
+}
+
+// GetCrossServerSeason returns a season's cross-server standings, the
+// running season's when seasonID is nil. Standings of a running season are
+// the sum of its weeks so far.
+func (s *DungeonService) GetCrossServerSeason(ctx context.Context, accountID, characterID uuid.UUID, seasonID *int, limit, offset int) (*models.CrossServerSeason, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	var season models.CrossServerSeason
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT id, name, starts_at, ends_at, cross_server_closed_at FROM seasons
+		WHERE id = COALESCE($1, `+seasonAt("NOW()")+`)
+	`, seasonID).Scan(&season.ID, &season.Name, &season.StartsAt, &season.EndsAt, &season.ClosedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if seasonID == nil {
+			return nil, ErrNoActiveSeason
+		}
+		return nil, ErrSeasonNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get season: %w", err)
+	}
+
+	query := `
+		SELECT ROW_NUMBER() OVER (ORDER BY SUM(r.score) DESC, SUM(r.clears) DESC, r.character_id),
+		       r.character_id, c.name, c.level, c.class, c.server_id, sv.name,
+		       SUM(r.score)::int, SUM(r.clears)::int, NULL::bigint
+		FROM cross_server_dungeon_rankings r
+		JOIN characters c ON c.id = r.character_id
+		JOIN servers sv ON sv.id = c.server_id
+		WHERE r.season_id = $1
+		GROUP BY r.character_id, c.name, c.level, c.class, c.server_id, sv.name
+		ORDER BY 1
+		LIMIT $2 OFFSET $3`
+	if season.ClosedAt != nil {
+		query = `
+			SELECT res.final_rank, res.character_id, c.name, c.level, c.class, res.server_id, sv.name,
+			       res.score, res.clears, res.reward_gold
+			FROM cross_server_season_results res
+			JOIN characters c ON c.id = res.character_id
+			JOIN servers sv ON sv.id = res.server_id
+			WHERE res.season_id = $1
+			ORDER BY res.final_rank
+			LIMIT $2 OFFSET $3`
+	}
+	rows, err := s.db.Pool.Query(ctx, query, season.ID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get season standings: %w", err)
+	}
+	defer rows.Close()
+
+	season.Standings = []*models.CrossServerSeasonStanding{}
+	for rows.Next() {
+		var st models.CrossServerSeasonStanding
+		if err := rows.Scan(&st.Rank, &st.CharacterID, &st.Name, &st.Level, &st.Class, &st.ServerID, &st.ServerName,
+			&st.Score, &st.Clears, &st.RewardGold); err != nil {
+			return nil, fmt.Errorf("failed to scan season standing: %w", err)
+		}
+		season.Standings = append(season.Standings, &st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// finalizeCrossServerWeeks fixes the ranks of finished weeks, one ranking
+// per week and season
+func (s *DungeonService) finalizeCrossServerWeeks(ctx context.Context) (int, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE cross_server_dungeon_rankings r SET current_rank = ranked.rn
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (
+				PARTITION BY week_start, COALESCE(season_id, 0)
+				ORDER BY score DESC, clears DESC, best_clear_seconds NULLS LAST, character_id
+			) AS rn
+			FROM cross_server_dungeon_rankings
+			WHERE week_start < date_trunc('week', NOW())::date
+			  AND week_start IN (
+			      SELECT DISTINCT week_start FROM cross_server_dungeon_rankings
+			      WHERE current_rank IS NULL AND week_start < date_trunc('week', NOW())::date
+			  )
+		) ranked
+		WHERE r.id = ranked.id AND r.current_rank IS NULL
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to finalize cross-server rankings: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// closeCrossServerSeasons fixes the final standings of seasons that have
+// ended. The next season's rankings start from zero.
+func (s *DungeonService) closeCrossServerSeasons(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM seasons WHERE ends_at <= NOW() AND cross_server_closed_at IS NULL ORDER BY ends_at
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ended seasons: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan ended seasons: %w", err)
+	}
+
+	closed := 0
+	for _, id := range ids {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			var done bool
+			err := tx.QueryRow(ctx, `
+				SELECT cross_server_closed_at IS NOT NULL FROM seasons WHERE id = $1 FOR UPDATE
+			`, id).Scan(&done)
+			if err != nil {
+				return fmt.Errorf("failed to lock season: %w", err)
+			}
+			if done {
+				return nil
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO cross_server_season_results (season_id, character_id, server_id, score, clears, final_rank)
+				SELECT $1, r.character_id, c.server_id, SUM(r.score), SUM(r.clears),
+				       ROW_NUMBER() OVER (ORDER BY SUM(r.score) DESC, SUM(r.clears) DESC, r.character_id)
+				FROM cross_server_dungeon_rankings r
+				JOIN characters c ON c.id = r.character_id
+				WHERE r.season_id = $1
+				GROUP BY r.character_id, c.server_id
+			`, id)
+			if err != nil {
+				return fmt.Errorf("failed to record season standings: %w", err)
+			}
+			_, err = tx.Exec(ctx, "UPDATE seasons SET cross_server_closed_at = NOW() WHERE id = $1", id)
+			if err != nil {
+				return fmt.Errorf("failed to close season: %w", err)
+			}
+			closed++
+			return nil
+		})
+		if err != nil {
+			return closed, fmt.Errorf("failed to close season %d: %w", id, err)
+		}
+	}
+	return closed, nil
+}
+
+// crossServerPayout is a ranking table whose top ranks are paid in gold
+type crossServerPayout struct {
+	table   string
+	rank    string
+	rewards []int64
+	reason  string
+	subject string
+}
+
+var crossServerPayouts = []crossServerPayout{
+	{"cross_server_dungeon_rankings", "current_rank", CrossServerWeeklyRewards, "cross_server_weekly", "Cross-server weekly ranking reward"},
+	{"cross_server_season_results", "final_rank", CrossServerSeasonRewards, "cross_server_season", "Cross-server season ranking reward"},
+}
+
+// payCrossServerRewards pays the top ranks of a ranking table that have
+// not been paid yet. Gold goes to each character on their home server.
+func (s *DungeonService) payCrossServerRewards(ctx context.Context, p crossServerPayout) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM `+p.table+` WHERE rewarded_at IS NULL AND `+p.rank+` <= $1 ORDER BY `+p.rank+`
+	`, len(p.rewards))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unpaid cross-server rewards: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan unpaid cross-server rewards: %w", err)
+	}
+
+	paid := 0
+	for _, id := range ids {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			var characterID uuid.UUID
+			err := tx.QueryRow(ctx, "SELECT character_id FROM "+p.table+" WHERE id = $1", id).Scan(&characterID)
+			if err != nil {
+				return fmt.Errorf("failed to get cross-server reward: %w", err)
+			}
+			if _, err := lockCharacters(ctx, tx, characterID); err != nil {
+				return err
+			}
+
+			var serverID, rank int
+			err = tx.QueryRow(ctx, `
+				SELECT server_id, `+p.rank+` FROM `+p.table+` WHERE id = $1 AND rewarded_at IS NULL FOR UPDATE
+			`, id).Scan(&serverID, &rank)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to lock cross-server reward: %w", err)
+			}
+
+			gold := p.rewards[rank-1]
+			err = s.ledger.Post(ctx, tx, &Posting{
+				ServerID:      serverID,
+				Currency:      models.CurrencyGold,
+				Amount:        gold,
+				From:          SystemAccount(SystemCrossServerReward),
+				To:            CharacterAccount(characterID),
+				Reason:        p.reason,
+				ReferenceType: p.table,
+				ReferenceID:   &id,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `
+				UPDATE `+p.table+` SET reward_gold = $2, rewarded_at = NOW() WHERE id = $1
+			`, id, gold)
+			if err != nil {
+				return fmt.Errorf("failed to record cross-server reward: %w", err)
+			}
+			body := fmt.Sprintf("You finished #%d and were paid %d gold.", rank, gold)
+			if err := sendSystemMail(ctx, tx, characterID, p.reason, p.subject, body, 0, nil); err != nil {
+				return err
+			}
+			paid++
+			return nil
+		})
+		if err != nil {
+			return paid, fmt.Errorf("failed to pay cross-server reward %s: %w", id, err)
+		}
+	}
+	return paid, nil
+}
+
+// ProcessRankings closes finished cross-server weeks and seasons and pays
+// their rewards
+func (s *DungeonService) ProcessRankings(ctx context.Context) (int, error) {
+	processed, err := s.finalizeCrossServerWeeks(ctx)
+	if err != nil {
+		return processed, err
+	}
+	closed, err := s.closeCrossServerSeasons(ctx)
+	processed += closed
+	if err != nil {
+		return processed, err
+	}
+	for _, p := range crossServerPayouts {
+		paid, err := s.payCrossServerRewards(ctx, p)
+		processed += paid
+		if err != nil {
+			return processed, err
+		}
+	}
+	return processed, nil
+}
+
+// RunRankings processes the cross-server rankings every interval until
+// ctx is cancelled
+func (s *DungeonService) RunRankings(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "cross-server rankings", interval, s.ProcessRankings)
+}
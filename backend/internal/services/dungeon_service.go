@@ -0,0 +1,1205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrDungeonNotFound         = errors.New("dungeon not found")
+	ErrDungeonInstanceNotFound = errors.New("dungeon instance not found")
+	ErrInvalidDifficulty       = errors.New("invalid dungeon difficulty")
+	ErrDifficultyUnavailable   = errors.New("dungeon is not available at this difficulty")
+	ErrDungeonLevelTooLow      = errors.New("level too low for this dungeon")
+	ErrDungeonGearScoreTooLow  = errors.New("gear score too low for this dungeon")
+	ErrDungeonEntriesExhausted = errors.New("no dungeon entries left")
+	ErrAlreadyInDungeon        = errors.New("already in a dungeon party")
+	ErrDungeonPartyFull        = errors.New("dungeon party is full")
+	ErrDungeonClassTaken       = errors.New("the party already has a character of this class")
+	ErrDungeonPartyIncomplete  = errors.New("a dungeon party needs one warrior, archer, mage, healer and ninja")
+	ErrDungeonPartyChanged     = errors.New("dungeon party changed, try again")
+	ErrDungeonNotForming       = errors.New("dungeon party is no longer forming")
+	ErrDungeonNotInProgress    = errors.New("dungeon run is not in progress")
+	ErrDungeonTimeUp           = errors.New("dungeon time limit has run out")
+	ErrNotDungeonLeader        = errors.New("only the party leader can do this")
+	ErrNotDungeonParticipant   = errors.New("not a participant of this dungeon")
+	ErrDungeonAttackCooldown   = errors.New("attack is on cooldown")
+	ErrDungeonWithoutBosses    = errors.New("dungeon has no bosses")
+	ErrDungeonPartyOnly        = errors.New("this dungeon party is reserved for the leader's party")
+)
+
+const (
+	// DungeonFormingTimeout is how long a party has to fill up and start
+	DungeonFormingTimeout = 15 * time.Minute
+	// DungeonIdleTimeout abandons a running instance nobody has fought in
+	DungeonIdleTimeout    = 10 * time.Minute
+	DungeonAttackCooldown = 3 * time.Second
+	// DungeonAttackRounds is how many combat rounds one attack stands for
+	DungeonAttackRounds = 10
+	// DungeonCritMultiplier scales critical hits
+	DungeonCritMultiplier = 1.5
+	DungeonBatchSize      = 50
+)
+
+// System ledger account dungeon gold rewards are paid from
+const SystemDungeonReward = "dungeon_reward"
+
+// character_cooldowns types counting dungeon entries per dungeon
+const (
+	DungeonEntryCooldown       = "dungeon_entry"
+	DungeonWeeklyEntryCooldown = "dungeon_entry_weekly"
+)
+
+type DungeonService struct {
+	db      *database.DB
+	ledger  *LedgerService
+	guilds  *GuildService
+	bonuses *GuildBonusService
+	tax     *TaxService
+	parties *PartyService
+}
+
+func NewDungeonService(db *database.DB, ledger *LedgerService, guilds *GuildService, bonuses *GuildBonusService, tax *TaxService, parties *PartyService) *DungeonService {
+	return &DungeonService{db: db, ledger: ledger, guilds: guilds, bonuses: bonuses, tax: tax, parties: parties}
+}
+
+const dungeonColumns = `id, name, description, COALESCE(min_level, 1), COALESCE(min_gear_score, 0),
+	COALESCE(has_normal, true), COALESCE(has_hard, true), COALESCE(has_nightmare, true), COALESCE(has_hell, false),
+	COALESCE(required_players, 5), COALESCE(requires_all_classes, true), COALESCE(daily_entries, 3), weekly_entries,
+	COALESCE(time_limit_minutes, 60), COALESCE(base_exp_reward, 0), COALESCE(base_gold_reward, 0),
+	COALESCE(is_cross_server, false), map_id`
+
+func scanDungeon(row pgx.Row) (*models.Dungeon, error) {
+	var d models.Dungeon
+	var has [4]bool
+	err := row.Scan(&d.ID, &d.Name, &d.Description, &d.MinLevel, &d.MinGearScore,
+		&has[0], &has[1], &has[2], &has[3],
+		&d.RequiredPlayers, &d.RequiresAllClasses, &d.DailyEntries, &d.WeeklyEntries,
+		&d.TimeLimitMinutes, &d.BaseExpReward, &d.BaseGoldReward, &d.IsCrossServer, &d.MapID)
+	if err != nil {
+		return nil, err
+	}
+	d.Difficulties = []models.DungeonDifficulty{}
+	for i, difficulty := range models.DungeonDifficulties {
+		if has[i] {
+			d.Difficulties = append(d.Difficulties, difficulty)
+		}
+	}
+	return &d, nil
+}
+
+func getDungeon(ctx context.Context, q querier, dungeonID int) (*models.Dungeon, error) {
+	d, err := scanDungeon(q.QueryRow(ctx, `
+		SELECT `+dungeonColumns+` FROM dungeon_definitions WHERE id = $1 AND COALESCE(is_active, true)
+	`, dungeonID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDungeonNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dungeon: %w", err)
+	}
+	return d, nil
+}
+
+const dungeonBossColumns = `id, name, description, base_hp, base_attack, base_defense, COALESCE(base_speed, 10),
+	COALESCE(boss_order, 1), COALESCE(is_final_boss, false), loot_table_id`
+
+func scanDungeonBoss(row pgx.Row) (*models.DungeonBoss, error) {
+	var b models.DungeonBoss
+	if err := row.Scan(&b.ID, &b.Name, &b.Description, &b.HP, &b.Attack, &b.Defense, &b.Speed,
+		&b.BossOrder, &b.IsFinalBoss, &b.LootTableID); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func dungeonBosses(ctx context.Context, q querier, dungeonID int) ([]*models.DungeonBoss, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+dungeonBossColumns+` FROM dungeon_bosses WHERE dungeon_id = $1 ORDER BY boss_order, id
+	`, dungeonID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dungeon bosses: %w", err)
+	}
+	defer rows.Close()
+
+	bosses := []*models.DungeonBoss{}
+	for rows.Next() {
+		b, err := scanDungeonBoss(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dungeon boss: %w", err)
+		}
+		bosses = append(bosses, b)
+	}
+	return bosses, rows.Err()
+}
+
+// nextDungeonBoss returns the first boss after order, nil after the last
+func nextDungeonBoss(ctx context.Context, q querier, dungeonID, order int) (*models.DungeonBoss, error) {
+	b, err := scanDungeonBoss(q.QueryRow(ctx, `
+		SELECT `+dungeonBossColumns+` FROM dungeon_bosses
+		WHERE dungeon_id = $1 AND COALESCE(boss_order, 1) > $2
+		ORDER BY boss_order, id LIMIT 1
+	`, dungeonID, order))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dungeon boss: %w", err)
+	}
+	return b, nil
+}
+
+const dungeonInstanceColumns = `i.id, i.dungeon_id, d.name, i.server_id, COALESCE(i.difficulty, 'normal')::text,
+	COALESCE(i.status, 'forming'), i.created_at, i.started_at, i.completed_at, i.expires_at, i.last_activity_at,
+	COALESCE(i.current_boss_order, 0), COALESCE(i.bosses_defeated, 0), i.total_bosses, i.leader_id,
+	COALESCE(i.is_cross_server, false), i.boss_hp, i.boss_max_hp`
+
+func scanDungeonInstance(row pgx.Row) (*models.DungeonInstance, error) {
+	var i models.DungeonInstance
+	if err := row.Scan(&i.ID, &i.DungeonID, &i.DungeonName, &i.ServerID, &i.Difficulty,
+		&i.Status, &i.CreatedAt, &i.StartedAt, &i.CompletedAt, &i.ExpiresAt, &i.LastActivityAt,
+		&i.CurrentBossOrder, &i.BossesDefeated, &i.TotalBosses, &i.LeaderID,
+		&i.IsCrossServer, &i.BossHP, &i.BossMaxHP); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// getDungeonInstance reads an instance, locking its row when forUpdate is
+// set. Participants' characters are locked before instance rows.
+func getDungeonInstance(ctx context.Context, q querier, instanceID uuid.UUID, forUpdate bool) (*models.DungeonInstance, error) {
+	query := `SELECT ` + dungeonInstanceColumns + `
+		FROM dungeon_instances i
+		JOIN dungeon_definitions d ON d.id = i.dungeon_id
+		WHERE i.id = $1`
+	if forUpdate {
+		query += " FOR UPDATE OF i"
+	}
+	inst, err := scanDungeonInstance(q.QueryRow(ctx, query, instanceID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDungeonInstanceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dungeon instance: %w", err)
+	}
+	return inst, nil
+}
+
+func dungeonParticipants(ctx context.Context, q querier, instanceID uuid.UUID) ([]*models.DungeonParticipant, error) {
+	rows, err := q.Query(ctx, `
+		SELECT p.character_id, c.name, c.server_id, c.level, p.class, c.specialization, p.role,
+		       COALESCE(p.damage_dealt, 0), COALESCE(p.damage_taken, 0), COALESCE(p.deaths, 0),
+		       COALESCE(p.items_received, 0), COALESCE(p.exp_received, 0), COALESCE(p.gold_received, 0),
+		       COALESCE(p.is_active, false),
+		       p.left_at, p.joined_at
+		FROM dungeon_participants p
+		JOIN characters c ON c.id = p.character_id
+		WHERE p.instance_id = $1
+		ORDER BY p.joined_at, p.character_id
+	`, instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dungeon participants: %w", err)
+	}
+	defer rows.Close()
+
+	participants := []*models.DungeonParticipant{}
+	for rows.Next() {
+		var p models.DungeonParticipant
+		if err := rows.Scan(&p.CharacterID, &p.Name, &p.ServerID, &p.Level, &p.Class, &p.Specialization, &p.Role,
+			&p.DamageDealt, &p.DamageTaken, &p.Deaths,
+			&p.ItemsReceived, &p.ExpReceived, &p.GoldReceived, &p.IsActive,
+			&p.LeftAt, &p.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan dungeon participant: %w", err)
+		}
+		participants = append(participants, &p)
+	}
+	return participants, rows.Err()
+}
+
+// activeParticipants returns the participants still in the instance
+func activeParticipants(participants []*models.DungeonParticipant) []*models.DungeonParticipant {
+	var active []*models.DungeonParticipant
+	for _, p := range participants {
+		if p.IsActive {
+			active = append(active, p)
+		}
+	}
+	return active
+}
+
+func participantIDs(participants []*models.DungeonParticipant) []uuid.UUID {
+	ids := make([]uuid.UUID, len(participants))
+	for i, p := range participants {
+		ids[i] = p.CharacterID
+	}
+	return ids
+}
+
+// lockDungeonParty locks the characters of an instance's active party and
+// any extra characters, then the instance. It fails with
+// ErrDungeonPartyChanged if someone joined in between.
+func lockDungeonParty(ctx context.Context, tx pgx.Tx, instanceID uuid.UUID, extra ...uuid.UUID) (map[uuid.UUID]*characterRef, *models.DungeonInstance, []*models.DungeonParticipant, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT character_id FROM dungeon_participants WHERE instance_id = $1 AND is_active
+	`, instanceID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get dungeon party: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to scan dungeon party: %w", err)
+	}
+
+	locked, err := lockCharacters(ctx, tx, append(ids, extra...)...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	inst, err := getDungeonInstance(ctx, tx, instanceID, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	participants, err := dungeonParticipants(ctx, tx, instanceID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, p := range activeParticipants(participants) {
+		if _, ok := locked[p.CharacterID]; !ok {
+			return nil, nil, nil, ErrDungeonPartyChanged
+		}
+	}
+	return locked, inst, participants, nil
+}
+
+// dungeonMember is what entry checks need to know about a character
+type dungeonMember struct {
+	ID        uuid.UUID
+	Name      string
+	Level     int
+	GearScore int
+	Class     models.CharacterClass
+}
+
+func getDungeonMember(ctx context.Context, q querier, characterID uuid.UUID) (*dungeonMember, error) {
+	var m dungeonMember
+	err := q.QueryRow(ctx, `
+		SELECT id, name, level, COALESCE(gear_score, 0), class FROM characters WHERE id = $1 AND deleted_at IS NULL
+	`, characterID).Scan(&m.ID, &m.Name, &m.Level, &m.GearScore, &m.Class)
+	if err != nil {
+		return nil, ErrCharacterNotFound
+	}
+	return &m, nil
+}
+
+// inDungeon reports whether a character is in a forming or running party
+func inDungeon(ctx context.Context, q querier, characterID uuid.UUID) (bool, error) {
+	var in bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM dungeon_participants p
+			JOIN dungeon_instances i ON i.id = p.instance_id
+			WHERE p.character_id = $1 AND p.is_active AND i.status IN ('forming', 'in_progress')
+		)
+	`, characterID).Scan(&in)
+	if err != nil {
+		return false, fmt.Errorf("failed to check dungeon party: %w", err)
+	}
+	return in, nil
+}
+
+// checkNotInDungeon fails while a character is in a dungeon party or the
+// matchmaking queue
+func checkNotInDungeon(ctx context.Context, q querier, characterID uuid.UUID) error {
+	in, err := inDungeon(ctx, q, characterID)
+	if err != nil {
+		return err
+	}
+	if in {
+		return ErrAlreadyInDungeon
+	}
+	queued, err := inDungeonQueue(ctx, q, characterID)
+	if err != nil {
+		return err
+	}
+	if queued {
+		return ErrAlreadyQueued
+	}
+	return nil
+}
+
+// dungeonEntryResets returns when the current day's and week's dungeon
+// entries reset
+func dungeonEntryResets(now time.Time) (time.Time, time.Time) {
+	y, m, d := now.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	week := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	return day.AddDate(0, 0, 1), week.AddDate(0, 0, 7)
+}
+
+// entriesLeft returns a character's entries left today and, for dungeons
+// with a weekly cap, this week. The guild's extra_entries bonus is a count
+// of extra daily entries.
+func (s *DungeonService) entriesLeft(ctx context.Context, q querier, characterID uuid.UUID, d *models.Dungeon) (int, *int, error) {
+	bonus, err := s.bonuses.Resolve(ctx, characterID, models.BonusActivityDungeon)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT cooldown_type, COALESCE(uses_today, 0) FROM character_cooldowns
+		WHERE character_id = $1 AND reference_id = $2 AND cooldown_type IN ($3, $4) AND resets_at > NOW()
+	`, characterID, strconv.Itoa(d.ID), DungeonEntryCooldown, DungeonWeeklyEntryCooldown)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get dungeon entries: %w", err)
+	}
+	defer rows.Close()
+
+	used := map[string]int{}
+	for rows.Next() {
+		var kind string
+		var n int
+		if err := rows.Scan(&kind, &n); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan dungeon entries: %w", err)
+		}
+		used[kind] = n
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	daily := max(0, d.DailyEntries+int(bonus.Percentage(models.BonusExtraEntries))-used[DungeonEntryCooldown])
+	var weekly *int
+	if d.WeeklyEntries != nil {
+		left := max(0, *d.WeeklyEntries-used[DungeonWeeklyEntryCooldown])
+		weekly = &left
+	}
+	return daily, weekly, nil
+}
+
+// checkDungeonEntry checks a character may enter a dungeon
+func (s *DungeonService) checkDungeonEntry(ctx context.Context, q querier, m *dungeonMember, d *models.Dungeon) error {
+	minLevel := d.MinLevel
+	if d.IsCrossServer {
+		minLevel = max(minLevel, models.CrossServerMinLevel)
+	}
+	if m.Level < minLevel {
+		return fmt.Errorf("%s: %w", m.Name, ErrDungeonLevelTooLow)
+	}
+	if m.GearScore < d.MinGearScore {
+		return fmt.Errorf("%s: %w", m.Name, ErrDungeonGearScoreTooLow)
+	}
+	if err := checkNotInPrison(ctx, q, m.ID); err != nil {
+		return err
+	}
+	daily, weekly, err := s.entriesLeft(ctx, q, m.ID, d)
+	if err != nil {
+		return err
+	}
+	if daily == 0 || (weekly != nil && *weekly == 0) {
+		return fmt.Errorf("%s: %w", m.Name, ErrDungeonEntriesExhausted)
+	}
+	return nil
+}
+
+// consumeDungeonEntry counts a run against a character's entries
+func consumeDungeonEntry(ctx context.Context, tx pgx.Tx, characterID uuid.UUID, d *models.Dungeon, now time.Time) error {
+	type entryCap struct {
+		kind    string
+		max     int
+		resetAt time.Time
+	}
+	dayReset, weekReset := dungeonEntryResets(now)
+	entries := []entryCap{{DungeonEntryCooldown, d.DailyEntries, dayReset}}
+	if d.WeeklyEntries != nil {
+		entries = append(entries, entryCap{DungeonWeeklyEntryCooldown, *d.WeeklyEntries, weekReset})
+	}
+
+	for _, e := range entries {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO character_cooldowns (character_id, cooldown_type, reference_id, uses_today, max_uses_daily, last_used_at, resets_at)
+			VALUES ($1, $2, $3, 1, $4, NOW(), $5)
+			ON CONFLICT (character_id, cooldown_type, reference_id) DO UPDATE SET
+				uses_today = CASE WHEN character_cooldowns.resets_at > NOW()
+					THEN COALESCE(character_cooldowns.uses_today, 0) + 1 ELSE 1 END,
+				max_uses_daily = EXCLUDED.max_uses_daily,
+				last_used_at = NOW(),
+				resets_at = EXCLUDED.resets_at
+		`, characterID, e.kind, strconv.Itoa(d.ID), e.max, e.resetAt)
+		if err != nil {
+			return fmt.Errorf("failed to count dungeon entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkDungeonParty checks a party against the dungeon's size and, when it
+// requires all classes, the five-class rule (5.1)
+func checkDungeonParty(d *models.Dungeon, participants []*models.DungeonParticipant) error {
+	if len(participants) != d.RequiredPlayers {
+		return ErrDungeonPartyIncomplete
+	}
+	if !d.RequiresAllClasses {
+		return nil
+	}
+	classes := make(map[models.CharacterClass]int, len(models.DungeonClasses))
+	for _, p := range participants {
+		classes[p.Class]++
+	}
+	for _, class := range models.DungeonClasses {
+		if classes[class] != 1 {
+			return ErrDungeonPartyIncomplete
+		}
+	}
+	return nil
+}
+
+// Create opens a forming party for a dungeon at a difficulty with the
+// acting character as leader
+func (s *DungeonService) Create(ctx context.Context, accountID, characterID uuid.UUID, dungeonID int, difficulty models.DungeonDifficulty) (*models.DungeonInstance, error) {
+	if !difficulty.Valid() {
+		return nil, ErrInvalidDifficulty
+	}
+
+	var instanceID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		d, err := getDungeon(ctx, tx, dungeonID)
+		if err != nil {
+			return err
+		}
+		if !d.HasDifficulty(difficulty) {
+			return ErrDifficultyUnavailable
+		}
+		if err := checkNotInDungeon(ctx, tx, c.ID); err != nil {
+			return err
+		}
+		// A party enters together, opened by its leader
+		party, err := s.parties.PartyOf(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		if party != nil && party.LeaderID != c.ID {
+			return ErrNotPartyLeader
+		}
+		m, err := getDungeonMember(ctx, tx, c.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkDungeonEntry(ctx, tx, m, d); err != nil {
+			return err
+		}
+
+		if instanceID, err = insertDungeonInstance(ctx, tx, d, c.ServerID, difficulty, c.ID); err != nil {
+			return err
+		}
+		return addDungeonParticipant(ctx, tx, instanceID, m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetInstance(ctx, accountID, characterID, instanceID)
+}
+
+// insertDungeonInstance opens a forming instance of a dungeon hosted on a
+// server. Instances of cross-server dungeons are open to every server.
+func insertDungeonInstance(ctx context.Context, tx pgx.Tx, d *models.Dungeon, serverID int, difficulty models.DungeonDifficulty, leaderID uuid.UUID) (uuid.UUID, error) {
+	var totalBosses int
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM dungeon_bosses WHERE dungeon_id = $1", d.ID).Scan(&totalBosses); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to count dungeon bosses: %w", err)
+	}
+	if totalBosses == 0 {
+		return uuid.Nil, ErrDungeonWithoutBosses
+	}
+
+	var instanceID uuid.UUID
+	err := tx.QueryRow(ctx, `
+		INSERT INTO dungeon_instances (dungeon_id, server_id, difficulty, status, expires_at, total_bosses, leader_id, is_cross_server, last_activity_at)
+		VALUES ($1, $2, $3::dungeon_difficulty, 'forming', $4, $5, $6, $7, NOW())
+		RETURNING id
+	`, d.ID, serverID, difficulty, time.Now().Add(DungeonFormingTimeout), totalBosses, leaderID, d.IsCrossServer).Scan(&instanceID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create dungeon instance: %w", err)
+	}
+	return instanceID, nil
+}
+
+func addDungeonParticipant(ctx context.Context, tx pgx.Tx, instanceID uuid.UUID, m *dungeonMember) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO dungeon_participants (instance_id, character_id, class, role)
+		SELECT $1, id, class, $3 FROM characters WHERE id = $2
+	`, instanceID, m.ID, models.DungeonRoles[m.Class])
+	if err != nil {
+		return fmt.Errorf("failed to join dungeon: %w", err)
+	}
+	_, err = tx.Exec(ctx, "UPDATE dungeon_instances SET last_activity_at = NOW() WHERE id = $1", instanceID)
+	if err != nil {
+		return fmt.Errorf("failed to update dungeon instance: %w", err)
+	}
+	return nil
+}
+
+// Join adds the acting character to a forming party on their server or a
+// cross-server party. Parties that need all classes take one character of
+// each.
+func (s *DungeonService) Join(ctx context.Context, accountID, characterID, instanceID uuid.UUID) (*models.DungeonInstance, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		inst, err := getDungeonInstance(ctx, tx, instanceID, true)
+		if err != nil {
+			return err
+		}
+		if !inst.OpenTo(c.ServerID) {
+			return ErrDungeonInstanceNotFound
+		}
+		if inst.Status != models.DungeonForming || (inst.ExpiresAt != nil && !time.Now().Before(*inst.ExpiresAt)) {
+			return ErrDungeonNotForming
+		}
+		if err := checkNotInDungeon(ctx, tx, c.ID); err != nil {
+			return err
+		}
+		if err := s.checkPartyEntry(ctx, inst, c.ID); err != nil {
+			return err
+		}
+
+		d, err := getDungeon(ctx, tx, inst.DungeonID)
+		if err != nil {
+			return err
+		}
+		m, err := getDungeonMember(ctx, tx, c.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkDungeonEntry(ctx, tx, m, d); err != nil {
+			return err
+		}
+
+		participants, err := dungeonParticipants(ctx, tx, inst.ID)
+		if err != nil {
+			return err
+		}
+		active := activeParticipants(participants)
+		if len(active) >= d.RequiredPlayers {
+			return ErrDungeonPartyFull
+		}
+		if d.RequiresAllClasses {
+			for _, p := range active {
+				if p.Class == m.Class {
+					return ErrDungeonClassTaken
+				}
+			}
+		}
+		return addDungeonParticipant(ctx, tx, inst.ID, m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetInstance(ctx, accountID, characterID, instanceID)
+}
+
+// checkPartyEntry keeps an instance opened by a party leader to that party
+func (s *DungeonService) checkPartyEntry(ctx context.Context, inst *models.DungeonInstance, characterID uuid.UUID) error {
+	if inst.LeaderID == nil {
+		return nil
+	}
+	party, err := s.parties.PartyOf(ctx, *inst.LeaderID)
+	if err != nil || party == nil {
+		return err
+	}
+	same, err := s.parties.SameParty(ctx, *inst.LeaderID, characterID)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return ErrDungeonPartyOnly
+	}
+	return nil
+}
+
+// Leave takes the acting character out of a party. A forming party breaks
+// up when its leader leaves; a running one passes the lead on and is
+// abandoned once nobody is left.
+func (s *DungeonService) Leave(ctx context.Context, accountID, characterID, instanceID uuid.UUID) error {
+	return s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		inst, err := getDungeonInstance(ctx, tx, instanceID, true)
+		if err != nil {
+			return err
+		}
+		if inst.Status != models.DungeonForming && inst.Status != models.DungeonInProgress {
+			return ErrDungeonNotInProgress
+		}
+		participants, err := dungeonParticipants(ctx, tx, inst.ID)
+		if err != nil {
+			return err
+		}
+		var remaining []*models.DungeonParticipant
+		found := false
+		for _, p := range activeParticipants(participants) {
+			if p.CharacterID == characterID {
+				found = true
+				continue
+			}
+			remaining = append(remaining, p)
+		}
+		if !found {
+			return ErrNotDungeonParticipant
+		}
+		isLeader := inst.LeaderID != nil && *inst.LeaderID == characterID
+
+		if inst.Status == models.DungeonForming {
+			if isLeader {
+				return closeDungeon(ctx, tx, inst, models.DungeonAbandoned)
+			}
+			_, err := tx.Exec(ctx, `
+				DELETE FROM dungeon_participants WHERE instance_id = $1 AND character_id = $2
+			`, inst.ID, characterID)
+			if err != nil {
+				return fmt.Errorf("failed to leave dungeon: %w", err)
+			}
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE dungeon_participants SET is_active = false, left_at = NOW()
+			WHERE instance_id = $1 AND character_id = $2
+		`, inst.ID, characterID)
+		if err != nil {
+			return fmt.Errorf("failed to leave dungeon: %w", err)
+		}
+		if len(remaining) == 0 {
+			return closeDungeon(ctx, tx, inst, models.DungeonAbandoned)
+		}
+		if isLeader {
+			_, err := tx.Exec(ctx, "UPDATE dungeon_instances SET leader_id = $2 WHERE id = $1", inst.ID, remaining[0].CharacterID)
+			if err != nil {
+				return fmt.Errorf("failed to pass dungeon lead: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Start takes a full party into the dungeon
+func (s *DungeonService) Start(ctx context.Context, accountID, characterID, instanceID uuid.UUID) (*models.DungeonInstance, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, inst, participants, err := lockDungeonParty(ctx, tx, instanceID, characterID)
+		if err != nil {
+			return err
+		}
+		if locked[characterID].AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		if !inst.OpenTo(locked[characterID].ServerID) {
+			return ErrDungeonInstanceNotFound
+		}
+		if inst.LeaderID == nil || *inst.LeaderID != characterID {
+			return ErrNotDungeonLeader
+		}
+		now := time.Now()
+		if inst.Status != models.DungeonForming || (inst.ExpiresAt != nil && !now.Before(*inst.ExpiresAt)) {
+			return ErrDungeonNotForming
+		}
+
+		d, err := getDungeon(ctx, tx, inst.DungeonID)
+		if err != nil {
+			return err
+		}
+		party := activeParticipants(participants)
+		if err := checkDungeonParty(d, party); err != nil {
+			return err
+		}
+		return s.beginDungeonRun(ctx, tx, inst, d, participantIDs(party), now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetInstance(ctx, accountID, characterID, instanceID)
+}
+
+// beginDungeonRun takes a forming instance into its first boss. Every
+// member must still meet the entry requirements and the run counts against
+// their entries.
+func (s *DungeonService) beginDungeonRun(ctx context.Context, tx pgx.Tx, inst *models.DungeonInstance, d *models.Dungeon, party []uuid.UUID, now time.Time) error {
+	for _, id := range party {
+		m, err := getDungeonMember(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.checkDungeonEntry(ctx, tx, m, d); err != nil {
+			return err
+		}
+		if err := consumeDungeonEntry(ctx, tx, id, d, now); err != nil {
+			return err
+		}
+	}
+
+	boss, err := nextDungeonBoss(ctx, tx, d.ID, 0)
+	if err != nil {
+		return err
+	}
+	if boss == nil {
+		return ErrDungeonWithoutBosses
+	}
+	boss = boss.Scaled(inst.Difficulty)
+	_, err = tx.Exec(ctx, `
+		UPDATE dungeon_instances SET status = 'in_progress', started_at = $2, expires_at = $3,
+			current_boss_order = $4, boss_hp = $5, boss_max_hp = $5, last_activity_at = $2
+		WHERE id = $1
+	`, inst.ID, now, now.Add(time.Duration(d.TimeLimitMinutes)*time.Minute), boss.BossOrder, boss.HP)
+	if err != nil {
+		return fmt.Errorf("failed to start dungeon: %w", err)
+	}
+	return nil
+}
+
+// dungeonHit rolls the damage of one attack. Each round deals attack
+// reduced by defense, DungeonAttackRounds rounds to an attack.
+func dungeonHit(attack, defense int, critRate, multiplier float64) (int64, bool) {
+	perRound := float64(attack) * 100 / float64(100+max(0, defense))
+	damage := perRound * DungeonAttackRounds * multiplier * (0.9 + rand.Float64()*0.2)
+	crit := rand.Float64()*100 < critRate
+	if crit {
+		damage *= DungeonCritMultiplier
+	}
+	return int64(math.Max(1, math.Round(damage))), crit
+}
+
+// Attack hits the current boss. The boss hits back and when it falls every
+// member rolls its loot and the party moves on to the next boss; the run
+// completes with the final boss.
+func (s *DungeonService) Attack(ctx context.Context, accountID, characterID, instanceID uuid.UUID) (*models.DungeonAttack, error) {
+	bonus, err := s.bonuses.Resolve(ctx, characterID, models.BonusActivityDungeon)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.DungeonAttack{}
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, inst, participants, err := lockDungeonParty(ctx, tx, instanceID)
+		if err != nil {
+			return err
+		}
+		me, ok := locked[characterID]
+		if !ok {
+			return ErrNotDungeonParticipant
+		}
+		if me.AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		now := time.Now()
+		if inst.Status != models.DungeonInProgress {
+			return ErrDungeonNotInProgress
+		}
+		if inst.ExpiresAt != nil && !now.Before(*inst.ExpiresAt) {
+			return ErrDungeonTimeUp
+		}
+
+		var lastAttackAt *time.Time
+		err = tx.QueryRow(ctx, `
+			SELECT last_attack_at FROM dungeon_participants WHERE instance_id = $1 AND character_id = $2
+		`, inst.ID, characterID).Scan(&lastAttackAt)
+		if err != nil {
+			return fmt.Errorf("failed to get dungeon participant: %w", err)
+		}
+		if lastAttackAt != nil && now.Sub(*lastAttackAt) < DungeonAttackCooldown {
+			return ErrDungeonAttackCooldown
+		}
+
+		st, err := loadFlagState(ctx, tx, characterID, false)
+		if err != nil {
+			return err
+		}
+		stats, err := combatStats(ctx, tx, st)
+		if err != nil {
+			return err
+		}
+		boss, err := nextDungeonBoss(ctx, tx, inst.DungeonID, inst.CurrentBossOrder-1)
+		if err != nil {
+			return err
+		}
+		if boss == nil {
+			return ErrDungeonWithoutBosses
+		}
+		boss = boss.Scaled(inst.Difficulty)
+
+		damage, crit := dungeonHit(stats.Attack, boss.Defense, stats.CritRate, bonus.Multiplier(models.BonusBossDamage))
+		hp := boss.HP
+		if inst.BossHP != nil {
+			hp = *inst.BossHP
+		}
+		damage = min(damage, hp)
+		counter, _ := dungeonHit(boss.Attack, stats.Defense, 0, 1)
+		result.Damage, result.CounterDamage, result.Critical = damage, counter, crit
+
+		_, err = tx.Exec(ctx, `
+			UPDATE dungeon_participants SET damage_dealt = COALESCE(damage_dealt, 0) + $3,
+				damage_taken = COALESCE(damage_taken, 0) + $4, last_attack_at = $5
+			WHERE instance_id = $1 AND character_id = $2
+		`, inst.ID, characterID, damage, counter, now)
+		if err != nil {
+			return fmt.Errorf("failed to record dungeon attack: %w", err)
+		}
+
+		hp -= damage
+		if hp > 0 {
+			_, err := tx.Exec(ctx, `
+				UPDATE dungeon_instances SET boss_hp = $2, last_activity_at = $3 WHERE id = $1
+			`, inst.ID, hp, now)
+			if err != nil {
+				return fmt.Errorf("failed to update boss: %w", err)
+			}
+			return nil
+		}
+
+		result.BossDefeated = true
+		loot, err := s.rollBossLoot(ctx, tx, inst, boss, activeParticipants(participants))
+		if err != nil {
+			return err
+		}
+		result.Loot = loot[characterID]
+		next, err := nextDungeonBoss(ctx, tx, inst.DungeonID, boss.BossOrder)
+		if err != nil {
+			return err
+		}
+		if next == nil || boss.IsFinalBoss {
+			_, err := tx.Exec(ctx, `
+				UPDATE dungeon_instances SET bosses_defeated = COALESCE(bosses_defeated, 0) + 1, boss_hp = 0,
+					last_activity_at = $2
+				WHERE id = $1
+			`, inst.ID, now)
+			if err != nil {
+				return fmt.Errorf("failed to update boss: %w", err)
+			}
+			return s.completeDungeon(ctx, tx, inst, activeParticipants(participants))
+		}
+		next = next.Scaled(inst.Difficulty)
+		_, err = tx.Exec(ctx, `
+			UPDATE dungeon_instances SET bosses_defeated = COALESCE(bosses_defeated, 0) + 1,
+				current_boss_order = $2, boss_hp = $3, boss_max_hp = $3, last_activity_at = $4
+			WHERE id = $1
+		`, inst.ID, next.BossOrder, next.HP, now)
+		if err != nil {
+			return fmt.Errorf("failed to advance dungeon: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Instance, err = s.GetInstance(ctx, accountID, characterID, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// completeDungeon ends a locked instance whose final boss fell and rewards
+// the members still in it. EXP scales with the difficulty and the guild's
+// dungeon_exp bonus. Gold is paid on each member's home server, and
+// cross-server clears count toward the weekly ranking.
+func (s *DungeonService) completeDungeon(ctx context.Context, tx pgx.Tx, inst *models.DungeonInstance, party []*models.DungeonParticipant) error {
+	d, err := getDungeon(ctx, tx, inst.DungeonID)
+	if err != nil {
+		return err
+	}
+	expMultiplier := models.DifficultyModifiers[inst.Difficulty].ExpMultiplier
+
+	for _, p := range party {
+		bonus, err := s.bonuses.Resolve(ctx, p.CharacterID, models.BonusActivityDungeon)
+		if err != nil {
+			return err
+		}
+		exp := int(math.Round(float64(d.BaseExpReward) * expMultiplier * bonus.Multiplier(models.BonusDungeonExp)))
+		if err := grantExp(ctx, tx, p.CharacterID, exp); err != nil {
+			return err
+		}
+		if d.BaseGoldReward > 0 {
+			err := s.ledger.Post(ctx, tx, &Posting{
+				ServerID:      p.ServerID,
+				Currency:      models.CurrencyGold,
+				Amount:        int64(d.BaseGoldReward),
+				From:          SystemAccount(SystemDungeonReward),
+				To:            CharacterAccount(p.CharacterID),
+				Reason:        "dungeon_reward",
+				ReferenceType: "dungeon_instance",
+				ReferenceID:   &inst.ID,
+			})
+			if err != nil {
+				return err
+			}
+			if err := s.levyDungeonTax(ctx, tx, inst, d, p); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE dungeon_participants SET exp_received = COALESCE(exp_received, 0) + $3,
+				gold_received = COALESCE(gold_received, 0) + $4
+			WHERE instance_id = $1 AND character_id = $2
+		`, inst.ID, p.CharacterID, exp, d.BaseGoldReward)
+		if err != nil {
+			return fmt.Errorf("failed to record dungeon reward: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE characters SET dungeons_completed = COALESCE(dungeons_completed, 0) + 1 WHERE id = ANY($1)
+	`, participantIDs(party))
+	if err != nil {
+		return fmt.Errorf("failed to count completed dungeon: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE dungeon_instances SET status = 'completed', completed_at = NOW() WHERE id = $1
+	`, inst.ID)
+	if err != nil {
+		return fmt.Errorf("failed to complete dungeon: %w", err)
+	}
+	if inst.IsCrossServer {
+		if err := recordCrossServerClear(ctx, tx, inst, d, party); err != nil {
+			return err
+		}
+	}
+	return s.guilds.RecordActivities(ctx, tx, participantIDs(party), models.GuildActivityDungeonsClear, 1)
+}
+
+// levyDungeonTax takes the zone tax on a participant's clear gold for the
+// guild holding the dungeon's entrance. Cross-server participants pay on
+// their home server, where they were paid. Dungeons without an entrance map
+// are untaxed.
+func (s *DungeonService) levyDungeonTax(ctx context.Context, tx pgx.Tx, inst *models.DungeonInstance, d *models.Dungeon, p *models.DungeonParticipant) error {
+	if d.MapID == nil {
+		return nil
+	}
+	_, err := s.tax.Levy(ctx, tx, &TaxableIncome{
+		ServerID:      p.ServerID,
+		CharacterID:   p.CharacterID,
+		Activity:      models.TaxDungeon,
+		Amount:        int64(d.BaseGoldReward),
+		MapID:         *d.MapID,
+		ZoneType:      ZoneTypeDungeonEntrance,
+		ReferenceType: "dungeon_instance",
+		ReferenceID:   &inst.ID,
+	})
+	return err
+}
+
+// closeDungeon ends a locked instance without a clear. A failed run counts
+// against the members still in it, whose characters must be locked.
+func closeDungeon(ctx context.Context, tx pgx.Tx, inst *models.DungeonInstance, status models.DungeonInstanceStatus) error {
+	if status == models.DungeonFailed {
+		_, err := tx.Exec(ctx, `
+			UPDATE characters SET dungeons_failed = COALESCE(dungeons_failed, 0) + 1
+			WHERE id IN (SELECT character_id FROM dungeon_participants WHERE instance_id = $1 AND is_active)
+		`, inst.ID)
+		if err != nil {
+			return fmt.Errorf("failed to count failed dungeon: %w", err)
+		}
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE dungeon_participants SET is_active = false, left_at = COALESCE(left_at, NOW())
+		WHERE instance_id = $1 AND is_active
+	`, inst.ID)
+	if err != nil {
+		return fmt.Errorf("failed to release dungeon party: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE dungeon_instances SET status = $2, completed_at = NOW() WHERE id = $1
+	`, inst.ID, status)
+	if err != nil {
+		return fmt.Errorf("failed to close dungeon: %w", err)
+	}
+	return nil
+}
+
+// ProcessInstances times out instances: forming parties that did not start
+// and idle runs are abandoned, runs past their time limit fail
+func (s *DungeonService) ProcessInstances(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM dungeon_instances
+		WHERE (status IN ('forming', 'in_progress') AND expires_at <= NOW())
+		   OR (status = 'in_progress' AND last_activity_at <= $1)
+		ORDER BY expires_at
+		LIMIT $2
+	`, time.Now().Add(-DungeonIdleTimeout), DungeonBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find stale dungeon instances: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan stale dungeon instances: %w", err)
+	}
+
+	processed := 0
+	for _, id := range ids {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			_, inst, _, err := lockDungeonParty(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			expired := inst.ExpiresAt != nil && !now.Before(*inst.ExpiresAt)
+			switch {
+			case inst.Status == models.DungeonForming && expired:
+				processed++
+				return closeDungeon(ctx, tx, inst, models.DungeonAbandoned)
+			case inst.Status == models.DungeonInProgress && expired:
+				processed++
+				return closeDungeon(ctx, tx, inst, models.DungeonFailed)
+			case inst.Status == models.DungeonInProgress && inst.LastActivityAt != nil &&
+				now.Sub(*inst.LastActivityAt) >= DungeonIdleTimeout:
+				processed++
+				return closeDungeon(ctx, tx, inst, models.DungeonAbandoned)
+			}
+			return nil
+		})
+		if err != nil {
+			return processed, fmt.Errorf("failed to time out dungeon instance %s: %w", id, err)
+		}
+	}
+	return processed, nil
+}
+
+// RunSweeper times out dungeon instances every interval until ctx is
+// cancelled
+func (s *DungeonService) RunSweeper(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "dungeon sweeper", interval, s.ProcessInstances)
+}
+
+// ListDungeons returns the dungeons with the acting character's entries
+// left in each
+func (s *DungeonService) ListDungeons(ctx context.Context, accountID, characterID uuid.UUID) ([]*models.Dungeon, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+dungeonColumns+` FROM dungeon_definitions WHERE COALESCE(is_active, true) ORDER BY min_level, id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dungeons: %w", err)
+	}
+	var dungeons []*models.Dungeon
+	for rows.Next() {
+		d, err := scanDungeon(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan dungeon: %w", err)
+		}
+		dungeons = append(dungeons, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, d := range dungeons {
+		if d.DailyEntriesLeft, d.WeeklyEntriesLeft, err = s.entriesLeft(ctx, s.db.Pool, characterID, d); err != nil {
+			return nil, err
+		}
+	}
+	return dungeons, nil
+}
+
+// GetDungeon returns a dungeon with its bosses at normal difficulty
+func (s *DungeonService) GetDungeon(ctx context.Context, accountID, characterID uuid.UUID, dungeonID int) (*models.Dungeon, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	d, err := getDungeon(ctx, s.db.Pool, dungeonID)
+	if err != nil {
+		return nil, err
+	}
+	if d.DailyEntriesLeft, d.WeeklyEntriesLeft, err = s.entriesLeft(ctx, s.db.Pool, characterID, d); err != nil {
+		return nil, err
+	}
+	if d.Bosses, err = dungeonBosses(ctx, s.db.Pool, d.ID); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ListInstances returns the parties forming on the acting character's
+// server and the cross-server ones, optionally for one dungeon
+func (s *DungeonService) ListInstances(ctx context.Context, accountID, characterID uuid.UUID, dungeonID *int, limit, offset int) ([]*models.DungeonInstance, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+dungeonInstanceColumns+`
+		FROM dungeon_instances i
+		JOIN dungeon_definitions d ON d.id = i.dungeon_id
+		WHERE (i.server_id = $1 OR i.is_cross_server) AND i.status = 'forming' AND i.expires_at > NOW()
+		  AND ($2::int IS NULL OR i.dungeon_id = $2)
+		ORDER BY i.created_at DESC
+		LIMIT $3 OFFSET $4
+	`, c.ServerID, dungeonID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dungeon instances: %w", err)
+	}
+	var instances []*models.DungeonInstance
+	for rows.Next() {
+		inst, err := scanDungeonInstance(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan dungeon instance: %w", err)
+		}
+		instances = append(instances, inst)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, inst := range instances {
+		if inst.Participants, err = dungeonParticipants(ctx, s.db.Pool, inst.ID); err != nil {
+			return nil, err
+		}
+	}
+	return instances, nil
+}
+
+// GetInstance returns an instance open to the acting character's server
+// with its party and, while running, the current boss
+func (s *DungeonService) GetInstance(ctx context.Context, accountID, characterID, instanceID uuid.UUID) (*models.DungeonInstance, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := getDungeonInstance(ctx, s.db.Pool, instanceID, false)
+	if err != nil {
+		return nil, err
+	}
+	if !inst.OpenTo(c.ServerID) {
+		return nil, ErrDungeonInstanceNotFound
+	}
+	if inst.Participants, err = dungeonParticipants(ctx, s.db.Pool, inst.ID); err != nil {
+		return nil, err
+	}
+	if inst.Status == models.DungeonInProgress {
+		boss, err := nextDungeonBoss(ctx, s.db.Pool, inst.DungeonID, inst.CurrentBossOrder-1)
+		if err != nil {
+			return nil, err
+		}
+		if boss != nil {
+			inst.CurrentBoss = boss.Scaled(inst.Difficulty)
+		}
+	}
+	return inst, nil
+}
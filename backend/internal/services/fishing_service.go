@@ -0,0 +1,712 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrFishingSpotNotFound = errors.New("fishing spot not found")
+	ErrAlreadyFishing      = errors.New("already fishing")
+	ErrNotFishing          = errors.New("not fishing")
+	ErrFishBagFull         = errors.New("fish bag is full")
+	ErrNoFishToSell        = errors.New("no fish to sell")
+	ErrPrisonSpot          = errors.New("only prisoners can fish here")
+	ErrFishingNoPvP        = errors.New("fishers in safe waters cannot be attacked")
+	ErrCannotAttackSelf    = errors.New("cannot attack yourself")
+)
+
+const (
+	// FishingBaseCatchInterval shrinks with fishing level, see gatheringInterval
+	FishingBaseCatchInterval = 30 * time.Second
+
+	// Catches settled per request; a longer backlog is dropped
+	FishingMaxCatchesPerSettle = 120
+	FishBagSize                = 200
+
+	TreacherousAttackDuration = 5 * time.Minute
+
+	FishingSweepBatchSize = 200
+)
+
+// System ledger account paying for sold fish
+const SystemFishSale = "fish_sale"
+
+type FishingService struct {
+	db      *database.DB
+	ledger  *LedgerService
+	karma   *KarmaService
+	tax     *TaxService
+	guilds  *GuildService
+	bonuses *GuildBonusService
+}
+
+func NewFishingService(db *database.DB, ledger *LedgerService, karma *KarmaService, tax *TaxService, guilds *GuildService, bonuses *GuildBonusService) *FishingService {
+	return &FishingService{db: db, ledger: ledger, karma: karma, tax: tax, guilds: guilds, bonuses: bonuses}
+}
+
+// fishingCatchInterval is the time between catches at a fishing level
+func fishingCatchInterval(level int) time.Duration {
+	return gatheringInterval(FishingBaseCatchInterval, level)
+}
+
+// fishingState is a locked character_fishing row with its spot
+type fishingState struct {
+	CharacterID uuid.UUID
+	ServerID    int
+	Level       int
+	Exp         int
+	Total       int
+	Rare        int
+	Legendary   int
+	IsFishing   bool
+	StartedAt   *time.Time
+	NextCatchAt *time.Time
+	Spot        *models.FishingSpot
+	// Bonus is the fisher's guild bonus
+	Bonus *models.ActivityBonus
+}
+
+// catchInterval is the time to the fisher's next catch, shortened by their
+// guild's fishing speed
+func (st *fishingState) catchInterval() time.Duration {
+	return time.Duration(float64(fishingCatchInterval(st.Level)) / st.Bonus.Multiplier(models.BonusFishingSpeed))
+}
+
+const fishingSpotColumns = `s.id, s.map_id, s.name, s.x, s.y, COALESCE(s.radius, 0), COALESCE(s.zone_type, 'safe'),
+	COALESCE(s.min_rarity, 'common'), COALESCE(s.max_rarity, 'rare'), COALESCE(s.rare_chance_bonus, 0), COALESCE(m.is_prison, false)`
+
+func scanFishingSpot(row pgx.Row) (*models.FishingSpot, error) {
+	var sp models.FishingSpot
+	err := row.Scan(&sp.ID, &sp.MapID, &sp.Name, &sp.X, &sp.Y, &sp.Radius, &sp.ZoneType,
+		&sp.MinRarity, &sp.MaxRarity, &sp.RareChanceBonus, &sp.IsPrison)
+	if err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+func getFishingSpot(ctx context.Context, q querier, spotID int) (*models.FishingSpot, error) {
+	sp, err := scanFishingSpot(q.QueryRow(ctx, `
+		SELECT `+fishingSpotColumns+`
+		FROM fishing_spots s
+		JOIN maps m ON m.id = s.map_id
+		WHERE s.id = $1 AND s.is_active
+	`, spotID))
+	if err != nil {
+		return nil, ErrFishingSpotNotFound
+	}
+	return sp, nil
+}
+
+// lockFishing locks the character's fishing row, creating it on first use,
+// and resolves the fisher's guild bonus
+func (s *FishingService) lockFishing(ctx context.Context, tx pgx.Tx, characterID uuid.UUID) (*fishingState, error) {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO character_fishing (character_id) VALUES ($1)
+		ON CONFLICT (character_id) DO NOTHING
+	`, characterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fishing profile: %w", err)
+	}
+
+	var st fishingState
+	var spotID *int
+	err = tx.QueryRow(ctx, `
+		SELECT f.character_id, c.server_id, COALESCE(f.fishing_level, 1), COALESCE(f.fishing_exp, 0),
+		       COALESCE(f.total_fish_caught, 0), COALESCE(f.rare_fish_caught, 0), COALESCE(f.legendary_fish_caught, 0),
+		       COALESCE(f.is_fishing, false), f.current_spot_id, f.fishing_started_at, f.next_catch_at
+		FROM character_fishing f
+		JOIN characters c ON c.id = f.character_id
+		WHERE f.character_id = $1
+		FOR UPDATE OF f
+	`, characterID).Scan(&st.CharacterID, &st.ServerID, &st.Level, &st.Exp,
+		&st.Total, &st.Rare, &st.Legendary,
+		&st.IsFishing, &spotID, &st.StartedAt, &st.NextCatchAt)
+	if err != nil {
+		return nil, ErrCharacterNotFound
+	}
+
+	if spotID != nil {
+		st.Spot, err = scanFishingSpot(tx.QueryRow(ctx, `
+			SELECT `+fishingSpotColumns+`
+			FROM fishing_spots s
+			JOIN maps m ON m.id = s.map_id
+			WHERE s.id = $1
+		`, *spotID))
+		if err != nil {
+			return nil, ErrFishingSpotNotFound
+		}
+	}
+	st.Bonus, err = s.bonuses.Resolve(ctx, characterID, models.BonusActivityFishing)
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// spotFish lists the fish that bite at the spot for a fishing level.
+// rareBonus adds to the spot's own rare chance bonus.
+func spotFish(ctx context.Context, q querier, spot *models.FishingSpot, level int, rareBonus float64) ([]*gatherable, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, name, COALESCE(rarity, 'common'), COALESCE(sell_price, 0)
+		FROM fish_definitions
+		WHERE is_active AND $1 = ANY(spawn_zones)
+		  AND COALESCE(required_fishing_level, 1) <= $2
+		  AND rarity BETWEEN $3::item_rarity AND $4::item_rarity
+	`, string(spot.ZoneType), level, spot.MinRarity, spot.MaxRarity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fish: %w", err)
+	}
+	defer rows.Close()
+
+	var fish []*gatherable
+	for rows.Next() {
+		var f gatherable
+		if err := rows.Scan(&f.ID, &f.Name, &f.Rarity, &f.SellPrice); err != nil {
+			return nil, fmt.Errorf("failed to scan fish: %w", err)
+		}
+		f.Weight = gatheringWeight(f.Rarity, spot.ZoneType, level, spot.RareChanceBonus+rareBonus)
+		fish = append(fish, &f)
+	}
+	return fish, rows.Err()
+}
+
+// settleFishing lands every catch whose timer has run out. Fishing stops when
+// the fish bag fills up. Prisoners' catches count as prison activity.
+func settleFishing(ctx context.Context, tx pgx.Tx, st *fishingState, now time.Time) ([]*models.FishCatch, error) {
+	if !st.IsFishing || st.Spot == nil || st.NextCatchAt == nil || st.NextCatchAt.After(now) {
+		return nil, nil
+	}
+
+	var bag int
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM fishing_catches WHERE character_id = $1 AND sold_at IS NULL
+	`, st.CharacterID).Scan(&bag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count fish bag: %w", err)
+	}
+
+	fish, err := spotFish(ctx, tx, st.Spot, st.Level, st.Bonus.Percentage(models.BonusRareFishChance)/100)
+	if err != nil {
+		return nil, err
+	}
+
+	var catches []*models.FishCatch
+	next := *st.NextCatchAt
+	for !next.After(now) && len(catches) < FishingMaxCatchesPerSettle && bag < FishBagSize {
+		f := rollGatherable(fish)
+		if f == nil {
+			break
+		}
+
+		exp := int(float64(gatheringRarityExp[f.Rarity]) * st.Bonus.Multiplier(models.BonusFishingExp))
+		c := &models.FishCatch{
+			FishID: f.ID, FishName: f.Name, Rarity: f.Rarity, SpotID: st.Spot.ID,
+			Quantity: 1, SellPrice: f.SellPrice, ExpEarned: exp,
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO fishing_catches (character_id, fish_id, spot_id, quantity, exp_earned, caught_at)
+			VALUES ($1, $2, $3, 1, $4, $5)
+			RETURNING id, caught_at
+		`, st.CharacterID, f.ID, st.Spot.ID, exp, next).Scan(&c.ID, &c.CaughtAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record catch: %w", err)
+		}
+		catches = append(catches, c)
+		bag++
+
+		st.Exp += exp
+		st.Level = gatheringLevelFor(st.Exp)
+		st.Total++
+		if isRareOrBetter(f.Rarity) {
+			st.Rare++
+		}
+		if rarityOrder[f.Rarity] >= rarityOrder["legendary"] {
+			st.Legendary++
+		}
+		next = next.Add(st.catchInterval())
+	}
+	if next.Before(now) {
+		next = now.Add(st.catchInterval())
+	}
+	st.NextCatchAt = &next
+	if bag >= FishBagSize {
+		st.IsFishing = false
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE character_fishing SET
+			fishing_level = $2, fishing_exp = $3,
+			total_fish_caught = $4, rare_fish_caught = $5, legendary_fish_caught = $6,
+			is_fishing = $7, next_catch_at = CASE WHEN $7 THEN $8::timestamptz END,
+			current_spot_id = CASE WHEN $7 THEN current_spot_id END,
+			fishing_started_at = CASE WHEN $7 THEN fishing_started_at END,
+			updated_at = NOW()
+		WHERE character_id = $1
+	`, st.CharacterID, st.Level, st.Exp, st.Total, st.Rare, st.Legendary, st.IsFishing, next)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update fishing: %w", err)
+	}
+	if len(catches) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE characters SET total_fish_caught = COALESCE(total_fish_caught, 0) + $2 WHERE id = $1
+	`, st.CharacterID, len(catches))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update fish count: %w", err)
+	}
+
+	if st.Spot.IsPrison {
+		exp := 0
+		for _, c := range catches {
+			exp += c.ExpEarned
+		}
+		err = logPrisonerActivity(ctx, tx, st.CharacterID, &prisonActivity{
+			Type: "fishing", FishCaught: len(catches), Exp: exp,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return catches, nil
+}
+
+func (st *fishingState) status(bag int) *models.FishingStatus {
+	status := &models.FishingStatus{
+		CharacterID:         st.CharacterID,
+		FishingLevel:        st.Level,
+		FishingExp:          st.Exp,
+		NextLevelExp:        gatheringExpForLevel(min(st.Level+1, GatheringMaxLevel)),
+		TotalFishCaught:     st.Total,
+		RareFishCaught:      st.Rare,
+		LegendaryFishCaught: st.Legendary,
+		IsFishing:           st.IsFishing,
+		BagCount:            bag,
+		BagSize:             FishBagSize,
+	}
+	if st.IsFishing {
+		status.Spot = st.Spot
+		status.FishingStartedAt = st.StartedAt
+		status.NextCatchAt = st.NextCatchAt
+	}
+	return status
+}
+
+// withFishing locks the acting character's fishing state, settles due
+// catches, runs fn and returns the resulting status.
+func (s *FishingService) withFishing(ctx context.Context, accountID, characterID uuid.UUID, fn func(tx pgx.Tx, st *fishingState) error) (*models.FishingStatus, error) {
+	var status *models.FishingStatus
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		st, err := s.lockFishing(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		catches, err := settleFishing(ctx, tx, st, time.Now())
+		if err != nil {
+			return err
+		}
+		if fn != nil {
+			if err := fn(tx, st); err != nil {
+				return err
+			}
+		}
+
+		var bag int
+		err = tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM fishing_catches WHERE character_id = $1 AND sold_at IS NULL
+		`, characterID).Scan(&bag)
+		if err != nil {
+			return fmt.Errorf("failed to count fish bag: %w", err)
+		}
+		status = st.status(bag)
+		status.NewCatches = catches
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// GetSpots returns the active fishing spots, optionally on one map
+func (s *FishingService) GetSpots(ctx context.Context, mapID *int) ([]*models.FishingSpot, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+fishingSpotColumns+`
+		FROM fishing_spots s
+		JOIN maps m ON m.id = s.map_id
+		WHERE s.is_active AND ($1::int IS NULL OR s.map_id = $1)
+		ORDER BY s.map_id, s.id
+	`, mapID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fishing spots: %w", err)
+	}
+	defer rows.Close()
+
+	var spots []*models.FishingSpot
+	for rows.Next() {
+		sp, err := scanFishingSpot(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan fishing spot: %w", err)
+		}
+		spots = append(spots, sp)
+	}
+	return spots, rows.Err()
+}
+
+// GetStatus returns the acting character's fishing state, landing any catches
+// that are due.
+func (s *FishingService) GetStatus(ctx context.Context, accountID, characterID uuid.UUID) (*models.FishingStatus, error) {
+	return s.withFishing(ctx, accountID, characterID, nil)
+}
+
+// Start casts a line at a spot. Prison spots are for prisoners only, and
+// prisoners cannot fish anywhere else.
+func (s *FishingService) Start(ctx context.Context, accountID, characterID uuid.UUID, spotID int) (*models.FishingStatus, error) {
+	return s.withFishing(ctx, accountID, characterID, func(tx pgx.Tx, st *fishingState) error {
+		if st.IsFishing {
+			return ErrAlreadyFishing
+		}
+		spot, err := getFishingSpot(ctx, tx, spotID)
+		if err != nil {
+			return err
+		}
+
+		err = checkNotInPrison(ctx, tx, characterID)
+		switch {
+		case errors.Is(err, ErrInPrison):
+			if !spot.IsPrison {
+				return ErrConfinedToPrison
+			}
+		case err != nil:
+			return err
+		case spot.IsPrison:
+			return ErrPrisonSpot
+		}
+
+		var bag int
+		err = tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM fishing_catches WHERE character_id = $1 AND sold_at IS NULL
+		`, characterID).Scan(&bag)
+		if err != nil {
+			return fmt.Errorf("failed to count fish bag: %w", err)
+		}
+		if bag >= FishBagSize {
+			return ErrFishBagFull
+		}
+
+		now := time.Now()
+		next := now.Add(st.catchInterval())
+		_, err = tx.Exec(ctx, `
+			UPDATE character_fishing SET is_fishing = true, current_spot_id = $2,
+				fishing_started_at = $3, next_catch_at = $4, updated_at = NOW()
+			WHERE character_id = $1
+		`, characterID, spot.ID, now, next)
+		if err != nil {
+			return fmt.Errorf("failed to start fishing: %w", err)
+		}
+		st.IsFishing, st.Spot, st.StartedAt, st.NextCatchAt = true, spot, &now, &next
+		return nil
+	})
+}
+
+// Stop reels in, keeping whatever was caught so far
+func (s *FishingService) Stop(ctx context.Context, accountID, characterID uuid.UUID) (*models.FishingStatus, error) {
+	return s.withFishing(ctx, accountID, characterID, func(tx pgx.Tx, st *fishingState) error {
+		if !st.IsFishing {
+			return ErrNotFishing
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE character_fishing SET is_fishing = false, current_spot_id = NULL,
+				fishing_started_at = NULL, next_catch_at = NULL, updated_at = NOW()
+			WHERE character_id = $1
+		`, characterID)
+		if err != nil {
+			return fmt.Errorf("failed to stop fishing: %w", err)
+		}
+		st.IsFishing = false
+		return nil
+	})
+}
+
+// GetCatches returns the fish kept in the acting character's bag, newest
+// first.
+func (s *FishingService) GetCatches(ctx context.Context, accountID, characterID uuid.UUID, limit, offset int) ([]*models.FishCatch, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT fc.id, fc.fish_id, f.name, COALESCE(f.rarity, 'common'), fc.spot_id, COALESCE(fc.quantity, 1), COALESCE(f.sell_price, 0),
+		       COALESCE(fc.exp_earned, 0), fc.caught_at, fc.sold_at, fc.sold_for
+		FROM fishing_catches fc
+		JOIN fish_definitions f ON f.id = fc.fish_id
+		WHERE fc.character_id = $1 AND fc.sold_at IS NULL
+		ORDER BY fc.caught_at DESC
+		LIMIT $2 OFFSET $3
+	`, characterID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get catches: %w", err)
+	}
+	defer rows.Close()
+
+	var catches []*models.FishCatch
+	for rows.Next() {
+		var c models.FishCatch
+		if err := rows.Scan(&c.ID, &c.FishID, &c.FishName, &c.Rarity, &c.SpotID, &c.Quantity, &c.SellPrice,
+			&c.ExpEarned, &c.CaughtAt, &c.SoldAt, &c.SoldFor); err != nil {
+			return nil, fmt.Errorf("failed to scan catch: %w", err)
+		}
+		catches = append(catches, &c)
+	}
+	return catches, rows.Err()
+}
+
+// Sell sells kept fish at their definition price, raised by the seller's
+// guild bonus. With no ids the whole bag is sold.
+func (s *FishingService) Sell(ctx context.Context, accountID, characterID uuid.UUID, catchIDs []uuid.UUID) (*models.FishSale, error) {
+	sale := &models.FishSale{}
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		me, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		bonus, err := s.bonuses.Resolve(ctx, me.ID, models.BonusActivityFishing)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `
+			UPDATE fishing_catches fc SET sold_at = NOW(),
+				sold_for = ROUND(COALESCE(f.sell_price, 0) * COALESCE(fc.quantity, 1) * $3::float8)
+			FROM fish_definitions f
+			WHERE f.id = fc.fish_id AND fc.character_id = $1 AND fc.sold_at IS NULL
+			  AND (COALESCE(cardinality($2::uuid[]), 0) = 0 OR fc.id = ANY($2))
+			RETURNING fc.spot_id, fc.sold_for
+		`, me.ID, catchIDs, bonus.Multiplier(models.BonusFishSellPrice))
+		if err != nil {
+			return fmt.Errorf("failed to sell fish: %w", err)
+		}
+		// Gold per spot, taxed by whoever controls the zone around it
+		earned := make(map[int]int64)
+		for rows.Next() {
+			var id int
+			var price int64
+			if err := rows.Scan(&id, &price); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to sell fish: %w", err)
+			}
+			earned[id] += price
+			sale.Sold++
+			sale.GoldEarned += price
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to sell fish: %w", err)
+		}
+		if sale.Sold == 0 {
+			return ErrNoFishToSell
+		}
+		if sale.GoldEarned == 0 {
+			return nil
+		}
+
+		err = s.ledger.Post(ctx, tx, &Posting{
+			ServerID: me.ServerID,
+			Currency: models.CurrencyGold,
+			Amount:   sale.GoldEarned,
+			From:     SystemAccount(SystemFishSale),
+			To:       CharacterAccount(me.ID),
+			Reason:   "fish_sale",
+			Details:  map[string]interface{}{"fish_sold": sale.Sold},
+		})
+		if err != nil {
+			return err
+		}
+
+		for id, gold := range earned {
+			var mapID, x, y int
+			err := tx.QueryRow(ctx, "SELECT map_id, x, y FROM fishing_spots WHERE id = $1", id).Scan(&mapID, &x, &y)
+			if err != nil {
+				return fmt.Errorf("failed to get spot location: %w", err)
+			}
+			tax, err := s.tax.Levy(ctx, tx, &TaxableIncome{
+				ServerID:    me.ServerID,
+				CharacterID: me.ID,
+				Activity:    models.TaxFishing,
+				Amount:      gold,
+				MapID:       mapID,
+				X:           &x,
+				Y:           &y,
+			})
+			if err != nil {
+				return err
+			}
+			sale.TaxPaid += tax
+		}
+		return s.guilds.RecordActivity(ctx, tx, me.ID, models.GuildActivityFishSold, sale.Sold)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sale, nil
+}
+
+// AttackFisher is called when a character attacks someone who is fishing.
+// Outside safe waters the attacker takes the Treacherous Attack debuff at the
+// strength of the fisher's water tier and the karma penalty for attacking a
+// fisher. It returns the attacker's resulting combat stats.
+func (s *FishingService) AttackFisher(ctx context.Context, accountID, characterID, fisherID uuid.UUID) (*models.CombatStats, error) {
+	if characterID == fisherID {
+		return nil, ErrCannotAttackSelf
+	}
+
+	var stats *models.CombatStats
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		chars, err := lockCharacters(ctx, tx, characterID, fisherID)
+		if err != nil {
+			return err
+		}
+		if chars[characterID].AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+
+		fishing, err := s.attackOnFisher(ctx, tx, characterID, fisherID)
+		if err != nil {
+			return err
+		}
+		if !fishing {
+			return ErrNotFishing
+		}
+
+		st, err := loadFlagState(ctx, tx, characterID, false)
+		if err != nil {
+			return err
+		}
+		stats, err = combatStats(ctx, tx, st)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// attackOnFisher applies the rules for attacking someone who is fishing,
+// with both characters locked. Fishers in safe waters cannot be attacked;
+// anywhere else the attacker takes the Treacherous Attack debuff at the
+// strength of the fisher's water tier and the karma penalty for attacking a
+// fisher. It reports whether the target was fishing.
+func (s *FishingService) attackOnFisher(ctx context.Context, tx pgx.Tx, attackerID, fisherID uuid.UUID) (bool, error) {
+	var fishing bool
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM character_fishing WHERE character_id = $1 AND is_fishing)
+	`, fisherID).Scan(&fishing)
+	if err != nil {
+		return false, fmt.Errorf("failed to check fishing: %w", err)
+	}
+	if !fishing {
+		return false, nil
+	}
+
+	fisher, err := s.lockFishing(ctx, tx, fisherID)
+	if err != nil {
+		return false, err
+	}
+	if _, err := settleFishing(ctx, tx, fisher, time.Now()); err != nil {
+		return false, err
+	}
+	if !fisher.IsFishing || fisher.Spot == nil {
+		return false, nil
+	}
+	if fisher.Spot.ZoneType == models.GatheringZoneSafe {
+		return false, ErrFishingNoPvP
+	}
+
+	if pct := models.GatheringZoneDebuffPercent[fisher.Spot.ZoneType]; pct > 0 {
+		_, err = tx.Exec(ctx, `
+			UPDATE characters SET treacherous_until = $2, treacherous_percent = $3 WHERE id = $1
+		`, attackerID, time.Now().Add(TreacherousAttackDuration), pct)
+		if err != nil {
+			return false, fmt.Errorf("failed to apply treacherous attack: %w", err)
+		}
+	}
+	if err := s.karma.Apply(ctx, tx, attackerID, models.KarmaFisherAttack, "fishing", nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// fishingInSafeWaters reports whether a character is fishing at a safe spot,
+// where they cannot be attacked
+func fishingInSafeWaters(ctx context.Context, q querier, characterID uuid.UUID) (bool, error) {
+	var safe bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM character_fishing f
+			JOIN fishing_spots s ON s.id = f.current_spot_id
+			WHERE f.character_id = $1 AND f.is_fishing AND COALESCE(s.zone_type, 'safe') = $2
+		)
+	`, characterID, models.GatheringZoneSafe).Scan(&safe)
+	if err != nil {
+		return false, fmt.Errorf("failed to check fishing: %w", err)
+	}
+	return safe, nil
+}
+
+// ProcessCatches lands due catches for everyone fishing, so bags fill and
+// fishing stops on time without the fisher checking in.
+func (s *FishingService) ProcessCatches(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT character_id FROM character_fishing
+		WHERE is_fishing = true AND next_catch_at <= NOW()
+		ORDER BY next_catch_at
+		LIMIT $1
+	`, FishingSweepBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due fishers: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan due fishers: %w", err)
+	}
+
+	landed := 0
+	for _, id := range ids {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			// Same lock order as the request path: character, then profile
+			if _, err := lockCharacters(ctx, tx, id); err != nil {
+				return err
+			}
+			st, err := s.lockFishing(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			catches, err := settleFishing(ctx, tx, st, time.Now())
+			landed += len(catches)
+			return err
+		})
+		if err != nil {
+			return landed, fmt.Errorf("failed to settle fishing for %s: %w", id, err)
+		}
+	}
+	return landed, nil
+}
+
+// RunSweeper lands due catches every interval until ctx is cancelled
+func (s *FishingService) RunSweeper(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "fishing sweeper", interval, s.ProcessCatches)
+}
@@ -0,0 +1,602 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInvalidFlag        = errors.New("flag must be red or blue")
+	ErrFlagAlreadyActive  = errors.New("you already carry this flag")
+	ErrNoFlag             = errors.New("you are not carrying a flag")
+	ErrFlagOnCooldown     = errors.New("flag was changed too recently")
+	ErrRedFlagInCity      = errors.New("red flag carriers cannot be in cities")
+	ErrFlagTargetNotFound = errors.New("target character not found")
+	ErrAttackNotAllowed   = errors.New("attack not allowed")
+	ErrMapNotFound        = errors.New("map not found")
+)
+
+const (
+	FlagChangeCooldown     = 30 * time.Minute
+	FlagRetaliationWindow  = 5 * time.Minute
+	RedFlagDeathMultiplier = 2.0
+	RedFlagDefensePercent  = -15
+	BlueFlagDefensePercent = 20
+)
+
+type FlagService struct {
+	db      *database.DB
+	ledger  *LedgerService
+	karma   *KarmaService
+	fishing *FishingService
+}
+
+func NewFlagService(db *database.DB, ledger *LedgerService, karma *KarmaService, fishing *FishingService) *FlagService {
+	return &FlagService{db: db, ledger: ledger, karma: karma, fishing: fishing}
+}
+
+// flagState is what the flag rules need to know about a character
+type flagState struct {
+	ID             uuid.UUID
+	AccountID      uuid.UUID
+	ServerID       int
+	Name           string
+	Level          int
+	Class          models.CharacterClass
+	Specialization *models.Specialization
+	Flag           *models.FlagType
+	StartedAt      *time.Time
+	ExpiresAt      *time.Time
+	ChangedAt      *time.Time
+	MapID          *int
+	InSafeZone     bool
+	PvPEnabled     bool
+	Attack         int
+	Defense        int
+	Speed          int
+	CritRate       float64
+	// Treacherous Attack debuff from attacking a fisher
+	TreacherousUntil   *time.Time
+	TreacherousPercent int
+}
+
+func loadFlagState(ctx context.Context, q querier, characterID uuid.UUID, forUpdate bool) (*flagState, error) {
+	query := `
+		SELECT c.id, c.account_id, c.server_id, c.name, c.level, c.class, c.specialization,
+		       c.flag, c.flag_started_at, c.flag_expires_at, c.flag_changed_at, c.current_map_id,
+		       COALESCE(m.is_safe_zone, false), COALESCE(m.is_pvp_enabled, false),
+		       c.total_attack, c.total_defense, c.total_speed, c.total_crit_rate,
+		       c.treacherous_until, COALESCE(c.treacherous_percent, 0)
+		FROM characters c
+		LEFT JOIN maps m ON m.id = c.current_map_id
+		WHERE c.id = $1 AND c.deleted_at IS NULL`
+	if forUpdate {
+		query += " FOR UPDATE OF c"
+	}
+
+	var st flagState
+	err := q.QueryRow(ctx, query, characterID).Scan(
+		&st.ID, &st.AccountID, &st.ServerID, &st.Name, &st.Level, &st.Class, &st.Specialization,
+		&st.Flag, &st.StartedAt, &st.ExpiresAt, &st.ChangedAt, &st.MapID,
+		&st.InSafeZone, &st.PvPEnabled,
+		&st.Attack, &st.Defense, &st.Speed, &st.CritRate,
+		&st.TreacherousUntil, &st.TreacherousPercent,
+	)
+	if err != nil {
+		return nil, ErrCharacterNotFound
+	}
+	return &st, nil
+}
+
+// activeFlag returns the flag the character currently carries, treating an
+// expired flag as none.
+func (st *flagState) activeFlag(now time.Time) *models.FlagType {
+	if st.Flag == nil || (st.ExpiresAt != nil && !st.ExpiresAt.After(now)) {
+		return nil
+	}
+	return st.Flag
+}
+
+func (st *flagState) cooldownEndsAt() *time.Time {
+	if st.ChangedAt == nil {
+		return nil
+	}
+	end := st.ChangedAt.Add(FlagChangeCooldown)
+	return &end
+}
+
+// DeathPenaltyMultiplier scales EXP and gold lost on death
+func DeathPenaltyMultiplier(flag *models.FlagType) float64 {
+	if flag != nil && *flag == models.FlagRed {
+		return RedFlagDeathMultiplier
+	}
+	return 1
+}
+
+// flagStatModifier is the flat bonus every carrier of a flag gets (6.2)
+func flagStatModifier(flag models.FlagType) models.StatModifier {
+	if flag == models.FlagRed {
+		return models.StatModifier{Source: "red_flag", Defense: RedFlagDefensePercent}
+	}
+	return models.StatModifier{Source: "blue_flag", Defense: BlueFlagDefensePercent}
+}
+
+// specFlagBonuses loads the specialization's flag synergy (6.3): buffs when
+// the carried flag is the preferred one, debuffs otherwise.
+func specFlagBonuses(ctx context.Context, q querier, spec models.Specialization, flag models.FlagType) (*models.StatModifier, map[string]interface{}, error) {
+	var preferred models.FlagType
+	var buffs, debuffs, attackBonus, defenseBonus []byte
+	err := q.QueryRow(ctx, `
+		SELECT preferred_flag, correct_flag_buffs, wrong_flag_debuffs, caravan_attack_bonus, caravan_defense_bonus
+		FROM specialization_definitions WHERE specialization = $1
+	`, spec).Scan(&preferred, &buffs, &debuffs, &attackBonus, &defenseBonus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get specialization: %w", err)
+	}
+
+	source := "spec_synergy"
+	raw := [][]byte{buffs}
+	if flag == preferred {
+		if flag == models.FlagRed {
+			raw = append(raw, attackBonus)
+		} else {
+			raw = append(raw, defenseBonus)
+		}
+	} else {
+		source = "spec_mismatch"
+		raw = [][]byte{debuffs}
+	}
+
+	mod := &models.StatModifier{Source: source}
+	effects := map[string]interface{}{}
+	for _, data := range raw {
+		if len(data) == 0 {
+			continue
+		}
+		var values map[string]interface{}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode specialization bonuses: %w", err)
+		}
+		for key, value := range values {
+			pct, numeric := value.(float64)
+			switch {
+			case numeric && (key == "attack" || key == "damage" || key == "magic_damage"):
+				mod.Attack += pct
+			case numeric && key == "defense":
+				mod.Defense += pct
+			case numeric && key == "crit_rate":
+				mod.CritRate += pct
+			case numeric && key == "all_stats":
+				mod.Attack += pct
+				mod.Defense += pct
+				mod.Speed += pct
+				mod.CritRate += pct
+			default:
+				effects[key] = value
+			}
+		}
+	}
+	return mod, effects, nil
+}
+
+// applyModifiers scales stored stats by every modifier in turn
+func applyModifiers(stats *models.CombatStats) {
+	attack, defense, speed, crit := float64(stats.Attack), float64(stats.Defense), float64(stats.Speed), stats.CritRate
+	for _, m := range stats.Modifiers {
+		attack *= 1 + m.Attack/100
+		defense *= 1 + m.Defense/100
+		speed *= 1 + m.Speed/100
+		crit *= 1 + m.CritRate/100
+	}
+	stats.Attack = int(math.Max(0, math.Round(attack)))
+	stats.Defense = int(math.Max(0, math.Round(defense)))
+	stats.Speed = int(math.Max(0, math.Round(speed)))
+	stats.CritRate = math.Max(0, math.Round(crit*100)/100)
+}
+
+// scaleModifier returns m with every change scaled to percent of its size
+func scaleModifier(m models.StatModifier, percent int) models.StatModifier {
+	f := float64(percent) / 100
+	m.Attack *= f
+	m.Defense *= f
+	m.Speed *= f
+	m.CritRate *= f
+	return m
+}
+
+// combatStats computes a character's effective stats from its stored totals,
+// the flag it carries and any active debuffs.
+func combatStats(ctx context.Context, q querier, st *flagState) (*models.CombatStats, error) {
+	stats := &models.CombatStats{
+		Attack:    st.Attack,
+		Defense:   st.Defense,
+		Speed:     st.Speed,
+		CritRate:  st.CritRate,
+		Modifiers: []models.StatModifier{},
+		Effects:   map[string]interface{}{},
+	}
+
+	if flag := st.activeFlag(time.Now()); flag != nil {
+		stats.Modifiers = append(stats.Modifiers, flagStatModifier(*flag))
+		if st.Specialization != nil {
+			mod, effects, err := specFlagBonuses(ctx, q, *st.Specialization, *flag)
+			if err != nil {
+				return nil, err
+			}
+			if mod != nil {
+				stats.Modifiers = append(stats.Modifiers, *mod)
+				for k, v := range effects {
+					stats.Effects[k] = v
+				}
+			}
+		}
+	}
+
+	if st.TreacherousUntil != nil && st.TreacherousUntil.After(time.Now()) && st.TreacherousPercent > 0 {
+		stats.Modifiers = append(stats.Modifiers, scaleModifier(models.TreacherousAttack, st.TreacherousPercent))
+	}
+
+	applyModifiers(stats)
+	return stats, nil
+}
+
+// GetCombatStats returns a character's effective stats for other services
+func (s *FlagService) GetCombatStats(ctx context.Context, characterID uuid.UUID) (*models.CombatStats, error) {
+	st, err := loadFlagState(ctx, s.db.Pool, characterID, false)
+	if err != nil {
+		return nil, err
+	}
+	return combatStats(ctx, s.db.Pool, st)
+}
+
+func (s *FlagService) status(st *flagState) *models.FlagStatus {
+	now := time.Now()
+	flag := st.activeFlag(now)
+	status := &models.FlagStatus{
+		CharacterID:            st.ID,
+		Name:                   st.Name,
+		Flag:                   flag,
+		ChangedAt:              st.ChangedAt,
+		CanChange:              true,
+		DeathPenaltyMultiplier: DeathPenaltyMultiplier(flag),
+	}
+	if flag != nil {
+		status.FlagStartedAt = st.StartedAt
+		status.FlagExpiresAt = st.ExpiresAt
+	}
+	if end := st.cooldownEndsAt(); end != nil && end.After(now) {
+		status.CooldownEndsAt = end
+		status.CanChange = false
+	}
+	return status
+}
+
+// GetStatus returns the acting character's flag, cooldown and effective stats
+func (s *FlagService) GetStatus(ctx context.Context, accountID, characterID uuid.UUID) (*models.FlagStatus, error) {
+	st, err := loadFlagState(ctx, s.db.Pool, characterID, false)
+	if err != nil || st.AccountID != accountID {
+		return nil, ErrCharacterNotFound
+	}
+
+	status := s.status(st)
+	if status.Stats, err = combatStats(ctx, s.db.Pool, st); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Inspect returns another character's public flag status on the same server
+func (s *FlagService) Inspect(ctx context.Context, accountID, characterID, targetID uuid.UUID) (*models.FlagStatus, error) {
+	me, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	st, err := loadFlagState(ctx, s.db.Pool, targetID, false)
+	if err != nil || st.ServerID != me.ServerID {
+		return nil, ErrFlagTargetNotFound
+	}
+	return s.status(st), nil
+}
+
+// Take raises a flag. Switching directly between red and blue is allowed,
+// but any change is subject to the cooldown.
+func (s *FlagService) Take(ctx context.Context, accountID, characterID uuid.UUID, flag models.FlagType) (*models.FlagStatus, error) {
+	if flag != models.FlagRed && flag != models.FlagBlue {
+		return nil, ErrInvalidFlag
+	}
+
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		st, err := loadFlagState(ctx, tx, characterID, true)
+		if err != nil || st.AccountID != accountID {
+			return ErrCharacterNotFound
+		}
+
+		now := time.Now()
+		if current := st.activeFlag(now); current != nil && *current == flag {
+			return ErrFlagAlreadyActive
+		}
+		if end := st.cooldownEndsAt(); end != nil && end.After(now) {
+			return ErrFlagOnCooldown
+		}
+		if flag == models.FlagRed && st.InSafeZone {
+			return ErrRedFlagInCity
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE characters SET flag = $1, flag_started_at = NOW(), flag_expires_at = NULL,
+				flag_changed_at = NOW(), updated_at = NOW()
+			WHERE id = $2
+		`, flag, st.ID)
+		if err != nil {
+			return fmt.Errorf("failed to take flag: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStatus(ctx, accountID, characterID)
+}
+
+// Drop lowers the carried flag. Dropping also starts the cooldown.
+func (s *FlagService) Drop(ctx context.Context, accountID, characterID uuid.UUID) (*models.FlagStatus, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		st, err := loadFlagState(ctx, tx, characterID, true)
+		if err != nil || st.AccountID != accountID {
+			return ErrCharacterNotFound
+		}
+
+		now := time.Now()
+		if st.activeFlag(now) == nil {
+			return ErrNoFlag
+		}
+		if end := st.cooldownEndsAt(); end != nil && end.After(now) {
+			return ErrFlagOnCooldown
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE characters SET flag = NULL, flag_started_at = NULL, flag_expires_at = NULL,
+				flag_changed_at = NOW(), updated_at = NOW()
+			WHERE id = $1
+		`, st.ID)
+		if err != nil {
+			return fmt.Errorf("failed to drop flag: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStatus(ctx, accountID, characterID)
+}
+
+// ListRedCarriers returns online red flag carriers on the acting character's
+// server. Bandits are visible to everyone.
+func (s *FlagService) ListRedCarriers(ctx context.Context, accountID, characterID uuid.UUID, mapID *int, limit, offset int) ([]*models.FlagCarrier, error) {
+	me, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, name, level, class, current_map_id, position_x, position_y
+		FROM characters
+		WHERE server_id = $1 AND flag = 'red' AND deleted_at IS NULL AND is_online = true
+		  AND (flag_expires_at IS NULL OR flag_expires_at > NOW())
+		  AND ($2::int IS NULL OR current_map_id = $2)
+		ORDER BY name
+		LIMIT $3 OFFSET $4
+	`, me.ServerID, mapID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flag carriers: %w", err)
+	}
+	defer rows.Close()
+
+	var carriers []*models.FlagCarrier
+	for rows.Next() {
+		var c models.FlagCarrier
+		var cMapID *int
+		if err := rows.Scan(&c.CharacterID, &c.Name, &c.Level, &c.Class, &cMapID, &c.PositionX, &c.PositionY); err != nil {
+			return nil, fmt.Errorf("failed to scan flag carrier: %w", err)
+		}
+		if cMapID != nil {
+			c.MapID = *cMapID
+		}
+		carriers = append(carriers, &c)
+	}
+	return carriers, rows.Err()
+}
+
+// canEnterMap reports whether the character may enter a map. Prisoners are
+// confined to the prison and red flag carriers are barred from cities (safe
+// zones).
+func canEnterMap(ctx context.Context, q querier, characterID uuid.UUID, mapID int) error {
+	st, err := loadFlagState(ctx, q, characterID, false)
+	if err != nil {
+		return err
+	}
+
+	var confined bool
+	err = q.QueryRow(ctx, `
+		SELECT COALESCE(c.is_in_prison AND c.prison_release_at > NOW(), false)
+		       AND NOT COALESCE((SELECT is_prison FROM maps WHERE id = $2), false)
+		FROM characters c WHERE c.id = $1
+	`, characterID, mapID).Scan(&confined)
+	if err != nil {
+		return fmt.Errorf("failed to check prison: %w", err)
+	}
+	if confined {
+		return ErrConfinedToPrison
+	}
+	flag := st.activeFlag(time.Now())
+	if flag == nil || *flag != models.FlagRed {
+		return nil
+	}
+
+	var safe bool
+	err = q.QueryRow(ctx, "SELECT COALESCE(is_safe_zone, false) FROM maps WHERE id = $1", mapID).Scan(&safe)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrMapNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get map: %w", err)
+	}
+	if safe {
+		return ErrRedFlagInCity
+	}
+	return nil
+}
+
+// CheckAttack applies the flag PvP rules to an attack on target. Only
+// flagged characters fight, and blue only fights back: it may attack a
+// character that attacked it within the retaliation window. Members of enemy
+// guilds can always fight outside safe zones (8.2.2).
+func (s *FlagService) CheckAttack(ctx context.Context, accountID, characterID, targetID uuid.UUID) (*models.AttackCheck, error) {
+	attacker, err := loadFlagState(ctx, s.db.Pool, characterID, false)
+	if err != nil || attacker.AccountID != accountID {
+		return nil, ErrCharacterNotFound
+	}
+	target, err := loadFlagState(ctx, s.db.Pool, targetID, false)
+	if err != nil || target.ServerID != attacker.ServerID {
+		return nil, ErrFlagTargetNotFound
+	}
+
+	deny := func(reason string) (*models.AttackCheck, error) {
+		return &models.AttackCheck{Allowed: false, Reason: reason}, nil
+	}
+
+	enemy, err := enemyGuilds(ctx, s.db.Pool, attacker.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	safeFisher, err := fishingInSafeWaters(ctx, s.db.Pool, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	attackerFlag := attacker.activeFlag(now)
+	switch {
+	case attacker.ID == target.ID:
+		return deny("cannot attack yourself")
+	case attackerFlag == nil && !enemy:
+		return deny("you must carry a flag to fight")
+	case attacker.MapID == nil || target.MapID == nil || *attacker.MapID != *target.MapID:
+		return deny("target is not on your map")
+	case attacker.InSafeZone || (!attacker.PvPEnabled && !enemy):
+		return deny("PvP is not allowed here")
+	case safeFisher:
+		return deny(ErrFishingNoPvP.Error())
+	}
+	if enemy {
+		return &models.AttackCheck{Allowed: true, EnemyGuild: true}, nil
+	}
+
+	if *attackerFlag == models.FlagBlue {
+		var retaliating bool
+		err := s.db.Pool.QueryRow(ctx, `
+			SELECT EXISTS(
+				SELECT 1 FROM pvp_logs
+				WHERE attacker_id = $1 AND defender_id = $2 AND created_at >= $3
+			)
+		`, target.ID, attacker.ID, now.Add(-FlagRetaliationWindow)).Scan(&retaliating)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check retaliation: %w", err)
+		}
+		if !retaliating {
+			return deny("blue flag carriers cannot strike first")
+		}
+	}
+
+	return &models.AttackCheck{Allowed: true}, nil
+}
+
+// EnterMap moves a character to a map reported by the game server, unless
+// the map is closed to them
+func (s *FlagService) EnterMap(ctx context.Context, characterID uuid.UUID, req *models.EnterMapRequest) error {
+	return s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockCharacters(ctx, tx, characterID); err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM maps WHERE id = $1)", req.MapID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to get map: %w", err)
+		}
+		if !exists {
+			return ErrMapNotFound
+		}
+		if err := canEnterMap(ctx, tx, characterID, req.MapID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE characters SET current_map_id = $2, position_x = $3, position_y = $4, updated_at = NOW() WHERE id = $1
+		`, characterID, req.MapID, req.PositionX, req.PositionY)
+		if err != nil {
+			return fmt.Errorf("failed to move character: %w", err)
+		}
+		return nil
+	})
+}
+
+// Attack fights target under the flag PvP rules and records the outcome,
+// which can send either side to prison (9.2.1). Attacking a fisher costs
+// the attacker as it does through the fishing attack (9.1.2).
+func (s *FlagService) Attack(ctx context.Context, accountID, characterID, targetID uuid.UUID) (*models.PvPResult, error) {
+	check, err := s.CheckAttack(ctx, accountID, characterID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if !check.Allowed {
+		return nil, fmt.Errorf("%w: %s", ErrAttackNotAllowed, check.Reason)
+	}
+
+	var result *models.PvPResult
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockCharacters(ctx, tx, characterID, targetID)
+		if err != nil {
+			return err
+		}
+		if len(locked) != 2 {
+			return ErrFlagTargetNotFound
+		}
+		if err := checkNotInPrison(ctx, tx, characterID); err != nil {
+			return err
+		}
+		attacker, err := loadFlagState(ctx, tx, characterID, false)
+		if err != nil {
+			return err
+		}
+		target, err := loadFlagState(ctx, tx, targetID, false)
+		if err != nil {
+			return err
+		}
+		if attacker.MapID == nil || target.MapID == nil || *attacker.MapID != *target.MapID {
+			return fmt.Errorf("%w: target is not on your map", ErrAttackNotAllowed)
+		}
+		if _, err := s.fishing.attackOnFisher(ctx, tx, characterID, targetID); err != nil {
+			return err
+		}
+
+		if result, err = duel(ctx, tx, *attacker.MapID, characterID, targetID); err != nil {
+			return err
+		}
+		return recordPvPResult(ctx, tx, s.karma, s.ledger, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FraudSalesWindow        = 24 * time.Hour
+	FraudPairWindow         = 7 * 24 * time.Hour
+	FraudNewAccountAge      = 7 * 24 * time.Hour
+	FraudDeviceWindow       = 30 * 24 * time.Hour
+	PriceMedianDays         = 14 // rolling window over price_history
+	PriceMedianMinDays      = 3  // fewer data points than this and the median is not trusted
+	PriceOutlierFactor      = 5  // 5x above or below the median
+	PriceOutlierHighFactor  = 20
+	RepeatedTradeThreshold  = 10 // deals between the same two accounts per window
+	OneWayGoldThreshold     = 100000
+	MaxAccountsPerIP        = 2
+	MaxAccountsPerDevice    = 1
+	FraudHighSeverityFactor = 3 // threshold multiple that escalates medium to high
+)
+
+type FraudService struct {
+	db *database.DB
+}
+
+func NewFraudService(db *database.DB) *FraudService {
+	return &FraudService{db: db}
+}
+
+// suspiciousFlag is one row for suspicious_activity_logs. DedupeKey makes
+// repeated analyser runs idempotent.
+type suspiciousFlag struct {
+	AccountID    uuid.UUID
+	CharacterID  *uuid.UUID
+	ActivityType string
+	Severity     models.Severity
+	Description  string
+	Evidence     map[string]interface{}
+	DedupeKey    string
+}
+
+// flagSuspicious records a flag unless the same one already exists. The
+// trust score penalty is applied by the table's insert trigger.
+func flagSuspicious(ctx context.Context, q querier, f *suspiciousFlag) (bool, error) {
+	evidence, err := json.Marshal(f.Evidence)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode evidence: %w", err)
+	}
+
+	result, err := q.Exec(ctx, `
+		INSERT INTO suspicious_activity_logs (id, account_id, character_id, activity_type, severity, description, evidence, dedupe_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (account_id, activity_type, dedupe_key) DO NOTHING
+	`, uuid.New(), f.AccountID, f.CharacterID, f.ActivityType, f.Severity, f.Description, evidence, f.DedupeKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to flag suspicious activity: %w", err)
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func escalate(value, threshold int64) models.Severity {
+	if value >= threshold*FraudHighSeverityFactor {
+		return models.SeverityHigh
+	}
+	return models.SeverityMedium
+}
+
+// Analyze runs every detector and returns how many new flags were raised
+func (s *FraudService) Analyze(ctx context.Context) (int, error) {
+	detectors := []func(context.Context) (int, error){
+		s.detectPriceOutliers,
+		s.detectRepeatedPairs,
+		s.detectOneWayGold,
+		s.detectSharedIPs,
+		s.detectSharedDevices,
+	}
+
+	total := 0
+	var errs []error
+	for _, detect := range detectors {
+		n, err := detect(ctx)
+		total += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// RunAnalyzer runs Analyze every interval until ctx is cancelled
+func (s *FraudService) RunAnalyzer(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "fraud analyzer", interval, s.Analyze)
+}
+
+func (s *FraudService) raise(ctx context.Context, flags []*suspiciousFlag) (int, error) {
+	raised := 0
+	for _, f := range flags {
+		ok, err := flagSuspicious(ctx, s.db.Pool, f)
+		if err != nil {
+			return raised, err
+		}
+		if ok {
+			raised++
+		}
+	}
+	return raised, nil
+}
+
+// detectPriceOutliers flags market sales priced far from the item's rolling
+// median. Overpriced sales move gold to the seller and underpriced ones to
+// the buyer, so the side that benefits is flagged.
+func (s *FraudService) detectPriceOutliers(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		WITH medians AS (
+			SELECT server_id, item_definition_id,
+			       percentile_cont(0.5) WITHIN GROUP (ORDER BY avg_price) AS median_price,
+			       COUNT(*) AS days
+			FROM price_history
+			WHERE date >= CURRENT_DATE - $1::int
+			GROUP BY server_id, item_definition_id
+		)
+		SELECT ml.id, ml.item_definition_id, ml.price_per_unit, m.median_price::bigint,
+		       ml.seller_id, seller.account_id, ml.buyer_id, buyer.account_id
+		FROM market_listings ml
+		JOIN medians m ON m.server_id = ml.server_id AND m.item_definition_id = ml.item_definition_id
+		JOIN characters seller ON seller.id = ml.seller_id
+		JOIN characters buyer ON buyer.id = ml.buyer_id
+		WHERE ml.status = 'sold' AND ml.sold_at > $2
+		  AND m.days >= $3 AND m.median_price > 0
+		  AND (ml.price_per_unit >= m.median_price * $4 OR ml.price_per_unit * $4 <= m.median_price)
+	`, PriceMedianDays, time.Now().Add(-FraudSalesWindow), PriceMedianMinDays, PriceOutlierFactor)
+	if err != nil {
+		return 0, fmt.Errorf("price outliers: %w", err)
+	}
+	defer rows.Close()
+
+	var flags []*suspiciousFlag
+	for rows.Next() {
+		var listingID, sellerID, sellerAccount, buyerID, buyerAccount uuid.UUID
+		var itemID int
+		var price, median int64
+		if err := rows.Scan(&listingID, &itemID, &price, &median, &sellerID, &sellerAccount, &buyerID, &buyerAccount); err != nil {
+			return 0, fmt.Errorf("price outliers: %w", err)
+		}
+
+		f := &suspiciousFlag{
+			ActivityType: "price_manipulation",
+			DedupeKey:    "listing:" + listingID.String(),
+			Evidence: map[string]interface{}{
+				"listing_id":         listingID,
+				"item_definition_id": itemID,
+				"price_per_unit":     price,
+				"median_price":       median,
+				"seller_id":          sellerID,
+				"buyer_id":           buyerID,
+			},
+		}
+		var ratio int64
+		if price > median {
+			ratio = price / median
+			f.AccountID, f.CharacterID = sellerAccount, &sellerID
+			f.Description = fmt.Sprintf("Sold item %d at %dx its %d-day median price", itemID, ratio, PriceMedianDays)
+		} else {
+			ratio = median / max(price, 1)
+			f.AccountID, f.CharacterID = buyerAccount, &buyerID
+			f.Description = fmt.Sprintf("Bought item %d at 1/%d of its %d-day median price", itemID, ratio, PriceMedianDays)
+		}
+		f.Severity = models.SeverityMedium
+		if ratio >= PriceOutlierHighFactor {
+			f.Severity = models.SeverityHigh
+		}
+		flags = append(flags, f)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("price outliers: %w", err)
+	}
+	rows.Close()
+
+	return s.raise(ctx, flags)
+}
+
+// detectRepeatedPairs flags pairs of accounts that keep dealing with each
+// other through trades or the market.
+func (s *FraudService) detectRepeatedPairs(ctx context.Context) (int, error) {
+	since := time.Now().Add(-FraudPairWindow)
+	rows, err := s.db.Pool.Query(ctx, `
+		WITH deals AS (
+			SELECT c1.account_id AS a, c2.account_id AS b
+			FROM player_trades t
+			JOIN characters c1 ON c1.id = t.player1_id
+			JOIN characters c2 ON c2.id = t.player2_id
+			WHERE t.status = 'completed' AND t.completed_at > $1
+			UNION ALL
+			SELECT seller.account_id, buyer.account_id
+			FROM market_listings ml
+			JOIN characters seller ON seller.id = ml.seller_id
+			JOIN characters buyer ON buyer.id = ml.buyer_id
+			WHERE ml.status = 'sold' AND ml.sold_at > $1
+		)
+		SELECT LEAST(a, b), GREATEST(a, b), COUNT(*)
+		FROM deals
+		GROUP BY 1, 2
+		HAVING COUNT(*) >= $2
+	`, since, RepeatedTradeThreshold)
+	if err != nil {
+		return 0, fmt.Errorf("repeated pairs: %w", err)
+	}
+	defer rows.Close()
+
+	// One flag per pair per calendar week
+	year, week := time.Now().ISOWeek()
+	var flags []*suspiciousFlag
+	for rows.Next() {
+		var a, b uuid.UUID
+		var deals int64
+		if err := rows.Scan(&a, &b, &deals); err != nil {
+			return 0, fmt.Errorf("repeated pairs: %w", err)
+		}
+
+		key := fmt.Sprintf("pair:%s:%s:%d-W%02d", a, b, year, week)
+		for _, pair := range [][2]uuid.UUID{{a, b}, {b, a}} {
+			flags = append(flags, &suspiciousFlag{
+				AccountID:    pair[0],
+				ActivityType: "repeated_trading",
+				Severity:     escalate(deals, RepeatedTradeThreshold),
+				Description:  fmt.Sprintf("%d trades with the same account in the last 7 days", deals),
+				Evidence:     map[string]interface{}{"other_account_id": pair[1], "deals": deals},
+				DedupeKey:    key,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("repeated pairs: %w", err)
+	}
+	rows.Close()
+
+	return s.raise(ctx, flags)
+}
+
+// detectOneWayGold flags large amounts of trade gold flowing to a new account
+// with little or nothing coming back, the usual shape of a gold-selling drop.
+func (s *FraudService) detectOneWayGold(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		WITH flows AS (
+			SELECT c1.account_id AS giver, c2.account_id AS receiver, t.player1_gold AS gold
+			FROM player_trades t
+			JOIN characters c1 ON c1.id = t.player1_id
+			JOIN characters c2 ON c2.id = t.player2_id
+			WHERE t.status = 'completed' AND t.completed_at > $1
+			UNION ALL
+			SELECT c2.account_id, c1.account_id, t.player2_gold
+			FROM player_trades t
+			JOIN characters c1 ON c1.id = t.player1_id
+			JOIN characters c2 ON c2.id = t.player2_id
+			WHERE t.status = 'completed' AND t.completed_at > $1
+		), net AS (
+			SELECT giver, receiver, SUM(gold) AS gold FROM flows GROUP BY giver, receiver
+		)
+		SELECT n.giver, n.receiver, n.gold, COALESCE(back.gold, 0)
+		FROM net n
+		JOIN accounts r ON r.id = n.receiver
+		LEFT JOIN net back ON back.giver = n.receiver AND back.receiver = n.giver
+		WHERE r.created_at > $2
+		  AND n.gold >= $3
+		  AND COALESCE(back.gold, 0) * 10 < n.gold
+	`, time.Now().Add(-FraudPairWindow), time.Now().Add(-FraudNewAccountAge), OneWayGoldThreshold)
+	if err != nil {
+		return 0, fmt.Errorf("one-way gold: %w", err)
+	}
+	defer rows.Close()
+
+	var flags []*suspiciousFlag
+	for rows.Next() {
+		var giver, receiver uuid.UUID
+		var gold, returned int64
+		if err := rows.Scan(&giver, &receiver, &gold, &returned); err != nil {
+			return 0, fmt.Errorf("one-way gold: %w", err)
+		}
+
+		evidence := map[string]interface{}{
+			"giver_account_id":    giver,
+			"receiver_account_id": receiver,
+			"gold_sent":           gold,
+			"gold_returned":       returned,
+		}
+		key := fmt.Sprintf("flow:%s:%s", giver, receiver)
+		severity := escalate(gold, OneWayGoldThreshold)
+		flags = append(flags,
+			&suspiciousFlag{
+				AccountID:    giver,
+				ActivityType: "rmt_gold_flow",
+				Severity:     severity,
+				Description:  fmt.Sprintf("Sent %d gold to a new account with little in return", gold),
+				Evidence:     evidence,
+				DedupeKey:    key,
+			},
+			&suspiciousFlag{
+				AccountID:    receiver,
+				ActivityType: "rmt_gold_flow",
+				Severity:     severity,
+				Description:  fmt.Sprintf("New account received %d gold with little in return", gold),
+				Evidence:     evidence,
+				DedupeKey:    key,
+			},
+		)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("one-way gold: %w", err)
+	}
+	rows.Close()
+
+	return s.raise(ctx, flags)
+}
+
+// detectSharedIPs flags every account on an IP used by more accounts than
+// the design allows.
+func (s *FraudService) detectSharedIPs(ctx context.Context) (int, error) {
+	return s.detectSharedIdentity(ctx, "ip", `
+		SELECT host(ip_address), array_agg(DISTINCT account_id)
+		FROM ip_history
+		WHERE last_seen_at > $1
+		GROUP BY ip_address
+		HAVING COUNT(DISTINCT account_id) > $2
+	`, MaxAccountsPerIP)
+}
+
+// detectSharedDevices flags every account seen on the same device fingerprint
+func (s *FraudService) detectSharedDevices(ctx context.Context) (int, error) {
+	return s.detectSharedIdentity(ctx, "device", `
+		SELECT fingerprint, array_agg(DISTINCT account_id)
+		FROM devices
+		WHERE last_seen_at > $1
+		GROUP BY fingerprint
+		HAVING COUNT(DISTINCT account_id) > $2
+	`, MaxAccountsPerDevice)
+}
+
+func (s *FraudService) detectSharedIdentity(ctx context.Context, kind, query string, limit int) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, query, time.Now().Add(-FraudDeviceWindow), limit)
+	if err != nil {
+		return 0, fmt.Errorf("shared %s: %w", kind, err)
+	}
+	defer rows.Close()
+
+	var flags []*suspiciousFlag
+	for rows.Next() {
+		var value string
+		var accounts []uuid.UUID
+		if err := rows.Scan(&value, &accounts); err != nil {
+			return 0, fmt.Errorf("shared %s: %w", kind, err)
+		}
+
+		for _, accountID := range accounts {
+			flags = append(flags, &suspiciousFlag{
+				AccountID:    accountID,
+				ActivityType: "multi_account",
+				Severity:     escalate(int64(len(accounts)), int64(limit+1)),
+				Description:  fmt.Sprintf("%d accounts share the same %s", len(accounts), kind),
+				Evidence:     map[string]interface{}{kind: value, "account_ids": accounts},
+				DedupeKey:    kind + ":" + value,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("shared %s: %w", kind, err)
+	}
+	rows.Close()
+
+	return s.raise(ctx, flags)
+}
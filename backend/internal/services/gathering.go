@@ -0,0 +1,111 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"realm-of-conquest/internal/models"
+)
+
+// Fishing and mining share rarity rolls, EXP curves and zone tiers
+
+const (
+	GatheringMaxLevel     = 100
+	GatheringLevelExpBase = 100
+
+	// Each level shortens the gathering interval, down to half the base
+	GatheringLevelSpeedup      = 0.005
+	GatheringMinIntervalFactor = 0.5
+)
+
+// gatheringRarityWeight is the base roll weight per rarity
+var gatheringRarityWeight = map[string]float64{
+	"common":    1000,
+	"uncommon":  300,
+	"rare":      80,
+	"epic":      20,
+	"legendary": 4,
+	"mythic":    1,
+}
+
+// gatheringRarityExp is the fishing or mining EXP per rarity
+var gatheringRarityExp = map[string]int{
+	"common":    10,
+	"uncommon":  25,
+	"rare":      60,
+	"epic":      150,
+	"legendary": 400,
+	"mythic":    1000,
+}
+
+// gatheringZoneRareBonus multiplies rare-and-better weights by zone tier
+var gatheringZoneRareBonus = map[models.GatheringZone]float64{
+	models.GatheringZoneSafe:      1.0,
+	models.GatheringZoneContested: 1.25,
+	models.GatheringZoneWild:      1.6,
+	models.GatheringZoneDark:      2.0,
+}
+
+// rarityOrder is item_rarity in enum order
+var rarityOrder = map[string]int{
+	"common": 0, "uncommon": 1, "rare": 2, "epic": 3, "legendary": 4, "mythic": 5,
+}
+
+func isRareOrBetter(rarity string) bool {
+	return rarityOrder[rarity] >= rarityOrder["rare"]
+}
+
+// gatheringLevelFor returns the level reached with exp. Level n needs
+// GatheringLevelExpBase * (n-1)^2 EXP.
+func gatheringLevelFor(exp int) int {
+	level := 1 + int(math.Sqrt(float64(exp)/GatheringLevelExpBase))
+	return min(level, GatheringMaxLevel)
+}
+
+func gatheringExpForLevel(level int) int {
+	return GatheringLevelExpBase * (level - 1) * (level - 1)
+}
+
+// gatheringInterval shortens base by the gatherer's level
+func gatheringInterval(base time.Duration, level int) time.Duration {
+	factor := math.Max(1-float64(level-1)*GatheringLevelSpeedup, GatheringMinIntervalFactor)
+	return time.Duration(float64(base) * factor)
+}
+
+// gatherable is a fish or ore that can be rolled, with its roll weight
+type gatherable struct {
+	ID        int
+	Name      string
+	Rarity    string
+	SellPrice int64
+	Weight    float64
+}
+
+// gatheringWeight is the roll weight of a rarity. Rare and better are
+// weighted up by zone tier, gatherer level and the spot's own bonus.
+func gatheringWeight(rarity string, zone models.GatheringZone, level int, rareBonus float64) float64 {
+	w := gatheringRarityWeight[rarity]
+	if isRareOrBetter(rarity) {
+		w *= gatheringZoneRareBonus[zone] * (1 + float64(level)/100) * (1 + rareBonus)
+	}
+	return w
+}
+
+func rollGatherable(pool []*gatherable) *gatherable {
+	var total float64
+	for _, g := range pool {
+		total += g.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+	roll := rand.Float64() * total
+	for _, g := range pool {
+		if roll < g.Weight {
+			return g
+		}
+		roll -= g.Weight
+	}
+	return pool[len(pool)-1]
+}
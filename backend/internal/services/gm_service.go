@@ -12,6 +12,7 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -453,6 +454,9 @@ func (s *GMService) GetDashboardStats(ctx context.Context) (*models.DashboardSta
 	// Active mutes
 	s.db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM mutes WHERE is_active = true AND expires_at > NOW()").Scan(&stats.ActiveMutes)
 
+	// Suspicious activity waiting for review
+	s.db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM suspicious_activity_logs WHERE reviewed = false").Scan(&stats.UnreviewedFlags)
+
 	return stats, nil
 }
 
@@ -585,9 +589,16 @@ type PlayerDetailedProfile struct {
 	CharacterName string     `json:"character_name"`
 	Class         string     `json:"class"`
 	Level         int        `json:"level"`
-	Gold          int        `json:"gold"`
+	Gold          int64      `json:"gold"`
+	PremiumGems   int        `json:"premium_gems"`
 	IsOnline      bool       `json:"is_online"`
 
+	// Karma
+	Karma         int                 `json:"karma"`
+	Infamy        int                 `json:"infamy"`
+	InfamyStatus  models.InfamyStatus `json:"infamy_status"`
+	IsWanted      bool                `json:"is_wanted"`
+
 	// Moderation history
 	ActiveMutes   int        `json:"active_mutes"`
 	TotalBans     int        `json:"total_bans"`
@@ -605,18 +616,22 @@ func (s *GMService) GetPlayerDetailedProfile(ctx context.Context, characterID uu
 	err := s.db.Pool.QueryRow(ctx, `
 		SELECT
 			a.id, a.email, a.username, a.is_banned, a.ban_reason, a.created_at, a.last_login_at, a.last_login_ip,
-			c.id, c.name, c.class, c.level, c.gold, c.is_online
+			c.id, c.name, c.class, c.level, c.gold, c.premium_currency, c.is_online,
+			COALESCE(c.karma, 0), COALESCE(c.infamy, 0)
 		FROM characters c
 		JOIN accounts a ON a.id = c.account_id
 		WHERE c.id = $1 AND c.deleted_at IS NULL
 	`, characterID).Scan(
 		&profile.AccountID, &profile.Email, &profile.Username, &profile.IsBanned, &profile.BanReason,
 		&profile.CreatedAt, &profile.LastLoginAt, &profile.LastLoginIP,
-		&profile.CharacterID, &profile.CharacterName, &profile.Class, &profile.Level, &profile.Gold, &profile.IsOnline,
+		&profile.CharacterID, &profile.CharacterName, &profile.Class, &profile.Level, &profile.Gold, &profile.PremiumGems, &profile.IsOnline,
+		&profile.Karma, &profile.Infamy,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("character not found: %w", err)
 	}
+	profile.InfamyStatus = models.InfamyStatusFor(profile.Infamy)
+	profile.IsWanted = profile.Infamy >= models.WantedInfamy
 
 	// Get moderation stats
 	s.db.Pool.QueryRow(ctx, `
@@ -737,3 +752,140 @@ func (s *GMService) GetOnlineGMCount(ctx context.Context) (int, error) {
 	`).Scan(&count)
 	return count, err
 }
+
+// Suspicious Activity Review Queue
+func (s *GMService) GetSuspiciousActivity(ctx context.Context, severity, activityType string, reviewed bool, limit, offset int) ([]*models.SuspiciousActivity, error) {
+	query := `
+		SELECT l.id, l.account_id, a.username, a.trust_score, l.character_id, c.name,
+		       l.activity_type, l.severity, l.description, l.evidence, l.auto_action_taken,
+		       l.reviewed, l.reviewed_by, l.review_result, l.created_at
+		FROM suspicious_activity_logs l
+		JOIN accounts a ON a.id = l.account_id
+		LEFT JOIN characters c ON c.id = l.character_id
+		WHERE l.reviewed = $1
+	`
+	args := []interface{}{reviewed}
+	argIndex := 2
+
+	if severity != "" {
+		query += fmt.Sprintf(" AND l.severity = $%d", argIndex)
+		args = append(args, severity)
+		argIndex++
+	}
+	if activityType != "" {
+		query += fmt.Sprintf(" AND l.activity_type = $%d", argIndex)
+		args = append(args, activityType)
+		argIndex++
+	}
+
+	// Worst first, then oldest first so nothing waits forever
+	query += fmt.Sprintf(`
+		ORDER BY CASE l.severity WHEN 'critical' THEN 4 WHEN 'high' THEN 3 WHEN 'medium' THEN 2 ELSE 1 END DESC,
+		         l.created_at ASC
+		LIMIT $%d OFFSET $%d`, argIndex, argIndex+1)
+	args = append(args, limit, offset)
+
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suspicious activity: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []*models.SuspiciousActivity
+	for rows.Next() {
+		var l models.SuspiciousActivity
+		var evidence []byte
+		if err := rows.Scan(&l.ID, &l.AccountID, &l.Username, &l.TrustScore, &l.CharacterID, &l.CharacterName,
+			&l.ActivityType, &l.Severity, &l.Description, &evidence, &l.AutoActionTaken,
+			&l.Reviewed, &l.ReviewedBy, &l.ReviewResult, &l.CreatedAt); err != nil {
+			continue
+		}
+		l.Evidence = evidence
+		logs = append(logs, &l)
+	}
+	return logs, nil
+}
+
+// ReviewSuspiciousActivity closes a flag. Dismissing a flag gives back the
+// trust score its insert trigger took.
+func (s *GMService) ReviewSuspiciousActivity(ctx context.Context, gmID uuid.UUID, logID uuid.UUID, result string) error {
+	if result != "confirmed" && result != "dismissed" {
+		return errors.New("result must be confirmed or dismissed")
+	}
+
+	gm, err := s.GetGMByID(ctx, gmID)
+	if err != nil {
+		return err
+	}
+
+	var accountID uuid.UUID
+	var severity string
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE suspicious_activity_logs SET reviewed = true, reviewed_by = $1, review_result = $2
+			WHERE id = $3 AND reviewed = false
+			RETURNING account_id, severity
+		`, gm.GMName, result, logID).Scan(&accountID, &severity)
+		if err != nil {
+			return errors.New("activity not found or already reviewed")
+		}
+
+		if result == "dismissed" {
+			_, err = tx.Exec(ctx, `
+				UPDATE accounts SET trust_score = LEAST(1000, trust_score +
+					CASE $1 WHEN 'medium' THEN 50 WHEN 'high' THEN 100 WHEN 'critical' THEN 200 ELSE 10 END)
+				WHERE id = $2
+			`, severity, accountID)
+			if err != nil {
+				return fmt.Errorf("failed to restore trust score: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logGMAction(ctx, gmID, "review_suspicious", &accountID, nil, fmt.Sprintf("Flag %s (%s) %s", logID, severity, result))
+	return nil
+}
+
+// JailCharacter sends a character to prison. Minutes overrides the standard
+// sentence for the reason; exploit sentences are never shorter than 24 hours.
+func (s *GMService) JailCharacter(ctx context.Context, gmID uuid.UUID, characterID uuid.UUID, req *models.JailRequest) (*models.PrisonRecord, error) {
+	sentence, err := sentenceFor(req.Reason, req.Minutes)
+	if err != nil {
+		return nil, err
+	}
+
+	var record *models.PrisonRecord
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		record, err = imprison(ctx, tx, characterID, &jailOrder{
+			Reason:   req.Reason,
+			Details:  req.Details,
+			Sentence: sentence,
+			JailedBy: &gmID,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logGMAction(ctx, gmID, "jail", nil, &characterID, fmt.Sprintf("Reason: %s, Sentence: %d min, Details: %s", req.Reason, record.SentenceMinutes, req.Details))
+	return record, nil
+}
+
+// UnjailCharacter releases a prisoner before their sentence is served
+func (s *GMService) UnjailCharacter(ctx context.Context, gmID uuid.UUID, characterID uuid.UUID, reason string) error {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return release(ctx, tx, characterID, &gmID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logGMAction(ctx, gmID, "unjail", nil, &characterID, fmt.Sprintf("Unjail reason: %s", reason))
+	return nil
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// GuildBonusCacheTTL bounds how long a member's guild is cached. Membership
+// changes invalidate right away; guild level-ups show after at most this.
+const GuildBonusCacheTTL = 5 * time.Minute
+
+// GuildBonusService resolves the specialization bonuses a character gets
+// from their guild for other services' rewards
+type GuildBonusService struct {
+	db *database.DB
+
+	mu sync.Mutex
+	// tiers holds guild_specialization_bonuses by specialization and tier
+	// level; the table is static and loaded once
+	tiers map[models.GuildSpecialization]map[int]map[models.GuildBonus]float64
+	// members caches each character's guild; generation makes a lookup
+	// that raced an invalidation drop its result
+	members    map[uuid.UUID]*memberGuild
+	generation uint64
+}
+
+func NewGuildBonusService(db *database.DB) *GuildBonusService {
+	return &GuildBonusService{db: db, members: make(map[uuid.UUID]*memberGuild)}
+}
+
+// memberGuild is a cached guild membership. GuildID is nil for characters
+// outside a guild.
+type memberGuild struct {
+	GuildID        *uuid.UUID
+	Specialization models.GuildSpecialization
+	Level          int
+	ExpiresAt      time.Time
+}
+
+func (s *GuildBonusService) loadTiers(ctx context.Context) (map[models.GuildSpecialization]map[int]map[models.GuildBonus]float64, error) {
+	s.mu.Lock()
+	tiers := s.tiers
+	s.mu.Unlock()
+	if tiers != nil {
+		return tiers, nil
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT specialization::text, bonus_level_1, bonus_level_5, bonus_level_10 FROM guild_specialization_bonuses
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild bonuses: %w", err)
+	}
+	defer rows.Close()
+
+	tiers = make(map[models.GuildSpecialization]map[int]map[models.GuildBonus]float64)
+	for rows.Next() {
+		var spec models.GuildSpecialization
+		raw := make([][]byte, len(models.GuildBonusTierLevels))
+		if err := rows.Scan(&spec, &raw[0], &raw[1], &raw[2]); err != nil {
+			return nil, fmt.Errorf("failed to scan guild bonuses: %w", err)
+		}
+		tiers[spec] = make(map[int]map[models.GuildBonus]float64)
+		for i, level := range models.GuildBonusTierLevels {
+			var bonus map[models.GuildBonus]float64
+			if err := json.Unmarshal(raw[i], &bonus); err != nil {
+				return nil, fmt.Errorf("invalid %s bonuses at level %d: %w", spec, level, err)
+			}
+			tiers[spec][level] = bonus
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.tiers = tiers
+	s.mu.Unlock()
+	return tiers, nil
+}
+
+func (s *GuildBonusService) memberGuild(ctx context.Context, characterID uuid.UUID) (*memberGuild, error) {
+	s.mu.Lock()
+	m, ok := s.members[characterID]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && time.Now().Before(m.ExpiresAt) {
+		return m, nil
+	}
+
+	m = &memberGuild{ExpiresAt: time.Now().Add(GuildBonusCacheTTL)}
+	var guildID uuid.UUID
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT g.id, g.specialization::text, COALESCE(g.level, 1)
+		FROM guild_members gm
+		JOIN guilds g ON g.id = gm.guild_id
+		WHERE gm.character_id = $1 AND g.disbanded_at IS NULL
+	`, characterID).Scan(&guildID, &m.Specialization, &m.Level)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("failed to get guild membership: %w", err)
+	default:
+		m.GuildID = &guildID
+	}
+
+	s.mu.Lock()
+	if s.generation == generation {
+		s.members[characterID] = m
+	}
+	s.mu.Unlock()
+	return m, nil
+}
+
+// Resolve returns the bonuses a character's guild gives to an activity
+func (s *GuildBonusService) Resolve(ctx context.Context, characterID uuid.UUID, activity models.BonusActivity) (*models.ActivityBonus, error) {
+	b := &models.ActivityBonus{Activity: activity, Percent: map[models.GuildBonus]float64{}}
+	m, err := s.memberGuild(ctx, characterID)
+	if err != nil || m.GuildID == nil {
+		return b, err
+	}
+	tiers, err := s.loadTiers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := m.Specialization
+	b.Specialization, b.GuildLevel = &spec, m.Level
+	tier := tiers[spec][models.GuildBonusTier(m.Level)]
+	for _, key := range models.BonusActivityKeys[activity] {
+		if pct, ok := tier[key]; ok {
+			b.Percent[key] = pct
+		}
+	}
+	return b, nil
+}
+
+// Invalidate drops the cached guild of characters whose membership changed
+func (s *GuildBonusService) Invalidate(characterIDs ...uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	for _, id := range characterIDs {
+		delete(s.members, id)
+	}
+}
+
+// InvalidateGuild drops every cached member of a guild
+func (s *GuildBonusService) InvalidateGuild(guildID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	for id, m := range s.members {
+		if m.GuildID != nil && *m.GuildID == guildID {
+			delete(s.members, id)
+		}
+	}
+}
+
+// GetBonuses returns what the acting character's guild adds to each activity
+func (s *GuildService) GetBonuses(ctx context.Context, accountID, characterID uuid.UUID) ([]*models.ActivityBonus, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	if _, err := requireMembership(ctx, s.db.Pool, characterID); err != nil {
+		return nil, err
+	}
+
+	bonuses := make([]*models.ActivityBonus, 0, len(models.BonusActivities))
+	for _, a := range models.BonusActivities {
+		b, err := s.bonuses.Resolve(ctx, characterID, a)
+		if err != nil {
+			return nil, err
+		}
+		bonuses = append(bonuses, b)
+	}
+	return bonuses, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidChatChannel = errors.New("invalid guild chat channel")
+	ErrInvalidChatMessage = errors.New("chat message must be 1-500 characters")
+	ErrGuildChatLocked    = errors.New("guild chat unlocks at guild level 2")
+)
+
+const GuildChatMaxLength = 500
+
+// guildChatChannelID returns the chat_messages channel_id of a guild's chat
+// channel. Allies share the channel keyed by their alliance.
+func guildChatChannelID(ctx context.Context, q querier, guildID uuid.UUID, channel models.GuildChatChannel) (string, error) {
+	switch channel {
+	case models.GuildChatGuild:
+		return guildID.String(), nil
+	case models.GuildChatAlliance:
+		alliance, err := allianceOf(ctx, q, guildID)
+		if err != nil {
+			return "", err
+		}
+		if alliance == nil {
+			return "", ErrNoAlliance
+		}
+		return alliance.String(), nil
+	}
+	return "", ErrInvalidChatChannel
+}
+
+// requireGuildChat fails with ErrGuildChatLocked until the guild has
+// unlocked chat
+func requireGuildChat(ctx context.Context, q querier, guildID uuid.UUID) error {
+	g, err := getGuild(ctx, q, guildID)
+	if err != nil {
+		return err
+	}
+	if !models.GuildFeatureUnlocked(g.Level, models.GuildFeatureChat) {
+		return ErrGuildChatLocked
+	}
+	return nil
+}
+
+// SendChat posts to the acting character's guild or alliance channel
+func (s *GuildService) SendChat(ctx context.Context, accountID, characterID uuid.UUID, channel models.GuildChatChannel, message string) (*models.GuildChatMessage, error) {
+	message = strings.TrimSpace(message)
+	if n := utf8.RuneCountInString(message); n == 0 || n > GuildChatMaxLength {
+		return nil, ErrInvalidChatMessage
+	}
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireGuildChat(ctx, s.db.Pool, m.GuildID); err != nil {
+		return nil, err
+	}
+	channelID, err := guildChatChannelID(ctx, s.db.Pool, m.GuildID, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &models.GuildChatMessage{
+		Channel:    channel,
+		SenderID:   c.ID,
+		SenderName: c.Name,
+		Message:    message,
+	}
+	err = s.db.Pool.QueryRow(ctx, `
+		INSERT INTO chat_messages (server_id, channel_type, channel_id, sender_id, sender_name, message)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, sent_at
+	`, c.ServerID, channel, channelID, c.ID, c.Name, message).Scan(&msg.ID, &msg.SentAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send chat message: %w", err)
+	}
+	return msg, nil
+}
+
+// GetChat returns the latest messages of the acting character's guild or
+// alliance channel, newest first
+func (s *GuildService) GetChat(ctx context.Context, accountID, characterID uuid.UUID, channel models.GuildChatChannel, limit, offset int) ([]*models.GuildChatMessage, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireGuildChat(ctx, s.db.Pool, m.GuildID); err != nil {
+		return nil, err
+	}
+	channelID, err := guildChatChannelID(ctx, s.db.Pool, m.GuildID, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, sender_id, sender_name, message, sent_at
+		FROM chat_messages
+		WHERE server_id = $1 AND channel_type = $2 AND channel_id = $3
+		ORDER BY sent_at DESC
+		LIMIT $4 OFFSET $5
+	`, c.ServerID, channel, channelID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*models.GuildChatMessage
+	for rows.Next() {
+		msg := &models.GuildChatMessage{Channel: channel}
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.SenderName, &msg.Message, &msg.SentAt); err != nil {
+			return nil, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,533 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrGuildNotRecruiting  = errors.New("guild is not recruiting")
+	ErrGuildLevelTooLow    = errors.New("character level is below the guild's requirement")
+	ErrApplicationNotFound = errors.New("guild application not found")
+	ErrApplicationPending  = errors.New("an application to this guild is already pending")
+	ErrInviteNotFound      = errors.New("guild invite not found")
+	ErrAlreadyInvited      = errors.New("character already has a pending invite from this guild")
+)
+
+// GuildInviteDuration is how long an invite can be accepted
+const GuildInviteDuration = 72 * time.Hour
+
+const guildApplicationColumns = `a.id, a.guild_id, g.name, a.character_id, c.name, c.level, a.message,
+	COALESCE(a.status, 'pending'), a.reviewed_by, a.reviewed_at, a.created_at`
+
+func scanGuildApplication(row pgx.Row) (*models.GuildApplication, error) {
+	var a models.GuildApplication
+	err := row.Scan(&a.ID, &a.GuildID, &a.GuildName, &a.CharacterID, &a.CharacterName, &a.CharacterLevel, &a.Message,
+		&a.Status, &a.ReviewedBy, &a.ReviewedAt, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func getGuildApplication(ctx context.Context, q querier, applicationID uuid.UUID) (*models.GuildApplication, error) {
+	a, err := scanGuildApplication(q.QueryRow(ctx, `
+		SELECT `+guildApplicationColumns+`
+		FROM guild_applications a
+		JOIN guilds g ON g.id = a.guild_id
+		JOIN characters c ON c.id = a.character_id
+		WHERE a.id = $1
+	`, applicationID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrApplicationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild application: %w", err)
+	}
+	return a, nil
+}
+
+const guildInviteColumns = `i.id, i.guild_id, g.name, i.character_id, c.name, i.invited_by, COALESCE(ib.name, ''),
+	COALESCE(i.status, 'pending'), i.created_at, i.expires_at`
+
+func scanGuildInvite(row pgx.Row) (*models.GuildInvite, error) {
+	var i models.GuildInvite
+	err := row.Scan(&i.ID, &i.GuildID, &i.GuildName, &i.CharacterID, &i.CharacterName, &i.InvitedBy, &i.InvitedByName,
+		&i.Status, &i.CreatedAt, &i.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// lockMembers locks the acting character and another character, checks the
+// actor's ownership and returns both guild memberships.
+func lockMembers(ctx context.Context, tx pgx.Tx, accountID, characterID, otherID uuid.UUID) (map[uuid.UUID]*characterRef, *guildMembership, *guildMembership, error) {
+	locked, err := lockCharacters(ctx, tx, characterID, otherID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if locked[characterID].AccountID != accountID {
+		return nil, nil, nil, ErrNotCharacterOwner
+	}
+	actor, err := requireMembership(ctx, tx, characterID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	other, err := getMembership(ctx, tx, otherID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return locked, actor, other, nil
+}
+
+// Apply asks to join a guild on the character's server. A guild with auto
+// accept takes the character in straight away.
+func (s *GuildService) Apply(ctx context.Context, accountID, characterID, guildID uuid.UUID, message string) (*models.GuildApplication, error) {
+	var msg *string
+	if m := strings.TrimSpace(message); m != "" {
+		msg = &m
+	}
+
+	var applicationID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		m, err := getMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			return ErrAlreadyInGuild
+		}
+		g, err := lockGuild(ctx, tx, guildID)
+		if err != nil {
+			return err
+		}
+		if g.ServerID != c.ServerID {
+			return ErrGuildNotFound
+		}
+		if !g.IsRecruiting {
+			return ErrGuildNotRecruiting
+		}
+		if c.Level < g.MinLevelRequirement {
+			return ErrGuildLevelTooLow
+		}
+		if g.CurrentMembers >= models.GuildMemberLimit(g.Level) {
+			return ErrGuildFull
+		}
+
+		status := "pending"
+		var reviewedAt *time.Time
+		if g.AutoAccept {
+			now := time.Now()
+			status, reviewedAt = "accepted", &now
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO guild_applications (guild_id, character_id, message, status, reviewed_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (guild_id, character_id) DO UPDATE SET
+				message = EXCLUDED.message,
+				status = EXCLUDED.status,
+				reviewed_by = NULL,
+				reviewed_at = EXCLUDED.reviewed_at,
+				created_at = NOW()
+			WHERE guild_applications.status <> 'pending'
+			RETURNING id
+		`, g.ID, characterID, msg, status, reviewedAt).Scan(&applicationID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrApplicationPending
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create guild application: %w", err)
+		}
+
+		if g.AutoAccept {
+			return addMember(ctx, tx, g, characterID, models.GuildRankMember, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.bonuses.Invalidate(characterID)
+	return getGuildApplication(ctx, s.db.Pool, applicationID)
+}
+
+// CancelApplication withdraws one of the acting character's pending
+// applications
+func (s *GuildService) CancelApplication(ctx context.Context, accountID, characterID, applicationID uuid.UUID) error {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return err
+	}
+	tag, err := s.db.Pool.Exec(ctx, `
+		UPDATE guild_applications SET status = 'cancelled'
+		WHERE id = $1 AND character_id = $2 AND status = 'pending'
+	`, applicationID, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel application: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrApplicationNotFound
+	}
+	return nil
+}
+
+// ListApplications returns the pending applications to the acting
+// character's guild, oldest first. Officers and the leader only.
+func (s *GuildService) ListApplications(ctx context.Context, accountID, characterID uuid.UUID) ([]*models.GuildApplication, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageMembers(m.Rank) {
+		return nil, ErrInsufficientGuildRank
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+guildApplicationColumns+`
+		FROM guild_applications a
+		JOIN guilds g ON g.id = a.guild_id
+		JOIN characters c ON c.id = a.character_id
+		WHERE a.guild_id = $1 AND a.status = 'pending'
+		ORDER BY a.created_at
+	`, m.GuildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild applications: %w", err)
+	}
+	defer rows.Close()
+
+	var applications []*models.GuildApplication
+	for rows.Next() {
+		a, err := scanGuildApplication(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan guild application: %w", err)
+		}
+		applications = append(applications, a)
+	}
+	return applications, rows.Err()
+}
+
+// AcceptApplication takes an applicant into the acting officer's guild
+func (s *GuildService) AcceptApplication(ctx context.Context, accountID, characterID, applicationID uuid.UUID) (*models.GuildApplication, error) {
+	app, err := getGuildApplication(ctx, s.db.Pool, applicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		_, actor, applicant, err := lockMembers(ctx, tx, accountID, characterID, app.CharacterID)
+		if err != nil {
+			return err
+		}
+		if actor.GuildID != app.GuildID {
+			return ErrApplicationNotFound
+		}
+		if !canManageMembers(actor.Rank) {
+			return ErrInsufficientGuildRank
+		}
+		if applicant != nil {
+			return ErrAlreadyInGuild
+		}
+		g, err := lockGuild(ctx, tx, app.GuildID)
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, `
+			UPDATE guild_applications SET status = 'accepted', reviewed_by = $2, reviewed_at = NOW()
+			WHERE id = $1 AND status = 'pending'
+		`, applicationID, characterID)
+		if err != nil {
+			return fmt.Errorf("failed to accept application: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrApplicationNotFound
+		}
+		return addMember(ctx, tx, g, app.CharacterID, models.GuildRankMember, &characterID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.bonuses.Invalidate(app.CharacterID)
+	return getGuildApplication(ctx, s.db.Pool, applicationID)
+}
+
+// RejectApplication turns down a pending application to the acting
+// officer's guild
+func (s *GuildService) RejectApplication(ctx context.Context, accountID, characterID, applicationID uuid.UUID) (*models.GuildApplication, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageMembers(m.Rank) {
+		return nil, ErrInsufficientGuildRank
+	}
+
+	tag, err := s.db.Pool.Exec(ctx, `
+		UPDATE guild_applications SET status = 'rejected', reviewed_by = $3, reviewed_at = NOW()
+		WHERE id = $1 AND guild_id = $2 AND status = 'pending'
+	`, applicationID, m.GuildID, characterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reject application: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrApplicationNotFound
+	}
+	return getGuildApplication(ctx, s.db.Pool, applicationID)
+}
+
+// Invite asks a guildless character on the same server to join the acting
+// officer's guild
+func (s *GuildService) Invite(ctx context.Context, accountID, characterID, targetID uuid.UUID) (*models.GuildInvite, error) {
+	var inviteID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, actor, target, err := lockMembers(ctx, tx, accountID, characterID, targetID)
+		if err != nil {
+			return err
+		}
+		if locked[targetID].ServerID != locked[characterID].ServerID {
+			return ErrCharacterNotFound
+		}
+		if !canManageMembers(actor.Rank) {
+			return ErrInsufficientGuildRank
+		}
+		if target != nil {
+			return ErrAlreadyInGuild
+		}
+		g, err := lockGuild(ctx, tx, actor.GuildID)
+		if err != nil {
+			return err
+		}
+		if g.CurrentMembers >= models.GuildMemberLimit(g.Level) {
+			return ErrGuildFull
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE guild_invites SET status = 'expired'
+			WHERE guild_id = $1 AND character_id = $2 AND status = 'pending' AND expires_at <= NOW()
+		`, g.ID, targetID)
+		if err != nil {
+			return fmt.Errorf("failed to expire invites: %w", err)
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO guild_invites (guild_id, character_id, invited_by, expires_at)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, g.ID, targetID, characterID, time.Now().Add(GuildInviteDuration)).Scan(&inviteID)
+		if _, ok := uniqueViolation(err); ok {
+			return ErrAlreadyInvited
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create guild invite: %w", err)
+		}
+		return logGuild(ctx, tx, g.ID, "member_invite", &characterID, &targetID, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invite, err := scanGuildInvite(s.db.Pool.QueryRow(ctx, `
+		SELECT `+guildInviteColumns+`
+		FROM guild_invites i
+		JOIN guilds g ON g.id = i.guild_id
+		JOIN characters c ON c.id = i.character_id
+		LEFT JOIN characters ib ON ib.id = i.invited_by
+		WHERE i.id = $1
+	`, inviteID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild invite: %w", err)
+	}
+	return invite, nil
+}
+
+// ListMyInvites returns the acting character's open guild invites
+func (s *GuildService) ListMyInvites(ctx context.Context, accountID, characterID uuid.UUID) ([]*models.GuildInvite, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+guildInviteColumns+`
+		FROM guild_invites i
+		JOIN guilds g ON g.id = i.guild_id AND g.disbanded_at IS NULL
+		JOIN characters c ON c.id = i.character_id
+		LEFT JOIN characters ib ON ib.id = i.invited_by
+		WHERE i.character_id = $1 AND i.status = 'pending' AND i.expires_at > NOW()
+		ORDER BY i.created_at DESC
+	`, characterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []*models.GuildInvite
+	for rows.Next() {
+		i, err := scanGuildInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan guild invite: %w", err)
+		}
+		invites = append(invites, i)
+	}
+	return invites, rows.Err()
+}
+
+// AcceptInvite joins the guild behind one of the acting character's invites
+func (s *GuildService) AcceptInvite(ctx context.Context, accountID, characterID, inviteID uuid.UUID) (*models.Guild, error) {
+	var guildID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		m, err := getMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			return ErrAlreadyInGuild
+		}
+
+		var invitedBy uuid.UUID
+		err = tx.QueryRow(ctx, `
+			UPDATE guild_invites SET status = 'accepted', responded_at = NOW()
+			WHERE id = $1 AND character_id = $2 AND status = 'pending' AND expires_at > NOW()
+			RETURNING guild_id, invited_by
+		`, inviteID, characterID).Scan(&guildID, &invitedBy)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInviteNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to accept invite: %w", err)
+		}
+		g, err := lockGuild(ctx, tx, guildID)
+		if err != nil {
+			return err
+		}
+		return addMember(ctx, tx, g, characterID, models.GuildRankMember, &invitedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.bonuses.Invalidate(characterID)
+	return getGuild(ctx, s.db.Pool, guildID)
+}
+
+// DeclineInvite turns down one of the acting character's invites
+func (s *GuildService) DeclineInvite(ctx context.Context, accountID, characterID, inviteID uuid.UUID) error {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return err
+	}
+	tag, err := s.db.Pool.Exec(ctx, `
+		UPDATE guild_invites SET status = 'declined', responded_at = NOW()
+		WHERE id = $1 AND character_id = $2 AND status = 'pending'
+	`, inviteID, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to decline invite: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// Kick removes a lower ranked member from the acting officer's guild
+func (s *GuildService) Kick(ctx context.Context, accountID, characterID, targetID uuid.UUID) error {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		_, actor, target, err := lockMembers(ctx, tx, accountID, characterID, targetID)
+		if err != nil {
+			return err
+		}
+		if target == nil || target.GuildID != actor.GuildID {
+			return ErrNotGuildMember
+		}
+		if !canManageMembers(actor.Rank) || !actor.Rank.Outranks(target.Rank) {
+			return ErrInsufficientGuildRank
+		}
+		if _, err := lockGuild(ctx, tx, actor.GuildID); err != nil {
+			return err
+		}
+		return removeMember(ctx, tx, actor.GuildID, targetID, "member_kick", &characterID)
+	})
+	if err != nil {
+		return err
+	}
+	s.bonuses.Invalidate(targetID)
+	return nil
+}
+
+// Leave takes the acting character out of their guild. The leader has to
+// transfer leadership or disband instead.
+func (s *GuildService) Leave(ctx context.Context, accountID, characterID uuid.UUID) error {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if m.Rank == models.GuildRankLeader {
+			return ErrLeaderCannotLeave
+		}
+		if _, err := lockGuild(ctx, tx, m.GuildID); err != nil {
+			return err
+		}
+		return removeMember(ctx, tx, m.GuildID, characterID, "member_leave", &characterID)
+	})
+	if err != nil {
+		return err
+	}
+	s.bonuses.Invalidate(characterID)
+	return nil
+}
+
+// SetRank promotes or demotes a member. Officers and the leader can only
+// manage members below them and only assign ranks below their own;
+// leadership moves through Transfer.
+func (s *GuildService) SetRank(ctx context.Context, accountID, characterID, targetID uuid.UUID, rank models.GuildRank) error {
+	if _, ok := models.GuildRankOrder[rank]; !ok || rank == models.GuildRankLeader {
+		return ErrInvalidGuildRank
+	}
+
+	return s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		_, actor, target, err := lockMembers(ctx, tx, accountID, characterID, targetID)
+		if err != nil {
+			return err
+		}
+		if target == nil || target.GuildID != actor.GuildID {
+			return ErrNotGuildMember
+		}
+		if !canManageMembers(actor.Rank) || !actor.Rank.Outranks(target.Rank) || !actor.Rank.Outranks(rank) {
+			return ErrInsufficientGuildRank
+		}
+		if target.Rank == rank {
+			return nil
+		}
+		if _, err := lockGuild(ctx, tx, actor.GuildID); err != nil {
+			return err
+		}
+		if err := setMemberRank(ctx, tx, actor.GuildID, targetID, rank); err != nil {
+			return err
+		}
+		return logGuild(ctx, tx, actor.GuildID, "rank_change", &characterID, &targetID, map[string]interface{}{
+			"from": target.Rank,
+			"to":   rank,
+		})
+	})
+}
@@ -0,0 +1,478 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Guild quest rotation. Daily quests start at midnight and weekly quests on
+// Monday; guilds with quests_plus get one more of each.
+const (
+	GuildDailyQuestCount  = 2
+	GuildWeeklyQuestCount = 1
+
+	GuildProgressBatchSize = 50
+)
+
+// SystemGuildQuestReward pays guild quest gold into guild treasuries
+const SystemGuildQuestReward = "guild_quest_reward"
+
+// addGuildExp gives a guild EXP and levels it up through every threshold
+// it passes, raising the member limit. Level-ups are logged and queued for
+// the members; the mail goes out from ProcessGuildProgress so the guild row
+// is never held while member rows are touched.
+func addGuildExp(ctx context.Context, tx pgx.Tx, guildID uuid.UUID, amount int64, source string) error {
+	if amount <= 0 {
+		return nil
+	}
+	var level int
+	var exp int64
+	err := tx.QueryRow(ctx, `
+		UPDATE guilds SET exp = COALESCE(exp, 0) + $2, updated_at = NOW()
+		WHERE id = $1 AND disbanded_at IS NULL
+		RETURNING COALESCE(level, 1), exp
+	`, guildID, amount).Scan(&level, &exp)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add guild exp: %w", err)
+	}
+
+	newLevel := models.GuildLevelForExp(exp)
+	if newLevel <= level {
+		return nil
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE guilds SET level = $2, max_members = GREATEST(COALESCE(max_members, 0), $3) WHERE id = $1
+	`, guildID, newLevel, models.GuildMemberLimit(newLevel))
+	if err != nil {
+		return fmt.Errorf("failed to level up guild: %w", err)
+	}
+
+	var unlocked []string
+	for _, f := range models.GuildFeatures {
+		if need := models.GuildFeatureLevels[f]; need > level && need <= newLevel {
+			unlocked = append(unlocked, string(f))
+		}
+	}
+	if err := logGuild(ctx, tx, guildID, "level_up", nil, nil, map[string]interface{}{
+		"level":    newLevel,
+		"source":   source,
+		"unlocked": unlocked,
+	}); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Your guild is now level %d and can have up to %d members.", newLevel, models.GuildMemberLimit(newLevel))
+	if len(unlocked) > 0 {
+		body += " Unlocked: " + strings.Join(unlocked, ", ") + "."
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO guild_notifications (guild_id, notification_type, subject, body)
+		VALUES ($1, 'level_up', $2, $3)
+	`, guildID, fmt.Sprintf("Guild reached level %d", newLevel), body)
+	if err != nil {
+		return fmt.Errorf("failed to queue guild notification: %w", err)
+	}
+	return nil
+}
+
+// RecordActivity credits a member's activity to their guild: guild EXP, the
+// member's contribution and progress on open guild quests of the same type.
+// Characters outside a guild are skipped.
+func (s *GuildService) RecordActivity(ctx context.Context, tx pgx.Tx, characterID uuid.UUID, activity models.GuildActivity, count int) error {
+	if count <= 0 {
+		return nil
+	}
+	m, err := getMembership(ctx, tx, characterID)
+	if err != nil || m == nil {
+		return err
+	}
+
+	exp := models.GuildActivityExp[activity] * count
+	_, err = tx.Exec(ctx, `
+		UPDATE guild_members SET weekly_contribution = COALESCE(weekly_contribution, 0) + $2,
+			total_contribution = COALESCE(total_contribution, 0) + $2, last_active_at = NOW()
+		WHERE character_id = $1
+	`, characterID, exp)
+	if err != nil {
+		return fmt.Errorf("failed to record guild contribution: %w", err)
+	}
+	if err := addGuildExp(ctx, tx, m.GuildID, int64(exp), string(activity)); err != nil {
+		return err
+	}
+	return s.progressQuests(ctx, tx, m.GuildID, characterID, activity, count)
+}
+
+// RecordActivities credits the same activity for several characters, going
+// through their guilds in id order
+func (s *GuildService) RecordActivities(ctx context.Context, tx pgx.Tx, characterIDs []uuid.UUID, activity models.GuildActivity, count int) error {
+	if len(characterIDs) == 0 {
+		return nil
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT character_id FROM guild_members WHERE character_id = ANY($1) ORDER BY guild_id, character_id
+	`, characterIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get guild members: %w", err)
+	}
+	members, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return fmt.Errorf("failed to scan guild members: %w", err)
+	}
+	for _, id := range members {
+		if err := s.RecordActivity(ctx, tx, id, activity, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type questProgress struct {
+	ID         uuid.UUID
+	Done       bool
+	RewardExp  int
+	RewardGold int
+	IsWeekly   bool
+}
+
+// progressQuests advances a guild's open quests of one type and pays out
+// those it completes
+func (s *GuildService) progressQuests(ctx context.Context, tx pgx.Tx, guildID, characterID uuid.UUID, activity models.GuildActivity, count int) error {
+	rows, err := tx.Query(ctx, `
+		UPDATE guild_quests SET current_count = LEAST(target_count, COALESCE(current_count, 0) + $3)
+		WHERE guild_id = $1 AND quest_type = $2 AND completed_at IS NULL
+		  AND starts_at <= NOW() AND expires_at > NOW()
+		RETURNING id, current_count >= target_count, COALESCE(reward_exp, 0), COALESCE(reward_gold, 0),
+		          COALESCE(is_weekly, false)
+	`, guildID, activity, count)
+	if err != nil {
+		return fmt.Errorf("failed to progress guild quests: %w", err)
+	}
+	quests, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (questProgress, error) {
+		var q questProgress
+		err := row.Scan(&q.ID, &q.Done, &q.RewardExp, &q.RewardGold, &q.IsWeekly)
+		return q, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan guild quests: %w", err)
+	}
+
+	for _, q := range quests {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO guild_quest_contributions (quest_id, character_id, contribution_count)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (quest_id, character_id) DO UPDATE
+			SET contribution_count = COALESCE(guild_quest_contributions.contribution_count, 0) + EXCLUDED.contribution_count
+		`, q.ID, characterID, count)
+		if err != nil {
+			return fmt.Errorf("failed to record quest contribution: %w", err)
+		}
+		if !q.Done {
+			continue
+		}
+
+		tag, err := tx.Exec(ctx, "UPDATE guild_quests SET completed_at = NOW() WHERE id = $1 AND completed_at IS NULL", q.ID)
+		if err != nil {
+			return fmt.Errorf("failed to complete guild quest: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			continue
+		}
+		if err := s.rewardQuest(ctx, tx, guildID, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewardQuest pays a completed quest's EXP and gold to the guild
+func (s *GuildService) rewardQuest(ctx context.Context, tx pgx.Tx, guildID uuid.UUID, q questProgress) error {
+	if q.RewardGold > 0 {
+		var serverID int
+		if err := tx.QueryRow(ctx, "SELECT server_id FROM guilds WHERE id = $1", guildID).Scan(&serverID); err != nil {
+			return fmt.Errorf("failed to get guild server: %w", err)
+		}
+		err := s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      serverID,
+			Currency:      models.CurrencyGold,
+			Amount:        int64(q.RewardGold),
+			From:          SystemAccount(SystemGuildQuestReward),
+			To:            GuildAccount(guildID),
+			Reason:        "guild_quest_reward",
+			ReferenceType: "guild_quest",
+			ReferenceID:   &q.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := logGuild(ctx, tx, guildID, "quest_complete", nil, nil, map[string]interface{}{
+		"quest_id":    q.ID,
+		"weekly":      q.IsWeekly,
+		"reward_exp":  q.RewardExp,
+		"reward_gold": q.RewardGold,
+	}); err != nil {
+		return err
+	}
+	return addGuildExp(ctx, tx, guildID, int64(q.RewardExp), "guild_quest")
+}
+
+// GetLevel returns the acting character's guild level progress and which
+// features it has unlocked
+func (s *GuildService) GetLevel(ctx context.Context, accountID, characterID uuid.UUID) (*models.GuildLevelInfo, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	g, err := getGuild(ctx, s.db.Pool, m.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &models.GuildLevelInfo{
+		GuildID:     g.ID,
+		Level:       g.Level,
+		Exp:         g.Exp,
+		MemberLimit: models.GuildMemberLimit(g.Level),
+	}
+	if g.Level < models.GuildMaxLevel {
+		next := models.GuildLevelExp[g.Level]
+		info.NextLevelExp = &next
+	}
+	for _, f := range models.GuildFeatures {
+		info.Features = append(info.Features, &models.GuildFeatureState{
+			Feature:  f,
+			Level:    models.GuildFeatureLevels[f],
+			Unlocked: models.GuildFeatureUnlocked(g.Level, f),
+		})
+	}
+	return info, nil
+}
+
+// ListQuests returns the acting character's guild quests for the current
+// day and week with every member's contribution
+func (s *GuildService) ListQuests(ctx context.Context, accountID, characterID uuid.UUID) ([]*models.GuildQuest, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, quest_type, target_count, COALESCE(current_count, 0), COALESCE(reward_exp, 0),
+		       COALESCE(reward_gold, 0), COALESCE(is_weekly, false), starts_at, expires_at, completed_at
+		FROM guild_quests
+		WHERE guild_id = $1 AND starts_at <= NOW() AND expires_at > NOW()
+		ORDER BY is_weekly, quest_type
+	`, m.GuildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild quests: %w", err)
+	}
+	defer rows.Close()
+
+	var quests []*models.GuildQuest
+	byID := make(map[uuid.UUID]*models.GuildQuest)
+	var ids []uuid.UUID
+	for rows.Next() {
+		q := &models.GuildQuest{Contributors: []*models.GuildQuestContribution{}}
+		if err := rows.Scan(&q.ID, &q.QuestType, &q.TargetCount, &q.CurrentCount, &q.RewardExp,
+			&q.RewardGold, &q.IsWeekly, &q.StartsAt, &q.ExpiresAt, &q.CompletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan guild quest: %w", err)
+		}
+		quests = append(quests, q)
+		byID[q.ID] = q
+		ids = append(ids, q.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return quests, nil
+	}
+
+	rows, err = s.db.Pool.Query(ctx, `
+		SELECT qc.quest_id, qc.character_id, c.name, COALESCE(qc.contribution_count, 0)
+		FROM guild_quest_contributions qc
+		JOIN characters c ON c.id = qc.character_id
+		WHERE qc.quest_id = ANY($1)
+		ORDER BY qc.contribution_count DESC, c.name
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quest contributions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var questID uuid.UUID
+		var c models.GuildQuestContribution
+		if err := rows.Scan(&questID, &c.CharacterID, &c.Name, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan quest contribution: %w", err)
+		}
+		q := byID[questID]
+		q.Contributors = append(q.Contributors, &c)
+		if c.CharacterID == characterID {
+			q.MyContribution = c.Count
+		}
+	}
+	return quests, rows.Err()
+}
+
+// questSeed picks a guild's quests for a period, the same on every run
+func questSeed(guildID uuid.UUID, start time.Time) int64 {
+	return int64(binary.BigEndian.Uint64(guildID[:8])) ^ start.Unix()
+}
+
+// insertGuildQuests hands a guild n quests from pool for one period and
+// returns how many were new
+func insertGuildQuests(ctx context.Context, tx pgx.Tx, guildID uuid.UUID, pool []models.GuildQuestTemplate, n int, weekly bool, start, end time.Time) (int, error) {
+	r := rand.New(rand.NewSource(questSeed(guildID, start)))
+	added := 0
+	for _, i := range r.Perm(len(pool))[:min(n, len(pool))] {
+		t := pool[i]
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO guild_quests (guild_id, quest_type, target_count, reward_exp, reward_gold, starts_at, expires_at, is_weekly)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (guild_id, is_weekly, quest_type, starts_at) DO NOTHING
+		`, guildID, t.Type, t.Target, t.RewardExp, t.RewardGold, start, end, weekly)
+		if err != nil {
+			return added, fmt.Errorf("failed to create guild quest: %w", err)
+		}
+		added += int(tag.RowsAffected())
+	}
+	return added, nil
+}
+
+// ProcessGuildProgress hands out the day's and week's guild quests and
+// mails queued guild notifications to the members
+func (s *GuildService) ProcessGuildProgress(ctx context.Context) (int, error) {
+	now := time.Now()
+	y, m, d := now.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	week := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT g.id, COALESCE(g.level, 1)
+		FROM guilds g
+		WHERE g.disbanded_at IS NULL
+		  AND (NOT EXISTS (SELECT 1 FROM guild_quests q WHERE q.guild_id = g.id AND NOT q.is_weekly AND q.starts_at = $1)
+		    OR NOT EXISTS (SELECT 1 FROM guild_quests q WHERE q.guild_id = g.id AND q.is_weekly AND q.starts_at = $2))
+		LIMIT $3
+	`, day, week, GuildProgressBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find guilds without quests: %w", err)
+	}
+	type guildLevel struct {
+		ID    uuid.UUID
+		Level int
+	}
+	guilds, err := pgx.CollectRows(rows, pgx.RowToStructByPos[guildLevel])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan guilds without quests: %w", err)
+	}
+
+	processed := 0
+	for _, g := range guilds {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			daily, weekly := GuildDailyQuestCount, GuildWeeklyQuestCount
+			if models.GuildFeatureUnlocked(g.Level, models.GuildFeatureQuestsPlus) {
+				daily++
+				weekly++
+			}
+			if _, err := insertGuildQuests(ctx, tx, g.ID, models.GuildDailyQuests, daily, false, day, day.AddDate(0, 0, 1)); err != nil {
+				return err
+			}
+			added, err := insertGuildQuests(ctx, tx, g.ID, models.GuildWeeklyQuests, weekly, true, week, week.AddDate(0, 0, 7))
+			if err != nil {
+				return err
+			}
+			if added > 0 {
+				// A new week starts the weekly contribution ranking over
+				if _, err := tx.Exec(ctx, "UPDATE guild_members SET weekly_contribution = 0 WHERE guild_id = $1", g.ID); err != nil {
+					return fmt.Errorf("failed to reset weekly contributions: %w", err)
+				}
+			}
+			processed++
+			return nil
+		})
+		if err != nil {
+			return processed, fmt.Errorf("failed to rotate quests of guild %s: %w", g.ID, err)
+		}
+	}
+
+	rows, err = s.db.Pool.Query(ctx, `
+		SELECT id FROM guild_notifications WHERE delivered_at IS NULL ORDER BY created_at LIMIT $1
+	`, GuildProgressBatchSize)
+	if err != nil {
+		return processed, fmt.Errorf("failed to find guild notifications: %w", err)
+	}
+	notificationIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return processed, fmt.Errorf("failed to scan guild notifications: %w", err)
+	}
+
+	for _, id := range notificationIDs {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			var guildID uuid.UUID
+			var notificationType, subject string
+			var body *string
+			err := tx.QueryRow(ctx, `
+				UPDATE guild_notifications SET delivered_at = NOW()
+				WHERE id = $1 AND delivered_at IS NULL
+				RETURNING guild_id, notification_type, subject, body
+			`, id).Scan(&guildID, &notificationType, &subject, &body)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to claim guild notification: %w", err)
+			}
+
+			rows, err := tx.Query(ctx, "SELECT character_id FROM guild_members WHERE guild_id = $1", guildID)
+			if err != nil {
+				return fmt.Errorf("failed to get guild members: %w", err)
+			}
+			members, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+			if err != nil {
+				return fmt.Errorf("failed to scan guild members: %w", err)
+			}
+			text := ""
+			if body != nil {
+				text = *body
+			}
+			for _, memberID := range members {
+				if err := sendSystemMail(ctx, tx, memberID, "guild_"+notificationType, subject, text, 0, nil); err != nil {
+					return err
+				}
+			}
+			processed++
+			return nil
+		})
+		if err != nil {
+			return processed, fmt.Errorf("failed to deliver guild notification %s: %w", id, err)
+		}
+	}
+	return processed, nil
+}
+
+// RunProgress rotates guild quests and delivers guild notifications every
+// interval until ctx is cancelled
+func (s *GuildService) RunProgress(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "guild progress", interval, s.ProcessGuildProgress)
+}
@@ -0,0 +1,514 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrRelationNotFound       = errors.New("guild relation not found")
+	ErrRelationExists         = errors.New("the guilds already have a relation")
+	ErrInvalidRelationTarget  = errors.New("a guild cannot have a relation with itself")
+	ErrAllianceExists         = errors.New("guild already has an ally or a pending alliance")
+	ErrTooManyEnemies         = errors.New("guild already has the maximum number of enemies")
+	ErrRelationLocked         = errors.New("guild relation is still locked")
+	ErrRelationNotActive      = errors.New("guild relation is not active")
+	ErrNotDeclaringGuild      = errors.New("only the declaring guild can end this relation")
+	ErrNoAlliance             = errors.New("guild has no ally")
+	ErrRelationTargetNotFound = errors.New("target guild not found")
+)
+
+const (
+	// GuildAllyLockDuration is how long a new alliance cannot be cancelled
+	GuildAllyLockDuration = 30 * 24 * time.Hour
+	// GuildAllyCancelWait is how long an alliance lasts after the cancel vote
+	GuildAllyCancelWait = 7 * 24 * time.Hour
+	// GuildEnemyLockDuration is how long a declared enemy cannot be dropped
+	GuildEnemyLockDuration = 14 * 24 * time.Hour
+	// GuildMaxEnemies counts enemies a guild declared, pending or active
+	GuildMaxEnemies = 3
+)
+
+// lockGuilds locks active guilds in id order
+func lockGuilds(ctx context.Context, tx pgx.Tx, ids ...uuid.UUID) (map[uuid.UUID]*models.Guild, error) {
+	sorted := append([]uuid.UUID(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+
+	locked := make(map[uuid.UUID]*models.Guild, len(sorted))
+	for _, id := range sorted {
+		if _, ok := locked[id]; ok {
+			continue
+		}
+		g, err := lockGuild(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		locked[id] = g
+	}
+	return locked, nil
+}
+
+const guildRelationColumns = `r.id, r.guild_id, g.name, r.target_guild_id, t.name, r.relation_type::text,
+	COALESCE(r.status, 'pending'), COALESCE(r.votes_for, 0), COALESCE(r.votes_required, 0),
+	COALESCE(r.is_confirmed, false), r.locked_until, r.cancel_requested_at, r.ends_at, r.created_at, r.confirmed_at`
+
+const guildRelationJoins = `
+	FROM guild_relations r
+	JOIN guilds g ON g.id = r.guild_id
+	JOIN guilds t ON t.id = r.target_guild_id`
+
+func scanGuildRelation(row pgx.Row) (*models.GuildRelation, error) {
+	var r models.GuildRelation
+	err := row.Scan(&r.ID, &r.GuildID, &r.GuildName, &r.TargetGuildID, &r.TargetGuildName, &r.RelationType,
+		&r.Status, &r.VotesFor, &r.VotesRequired,
+		&r.IsConfirmed, &r.LockedUntil, &r.CancelRequestedAt, &r.EndsAt, &r.CreatedAt, &r.ConfirmedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func getGuildRelation(ctx context.Context, q querier, relationID uuid.UUID) (*models.GuildRelation, error) {
+	r, err := scanGuildRelation(q.QueryRow(ctx, `SELECT `+guildRelationColumns+guildRelationJoins+` WHERE r.id = $1`, relationID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRelationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild relation: %w", err)
+	}
+	return r, nil
+}
+
+// otherGuild returns the guild on the other side of a relation
+func otherGuild(r *models.GuildRelation, guildID uuid.UUID) uuid.UUID {
+	if r.GuildID == guildID {
+		return r.TargetGuildID
+	}
+	return r.GuildID
+}
+
+// enemyGuilds reports whether two characters are in guilds where one has
+// declared the other an enemy
+func enemyGuilds(ctx context.Context, q querier, characterID, otherID uuid.UUID) (bool, error) {
+	var enemies bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM guild_members a
+			JOIN guild_members b ON b.character_id = $2
+			JOIN guild_relations r ON r.relation_type = 'enemy' AND r.is_confirmed
+			  AND ((r.guild_id = a.guild_id AND r.target_guild_id = b.guild_id)
+			    OR (r.guild_id = b.guild_id AND r.target_guild_id = a.guild_id))
+			WHERE a.character_id = $1
+		)
+	`, characterID, otherID).Scan(&enemies)
+	if err != nil {
+		return false, fmt.Errorf("failed to check enemy guilds: %w", err)
+	}
+	return enemies, nil
+}
+
+// allianceOf returns the id of the guild's confirmed alliance, nil if none
+func allianceOf(ctx context.Context, q querier, guildID uuid.UUID) (*uuid.UUID, error) {
+	var id uuid.UUID
+	err := q.QueryRow(ctx, `
+		SELECT id FROM guild_relations
+		WHERE relation_type = 'ally' AND is_confirmed AND (guild_id = $1 OR target_guild_id = $1)
+	`, guildID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alliance: %w", err)
+	}
+	return &id, nil
+}
+
+// proposeRelation checks the acting officer may start a relation with the
+// target guild and opens the vote on it in the officer's guild
+func (s *GuildService) proposeRelation(ctx context.Context, accountID, characterID, targetGuildID uuid.UUID, relationType models.GuildRelationType) (*models.GuildVote, error) {
+	var voteID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if !canManageMembers(m.Rank) {
+			return ErrInsufficientGuildRank
+		}
+		if targetGuildID == m.GuildID {
+			return ErrInvalidRelationTarget
+		}
+		guilds, err := lockGuilds(ctx, tx, m.GuildID, targetGuildID)
+		if errors.Is(err, ErrGuildNotFound) {
+			return ErrRelationTargetNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if guilds[targetGuildID].ServerID != c.ServerID {
+			return ErrRelationTargetNotFound
+		}
+
+		var pairTaken, allianceTaken bool
+		var enemies int
+		err = tx.QueryRow(ctx, `
+			SELECT
+				EXISTS(SELECT 1 FROM guild_relations
+					WHERE (guild_id = $1 AND target_guild_id = $2) OR (guild_id = $2 AND target_guild_id = $1)),
+				EXISTS(SELECT 1 FROM guild_relations
+					WHERE relation_type = 'ally' AND (guild_id IN ($1, $2) OR target_guild_id IN ($1, $2))),
+				(SELECT COUNT(*) FROM guild_relations WHERE relation_type = 'enemy' AND guild_id = $1)
+		`, m.GuildID, targetGuildID).Scan(&pairTaken, &allianceTaken, &enemies)
+		if err != nil {
+			return fmt.Errorf("failed to check guild relations: %w", err)
+		}
+		switch {
+		case pairTaken:
+			return ErrRelationExists
+		case relationType == models.GuildRelationAlly && allianceTaken:
+			return ErrAllianceExists
+		case relationType == models.GuildRelationEnemy && enemies >= GuildMaxEnemies:
+			return ErrTooManyEnemies
+		}
+
+		var relationID uuid.UUID
+		err = tx.QueryRow(ctx, `
+			INSERT INTO guild_relations (guild_id, target_guild_id, relation_type, status, proposed_by)
+			VALUES ($1, $2, $3::guild_relation_type, $4, $5)
+			RETURNING id
+		`, m.GuildID, targetGuildID, string(relationType), models.GuildRelationPending, characterID).Scan(&relationID)
+		if err != nil {
+			return fmt.Errorf("failed to create guild relation: %w", err)
+		}
+
+		voteType := models.GuildVoteAllyPropose
+		if relationType == models.GuildRelationEnemy {
+			voteType = models.GuildVoteEnemyDeclare
+		}
+		v, err := openGuildVote(ctx, tx, m.GuildID, voteType, &relationID, &targetGuildID, &characterID)
+		if err != nil {
+			return err
+		}
+		voteID = v.ID
+		return s.castBallot(ctx, tx, v, characterID, m.Rank, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getVoteFor(ctx, voteID, characterID)
+}
+
+// ProposeAlliance opens a vote in the acting officer's guild on allying with
+// the target guild. Once 70% agree, the target guild votes on accepting.
+func (s *GuildService) ProposeAlliance(ctx context.Context, accountID, characterID, targetGuildID uuid.UUID) (*models.GuildVote, error) {
+	return s.proposeRelation(ctx, accountID, characterID, targetGuildID, models.GuildRelationAlly)
+}
+
+// DeclareEnemy opens a vote in the acting officer's guild on declaring the
+// target guild an enemy. It needs the leader and half the members.
+func (s *GuildService) DeclareEnemy(ctx context.Context, accountID, characterID, targetGuildID uuid.UUID) (*models.GuildVote, error) {
+	return s.proposeRelation(ctx, accountID, characterID, targetGuildID, models.GuildRelationEnemy)
+}
+
+// CancelRelation opens a vote on ending an alliance or an enemy declaration
+// once its lock has run out. Either ally can cancel; only the declaring
+// guild can drop an enemy.
+func (s *GuildService) CancelRelation(ctx context.Context, accountID, characterID, relationID uuid.UUID) (*models.GuildVote, error) {
+	rel, err := getGuildRelation(ctx, s.db.Pool, relationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var voteID uuid.UUID
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if m.GuildID != rel.GuildID && m.GuildID != rel.TargetGuildID {
+			return ErrRelationNotFound
+		}
+		if !canManageMembers(m.Rank) {
+			return ErrInsufficientGuildRank
+		}
+		if _, err := lockGuilds(ctx, tx, rel.GuildID, rel.TargetGuildID); err != nil {
+			return err
+		}
+		if rel, err = getGuildRelation(ctx, tx, relationID); err != nil {
+			return err
+		}
+		if rel.Status != models.GuildRelationActive {
+			return ErrRelationNotActive
+		}
+		if rel.LockedUntil != nil && rel.LockedUntil.After(time.Now()) {
+			return ErrRelationLocked
+		}
+
+		voteType := models.GuildVoteAllyCancel
+		if rel.RelationType == models.GuildRelationEnemy {
+			if m.GuildID != rel.GuildID {
+				return ErrNotDeclaringGuild
+			}
+			voteType = models.GuildVoteEnemyEnd
+		}
+		target := otherGuild(rel, m.GuildID)
+		v, err := openGuildVote(ctx, tx, m.GuildID, voteType, &rel.ID, &target, &characterID)
+		if err != nil {
+			return err
+		}
+		voteID = v.ID
+		return s.castBallot(ctx, tx, v, characterID, m.Rank, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getVoteFor(ctx, voteID, characterID)
+}
+
+// applyRelationVote carries out a closed vote on a relation. Both guilds of
+// the relation are locked.
+func (s *GuildService) applyRelationVote(ctx context.Context, tx pgx.Tx, v *models.GuildVote) error {
+	if v.RelationID == nil {
+		return nil
+	}
+	rel, err := getGuildRelation(ctx, tx, *v.RelationID)
+	if errors.Is(err, ErrRelationNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	passed := v.Status == models.GuildVotePassed
+
+	switch v.VoteType {
+	case models.GuildVoteAllyPropose:
+		if !passed {
+			return endRelation(ctx, tx, rel, "ally_rejected")
+		}
+		// The proposal goes to the target guild
+		_, err := openGuildVote(ctx, tx, rel.TargetGuildID, models.GuildVoteAllyAccept, &rel.ID, &rel.GuildID, nil)
+		return err
+
+	case models.GuildVoteAllyAccept:
+		if !passed {
+			return endRelation(ctx, tx, rel, "ally_rejected")
+		}
+		now := time.Now()
+		lockedUntil := now.Add(GuildAllyLockDuration)
+		if err := confirmRelation(ctx, tx, rel, lockedUntil); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE guilds SET
+				ally_guild_id = CASE WHEN id = $1 THEN $2::uuid ELSE $1::uuid END,
+				ally_since = $3, ally_locked_until = $4, updated_at = NOW()
+			WHERE id IN ($1, $2)
+		`, rel.GuildID, rel.TargetGuildID, now, lockedUntil)
+		if err != nil {
+			return fmt.Errorf("failed to set guild allies: %w", err)
+		}
+		return logRelation(ctx, tx, rel, "ally_formed")
+
+	case models.GuildVoteAllyCancel:
+		if !passed {
+			return nil
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE guild_relations SET status = $2, cancel_requested_at = NOW(), ends_at = $3 WHERE id = $1
+		`, rel.ID, models.GuildRelationCancelling, time.Now().Add(GuildAllyCancelWait))
+		if err != nil {
+			return fmt.Errorf("failed to cancel alliance: %w", err)
+		}
+		return logRelation(ctx, tx, rel, "ally_cancelling")
+
+	case models.GuildVoteEnemyDeclare:
+		if !passed {
+			return endRelation(ctx, tx, rel, "enemy_rejected")
+		}
+		if err := confirmRelation(ctx, tx, rel, time.Now().Add(GuildEnemyLockDuration)); err != nil {
+			return err
+		}
+		return logRelation(ctx, tx, rel, "enemy_declared")
+
+	case models.GuildVoteEnemyEnd:
+		if !passed {
+			return nil
+		}
+		return endRelation(ctx, tx, rel, "enemy_ended")
+	}
+	return nil
+}
+
+// confirmRelation puts a relation into effect
+func confirmRelation(ctx context.Context, tx pgx.Tx, rel *models.GuildRelation, lockedUntil time.Time) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE guild_relations SET status = $2, is_confirmed = true, confirmed_at = NOW(), locked_until = $3
+		WHERE id = $1
+	`, rel.ID, models.GuildRelationActive, lockedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to confirm guild relation: %w", err)
+	}
+	return nil
+}
+
+// endRelation removes a relation and, for an alliance, the guilds' ally
+// links
+func endRelation(ctx context.Context, tx pgx.Tx, rel *models.GuildRelation, action string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM guild_relations WHERE id = $1", rel.ID); err != nil {
+		return fmt.Errorf("failed to end guild relation: %w", err)
+	}
+	if rel.RelationType == models.GuildRelationAlly {
+		_, err := tx.Exec(ctx, `
+			UPDATE guilds SET ally_guild_id = NULL, ally_since = NULL, ally_locked_until = NULL, updated_at = NOW()
+			WHERE id IN ($1, $2) AND ally_guild_id IN ($1, $2)
+		`, rel.GuildID, rel.TargetGuildID)
+		if err != nil {
+			return fmt.Errorf("failed to clear guild allies: %w", err)
+		}
+	}
+	return logRelation(ctx, tx, rel, action)
+}
+
+// logRelation logs a relation change in both guilds
+func logRelation(ctx context.Context, tx pgx.Tx, rel *models.GuildRelation, action string) error {
+	for _, pair := range [][2]uuid.UUID{{rel.GuildID, rel.TargetGuildID}, {rel.TargetGuildID, rel.GuildID}} {
+		if err := logGuild(ctx, tx, pair[0], action, nil, &pair[1], map[string]interface{}{
+			"relation_id": rel.ID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListRelations returns the relations of the acting character's guild,
+// whichever side started them
+func (s *GuildService) ListRelations(ctx context.Context, accountID, characterID uuid.UUID) ([]*models.GuildRelation, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+guildRelationColumns+guildRelationJoins+`
+		WHERE r.guild_id = $1 OR r.target_guild_id = $1
+		ORDER BY r.relation_type, r.created_at
+	`, m.GuildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild relations: %w", err)
+	}
+	defer rows.Close()
+
+	var relations []*models.GuildRelation
+	for rows.Next() {
+		r, err := scanGuildRelation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan guild relation: %w", err)
+		}
+		relations = append(relations, r)
+	}
+	return relations, rows.Err()
+}
+
+// ProcessRelations fails votes whose deadline passed and ends alliances
+// whose cancellation wait is over
+func (s *GuildService) ProcessRelations(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM guild_votes WHERE status = 'open' AND deadline <= NOW() ORDER BY deadline LIMIT $1
+	`, GuildVoteSweepBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired guild votes: %w", err)
+	}
+	voteIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan expired guild votes: %w", err)
+	}
+
+	processed := 0
+	for _, id := range voteIDs {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			v, err := getGuildVote(ctx, tx, id, false)
+			if err != nil {
+				return err
+			}
+			guildIDs := []uuid.UUID{v.GuildID}
+			if v.TargetGuildID != nil {
+				guildIDs = append(guildIDs, *v.TargetGuildID)
+			}
+			if _, err := lockGuilds(ctx, tx, guildIDs...); err != nil {
+				return err
+			}
+			if v, err = getGuildVote(ctx, tx, id, true); err != nil {
+				return err
+			}
+			if v.Status != models.GuildVoteOpen {
+				return nil
+			}
+			processed++
+			return s.closeVote(ctx, tx, v, models.GuildVoteFailed)
+		})
+		if err != nil {
+			return processed, fmt.Errorf("failed to close guild vote %s: %w", id, err)
+		}
+	}
+
+	rows, err = s.db.Pool.Query(ctx, `
+		SELECT id FROM guild_relations WHERE status = 'cancelling' AND ends_at <= NOW() ORDER BY ends_at LIMIT $1
+	`, GuildVoteSweepBatchSize)
+	if err != nil {
+		return processed, fmt.Errorf("failed to find ending alliances: %w", err)
+	}
+	relationIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return processed, fmt.Errorf("failed to scan ending alliances: %w", err)
+	}
+
+	for _, id := range relationIDs {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			rel, err := getGuildRelation(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if _, err := lockGuilds(ctx, tx, rel.GuildID, rel.TargetGuildID); err != nil {
+				return err
+			}
+			if rel, err = getGuildRelation(ctx, tx, id); err != nil {
+				return err
+			}
+			if rel.Status != models.GuildRelationCancelling {
+				return nil
+			}
+			processed++
+			return endRelation(ctx, tx, rel, "ally_ended")
+		})
+		if err != nil {
+			return processed, fmt.Errorf("failed to end alliance %s: %w", id, err)
+		}
+	}
+	return processed, nil
+}
+
+// RunRelationSweeper settles expired votes and ended alliances every
+// interval until ctx is cancelled
+func (s *GuildService) RunRelationSweeper(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "guild relation sweeper", interval, s.ProcessRelations)
+}
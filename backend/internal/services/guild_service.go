@@ -0,0 +1,650 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrGuildSpecTaken        = errors.New("a guild of this specialization already exists on this server")
+	ErrGuildNameTaken        = errors.New("guild name is already taken")
+	ErrInvalidGuildName      = errors.New("guild name must be 3-20 characters")
+	ErrInvalidSpecialization = errors.New("invalid guild specialization")
+	ErrAlreadyInGuild        = errors.New("character is already in a guild")
+	ErrNotInGuild            = errors.New("character is not in a guild")
+	ErrNotGuildMember        = errors.New("character is not a member of this guild")
+	ErrGuildFull             = errors.New("guild has reached its member limit")
+	ErrInsufficientGuildRank = errors.New("guild rank is too low")
+	ErrInvalidGuildRank      = errors.New("invalid guild rank")
+	ErrAlreadyGuildLeader    = errors.New("character is already the guild leader")
+	ErrLeaderCannotLeave     = errors.New("the guild leader must transfer leadership or disband the guild")
+	ErrInvalidGuildSettings  = errors.New("invalid guild settings")
+)
+
+const (
+	GuildNameMinLength = 3
+	GuildNameMaxLength = 20
+)
+
+// System ledger account receiving the treasury of a disbanded guild
+const SystemGuildDisband = "guild_disband"
+
+type GuildService struct {
+	db      *database.DB
+	ledger  *LedgerService
+	bonuses *GuildBonusService
+}
+
+func NewGuildService(db *database.DB, ledger *LedgerService, bonuses *GuildBonusService) *GuildService {
+	return &GuildService{db: db, ledger: ledger, bonuses: bonuses}
+}
+
+const guildColumns = `g.id, g.server_id, g.name, g.description, g.emblem_url, g.specialization::text,
+	COALESCE(g.level, 1), COALESCE(g.exp, 0), COALESCE(g.max_members, 20), COALESCE(g.current_members, 0),
+	COALESCE(g.gold_treasury, 0), g.leader_id, COALESCE(l.name, ''), COALESCE(g.is_recruiting, true),
+	COALESCE(g.min_level_requirement, 1), COALESCE(g.auto_accept, false), g.created_at`
+
+func scanGuild(row pgx.Row) (*models.Guild, error) {
+	var g models.Guild
+	err := row.Scan(&g.ID, &g.ServerID, &g.Name, &g.Description, &g.EmblemURL, &g.Specialization,
+		&g.Level, &g.Exp, &g.MaxMembers, &g.CurrentMembers,
+		&g.GoldTreasury, &g.LeaderID, &g.LeaderName, &g.IsRecruiting,
+		&g.MinLevelRequirement, &g.AutoAccept, &g.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func getGuild(ctx context.Context, q querier, guildID uuid.UUID) (*models.Guild, error) {
+	g, err := scanGuild(q.QueryRow(ctx, `
+		SELECT `+guildColumns+`
+		FROM guilds g
+		LEFT JOIN characters l ON l.id = g.leader_id
+		WHERE g.id = $1 AND g.disbanded_at IS NULL
+	`, guildID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGuildNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild: %w", err)
+	}
+	return g, nil
+}
+
+// lockGuild locks an active guild row. Membership changes take the member's
+// character lock first and the guild lock second.
+func lockGuild(ctx context.Context, tx pgx.Tx, guildID uuid.UUID) (*models.Guild, error) {
+	g, err := scanGuild(tx.QueryRow(ctx, `
+		SELECT `+guildColumns+`
+		FROM guilds g
+		LEFT JOIN characters l ON l.id = g.leader_id
+		WHERE g.id = $1 AND g.disbanded_at IS NULL
+		FOR UPDATE OF g
+	`, guildID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGuildNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock guild: %w", err)
+	}
+	return g, nil
+}
+
+// guildMembership is a character's guild and rank
+type guildMembership struct {
+	GuildID uuid.UUID
+	Rank    models.GuildRank
+}
+
+// getMembership returns the character's guild membership, nil if guildless
+func getMembership(ctx context.Context, q querier, characterID uuid.UUID) (*guildMembership, error) {
+	var m guildMembership
+	err := q.QueryRow(ctx, `
+		SELECT guild_id, COALESCE(rank, 'member') FROM guild_members WHERE character_id = $1
+	`, characterID).Scan(&m.GuildID, &m.Rank)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild membership: %w", err)
+	}
+	return &m, nil
+}
+
+// requireMembership is getMembership failing with ErrNotInGuild
+func requireMembership(ctx context.Context, q querier, characterID uuid.UUID) (*guildMembership, error) {
+	m, err := getMembership(ctx, q, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, ErrNotInGuild
+	}
+	return m, nil
+}
+
+// canManageMembers reports whether a rank may review applications and invite
+func canManageMembers(rank models.GuildRank) bool {
+	return rank == models.GuildRankLeader || rank == models.GuildRankOfficer
+}
+
+// logGuild writes a guild_logs entry
+func logGuild(ctx context.Context, q querier, guildID uuid.UUID, action string, actorID, targetID *uuid.UUID, details map[string]interface{}) error {
+	var raw []byte
+	if details != nil {
+		var err error
+		if raw, err = json.Marshal(details); err != nil {
+			return fmt.Errorf("failed to encode guild log: %w", err)
+		}
+	}
+	_, err := q.Exec(ctx, `
+		INSERT INTO guild_logs (guild_id, action_type, actor_id, target_id, details)
+		VALUES ($1, $2, $3, $4, $5)
+	`, guildID, action, actorID, targetID, raw)
+	if err != nil {
+		return fmt.Errorf("failed to write guild log: %w", err)
+	}
+	return nil
+}
+
+// addMember puts a guildless character into a locked guild, enforcing the
+// member limit of the guild's level, and drops the character's other pending
+// applications and invites.
+func addMember(ctx context.Context, tx pgx.Tx, g *models.Guild, characterID uuid.UUID, rank models.GuildRank, actorID *uuid.UUID) error {
+	limit := models.GuildMemberLimit(g.Level)
+	if g.CurrentMembers >= limit {
+		return ErrGuildFull
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO guild_members (guild_id, character_id, rank, rank_order)
+		VALUES ($1, $2, $3, $4)
+	`, g.ID, characterID, rank, models.GuildRankOrder[rank])
+	if _, ok := uniqueViolation(err); ok {
+		return ErrAlreadyInGuild
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add guild member: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE guilds SET current_members = COALESCE(current_members, 0) + 1, max_members = $2, updated_at = NOW()
+		WHERE id = $1
+	`, g.ID, limit)
+	if err != nil {
+		return fmt.Errorf("failed to update member count: %w", err)
+	}
+	g.CurrentMembers++
+	g.MaxMembers = limit
+
+	_, err = tx.Exec(ctx, `
+		UPDATE characters SET guild_id = $2, guild_rank = $3, guild_joined_at = NOW() WHERE id = $1
+	`, characterID, g.ID, rank)
+	if err != nil {
+		return fmt.Errorf("failed to set character guild: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE guild_applications SET status = 'cancelled' WHERE character_id = $1 AND status = 'pending'
+	`, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel applications: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE guild_invites SET status = 'cancelled', responded_at = NOW() WHERE character_id = $1 AND status = 'pending'
+	`, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel invites: %w", err)
+	}
+	return logGuild(ctx, tx, g.ID, "member_join", actorID, &characterID, map[string]interface{}{"rank": rank})
+}
+
+// removeMember takes a character out of a locked guild and logs action
+func removeMember(ctx context.Context, tx pgx.Tx, guildID, characterID uuid.UUID, action string, actorID *uuid.UUID) error {
+	tag, err := tx.Exec(ctx, "DELETE FROM guild_members WHERE guild_id = $1 AND character_id = $2", guildID, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to remove guild member: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotGuildMember
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE guilds SET current_members = GREATEST(COALESCE(current_members, 0) - 1, 0), updated_at = NOW()
+		WHERE id = $1
+	`, guildID)
+	if err != nil {
+		return fmt.Errorf("failed to update member count: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE characters SET guild_id = NULL, guild_rank = NULL, guild_joined_at = NULL WHERE id = $1
+	`, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to clear character guild: %w", err)
+	}
+	return logGuild(ctx, tx, guildID, action, actorID, &characterID, nil)
+}
+
+// setMemberRank changes a member's rank in guild_members and on the character
+func setMemberRank(ctx context.Context, tx pgx.Tx, guildID, characterID uuid.UUID, rank models.GuildRank) error {
+	tag, err := tx.Exec(ctx, `
+		UPDATE guild_members SET rank = $3, rank_order = $4 WHERE guild_id = $1 AND character_id = $2
+	`, guildID, characterID, rank, models.GuildRankOrder[rank])
+	if err != nil {
+		return fmt.Errorf("failed to set guild rank: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotGuildMember
+	}
+	_, err = tx.Exec(ctx, "UPDATE characters SET guild_rank = $2 WHERE id = $1", characterID, rank)
+	if err != nil {
+		return fmt.Errorf("failed to set character guild rank: %w", err)
+	}
+	return nil
+}
+
+// Found creates the acting character's guild with them as leader. A server
+// has one active guild per specialization; founders are serialized on the
+// server row and the partial unique indexes back the check up.
+func (s *GuildService) Found(ctx context.Context, accountID, characterID uuid.UUID, req *models.FoundGuildRequest) (*models.Guild, error) {
+	name := strings.TrimSpace(req.Name)
+	if n := utf8.RuneCountInString(name); n < GuildNameMinLength || n > GuildNameMaxLength {
+		return nil, ErrInvalidGuildName
+	}
+	if !req.Specialization.Valid() {
+		return nil, ErrInvalidSpecialization
+	}
+	var description *string
+	if d := strings.TrimSpace(req.Description); d != "" {
+		description = &d
+	}
+
+	var guildID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		m, err := getMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			return ErrAlreadyInGuild
+		}
+
+		if _, err := tx.Exec(ctx, "SELECT 1 FROM servers WHERE id = $1 FOR UPDATE", c.ServerID); err != nil {
+			return fmt.Errorf("failed to lock server: %w", err)
+		}
+		var specTaken, nameTaken bool
+		err = tx.QueryRow(ctx, `
+			SELECT COALESCE(bool_or(specialization::text = $2), false), COALESCE(bool_or(LOWER(name) = LOWER($3)), false)
+			FROM guilds
+			WHERE server_id = $1 AND disbanded_at IS NULL
+		`, c.ServerID, string(req.Specialization), name).Scan(&specTaken, &nameTaken)
+		if err != nil {
+			return fmt.Errorf("failed to check guilds: %w", err)
+		}
+		if specTaken {
+			return ErrGuildSpecTaken
+		}
+		if nameTaken {
+			return ErrGuildNameTaken
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO guilds (server_id, name, description, specialization, max_members, current_members, leader_id)
+			VALUES ($1, $2, $3, $4::guild_specialization, $5, 0, $6)
+			RETURNING id
+		`, c.ServerID, name, description, string(req.Specialization), models.GuildMemberLimit(1), characterID).Scan(&guildID)
+		if constraint, ok := uniqueViolation(err); ok {
+			if constraint == "idx_guilds_active_name" {
+				return ErrGuildNameTaken
+			}
+			return ErrGuildSpecTaken
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create guild: %w", err)
+		}
+
+		g, err := lockGuild(ctx, tx, guildID)
+		if err != nil {
+			return err
+		}
+		if err := logGuild(ctx, tx, guildID, "guild_found", &characterID, nil, map[string]interface{}{
+			"name":           name,
+			"specialization": req.Specialization,
+		}); err != nil {
+			return err
+		}
+		return addMember(ctx, tx, g, characterID, models.GuildRankLeader, &characterID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.bonuses.Invalidate(characterID)
+	return getGuild(ctx, s.db.Pool, guildID)
+}
+
+// ListGuilds returns the active guilds of the acting character's server in
+// specialization order
+func (s *GuildService) ListGuilds(ctx context.Context, accountID, characterID uuid.UUID) ([]*models.Guild, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+guildColumns+`
+		FROM guilds g
+		LEFT JOIN characters l ON l.id = g.leader_id
+		WHERE g.server_id = $1 AND g.disbanded_at IS NULL
+		ORDER BY g.specialization
+	`, c.ServerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guilds: %w", err)
+	}
+	defer rows.Close()
+
+	var guilds []*models.Guild
+	for rows.Next() {
+		g, err := scanGuild(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan guild: %w", err)
+		}
+		guilds = append(guilds, g)
+	}
+	return guilds, rows.Err()
+}
+
+func (s *GuildService) GetGuild(ctx context.Context, guildID uuid.UUID) (*models.Guild, error) {
+	return getGuild(ctx, s.db.Pool, guildID)
+}
+
+// GetMyGuild returns the acting character's guild
+func (s *GuildService) GetMyGuild(ctx context.Context, accountID, characterID uuid.UUID) (*models.Guild, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	return getGuild(ctx, s.db.Pool, m.GuildID)
+}
+
+// GetMembers lists a guild's members by rank, then join date
+func (s *GuildService) GetMembers(ctx context.Context, guildID uuid.UUID, limit, offset int) ([]*models.GuildMember, error) {
+	if _, err := getGuild(ctx, s.db.Pool, guildID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT c.id, c.name, c.level, c.class, COALESCE(gm.rank, 'member'),
+			COALESCE(gm.weekly_contribution, 0), COALESCE(gm.total_contribution, 0), gm.last_active_at, gm.joined_at
+		FROM guild_members gm
+		JOIN characters c ON c.id = gm.character_id
+		WHERE gm.guild_id = $1
+		ORDER BY gm.rank_order, gm.joined_at
+		LIMIT $2 OFFSET $3
+	`, guildID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*models.GuildMember
+	for rows.Next() {
+		var m models.GuildMember
+		if err := rows.Scan(&m.CharacterID, &m.Name, &m.Level, &m.Class, &m.Rank,
+			&m.WeeklyContribution, &m.TotalContribution, &m.LastActiveAt, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan guild member: %w", err)
+		}
+		members = append(members, &m)
+	}
+	return members, rows.Err()
+}
+
+// UpdateSettings changes the leader's guild recruiting settings
+func (s *GuildService) UpdateSettings(ctx context.Context, accountID, characterID uuid.UUID, req *models.GuildSettingsRequest) (*models.Guild, error) {
+	if req.MinLevelRequirement != nil && *req.MinLevelRequirement < 1 {
+		return nil, ErrInvalidGuildSettings
+	}
+
+	var guildID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		g, err := lockGuild(ctx, tx, m.GuildID)
+		if err != nil {
+			return err
+		}
+		if g.LeaderID != characterID {
+			return ErrNotGuildLeader
+		}
+		guildID = g.ID
+
+		_, err = tx.Exec(ctx, `
+			UPDATE guilds SET
+				description = COALESCE($2, description),
+				is_recruiting = COALESCE($3, is_recruiting),
+				min_level_requirement = COALESCE($4, min_level_requirement),
+				auto_accept = COALESCE($5, auto_accept),
+				updated_at = NOW()
+			WHERE id = $1
+		`, g.ID, req.Description, req.IsRecruiting, req.MinLevelRequirement, req.AutoAccept)
+		if err != nil {
+			return fmt.Errorf("failed to update guild settings: %w", err)
+		}
+		return logGuild(ctx, tx, g.ID, "settings_update", &characterID, nil, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getGuild(ctx, s.db.Pool, guildID)
+}
+
+// Transfer hands leadership to another member; the old leader becomes an
+// officer.
+func (s *GuildService) Transfer(ctx context.Context, accountID, characterID, targetID uuid.UUID) (*models.Guild, error) {
+	if targetID == characterID {
+		return nil, ErrAlreadyGuildLeader
+	}
+
+	var guildID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockCharacters(ctx, tx, characterID, targetID)
+		if err != nil {
+			return err
+		}
+		if locked[characterID].AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		target, err := getMembership(ctx, tx, targetID)
+		if err != nil {
+			return err
+		}
+		if target == nil || target.GuildID != m.GuildID {
+			return ErrNotGuildMember
+		}
+		g, err := lockGuild(ctx, tx, m.GuildID)
+		if err != nil {
+			return err
+		}
+		if g.LeaderID != characterID {
+			return ErrNotGuildLeader
+		}
+		guildID = g.ID
+
+		_, err = tx.Exec(ctx, `
+			UPDATE guilds SET leader_id = $2, leader_changed_at = NOW(), updated_at = NOW() WHERE id = $1
+		`, g.ID, targetID)
+		if err != nil {
+			return fmt.Errorf("failed to transfer guild: %w", err)
+		}
+		if err := setMemberRank(ctx, tx, g.ID, characterID, models.GuildRankOfficer); err != nil {
+			return err
+		}
+		if err := setMemberRank(ctx, tx, g.ID, targetID, models.GuildRankLeader); err != nil {
+			return err
+		}
+		return logGuild(ctx, tx, g.ID, "leader_transfer", &characterID, &targetID, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getGuild(ctx, s.db.Pool, guildID)
+}
+
+// Disband closes the leader's guild. Every member leaves, zone control and
+// relations end, the treasury is sunk and the specialization is free to be
+// founded again.
+func (s *GuildService) Disband(ctx context.Context, accountID, characterID uuid.UUID) error {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		// Member characters before the guild, the order joins and leaves use
+		_, err := tx.Exec(ctx, `
+			SELECT c.id FROM characters c
+			JOIN guild_members gm ON gm.character_id = c.id
+			WHERE gm.guild_id = $1
+			ORDER BY c.id
+			FOR UPDATE OF c
+		`, m.GuildID)
+		if err != nil {
+			return fmt.Errorf("failed to lock guild members: %w", err)
+		}
+		g, err := lockGuild(ctx, tx, m.GuildID)
+		if err != nil {
+			return err
+		}
+		if g.LeaderID != characterID {
+			return ErrNotGuildLeader
+		}
+
+		if g.GoldTreasury > 0 {
+			err := s.ledger.Post(ctx, tx, &Posting{
+				ServerID:      g.ServerID,
+				Currency:      models.CurrencyGold,
+				Amount:        g.GoldTreasury,
+				From:          GuildAccount(g.ID),
+				To:            SystemAccount(SystemGuildDisband),
+				Reason:        "guild_disband",
+				ReferenceType: "guild",
+				ReferenceID:   &g.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE characters SET guild_id = NULL, guild_rank = NULL, guild_joined_at = NULL WHERE guild_id = $1
+		`, g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to clear member guilds: %w", err)
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM guild_members WHERE guild_id = $1", g.ID); err != nil {
+			return fmt.Errorf("failed to remove guild members: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE guild_applications SET status = 'cancelled' WHERE guild_id = $1 AND status = 'pending'
+		`, g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to cancel applications: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE guild_invites SET status = 'cancelled', responded_at = NOW() WHERE guild_id = $1 AND status = 'pending'
+		`, g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to cancel invites: %w", err)
+		}
+		if err := returnGuildStorage(ctx, tx, g); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM guild_storage WHERE guild_id = $1", g.ID); err != nil {
+			return fmt.Errorf("failed to empty guild storage: %w", err)
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM zone_control WHERE guild_id = $1", g.ID); err != nil {
+			return fmt.Errorf("failed to release zones: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE guild_wars SET status = 'cancelled', ended_at = NOW()
+			WHERE attacker_guild_id = $1 AND status IN ('scheduled', 'in_progress')
+		`, g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to cancel territory wars: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE guild_wars SET defender_guild_id = NULL,
+				held_since = CASE WHEN holder_guild_id = $1 THEN NULL ELSE held_since END,
+				holder_guild_id = NULLIF(holder_guild_id, $1)
+			WHERE defender_guild_id = $1 AND status IN ('scheduled', 'in_progress')
+		`, g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to leave territory wars: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			DELETE FROM guild_war_participants p USING guild_wars w
+			WHERE w.id = p.war_id AND p.guild_id = $1 AND w.status IN ('scheduled', 'in_progress')
+		`, g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to remove war participants: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE guild_votes SET status = 'cancelled', resolved_at = NOW()
+			WHERE status = 'open' AND (guild_id = $1 OR target_guild_id = $1)
+		`, g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to cancel guild votes: %w", err)
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM guild_relations WHERE guild_id = $1 OR target_guild_id = $1", g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to end guild relations: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE guilds SET ally_guild_id = NULL, ally_since = NULL, ally_locked_until = NULL WHERE ally_guild_id = $1
+		`, g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to end alliance: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE guilds SET disbanded_at = NOW(), current_members = 0, updated_at = NOW() WHERE id = $1
+		`, g.ID)
+		if err != nil {
+			return fmt.Errorf("failed to disband guild: %w", err)
+		}
+		return logGuild(ctx, tx, g.ID, "guild_disband", &characterID, nil, map[string]interface{}{
+			"members":  g.CurrentMembers,
+			"treasury": g.GoldTreasury,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.bonuses.InvalidateGuild(m.GuildID)
+	return nil
+}
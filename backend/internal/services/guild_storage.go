@@ -0,0 +1,541 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrGuildStorageLocked   = errors.New("guild storage unlocks at guild level 3")
+	ErrGuildStorageFull     = errors.New("guild storage is full")
+	ErrStorageItemNotFound  = errors.New("item not found in guild storage")
+	ErrWithdrawalLimit      = errors.New("daily withdrawal limit reached")
+	ErrGuildLogActionFilter = errors.New("too many actions in filter")
+)
+
+// GuildLogMaxActions caps the actions a guild log query can filter by
+const GuildLogMaxActions = 20
+
+func storageRights(rank models.GuildRank) models.GuildStorageRights {
+	return models.GuildStorageRightsByRank[rank]
+}
+
+// lockStorageGuild locks the acting member's guild and checks that its
+// storage is unlocked
+func lockStorageGuild(ctx context.Context, tx pgx.Tx, guildID uuid.UUID) (*models.Guild, error) {
+	g, err := lockGuild(ctx, tx, guildID)
+	if err != nil {
+		return nil, err
+	}
+	if !models.GuildFeatureUnlocked(g.Level, models.GuildFeatureStorage) {
+		return nil, ErrGuildStorageLocked
+	}
+	return g, nil
+}
+
+// chargeWithdrawal counts a withdrawal against the character's daily caps
+// and fails once a cap is passed
+func chargeWithdrawal(ctx context.Context, tx pgx.Tx, guildID, characterID uuid.UUID, rights models.GuildStorageRights, items int, gold int64) error {
+	var usedItems int
+	var usedGold int64
+	err := tx.QueryRow(ctx, `
+		INSERT INTO guild_storage_withdrawals (guild_id, character_id, day, items_withdrawn, gold_withdrawn)
+		VALUES ($1, $2, CURRENT_DATE, $3, $4)
+		ON CONFLICT (guild_id, character_id, day) DO UPDATE SET
+			items_withdrawn = guild_storage_withdrawals.items_withdrawn + EXCLUDED.items_withdrawn,
+			gold_withdrawn = guild_storage_withdrawals.gold_withdrawn + EXCLUDED.gold_withdrawn
+		RETURNING items_withdrawn, gold_withdrawn
+	`, guildID, characterID, items, gold).Scan(&usedItems, &usedGold)
+	if err != nil {
+		return fmt.Errorf("failed to count withdrawal: %w", err)
+	}
+	if rights.DailyItemWithdrawals != models.GuildNoLimit && usedItems > rights.DailyItemWithdrawals {
+		return ErrWithdrawalLimit
+	}
+	if rights.DailyGoldWithdrawal != models.GuildNoLimit && usedGold > rights.DailyGoldWithdrawal {
+		return ErrWithdrawalLimit
+	}
+	return nil
+}
+
+// withdrawnToday returns what a character has taken out of their guild
+// today
+func withdrawnToday(ctx context.Context, q querier, guildID, characterID uuid.UUID) (int, int64, error) {
+	var items int
+	var gold int64
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE(SUM(items_withdrawn), 0), COALESCE(SUM(gold_withdrawn), 0)
+		FROM guild_storage_withdrawals
+		WHERE guild_id = $1 AND character_id = $2 AND day = CURRENT_DATE
+	`, guildID, characterID).Scan(&items, &gold)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get withdrawals: %w", err)
+	}
+	return items, gold, nil
+}
+
+// addGuildStorageItem puts a stack into a locked guild's storage, merging
+// plain stackable items with the same withdraw rank
+func addGuildStorageItem(ctx context.Context, tx pgx.Tx, guildID uuid.UUID, stack *models.ItemStack, depositedBy uuid.UUID, minRank models.GuildRank) (uuid.UUID, error) {
+	var isStackable bool
+	var maxStack int
+	err := tx.QueryRow(ctx, `
+		SELECT is_stackable, max_stack FROM item_definitions WHERE id = $1
+	`, stack.ItemDefinitionID).Scan(&isStackable, &maxStack)
+	if err != nil {
+		return uuid.Nil, ErrItemDefNotFound
+	}
+
+	plain := stack.UpgradeLevel == 0 && stack.BonusStats == nil &&
+		stack.GemSlots == [4]*int{}
+	if isStackable && plain {
+		var id uuid.UUID
+		err := tx.QueryRow(ctx, `
+			UPDATE guild_storage SET quantity = quantity + $3
+			WHERE id = (
+				SELECT id FROM guild_storage
+				WHERE guild_id = $1 AND item_definition_id = $2
+				  AND COALESCE(upgrade_level, 0) = 0 AND bonus_stats IS NULL
+				  AND COALESCE(min_rank_to_withdraw, 'officer') = $5
+				  AND quantity + $3 <= $4
+				LIMIT 1
+			)
+			RETURNING id
+		`, guildID, stack.ItemDefinitionID, stack.Quantity, maxStack, minRank).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("failed to merge storage stack: %w", err)
+		}
+	}
+
+	var slot int
+	err = tx.QueryRow(ctx, `
+		SELECT s FROM generate_series(1, $2) s
+		WHERE NOT EXISTS (
+			SELECT 1 FROM guild_storage WHERE guild_id = $1 AND slot_number = s
+		)
+		ORDER BY s LIMIT 1
+	`, guildID, models.GuildStorageSize).Scan(&slot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrGuildStorageFull
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to find free storage slot: %w", err)
+	}
+
+	id := uuid.New()
+	_, err = tx.Exec(ctx, `
+		INSERT INTO guild_storage (
+			id, guild_id, item_definition_id, quantity, upgrade_level,
+			gem_slot_1, gem_slot_2, gem_slot_3, gem_slot_4, bonus_stats, slot_number,
+			deposited_by, min_rank_to_withdraw
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, id, guildID, stack.ItemDefinitionID, stack.Quantity, stack.UpgradeLevel,
+		stack.GemSlots[0], stack.GemSlots[1], stack.GemSlots[2], stack.GemSlots[3], []byte(stack.BonusStats), slot,
+		depositedBy, minRank)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to store item: %w", err)
+	}
+	return id, nil
+}
+
+// returnGuildStorage hands every stored item back to the member who
+// deposited it, by mail when their bag is full. Items whose depositor is
+// gone go to the leader. The rows are left for the caller to delete.
+func returnGuildStorage(ctx context.Context, tx pgx.Tx, g *models.Guild) error {
+	rows, err := tx.Query(ctx, `
+		SELECT COALESCE(gs.deposited_by, $2), gs.item_definition_id, gs.quantity, COALESCE(gs.upgrade_level, 0),
+		       gs.gem_slot_1, gs.gem_slot_2, gs.gem_slot_3, gs.gem_slot_4, gs.bonus_stats
+		FROM guild_storage gs
+		WHERE gs.guild_id = $1
+		ORDER BY gs.slot_number
+		FOR UPDATE
+	`, g.ID, g.LeaderID)
+	if err != nil {
+		return fmt.Errorf("failed to get guild storage: %w", err)
+	}
+	type returned struct {
+		owner uuid.UUID
+		stack models.ItemStack
+	}
+	var items []returned
+	for rows.Next() {
+		var it returned
+		var bonusStats []byte
+		err := rows.Scan(&it.owner, &it.stack.ItemDefinitionID, &it.stack.Quantity, &it.stack.UpgradeLevel,
+			&it.stack.GemSlots[0], &it.stack.GemSlots[1], &it.stack.GemSlots[2], &it.stack.GemSlots[3], &bonusStats)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan guild storage item: %w", err)
+		}
+		it.stack.BonusStats = bonusStats
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get guild storage: %w", err)
+	}
+
+	for i := range items {
+		_, err := deliverItem(ctx, tx, items[i].owner, &items[i].stack, "guild_storage_return", "Guild disbanded: "+g.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStorage returns the acting character's guild storage
+func (s *GuildService) GetStorage(ctx context.Context, accountID, characterID uuid.UUID) (*models.GuildStorage, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	g, err := getGuild(ctx, s.db.Pool, m.GuildID)
+	if err != nil {
+		return nil, err
+	}
+	if !models.GuildFeatureUnlocked(g.Level, models.GuildFeatureStorage) {
+		return nil, ErrGuildStorageLocked
+	}
+
+	storage := &models.GuildStorage{
+		GuildID: g.ID,
+		Size:    models.GuildStorageSize,
+		Items:   []*models.GuildStorageItem{},
+		Rights:  storageRights(m.Rank),
+	}
+	if storage.ItemsWithdrawnToday, _, err = withdrawnToday(ctx, s.db.Pool, g.ID, characterID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT gs.id, gs.slot_number, gs.item_definition_id, d.name, gs.quantity, COALESCE(gs.upgrade_level, 0),
+		       gs.gem_slot_1, gs.gem_slot_2, gs.gem_slot_3, gs.gem_slot_4, gs.bonus_stats,
+		       COALESCE(gs.min_rank_to_withdraw, 'officer'), gs.deposited_by, c.name, gs.deposited_at
+		FROM guild_storage gs
+		JOIN item_definitions d ON d.id = gs.item_definition_id
+		LEFT JOIN characters c ON c.id = gs.deposited_by
+		WHERE gs.guild_id = $1
+		ORDER BY gs.slot_number
+	`, g.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild storage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var it models.GuildStorageItem
+		var bonusStats []byte
+		if err := rows.Scan(&it.ID, &it.SlotNumber, &it.ItemID, &it.ItemName, &it.Quantity, &it.UpgradeLevel,
+			&it.GemSlots[0], &it.GemSlots[1], &it.GemSlots[2], &it.GemSlots[3], &bonusStats,
+			&it.MinRankToWithdraw, &it.DepositedBy, &it.DepositedByName, &it.DepositedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan guild storage item: %w", err)
+		}
+		it.BonusStats = bonusStats
+		storage.Items = append(storage.Items, &it)
+	}
+	return storage, rows.Err()
+}
+
+// DepositItem moves an inventory item into the acting character's guild
+// storage. Members cannot keep an item from ranks above their own.
+func (s *GuildService) DepositItem(ctx context.Context, accountID, characterID uuid.UUID, req *models.GuildStorageDepositRequest) (*models.GuildStorage, error) {
+	minRank := req.MinRank
+	if minRank == "" {
+		minRank = models.GuildRankMember
+	}
+	if _, ok := models.GuildRankOrder[minRank]; !ok {
+		return nil, ErrInvalidGuildRank
+	}
+
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if !storageRights(m.Rank).Deposit || minRank.Outranks(m.Rank) {
+			return ErrInsufficientGuildRank
+		}
+		g, err := lockStorageGuild(ctx, tx, m.GuildID)
+		if err != nil {
+			return err
+		}
+
+		stack, err := takeInventoryItem(ctx, tx, characterID, req.InventoryItemID, req.Quantity)
+		if err != nil {
+			return err
+		}
+		storageID, err := addGuildStorageItem(ctx, tx, g.ID, stack, characterID, minRank)
+		if err != nil {
+			return err
+		}
+		return logGuild(ctx, tx, g.ID, "storage_deposit", &characterID, nil, map[string]interface{}{
+			"storage_item_id": storageID,
+			"item_id":         stack.ItemDefinitionID,
+			"quantity":        stack.Quantity,
+			"min_rank":        minRank,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStorage(ctx, accountID, characterID)
+}
+
+// WithdrawItem moves a guild storage item into the acting character's bag,
+// counting against their rank's daily cap
+func (s *GuildService) WithdrawItem(ctx context.Context, accountID, characterID, storageItemID uuid.UUID, quantity int) (*models.GuildStorage, error) {
+	if quantity < 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		rights := storageRights(m.Rank)
+		if !rights.Withdraw {
+			return ErrInsufficientGuildRank
+		}
+		g, err := lockStorageGuild(ctx, tx, m.GuildID)
+		if err != nil {
+			return err
+		}
+
+		var stack models.ItemStack
+		var bonusStats []byte
+		var minRank models.GuildRank
+		err = tx.QueryRow(ctx, `
+			SELECT item_definition_id, quantity, COALESCE(upgrade_level, 0),
+			       gem_slot_1, gem_slot_2, gem_slot_3, gem_slot_4, bonus_stats,
+			       COALESCE(min_rank_to_withdraw, 'officer')
+			FROM guild_storage
+			WHERE id = $1 AND guild_id = $2
+			FOR UPDATE
+		`, storageItemID, g.ID).Scan(&stack.ItemDefinitionID, &stack.Quantity, &stack.UpgradeLevel,
+			&stack.GemSlots[0], &stack.GemSlots[1], &stack.GemSlots[2], &stack.GemSlots[3], &bonusStats, &minRank)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrStorageItemNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get guild storage item: %w", err)
+		}
+		stack.BonusStats = bonusStats
+		if minRank.Outranks(m.Rank) {
+			return ErrInsufficientGuildRank
+		}
+		if quantity > stack.Quantity {
+			return ErrInvalidQuantity
+		}
+		left := 0
+		if quantity > 0 {
+			left = stack.Quantity - quantity
+			stack.Quantity = quantity
+		}
+
+		if err := chargeWithdrawal(ctx, tx, g.ID, characterID, rights, 1, 0); err != nil {
+			return err
+		}
+		if _, err := addInventoryItem(ctx, tx, characterID, &stack); err != nil {
+			return err
+		}
+		if left == 0 {
+			_, err = tx.Exec(ctx, "DELETE FROM guild_storage WHERE id = $1", storageItemID)
+		} else {
+			_, err = tx.Exec(ctx, "UPDATE guild_storage SET quantity = $2 WHERE id = $1", storageItemID, left)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to take item from guild storage: %w", err)
+		}
+		return logGuild(ctx, tx, g.ID, "storage_withdraw", &characterID, nil, map[string]interface{}{
+			"storage_item_id": storageItemID,
+			"item_id":         stack.ItemDefinitionID,
+			"quantity":        stack.Quantity,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStorage(ctx, accountID, characterID)
+}
+
+// GetTreasury returns the acting character's guild treasury
+func (s *GuildService) GetTreasury(ctx context.Context, accountID, characterID uuid.UUID) (*models.GuildTreasury, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	g, err := getGuild(ctx, s.db.Pool, m.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	treasury := &models.GuildTreasury{
+		GuildID: g.ID,
+		Gold:    g.GoldTreasury,
+		Rights:  storageRights(m.Rank),
+	}
+	if _, treasury.GoldWithdrawnToday, err = withdrawnToday(ctx, s.db.Pool, g.ID, characterID); err != nil {
+		return nil, err
+	}
+	return treasury, nil
+}
+
+// DonateGold moves gold from the acting character to their guild's
+// treasury. Every member can donate.
+func (s *GuildService) DonateGold(ctx context.Context, accountID, characterID uuid.UUID, amount int64) (*models.GuildTreasury, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		g, err := lockGuild(ctx, tx, m.GuildID)
+		if err != nil {
+			return err
+		}
+
+		err = s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      c.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        amount,
+			From:          CharacterAccount(characterID),
+			To:            GuildAccount(g.ID),
+			Reason:        "guild_donation",
+			ReferenceType: "guild",
+			ReferenceID:   &g.ID,
+		})
+		if err != nil {
+			return err
+		}
+		return logGuild(ctx, tx, g.ID, "treasury_deposit", &characterID, nil, map[string]interface{}{"amount": amount})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTreasury(ctx, accountID, characterID)
+}
+
+// WithdrawGold pays gold from the guild treasury to the acting character,
+// counting against their rank's daily cap
+func (s *GuildService) WithdrawGold(ctx context.Context, accountID, characterID uuid.UUID, amount int64) (*models.GuildTreasury, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		rights := storageRights(m.Rank)
+		if !rights.Withdraw || rights.DailyGoldWithdrawal == 0 {
+			return ErrInsufficientGuildRank
+		}
+		g, err := lockGuild(ctx, tx, m.GuildID)
+		if err != nil {
+			return err
+		}
+
+		if err := chargeWithdrawal(ctx, tx, g.ID, characterID, rights, 0, amount); err != nil {
+			return err
+		}
+		err = s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      c.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        amount,
+			From:          GuildAccount(g.ID),
+			To:            CharacterAccount(characterID),
+			Reason:        "guild_withdrawal",
+			ReferenceType: "guild",
+			ReferenceID:   &g.ID,
+		})
+		if err != nil {
+			return err
+		}
+		return logGuild(ctx, tx, g.ID, "treasury_withdraw", &characterID, nil, map[string]interface{}{"amount": amount})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTreasury(ctx, accountID, characterID)
+}
+
+// GetLogs pages through the acting character's guild log, newest first,
+// optionally keeping only the given actions
+func (s *GuildService) GetLogs(ctx context.Context, accountID, characterID uuid.UUID, actions []string, limit, offset int) ([]*models.GuildLogEntry, error) {
+	if len(actions) > GuildLogMaxActions {
+		return nil, ErrGuildLogActionFilter
+	}
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if len(actions) == 0 {
+		actions = nil
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT l.id, l.action_type, l.actor_id, a.name, l.target_id, COALESCE(t.name, tg.name), l.details, l.created_at
+		FROM guild_logs l
+		LEFT JOIN characters a ON a.id = l.actor_id
+		LEFT JOIN characters t ON t.id = l.target_id
+		LEFT JOIN guilds tg ON tg.id = l.target_id
+		WHERE l.guild_id = $1 AND ($2::text[] IS NULL OR l.action_type = ANY($2))
+		ORDER BY l.created_at DESC
+		LIMIT $3 OFFSET $4
+	`, m.GuildID, actions, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild logs: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.GuildLogEntry
+	for rows.Next() {
+		var e models.GuildLogEntry
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.ActionType, &e.ActorID, &e.ActorName, &e.TargetID, &e.TargetName,
+			&details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan guild log: %w", err)
+		}
+		e.Details = details
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
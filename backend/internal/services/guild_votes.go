@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrVoteNotFound     = errors.New("guild vote not found")
+	ErrVoteClosed       = errors.New("guild vote is closed")
+	ErrVoteInProgress   = errors.New("a guild vote on this is already open")
+	ErrAlreadyVoted     = errors.New("already voted")
+	ErrNotEligibleVoter = errors.New("only members who were in the guild when the vote opened can vote")
+)
+
+const (
+	GuildVoteDuration = 72 * time.Hour
+
+	GuildVoteSweepBatchSize = 100
+)
+
+// guildVoteRule is the approval a vote needs: Percent of the members when it
+// opened, plus the leader's yes when RequiresLeader is set (8.2)
+type guildVoteRule struct {
+	Percent        int
+	RequiresLeader bool
+}
+
+var guildVoteRules = map[models.GuildVoteType]guildVoteRule{
+	models.GuildVoteAllyPropose:  {Percent: 70},
+	models.GuildVoteAllyAccept:   {Percent: 70},
+	models.GuildVoteAllyCancel:   {Percent: 70},
+	models.GuildVoteEnemyDeclare: {Percent: 50, RequiresLeader: true},
+	models.GuildVoteEnemyEnd:     {Percent: 50, RequiresLeader: true},
+}
+
+const guildVoteColumns = `v.id, v.guild_id, v.vote_type, v.relation_id, v.target_guild_id, tg.name, v.proposed_by,
+	v.approval_percent, COALESCE(v.requires_leader, false), COALESCE(v.leader_approved, false),
+	v.eligible_voters, v.votes_required, COALESCE(v.votes_for, 0), COALESCE(v.votes_against, 0),
+	COALESCE(v.status, 'open'), v.deadline, v.created_at, v.resolved_at`
+
+func scanGuildVote(row pgx.Row) (*models.GuildVote, error) {
+	var v models.GuildVote
+	err := row.Scan(&v.ID, &v.GuildID, &v.VoteType, &v.RelationID, &v.TargetGuildID, &v.TargetGuildName, &v.ProposedBy,
+		&v.ApprovalPercent, &v.RequiresLeader, &v.LeaderApproved,
+		&v.EligibleVoters, &v.VotesRequired, &v.VotesFor, &v.VotesAgainst,
+		&v.Status, &v.Deadline, &v.CreatedAt, &v.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func getGuildVote(ctx context.Context, q querier, voteID uuid.UUID, forUpdate bool) (*models.GuildVote, error) {
+	query := `
+		SELECT ` + guildVoteColumns + `
+		FROM guild_votes v
+		LEFT JOIN guilds tg ON tg.id = v.target_guild_id
+		WHERE v.id = $1`
+	if forUpdate {
+		query += " FOR UPDATE OF v"
+	}
+	v, err := scanGuildVote(q.QueryRow(ctx, query, voteID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrVoteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild vote: %w", err)
+	}
+	return v, nil
+}
+
+// openGuildVote starts a vote in a locked guild. The number of members now
+// fixes how many yes votes it needs; later joiners cannot vote.
+func openGuildVote(ctx context.Context, tx pgx.Tx, guildID uuid.UUID, voteType models.GuildVoteType, relationID, targetGuildID, proposedBy *uuid.UUID) (*models.GuildVote, error) {
+	rule, ok := guildVoteRules[voteType]
+	if !ok {
+		return nil, fmt.Errorf("unknown guild vote type %q", voteType)
+	}
+
+	var eligible int
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM guild_members WHERE guild_id = $1", guildID).Scan(&eligible); err != nil {
+		return nil, fmt.Errorf("failed to count guild members: %w", err)
+	}
+	required := max((eligible*rule.Percent+99)/100, 1)
+
+	var voteID uuid.UUID
+	err := tx.QueryRow(ctx, `
+		INSERT INTO guild_votes (guild_id, vote_type, relation_id, target_guild_id, proposed_by,
+			approval_percent, requires_leader, eligible_voters, votes_required, deadline)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, guildID, voteType, relationID, targetGuildID, proposedBy,
+		rule.Percent, rule.RequiresLeader, eligible, required, time.Now().Add(GuildVoteDuration)).Scan(&voteID)
+	if _, ok := uniqueViolation(err); ok {
+		return nil, ErrVoteInProgress
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open guild vote: %w", err)
+	}
+
+	if relationID != nil {
+		_, err = tx.Exec(ctx, `
+			UPDATE guild_relations SET votes_for = 0, votes_required = $2 WHERE id = $1
+		`, *relationID, required)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update relation votes: %w", err)
+		}
+	}
+	if err := logGuild(ctx, tx, guildID, "vote_open", proposedBy, &voteID, map[string]interface{}{
+		"vote_type":      voteType,
+		"votes_required": required,
+	}); err != nil {
+		return nil, err
+	}
+	return getGuildVote(ctx, tx, voteID, true)
+}
+
+// castBallot records a member's ballot on a locked open vote and closes the
+// vote once the outcome is decided: passed when enough members (and the
+// leader, where required) said yes, failed when that can no longer happen.
+func (s *GuildService) castBallot(ctx context.Context, tx pgx.Tx, v *models.GuildVote, characterID uuid.UUID, rank models.GuildRank, approve bool) error {
+	if v.Status != models.GuildVoteOpen || !v.Deadline.After(time.Now()) {
+		return ErrVoteClosed
+	}
+
+	var eligible bool
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(joined_at <= $3, true) FROM guild_members WHERE guild_id = $1 AND character_id = $2
+	`, v.GuildID, characterID, v.CreatedAt).Scan(&eligible)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotGuildMember
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check voter: %w", err)
+	}
+	if !eligible {
+		return ErrNotEligibleVoter
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO guild_vote_ballots (vote_id, character_id, approve) VALUES ($1, $2, $3)
+	`, v.ID, characterID, approve)
+	if _, ok := uniqueViolation(err); ok {
+		return ErrAlreadyVoted
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cast ballot: %w", err)
+	}
+
+	leaderVeto := false
+	if approve {
+		v.VotesFor++
+	} else {
+		v.VotesAgainst++
+	}
+	if rank == models.GuildRankLeader {
+		v.LeaderApproved = approve
+		leaderVeto = !approve && v.RequiresLeader
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE guild_votes SET votes_for = $2, votes_against = $3, leader_approved = $4 WHERE id = $1
+	`, v.ID, v.VotesFor, v.VotesAgainst, v.LeaderApproved)
+	if err != nil {
+		return fmt.Errorf("failed to tally vote: %w", err)
+	}
+	if v.RelationID != nil {
+		_, err = tx.Exec(ctx, "UPDATE guild_relations SET votes_for = $2 WHERE id = $1", *v.RelationID, v.VotesFor)
+		if err != nil {
+			return fmt.Errorf("failed to update relation votes: %w", err)
+		}
+	}
+
+	switch {
+	case v.VotesFor >= v.VotesRequired && (!v.RequiresLeader || v.LeaderApproved):
+		return s.closeVote(ctx, tx, v, models.GuildVotePassed)
+	case leaderVeto || v.VotesAgainst > v.EligibleVoters-v.VotesRequired:
+		return s.closeVote(ctx, tx, v, models.GuildVoteFailed)
+	}
+	return nil
+}
+
+// closeVote settles a locked vote and applies its outcome
+func (s *GuildService) closeVote(ctx context.Context, tx pgx.Tx, v *models.GuildVote, status models.GuildVoteStatus) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE guild_votes SET status = $2, resolved_at = NOW() WHERE id = $1
+	`, v.ID, status)
+	if err != nil {
+		return fmt.Errorf("failed to close guild vote: %w", err)
+	}
+	v.Status = status
+	if err := logGuild(ctx, tx, v.GuildID, "vote_"+string(status), nil, &v.ID, map[string]interface{}{
+		"vote_type":     v.VoteType,
+		"votes_for":     v.VotesFor,
+		"votes_against": v.VotesAgainst,
+	}); err != nil {
+		return err
+	}
+	return s.applyRelationVote(ctx, tx, v)
+}
+
+// CastBallot votes yes or no on an open vote of the acting character's guild
+func (s *GuildService) CastBallot(ctx context.Context, accountID, characterID, voteID uuid.UUID, approve bool) (*models.GuildVote, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		v, err := getGuildVote(ctx, tx, voteID, false)
+		if err != nil {
+			return err
+		}
+		if v.GuildID != m.GuildID {
+			return ErrVoteNotFound
+		}
+		// A vote's outcome can change both guilds of a relation
+		guildIDs := []uuid.UUID{v.GuildID}
+		if v.TargetGuildID != nil {
+			guildIDs = append(guildIDs, *v.TargetGuildID)
+		}
+		if _, err := lockGuilds(ctx, tx, guildIDs...); err != nil {
+			return err
+		}
+		if v, err = getGuildVote(ctx, tx, voteID, true); err != nil {
+			return err
+		}
+		return s.castBallot(ctx, tx, v, characterID, m.Rank, approve)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getVoteFor(ctx, voteID, characterID)
+}
+
+// getVoteFor loads a vote with the character's ballot
+func (s *GuildService) getVoteFor(ctx context.Context, voteID, characterID uuid.UUID) (*models.GuildVote, error) {
+	v, err := getGuildVote(ctx, s.db.Pool, voteID, false)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT approve FROM guild_vote_ballots WHERE vote_id = $1 AND character_id = $2
+	`, voteID, characterID).Scan(&v.MyBallot)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get ballot: %w", err)
+	}
+	return v, nil
+}
+
+// GetVote returns one of the acting character's guild's votes
+func (s *GuildService) GetVote(ctx context.Context, accountID, characterID, voteID uuid.UUID) (*models.GuildVote, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.getVoteFor(ctx, voteID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if v.GuildID != m.GuildID {
+		return nil, ErrVoteNotFound
+	}
+	return v, nil
+}
+
+// ListVotes returns the acting character's guild's votes, newest first,
+// optionally only the open ones
+func (s *GuildService) ListVotes(ctx context.Context, accountID, characterID uuid.UUID, openOnly bool, limit, offset int) ([]*models.GuildVote, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	m, err := requireMembership(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+guildVoteColumns+`, b.approve
+		FROM guild_votes v
+		LEFT JOIN guilds tg ON tg.id = v.target_guild_id
+		LEFT JOIN guild_vote_ballots b ON b.vote_id = v.id AND b.character_id = $2
+		WHERE v.guild_id = $1 AND (NOT $3 OR v.status = 'open')
+		ORDER BY v.created_at DESC
+		LIMIT $4 OFFSET $5
+	`, m.GuildID, characterID, openOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild votes: %w", err)
+	}
+	defer rows.Close()
+
+	var votes []*models.GuildVote
+	for rows.Next() {
+		var v models.GuildVote
+		err := rows.Scan(&v.ID, &v.GuildID, &v.VoteType, &v.RelationID, &v.TargetGuildID, &v.TargetGuildName, &v.ProposedBy,
+			&v.ApprovalPercent, &v.RequiresLeader, &v.LeaderApproved,
+			&v.EligibleVoters, &v.VotesRequired, &v.VotesFor, &v.VotesAgainst,
+			&v.Status, &v.Deadline, &v.CreatedAt, &v.ResolvedAt, &v.MyBallot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan guild vote: %w", err)
+		}
+		votes = append(votes, &v)
+	}
+	return votes, rows.Err()
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInventoryFull    = errors.New("inventory is full")
+	ErrItemNotFound     = errors.New("item not found in inventory")
+	ErrItemNotTradeable = errors.New("item cannot be traded")
+	ErrInvalidQuantity  = errors.New("invalid quantity")
+	ErrItemDefNotFound  = errors.New("item definition not found")
+	ErrItemInTrade      = errors.New("item is offered in a pending trade")
+)
+
+// InventorySize is the number of bag slots every character has
+const InventorySize = 60
+
+// lockInventoryItem row-locks an inventory row owned by characterID and
+// returns its contents, with Quantity set to the full stack size. Equipped,
+// locked, bound and untradeable items are refused, as are items already
+// offered in a pending trade.
+func lockInventoryItem(ctx context.Context, tx pgx.Tx, characterID, inventoryID uuid.UUID) (*models.ItemStack, error) {
+	var stack models.ItemStack
+	var bonusStats []byte
+	var isBound, isEquipped, isLocked, isTradeable, inTrade bool
+	err := tx.QueryRow(ctx, `
+		SELECT ci.item_definition_id, ci.quantity, ci.upgrade_level,
+		       ci.gem_slot_1, ci.gem_slot_2, ci.gem_slot_3, ci.gem_slot_4, ci.bonus_stats,
+		       ci.is_bound, ci.is_equipped, ci.is_locked, d.is_tradeable,
+		       EXISTS (
+		           SELECT 1 FROM player_trade_items ti
+		           JOIN player_trades t ON t.id = ti.trade_id
+		           WHERE ti.inventory_item_id = ci.id AND t.status = 'pending' AND t.expires_at > NOW()
+		       )
+		FROM character_inventory ci
+		JOIN item_definitions d ON d.id = ci.item_definition_id
+		WHERE ci.id = $1 AND ci.character_id = $2
+		FOR UPDATE OF ci
+	`, inventoryID, characterID).Scan(
+		&stack.ItemDefinitionID, &stack.Quantity, &stack.UpgradeLevel,
+		&stack.GemSlots[0], &stack.GemSlots[1], &stack.GemSlots[2], &stack.GemSlots[3], &bonusStats,
+		&isBound, &isEquipped, &isLocked, &isTradeable, &inTrade,
+	)
+	if err != nil {
+		return nil, ErrItemNotFound
+	}
+	if isBound || isEquipped || isLocked || !isTradeable {
+		return nil, ErrItemNotTradeable
+	}
+	if inTrade {
+		return nil, ErrItemInTrade
+	}
+
+	stack.BonusStats = bonusStats
+	return &stack, nil
+}
+
+// takeInventoryItem removes quantity units of an inventory row owned by
+// characterID and returns what was removed. The row is locked for the rest of
+// the transaction.
+func takeInventoryItem(ctx context.Context, tx pgx.Tx, characterID, inventoryID uuid.UUID, quantity int) (*models.ItemStack, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	stack, err := lockInventoryItem(ctx, tx, characterID, inventoryID)
+	if err != nil {
+		return nil, err
+	}
+	if quantity > stack.Quantity {
+		return nil, ErrInvalidQuantity
+	}
+
+	if quantity == stack.Quantity {
+		_, err = tx.Exec(ctx, "DELETE FROM character_inventory WHERE id = $1", inventoryID)
+	} else {
+		_, err = tx.Exec(ctx, "UPDATE character_inventory SET quantity = quantity - $1 WHERE id = $2", quantity, inventoryID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove item: %w", err)
+	}
+
+	stack.Quantity = quantity
+	return stack, nil
+}
+
+// addInventoryItem puts a stack into the character's bag. Plain stackable
+// items are merged into an existing stack when there is room, otherwise the
+// first free slot is used.
+func addInventoryItem(ctx context.Context, q querier, characterID uuid.UUID, stack *models.ItemStack) (uuid.UUID, error) {
+	if stack.Quantity <= 0 {
+		return uuid.Nil, ErrInvalidQuantity
+	}
+
+	var isStackable bool
+	var maxStack int
+	err := q.QueryRow(ctx, `
+		SELECT is_stackable, max_stack FROM item_definitions WHERE id = $1
+	`, stack.ItemDefinitionID).Scan(&isStackable, &maxStack)
+	if err != nil {
+		return uuid.Nil, ErrItemDefNotFound
+	}
+
+	plain := stack.UpgradeLevel == 0 && stack.BonusStats == nil &&
+		stack.GemSlots == [4]*int{}
+	if isStackable && plain {
+		var id uuid.UUID
+		err := q.QueryRow(ctx, `
+			UPDATE character_inventory SET quantity = quantity + $3
+			WHERE id = (
+				SELECT id FROM character_inventory
+				WHERE character_id = $1 AND item_definition_id = $2
+				  AND upgrade_level = 0 AND bonus_stats IS NULL AND is_equipped = false
+				  AND quantity + $3 <= $4
+				LIMIT 1
+			)
+			RETURNING id
+		`, characterID, stack.ItemDefinitionID, stack.Quantity, maxStack).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("failed to merge stack: %w", err)
+		}
+	}
+
+	var slot int
+	err = q.QueryRow(ctx, `
+		SELECT s FROM generate_series(1, $2) s
+		WHERE NOT EXISTS (
+			SELECT 1 FROM character_inventory WHERE character_id = $1 AND slot_number = s
+		)
+		ORDER BY s LIMIT 1
+	`, characterID, InventorySize).Scan(&slot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrInventoryFull
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to find free slot: %w", err)
+	}
+
+	id := uuid.New()
+	_, err = q.Exec(ctx, `
+		INSERT INTO character_inventory (
+			id, character_id, item_definition_id, quantity, upgrade_level,
+			gem_slot_1, gem_slot_2, gem_slot_3, gem_slot_4, bonus_stats, slot_number
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, id, characterID, stack.ItemDefinitionID, stack.Quantity, stack.UpgradeLevel,
+		stack.GemSlots[0], stack.GemSlots[1], stack.GemSlots[2], stack.GemSlots[3], []byte(stack.BonusStats), slot)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to add item: %w", err)
+	}
+	return id, nil
+}
+
+// deliverItem adds the stack to the character's bag, falling back to system
+// mail when the bag is full. It reports whether the item was mailed.
+func deliverItem(ctx context.Context, q querier, characterID uuid.UUID, stack *models.ItemStack, mailType, subject string) (bool, error) {
+	_, err := addInventoryItem(ctx, q, characterID, stack)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, ErrInventoryFull) {
+		return false, err
+	}
+
+	if err := sendSystemMail(ctx, q, characterID, mailType, subject, "", 0, []models.ItemStack{*stack}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// sendSystemMail writes a system mail with optional gold and item attachments
+func sendSystemMail(ctx context.Context, q querier, recipientID uuid.UUID, mailType, subject, body string, gold int64, items []models.ItemStack) error {
+	if items == nil {
+		items = []models.ItemStack{}
+	}
+	attached, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("failed to encode attachments: %w", err)
+	}
+
+	_, err = q.Exec(ctx, `
+		INSERT INTO mail (id, recipient_id, is_system_mail, system_mail_type, subject, body, attached_gold, attached_items)
+		VALUES ($1, $2, true, $3, $4, $5, $6, $7)
+	`, uuid.New(), recipientID, mailType, subject, body, gold, attached)
+	if err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runPeriodic calls job every interval until ctx is cancelled, logging errors
+// and the number of rows the job reports it processed.
+func runPeriodic(ctx context.Context, name string, interval time.Duration, job func(context.Context) (int, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := job(ctx)
+			if err != nil {
+				log.Printf("%s: %v", name, err)
+			}
+			if n > 0 {
+				log.Printf("%s: processed %d", name, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidKarmaReason = errors.New("invalid karma reason")
+
+const (
+	// Infamy starts to fade once this long has passed since it was last gained
+	InfamyDecayDelay   = time.Hour
+	InfamyDecayPerHour = 5
+)
+
+type KarmaService struct {
+	db *database.DB
+}
+
+func NewKarmaService(db *database.DB) *KarmaService {
+	return &KarmaService{db: db}
+}
+
+// Apply records the karma change for reason inside the caller's transaction.
+// Good deeds raise karma; bad deeds lower it (never below zero) and add the
+// same amount of infamy.
+func (s *KarmaService) Apply(ctx context.Context, q querier, characterID uuid.UUID, reason models.KarmaReason, referenceType string, referenceID *uuid.UUID) error {
+	delta, ok := models.KarmaDeltas[reason]
+	if !ok {
+		return ErrInvalidKarmaReason
+	}
+	infamy := 0
+	if delta < 0 {
+		infamy = -delta
+	}
+
+	var serverID, karmaBefore, karmaAfter, infamyAfter int
+	err := q.QueryRow(ctx, `
+		UPDATE characters c SET
+			karma = GREATEST(c.karma + $1, 0),
+			infamy = c.infamy + $2,
+			last_infamy_at = CASE WHEN $2 > 0 THEN NOW() ELSE c.last_infamy_at END
+		FROM (SELECT id, karma FROM characters WHERE id = $3 FOR UPDATE) old
+		WHERE c.id = old.id
+		RETURNING c.server_id, old.karma, c.karma, c.infamy
+	`, delta, infamy, characterID).Scan(&serverID, &karmaBefore, &karmaAfter, &infamyAfter)
+	if err != nil {
+		return ErrCharacterNotFound
+	}
+
+	var refType *string
+	if referenceType != "" {
+		refType = &referenceType
+	}
+	_, err = q.Exec(ctx, `
+		INSERT INTO karma_logs (character_id, server_id, reason, karma_change, infamy_change,
+			karma_after, infamy_after, reference_type, reference_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, characterID, serverID, reason, karmaAfter-karmaBefore, infamy, karmaAfter, infamyAfter, refType, referenceID)
+	if err != nil {
+		return fmt.Errorf("failed to write karma log: %w", err)
+	}
+	return nil
+}
+
+func newKarmaProfile(id uuid.UUID, name string, level, karma, infamy int, lastInfamyAt *time.Time) *models.KarmaProfile {
+	return &models.KarmaProfile{
+		CharacterID:  id,
+		Name:         name,
+		Level:        level,
+		Karma:        karma,
+		Infamy:       infamy,
+		Standing:     models.KarmaStandingFor(karma),
+		InfamyStatus: models.InfamyStatusFor(infamy),
+		IsWanted:     infamy >= models.WantedInfamy,
+		JailOnDeath:  infamy >= models.WantedInfamy,
+		LastInfamyAt: lastInfamyAt,
+	}
+}
+
+// getKarmaProfile reads a character's karma standing
+func getKarmaProfile(ctx context.Context, q querier, characterID uuid.UUID) (*models.KarmaProfile, error) {
+	var name string
+	var level, karma, infamy int
+	var lastInfamyAt *time.Time
+	err := q.QueryRow(ctx, `
+		SELECT name, level, COALESCE(karma, 0), COALESCE(infamy, 0), last_infamy_at
+		FROM characters WHERE id = $1 AND deleted_at IS NULL
+	`, characterID).Scan(&name, &level, &karma, &infamy, &lastInfamyAt)
+	if err != nil {
+		return nil, ErrCharacterNotFound
+	}
+	return newKarmaProfile(characterID, name, level, karma, infamy, lastInfamyAt), nil
+}
+
+// GetProfile returns the acting character's karma standing
+func (s *KarmaService) GetProfile(ctx context.Context, accountID, characterID uuid.UUID) (*models.KarmaProfile, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	return getKarmaProfile(ctx, s.db.Pool, characterID)
+}
+
+// GetHistory returns the acting character's karma changes, newest first
+func (s *KarmaService) GetHistory(ctx context.Context, accountID, characterID uuid.UUID, limit, offset int) ([]*models.KarmaLog, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, character_id, reason, karma_change, infamy_change, karma_after, infamy_after,
+		       reference_type, reference_id, created_at
+		FROM karma_logs
+		WHERE character_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, characterID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get karma history: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []*models.KarmaLog
+	for rows.Next() {
+		var l models.KarmaLog
+		if err := rows.Scan(&l.ID, &l.CharacterID, &l.Reason, &l.KarmaChange, &l.InfamyChange, &l.KarmaAfter, &l.InfamyAfter,
+			&l.ReferenceType, &l.ReferenceID, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan karma log: %w", err)
+		}
+		logs = append(logs, &l)
+	}
+	return logs, rows.Err()
+}
+
+// ListWanted returns wanted characters on the acting character's server,
+// most infamous first.
+func (s *KarmaService) ListWanted(ctx context.Context, accountID, characterID uuid.UUID, limit, offset int) ([]*models.KarmaProfile, error) {
+	me, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, name, level, COALESCE(karma, 0), infamy, last_infamy_at
+		FROM characters
+		WHERE server_id = $1 AND infamy >= $2 AND deleted_at IS NULL
+		ORDER BY infamy DESC, name
+		LIMIT $3 OFFSET $4
+	`, me.ServerID, models.WantedInfamy, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wanted list: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []*models.KarmaProfile
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		var level, karma, infamy int
+		var lastInfamyAt *time.Time
+		if err := rows.Scan(&id, &name, &level, &karma, &infamy, &lastInfamyAt); err != nil {
+			return nil, fmt.Errorf("failed to scan wanted character: %w", err)
+		}
+		profiles = append(profiles, newKarmaProfile(id, name, level, karma, infamy, lastInfamyAt))
+	}
+	return profiles, rows.Err()
+}
+
+// DecayInfamy fades infamy for characters who have kept clean for a while.
+// Run hourly; it returns how many characters were affected.
+func (s *KarmaService) DecayInfamy(ctx context.Context) (int, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		WITH decayed AS (
+			UPDATE characters c SET infamy = GREATEST(c.infamy - $1, 0)
+			FROM (
+				SELECT id, infamy FROM characters
+				WHERE infamy > 0 AND deleted_at IS NULL
+				  AND (last_infamy_at IS NULL OR last_infamy_at <= $2)
+				FOR UPDATE SKIP LOCKED
+			) old
+			WHERE c.id = old.id
+			RETURNING c.id, c.server_id, c.karma, c.infamy, c.infamy - old.infamy AS change
+		)
+		INSERT INTO karma_logs (character_id, server_id, reason, infamy_change, karma_after, infamy_after)
+		SELECT id, server_id, $3, change, karma, infamy FROM decayed
+	`, InfamyDecayPerHour, time.Now().Add(-InfamyDecayDelay), models.KarmaInfamyDecay)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decay infamy: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// RunDecay fades infamy every interval until ctx is cancelled
+func (s *KarmaService) RunDecay(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "infamy decay", interval, s.DecayInfamy)
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInsufficientGold  = errors.New("insufficient gold")
+	ErrInsufficientGems  = errors.New("insufficient gems")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrInvalidCurrency   = errors.New("invalid currency")
+	ErrSelfPosting       = errors.New("posting source and destination are the same account")
+	ErrSystemOnlyPosting = errors.New("posting needs a character on at least one side")
+	ErrGuildNotFound     = errors.New("guild not found")
+)
+
+// System ledger accounts. They hold no balance: whatever they pay out is a
+// faucet and whatever they receive is a sink.
+const (
+	SystemStartingGold = "starting_gold"
+	SystemMarketFee    = "market_fee"
+	SystemMarketTax    = "market_tax"
+)
+
+// LedgerAccount is one side of a posting: a character's wallet, a guild's
+// treasury or a named system account.
+type LedgerAccount struct {
+	CharacterID uuid.UUID
+	GuildID     uuid.UUID
+	System      string
+}
+
+func CharacterAccount(id uuid.UUID) LedgerAccount {
+	return LedgerAccount{CharacterID: id}
+}
+
+// GuildAccount is a guild's gold treasury. Guilds hold no gems.
+func GuildAccount(id uuid.UUID) LedgerAccount {
+	return LedgerAccount{GuildID: id}
+}
+
+func SystemAccount(name string) LedgerAccount {
+	return LedgerAccount{System: name}
+}
+
+func (a LedgerAccount) String() string {
+	switch {
+	case a.System != "":
+		return "system:" + a.System
+	case a.GuildID != uuid.Nil:
+		return "guild:" + a.GuildID.String()
+	}
+	return "character:" + a.CharacterID.String()
+}
+
+func (a LedgerAccount) isCharacter() bool {
+	return a.System == "" && a.GuildID == uuid.Nil
+}
+
+// Posting moves Amount of Currency from one account to another. Reason is
+// stored as the economy_logs transaction_type.
+type Posting struct {
+	ServerID      int
+	Currency      models.Currency
+	Amount        int64
+	From          LedgerAccount
+	To            LedgerAccount
+	Reason        string
+	ReferenceType string
+	ReferenceID   *uuid.UUID
+	Details       map[string]interface{}
+}
+
+type LedgerService struct {
+	db *database.DB
+}
+
+func NewLedgerService(db *database.DB) *LedgerService {
+	return &LedgerService{db: db}
+}
+
+// Post applies a posting inside the caller's transaction and writes its
+// debit and credit entries. A debit that would take a balance below zero
+// fails with ErrInsufficientGold or ErrInsufficientGems.
+func (s *LedgerService) Post(ctx context.Context, tx pgx.Tx, p *Posting) error {
+	if p.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if p.Currency != models.CurrencyGold && p.Currency != models.CurrencyGems {
+		return ErrInvalidCurrency
+	}
+	if p.From == p.To {
+		return ErrSelfPosting
+	}
+	if p.From.System != "" && p.To.System != "" {
+		return ErrSystemOnlyPosting
+	}
+	if p.Currency != models.CurrencyGold && (p.From.GuildID != uuid.Nil || p.To.GuildID != uuid.Nil) {
+		return ErrInvalidCurrency
+	}
+
+	var details []byte
+	if p.Details != nil {
+		var err error
+		if details, err = json.Marshal(p.Details); err != nil {
+			return fmt.Errorf("failed to encode ledger details: %w", err)
+		}
+	}
+
+	entryID := uuid.New()
+	legs := []struct {
+		account, counterparty LedgerAccount
+		change                int64
+	}{
+		{p.From, p.To, -p.Amount},
+		{p.To, p.From, p.Amount},
+	}
+	for _, leg := range legs {
+		before, after, err := applyBalance(ctx, tx, leg.account, p.Currency, leg.change)
+		if err != nil {
+			return err
+		}
+
+		var characterID, guildID *uuid.UUID
+		if leg.account.isCharacter() {
+			id := leg.account.CharacterID
+			characterID = &id
+		} else if leg.account.GuildID != uuid.Nil {
+			id := leg.account.GuildID
+			guildID = &id
+		}
+		var referenceType *string
+		if p.ReferenceType != "" {
+			referenceType = &p.ReferenceType
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO economy_logs (
+				id, entry_id, server_id, character_id, guild_id, account, counterparty, currency,
+				transaction_type, gold_change, gold_before, gold_after,
+				reference_type, reference_id, details
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		`, uuid.New(), entryID, p.ServerID, characterID, guildID, leg.account.String(), leg.counterparty.String(), p.Currency,
+			p.Reason, leg.change, before, after,
+			referenceType, p.ReferenceID, details)
+		if err != nil {
+			return fmt.Errorf("failed to write ledger entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyBalance changes a character's or guild's balance and returns it before
+// and after. System accounts have no balance and return nils.
+func applyBalance(ctx context.Context, tx pgx.Tx, account LedgerAccount, currency models.Currency, delta int64) (*int64, *int64, error) {
+	if account.System != "" {
+		return nil, nil, nil
+	}
+	if account.GuildID != uuid.Nil {
+		return applyTreasury(ctx, tx, account.GuildID, delta)
+	}
+
+	query := `
+		UPDATE characters SET gold = gold + $1,
+			total_gold_earned = total_gold_earned + GREATEST($1, 0),
+			total_gold_spent = total_gold_spent + GREATEST(-$1, 0)
+		WHERE id = $2 AND gold + $1 >= 0
+		RETURNING gold`
+	insufficient := ErrInsufficientGold
+	if currency == models.CurrencyGems {
+		query = `
+			UPDATE characters SET premium_currency = premium_currency + $1
+			WHERE id = $2 AND premium_currency + $1 >= 0
+			RETURNING premium_currency`
+		insufficient = ErrInsufficientGems
+	}
+
+	var after int64
+	err := tx.QueryRow(ctx, query, delta, account.CharacterID).Scan(&after)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM characters WHERE id = $1)", account.CharacterID).Scan(&exists); err != nil {
+			return nil, nil, fmt.Errorf("failed to check character: %w", err)
+		}
+		if !exists {
+			return nil, nil, ErrCharacterNotFound
+		}
+		return nil, nil, insufficient
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update balance: %w", err)
+	}
+
+	before := after - delta
+	return &before, &after, nil
+}
+
+// applyTreasury changes a guild's gold treasury
+func applyTreasury(ctx context.Context, tx pgx.Tx, guildID uuid.UUID, delta int64) (*int64, *int64, error) {
+	var after int64
+	err := tx.QueryRow(ctx, `
+		UPDATE guilds SET gold_treasury = gold_treasury + $1
+		WHERE id = $2 AND gold_treasury + $1 >= 0
+		RETURNING gold_treasury
+	`, delta, guildID).Scan(&after)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM guilds WHERE id = $1)", guildID).Scan(&exists); err != nil {
+			return nil, nil, fmt.Errorf("failed to check guild: %w", err)
+		}
+		if !exists {
+			return nil, nil, ErrGuildNotFound
+		}
+		return nil, nil, ErrInsufficientGold
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update treasury: %w", err)
+	}
+
+	before := after - delta
+	return &before, &after, nil
+}
+
+// GetHistory returns the acting character's ledger entries, newest first
+func (s *LedgerService) GetHistory(ctx context.Context, accountID, characterID uuid.UUID, currency string, limit, offset int) ([]*models.LedgerEntry, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, entry_id, server_id, character_id, account, counterparty, currency,
+		       transaction_type, gold_change, gold_before, gold_after,
+		       reference_type, reference_id, details, created_at
+		FROM economy_logs
+		WHERE character_id = $1`
+	args := []interface{}{characterID}
+	argIndex := 2
+
+	if currency != "" {
+		query += fmt.Sprintf(" AND currency = $%d", argIndex)
+		args = append(args, currency)
+		argIndex++
+	}
+
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, limit, offset)
+
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.LedgerEntry
+	for rows.Next() {
+		var e models.LedgerEntry
+		var account, counterparty *string
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.EntryID, &e.ServerID, &e.CharacterID, &account, &counterparty, &e.Currency,
+			&e.TransactionType, &e.Change, &e.BalanceBefore, &e.BalanceAfter,
+			&e.ReferenceType, &e.ReferenceID, &details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		// Rows written before the ledger existed have no account columns
+		if account != nil {
+			e.Account = *account
+		}
+		if counterparty != nil {
+			e.Counterparty = *counterparty
+		}
+		e.Details = details
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// GetEconomySummary totals faucets and sinks per system account since the
+// given time, along with the currency currently held by characters.
+func (s *LedgerService) GetEconomySummary(ctx context.Context, since time.Time) (*models.EconomySummary, error) {
+	summary := &models.EconomySummary{Since: since, Flows: []*models.EconomyFlow{}}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT account, currency,
+		       COALESCE(SUM(-gold_change) FILTER (WHERE gold_change < 0), 0),
+		       COALESCE(SUM(gold_change) FILTER (WHERE gold_change > 0), 0)
+		FROM economy_logs
+		WHERE character_id IS NULL AND guild_id IS NULL AND account IS NOT NULL AND created_at >= $1
+		GROUP BY account, currency
+		ORDER BY account, currency
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get economy flows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f models.EconomyFlow
+		if err := rows.Scan(&f.Account, &f.Currency, &f.Faucet, &f.Sink); err != nil {
+			return nil, fmt.Errorf("failed to scan economy flow: %w", err)
+		}
+		summary.Flows = append(summary.Flows, &f)
+		if f.Currency == models.CurrencyGems {
+			summary.GemsFaucet += f.Faucet
+			summary.GemsSink += f.Sink
+		} else {
+			summary.GoldFaucet += f.Faucet
+			summary.GoldSink += f.Sink
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(gold), 0), COALESCE(SUM(premium_currency), 0)
+		FROM characters WHERE deleted_at IS NULL
+	`).Scan(&summary.GoldInCirculation, &summary.GemsInCirculation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get circulation: %w", err)
+	}
+
+	err = s.db.Pool.QueryRow(ctx, "SELECT COALESCE(SUM(gold_treasury), 0) FROM guilds").Scan(&summary.GoldInTreasuries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild treasuries: %w", err)
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,543 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrMarketLocked        = errors.New("market unlocks at level 20")
+	ErrListingNotFound     = errors.New("listing not found")
+	ErrListingUnavailable  = errors.New("listing is no longer available")
+	ErrCannotBuyOwnListing = errors.New("cannot buy your own listing")
+	ErrInvalidPrice        = errors.New("invalid price")
+	ErrInvalidDuration     = errors.New("invalid listing duration")
+	ErrTooManyListings     = errors.New("too many active listings")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+)
+
+const (
+	MarketUnlockLevel          = 20
+	MarketListingFeePercent    = 1 // charged when listing, not refunded
+	MarketSalesTaxPercent      = 5 // taken from the seller's proceeds
+	MarketDefaultDurationHours = 48
+	MarketMinDurationHours     = 12
+	MarketMaxDurationHours     = 72
+	MaxActiveListings          = 20
+	MarketSweepBatchSize       = 100
+)
+
+type MarketService struct {
+	db     *database.DB
+	ledger *LedgerService
+}
+
+func NewMarketService(db *database.DB, ledger *LedgerService) *MarketService {
+	return &MarketService{db: db, ledger: ledger}
+}
+
+func percentOf(amount int64, percent int64) int64 {
+	return amount * percent / 100
+}
+
+// CreateListing moves the item out of the seller's inventory into escrow and
+// charges the listing fee.
+func (s *MarketService) CreateListing(ctx context.Context, accountID, characterID uuid.UUID, req *models.CreateListingRequest) (*models.MarketListing, error) {
+	if req.PricePerUnit <= 0 {
+		return nil, ErrInvalidPrice
+	}
+	if req.Quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	duration := req.DurationHours
+	if duration == 0 {
+		duration = MarketDefaultDurationHours
+	}
+	if duration < MarketMinDurationHours || duration > MarketMaxDurationHours {
+		return nil, ErrInvalidDuration
+	}
+
+	var listing *models.MarketListing
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		seller, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		if seller.Level < MarketUnlockLevel {
+			return ErrMarketLocked
+		}
+
+		var active int
+		if err := tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM market_listings WHERE seller_id = $1 AND status = 'active'
+		`, seller.ID).Scan(&active); err != nil {
+			return fmt.Errorf("failed to count listings: %w", err)
+		}
+		if active >= MaxActiveListings {
+			return ErrTooManyListings
+		}
+
+		totalPrice := req.PricePerUnit * int64(req.Quantity)
+		fee := percentOf(totalPrice, MarketListingFeePercent)
+		if fee < 1 {
+			fee = 1
+		}
+
+		stack, err := takeInventoryItem(ctx, tx, seller.ID, req.InventoryItemID, req.Quantity)
+		if err != nil {
+			return err
+		}
+
+		listingID := uuid.New()
+		err = s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      seller.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        fee,
+			From:          CharacterAccount(seller.ID),
+			To:            SystemAccount(SystemMarketFee),
+			Reason:        "market_listing_fee",
+			ReferenceType: "market_listing",
+			ReferenceID:   &listingID,
+		})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		listing = &models.MarketListing{
+			ID:               listingID,
+			ServerID:         seller.ServerID,
+			SellerID:         seller.ID,
+			SellerName:       seller.Name,
+			ItemDefinitionID: stack.ItemDefinitionID,
+			Quantity:         stack.Quantity,
+			UpgradeLevel:     stack.UpgradeLevel,
+			GemSlots:         stack.GemSlots,
+			BonusStats:       stack.BonusStats,
+			PricePerUnit:     req.PricePerUnit,
+			TotalPrice:       totalPrice,
+			ListingFee:       fee,
+			Status:           models.ListingActive,
+			ListedAt:         now,
+			ExpiresAt:        now.Add(time.Duration(duration) * time.Hour),
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO market_listings (
+				id, server_id, seller_id, item_definition_id, quantity, upgrade_level,
+				gem_slot_1, gem_slot_2, gem_slot_3, gem_slot_4, bonus_stats,
+				price_per_unit, total_price, listing_fee, status, listed_at, expires_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		`, listing.ID, listing.ServerID, listing.SellerID, listing.ItemDefinitionID, listing.Quantity, listing.UpgradeLevel,
+			listing.GemSlots[0], listing.GemSlots[1], listing.GemSlots[2], listing.GemSlots[3], []byte(listing.BonusStats),
+			listing.PricePerUnit, listing.TotalPrice, listing.ListingFee, listing.Status, listing.ListedAt, listing.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to create listing: %w", err)
+		}
+
+		return tx.QueryRow(ctx, "SELECT name FROM item_definitions WHERE id = $1", listing.ItemDefinitionID).Scan(&listing.ItemName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+const listingColumns = `
+	ml.id, ml.server_id, ml.seller_id, seller.name, ml.item_definition_id, d.name,
+	ml.quantity, ml.upgrade_level, ml.gem_slot_1, ml.gem_slot_2, ml.gem_slot_3, ml.gem_slot_4, ml.bonus_stats,
+	ml.price_per_unit, ml.total_price, ml.listing_fee, ml.sales_tax, ml.status,
+	ml.listed_at, ml.expires_at, ml.sold_at, ml.buyer_id`
+
+const listingJoins = `
+	FROM market_listings ml
+	JOIN characters seller ON seller.id = ml.seller_id
+	JOIN item_definitions d ON d.id = ml.item_definition_id`
+
+func scanListing(row pgx.Row) (*models.MarketListing, error) {
+	var l models.MarketListing
+	var bonusStats []byte
+	err := row.Scan(
+		&l.ID, &l.ServerID, &l.SellerID, &l.SellerName, &l.ItemDefinitionID, &l.ItemName,
+		&l.Quantity, &l.UpgradeLevel, &l.GemSlots[0], &l.GemSlots[1], &l.GemSlots[2], &l.GemSlots[3], &bonusStats,
+		&l.PricePerUnit, &l.TotalPrice, &l.ListingFee, &l.SalesTax, &l.Status,
+		&l.ListedAt, &l.ExpiresAt, &l.SoldAt, &l.BuyerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	l.BonusStats = bonusStats
+	return &l, nil
+}
+
+func encodeListingCursor(l *models.MarketListing) string {
+	raw := fmt.Sprintf("%d:%s", l.PricePerUnit, l.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeListingCursor(cursor string) (int64, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, uuid.Nil, ErrInvalidCursor
+	}
+	priceStr, idStr, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, uuid.Nil, ErrInvalidCursor
+	}
+	price, err := strconv.ParseInt(priceStr, 10, 64)
+	if err != nil {
+		return 0, uuid.Nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return 0, uuid.Nil, ErrInvalidCursor
+	}
+	return price, id, nil
+}
+
+// Search returns active listings on the character's server, cheapest first.
+// Pagination is keyset based on (price_per_unit, id).
+func (s *MarketService) Search(ctx context.Context, accountID, characterID uuid.UUID, filter *models.MarketSearchFilter) (*models.MarketSearchResult, error) {
+	character, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + listingColumns + listingJoins + `
+		WHERE ml.server_id = $1 AND ml.status = 'active' AND ml.expires_at > NOW()`
+	args := []interface{}{character.ServerID}
+	argIndex := 2
+
+	addFilter := func(clause string, value interface{}) {
+		query += fmt.Sprintf(" AND "+clause, argIndex)
+		args = append(args, value)
+		argIndex++
+	}
+
+	if filter.ItemDefinitionID != nil {
+		addFilter("ml.item_definition_id = $%d", *filter.ItemDefinitionID)
+	}
+	if filter.MinUpgradeLevel != nil {
+		addFilter("ml.upgrade_level >= $%d", *filter.MinUpgradeLevel)
+	}
+	if filter.MaxUpgradeLevel != nil {
+		addFilter("ml.upgrade_level <= $%d", *filter.MaxUpgradeLevel)
+	}
+	if filter.GemID != nil {
+		query += fmt.Sprintf(" AND $%d IN (ml.gem_slot_1, ml.gem_slot_2, ml.gem_slot_3, ml.gem_slot_4)", argIndex)
+		args = append(args, *filter.GemID)
+		argIndex++
+	}
+	if filter.MinPrice != nil {
+		addFilter("ml.price_per_unit >= $%d", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		addFilter("ml.price_per_unit <= $%d", *filter.MaxPrice)
+	}
+	if filter.Cursor != "" {
+		price, id, err := decodeListingCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query += fmt.Sprintf(" AND (ml.price_per_unit, ml.id) > ($%d, $%d)", argIndex, argIndex+1)
+		args = append(args, price, id)
+		argIndex += 2
+	}
+
+	// Fetch one extra row to know whether another page exists
+	query += fmt.Sprintf(" ORDER BY ml.price_per_unit ASC, ml.id ASC LIMIT $%d", argIndex)
+	args = append(args, filter.Limit+1)
+
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search listings: %w", err)
+	}
+	defer rows.Close()
+
+	result := &models.MarketSearchResult{Listings: []*models.MarketListing{}}
+	for rows.Next() {
+		l, err := scanListing(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan listing: %w", err)
+		}
+		result.Listings = append(result.Listings, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Listings) > filter.Limit {
+		result.Listings = result.Listings[:filter.Limit]
+		result.NextCursor = encodeListingCursor(result.Listings[len(result.Listings)-1])
+	}
+	return result, nil
+}
+
+// GetMyListings returns the character's listings, newest first
+func (s *MarketService) GetMyListings(ctx context.Context, accountID, characterID uuid.UUID, status string, limit, offset int) ([]*models.MarketListing, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + listingColumns + listingJoins + ` WHERE ml.seller_id = $1`
+	args := []interface{}{characterID}
+	argIndex := 2
+	if status != "" {
+		query += fmt.Sprintf(" AND ml.status = $%d", argIndex)
+		args = append(args, status)
+		argIndex++
+	}
+	query += fmt.Sprintf(" ORDER BY ml.listed_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, limit, offset)
+
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get listings: %w", err)
+	}
+	defer rows.Close()
+
+	var listings []*models.MarketListing
+	for rows.Next() {
+		l, err := scanListing(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan listing: %w", err)
+		}
+		listings = append(listings, l)
+	}
+	return listings, rows.Err()
+}
+
+// lockListing locks an escrowed listing row for the rest of the transaction
+func lockListing(ctx context.Context, tx pgx.Tx, listingID uuid.UUID) (*models.MarketListing, error) {
+	l, err := scanListing(tx.QueryRow(ctx, `SELECT `+listingColumns+listingJoins+`
+		WHERE ml.id = $1
+		FOR UPDATE OF ml
+	`, listingID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrListingNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load listing: %w", err)
+	}
+	return l, nil
+}
+
+func listingStack(l *models.MarketListing) *models.ItemStack {
+	return &models.ItemStack{
+		ItemDefinitionID: l.ItemDefinitionID,
+		Quantity:         l.Quantity,
+		UpgradeLevel:     l.UpgradeLevel,
+		GemSlots:         l.GemSlots,
+		BonusStats:       l.BonusStats,
+	}
+}
+
+// Buy purchases a whole listing. The listing row is locked first, so when two
+// buyers race only the first to commit sees it as active.
+func (s *MarketService) Buy(ctx context.Context, accountID, buyerID, listingID uuid.UUID) (*models.MarketPurchase, error) {
+	var purchase *models.MarketPurchase
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		listing, err := lockListing(ctx, tx, listingID)
+		if err != nil {
+			return err
+		}
+		if listing.Status != models.ListingActive || !listing.ExpiresAt.After(time.Now()) {
+			return ErrListingUnavailable
+		}
+
+		locked, err := lockCharacters(ctx, tx, buyerID, listing.SellerID)
+		if err != nil {
+			return err
+		}
+		buyer, seller := locked[buyerID], locked[listing.SellerID]
+		if buyer.AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		if buyer.AccountID == seller.AccountID {
+			return ErrCannotBuyOwnListing
+		}
+		if buyer.ServerID != listing.ServerID {
+			return ErrListingNotFound
+		}
+		if buyer.Level < MarketUnlockLevel {
+			return ErrMarketLocked
+		}
+		tax := percentOf(listing.TotalPrice, MarketSalesTaxPercent)
+		err = s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      listing.ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        listing.TotalPrice - tax,
+			From:          CharacterAccount(buyer.ID),
+			To:            CharacterAccount(seller.ID),
+			Reason:        "market_sale",
+			ReferenceType: "market_listing",
+			ReferenceID:   &listing.ID,
+		})
+		if err != nil {
+			return err
+		}
+		if tax > 0 {
+			err = s.ledger.Post(ctx, tx, &Posting{
+				ServerID:      listing.ServerID,
+				Currency:      models.CurrencyGold,
+				Amount:        tax,
+				From:          CharacterAccount(buyer.ID),
+				To:            SystemAccount(SystemMarketTax),
+				Reason:        "market_sales_tax",
+				ReferenceType: "market_listing",
+				ReferenceID:   &listing.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		mailed, err := deliverItem(ctx, tx, buyer.ID, listingStack(listing), "market_purchase", "Market purchase: "+listing.ItemName)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		_, err = tx.Exec(ctx, `
+			UPDATE market_listings SET status = 'sold', sold_at = $1, buyer_id = $2, sales_tax = $3
+			WHERE id = $4
+		`, now, buyer.ID, tax, listing.ID)
+		if err != nil {
+			return fmt.Errorf("failed to close listing: %w", err)
+		}
+
+		if err := recordPrice(ctx, tx, listing.ServerID, listing.ItemDefinitionID, listing.PricePerUnit, listing.Quantity); err != nil {
+			return err
+		}
+
+		listing.Status = models.ListingSold
+		listing.SoldAt = &now
+		listing.BuyerID = &buyer.ID
+		listing.SalesTax = tax
+		purchase = &models.MarketPurchase{Listing: listing, GoldPaid: listing.TotalPrice, SentToMail: mailed}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purchase, nil
+}
+
+// recordPrice folds a sale into today's price_history row for the item
+func recordPrice(ctx context.Context, q querier, serverID, itemDefinitionID int, pricePerUnit int64, quantity int) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO price_history (server_id, item_definition_id, avg_price, min_price, max_price, volume, date)
+		VALUES ($1, $2, $3, $3, $3, $4, CURRENT_DATE)
+		ON CONFLICT (server_id, item_definition_id, date) DO UPDATE SET
+			avg_price = (price_history.avg_price * price_history.volume + EXCLUDED.avg_price * EXCLUDED.volume)
+			            / (price_history.volume + EXCLUDED.volume),
+			min_price = LEAST(price_history.min_price, EXCLUDED.min_price),
+			max_price = GREATEST(price_history.max_price, EXCLUDED.max_price),
+			volume = price_history.volume + EXCLUDED.volume
+	`, serverID, itemDefinitionID, pricePerUnit, quantity)
+	if err != nil {
+		return fmt.Errorf("failed to record price history: %w", err)
+	}
+	return nil
+}
+
+// Cancel returns an active listing's item to the seller. The listing fee is kept.
+func (s *MarketService) Cancel(ctx context.Context, accountID, characterID, listingID uuid.UUID) (*models.MarketListing, error) {
+	var listing *models.MarketListing
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		l, err := lockListing(ctx, tx, listingID)
+		if err != nil {
+			return err
+		}
+		if l.SellerID != characterID {
+			return ErrListingNotFound
+		}
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		if l.Status != models.ListingActive {
+			return ErrListingUnavailable
+		}
+
+		if err := s.returnToSeller(ctx, tx, l, models.ListingCancelled); err != nil {
+			return err
+		}
+		listing = l
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+func (s *MarketService) returnToSeller(ctx context.Context, tx pgx.Tx, l *models.MarketListing, status models.ListingStatus) error {
+	if _, err := lockCharacters(ctx, tx, l.SellerID); err != nil {
+		return err
+	}
+	if _, err := deliverItem(ctx, tx, l.SellerID, listingStack(l), "market_return", "Market listing returned: "+l.ItemName); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE market_listings SET status = $1 WHERE id = $2", status, l.ID); err != nil {
+		return fmt.Errorf("failed to close listing: %w", err)
+	}
+	l.Status = status
+	return nil
+}
+
+// ExpireListings returns every expired listing's item to its seller and
+// reports how many listings were closed.
+func (s *MarketService) ExpireListings(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM market_listings
+		WHERE status = 'active' AND expires_at <= NOW()
+		ORDER BY expires_at
+		LIMIT $1
+	`, MarketSweepBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired listings: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan expired listings: %w", err)
+	}
+
+	expired := 0
+	for _, id := range ids {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			l, err := lockListing(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			// A buyer may have won the race since the scan
+			if l.Status != models.ListingActive {
+				return nil
+			}
+			if err := s.returnToSeller(ctx, tx, l, models.ListingExpired); err != nil {
+				return err
+			}
+			expired++
+			return nil
+		})
+		if err != nil {
+			return expired, fmt.Errorf("failed to expire listing %s: %w", id, err)
+		}
+	}
+	return expired, nil
+}
+
+// RunSweeper expires listings every interval until ctx is cancelled
+func (s *MarketService) RunSweeper(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "market sweeper", interval, s.ExpireListings)
+}
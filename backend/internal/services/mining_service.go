@@ -0,0 +1,680 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrMiningNodeNotFound = errors.New("mining node not found")
+	ErrNodeDepleted       = errors.New("mining node is depleted")
+	ErrAlreadyMining      = errors.New("already mining")
+	ErrNotMining          = errors.New("not mining")
+	ErrOreBagFull         = errors.New("ore bag is full")
+	ErrNoOreToSell        = errors.New("no ore to sell")
+	ErrPrisonNode         = errors.New("only prisoners can mine here")
+)
+
+const (
+	// MiningBaseInterval shrinks with mining level, see gatheringInterval
+	MiningBaseInterval = 20 * time.Second
+
+	// Extractions settled per request; a longer backlog is dropped
+	MiningMaxExtractionsPerSettle = 120
+	OreBagSize                    = 200
+
+	MiningSweepBatchSize = 200
+)
+
+// System ledger account paying for sold ore
+const SystemOreSale = "ore_sale"
+
+type MiningService struct {
+	db      *database.DB
+	ledger  *LedgerService
+	tax     *TaxService
+	guilds  *GuildService
+	bonuses *GuildBonusService
+}
+
+func NewMiningService(db *database.DB, ledger *LedgerService, tax *TaxService, guilds *GuildService, bonuses *GuildBonusService) *MiningService {
+	return &MiningService{db: db, ledger: ledger, tax: tax, guilds: guilds, bonuses: bonuses}
+}
+
+func miningInterval(level int) time.Duration {
+	return gatheringInterval(MiningBaseInterval, level)
+}
+
+const miningNodeColumns = `n.id, n.map_id, n.name, n.x, n.y, COALESCE(n.radius, 0), COALESCE(n.zone_type, 'safe'),
+	COALESCE(n.min_rarity, 'common'), COALESCE(n.max_rarity, 'rare'), COALESCE(n.rare_chance_bonus, 0),
+	COALESCE(n.respawn_time_seconds, 300), COALESCE(n.current_resources, 0), COALESCE(n.max_resources, 0),
+	n.depleted_at, n.respawn_at, COALESCE(m.is_prison, false)`
+
+func scanMiningNode(row pgx.Row) (*models.MiningNode, error) {
+	var n models.MiningNode
+	err := row.Scan(&n.ID, &n.MapID, &n.Name, &n.X, &n.Y, &n.Radius, &n.ZoneType,
+		&n.MinRarity, &n.MaxRarity, &n.RareChanceBonus,
+		&n.RespawnTimeSeconds, &n.CurrentResources, &n.MaxResources,
+		&n.DepletedAt, &n.RespawnAt, &n.IsPrison)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// lockMiningNode locks a node for extraction, refilling it first if its
+// respawn is due. Every extraction goes through this lock, so concurrent
+// miners cannot take more than the node holds. Inactive nodes are only found
+// when activeOnly is false.
+func lockMiningNode(ctx context.Context, tx pgx.Tx, nodeID int, activeOnly bool, now time.Time) (*models.MiningNode, error) {
+	n, err := scanMiningNode(tx.QueryRow(ctx, `
+		SELECT `+miningNodeColumns+`
+		FROM mining_nodes n
+		JOIN maps m ON m.id = n.map_id
+		WHERE n.id = $1 AND (n.is_active OR NOT $2)
+		FOR UPDATE OF n
+	`, nodeID, activeOnly))
+	if err != nil {
+		return nil, ErrMiningNodeNotFound
+	}
+
+	if n.RespawnAt != nil && !n.RespawnAt.After(now) {
+		_, err := tx.Exec(ctx, `
+			UPDATE mining_nodes SET current_resources = max_resources, depleted_at = NULL, respawn_at = NULL
+			WHERE id = $1
+		`, n.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to respawn mining node: %w", err)
+		}
+		n.CurrentResources, n.DepletedAt, n.RespawnAt = n.MaxResources, nil, nil
+	}
+	return n, nil
+}
+
+// extractFromNode takes units out of a locked node, scheduling its respawn
+// when it runs dry.
+func extractFromNode(ctx context.Context, tx pgx.Tx, n *models.MiningNode, units int, now time.Time) error {
+	n.CurrentResources -= units
+	if n.CurrentResources <= 0 {
+		n.CurrentResources = 0
+		respawn := now.Add(time.Duration(n.RespawnTimeSeconds) * time.Second)
+		n.DepletedAt, n.RespawnAt = &now, &respawn
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE mining_nodes SET current_resources = $2, depleted_at = $3, respawn_at = $4 WHERE id = $1
+	`, n.ID, n.CurrentResources, n.DepletedAt, n.RespawnAt)
+	if err != nil {
+		return fmt.Errorf("failed to deplete mining node: %w", err)
+	}
+	return nil
+}
+
+// miningState is a locked character_mining row
+type miningState struct {
+	CharacterID uuid.UUID
+	Level       int
+	Exp         int
+	Total       int
+	Rare        int
+	IsMining    bool
+	NodeID      *int
+	StartedAt   *time.Time
+	NextMineAt  *time.Time
+	// Bonus is the miner's guild bonus
+	Bonus *models.ActivityBonus
+}
+
+// mineInterval is the time to the miner's next extraction, shortened by
+// their guild's mining speed
+func (st *miningState) mineInterval() time.Duration {
+	return time.Duration(float64(miningInterval(st.Level)) / st.Bonus.Multiplier(models.BonusMiningSpeed))
+}
+
+// lockMining locks the character's mining row, creating it on first use,
+// and resolves the miner's guild bonus
+func (s *MiningService) lockMining(ctx context.Context, tx pgx.Tx, characterID uuid.UUID) (*miningState, error) {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO character_mining (character_id) VALUES ($1)
+		ON CONFLICT (character_id) DO NOTHING
+	`, characterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mining profile: %w", err)
+	}
+
+	var st miningState
+	err = tx.QueryRow(ctx, `
+		SELECT character_id, COALESCE(mining_level, 1), COALESCE(mining_exp, 0),
+		       COALESCE(total_ore_mined, 0), COALESCE(rare_ore_mined, 0),
+		       COALESCE(is_mining, false), current_node_id, mining_started_at, next_mine_at
+		FROM character_mining
+		WHERE character_id = $1
+		FOR UPDATE
+	`, characterID).Scan(&st.CharacterID, &st.Level, &st.Exp, &st.Total, &st.Rare,
+		&st.IsMining, &st.NodeID, &st.StartedAt, &st.NextMineAt)
+	if err != nil {
+		return nil, ErrCharacterNotFound
+	}
+	st.Bonus, err = s.bonuses.Resolve(ctx, characterID, models.BonusActivityMining)
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func oreBagCount(ctx context.Context, q querier, characterID uuid.UUID) (int, error) {
+	var bag int
+	err := q.QueryRow(ctx, `
+		SELECT COUNT(*) FROM mining_extractions e
+		JOIN ore_definitions o ON o.id = e.ore_id
+		WHERE e.character_id = $1 AND e.sold_at IS NULL AND NOT COALESCE(o.is_prison_only, false)
+	`, characterID).Scan(&bag)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count ore bag: %w", err)
+	}
+	return bag, nil
+}
+
+// nodeOres lists the ores a node yields at a mining level. Prison nodes yield
+// only prison ores, which are smelted straight into the returned items.
+// rareBonus adds to the node's own rare chance bonus.
+func nodeOres(ctx context.Context, q querier, n *models.MiningNode, level int, rareBonus float64) ([]*gatherable, map[int]*models.ItemStack, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, name, COALESCE(rarity, 'common'), COALESCE(sell_price, 0),
+		       smelts_into_id, COALESCE(smelt_quantity, 1)
+		FROM ore_definitions
+		WHERE is_active AND $1 = ANY(spawn_zones)
+		  AND COALESCE(required_mining_level, 1) <= $2
+		  AND rarity BETWEEN $3::item_rarity AND $4::item_rarity
+		  AND COALESCE(is_prison_only, false) = $5
+	`, string(n.ZoneType), level, n.MinRarity, n.MaxRarity, n.IsPrison)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get ores: %w", err)
+	}
+	defer rows.Close()
+
+	var ores []*gatherable
+	smelted := make(map[int]*models.ItemStack)
+	for rows.Next() {
+		var o gatherable
+		var smeltsInto *int
+		var smeltQty int
+		if err := rows.Scan(&o.ID, &o.Name, &o.Rarity, &o.SellPrice, &smeltsInto, &smeltQty); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan ore: %w", err)
+		}
+		o.Weight = gatheringWeight(o.Rarity, n.ZoneType, level, n.RareChanceBonus+rareBonus)
+		if n.IsPrison && smeltsInto != nil {
+			smelted[o.ID] = &models.ItemStack{ItemDefinitionID: *smeltsInto, Quantity: smeltQty}
+		}
+		ores = append(ores, &o)
+	}
+	return ores, smelted, rows.Err()
+}
+
+// settleMining extracts every unit whose timer has run out. Mining stops when
+// the node runs dry or the ore bag fills up. Prison ores skip the bag and
+// count as prison activity.
+func settleMining(ctx context.Context, tx pgx.Tx, st *miningState, now time.Time) ([]*models.OreExtraction, error) {
+	if !st.IsMining || st.NodeID == nil || st.NextMineAt == nil || st.NextMineAt.After(now) {
+		return nil, nil
+	}
+
+	node, err := lockMiningNode(ctx, tx, *st.NodeID, false, now)
+	if err != nil {
+		return nil, err
+	}
+	bag, err := oreBagCount(ctx, tx, st.CharacterID)
+	if err != nil {
+		return nil, err
+	}
+	ores, smelted, err := nodeOres(ctx, tx, node, st.Level, st.Bonus.Percentage(models.BonusRareOreChance)/100)
+	if err != nil {
+		return nil, err
+	}
+
+	var mined []*models.OreExtraction
+	items := make(map[int]int)
+	next := *st.NextMineAt
+	for !next.After(now) && len(mined) < MiningMaxExtractionsPerSettle &&
+		len(mined) < node.CurrentResources && (node.IsPrison || bag < OreBagSize) {
+		o := rollGatherable(ores)
+		if o == nil {
+			break
+		}
+
+		exp := int(float64(gatheringRarityExp[o.Rarity]) * st.Bonus.Multiplier(models.BonusMiningExp))
+		e := &models.OreExtraction{
+			OreID: o.ID, OreName: o.Name, Rarity: o.Rarity, NodeID: node.ID,
+			Quantity: 1, SellPrice: o.SellPrice, ExpEarned: exp, PrisonOnly: node.IsPrison,
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO mining_extractions (character_id, node_id, ore_id, quantity, exp_earned, mined_at)
+			VALUES ($1, $2, $3, 1, $4, $5)
+			RETURNING id, mined_at
+		`, st.CharacterID, node.ID, o.ID, exp, next).Scan(&e.ID, &e.MinedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record extraction: %w", err)
+		}
+		mined = append(mined, e)
+		if stack, ok := smelted[o.ID]; ok {
+			items[stack.ItemDefinitionID] += stack.Quantity
+		} else if !node.IsPrison {
+			bag++
+		}
+
+		st.Exp += exp
+		st.Level = gatheringLevelFor(st.Exp)
+		st.Total++
+		if isRareOrBetter(o.Rarity) {
+			st.Rare++
+		}
+		next = next.Add(st.mineInterval())
+	}
+
+	if len(mined) > 0 {
+		if err := extractFromNode(ctx, tx, node, len(mined), now); err != nil {
+			return nil, err
+		}
+	}
+	if next.Before(now) {
+		next = now.Add(st.mineInterval())
+	}
+	st.NextMineAt = &next
+	if node.CurrentResources == 0 || (!node.IsPrison && bag >= OreBagSize) {
+		st.IsMining = false
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE character_mining SET
+			mining_level = $2, mining_exp = $3, total_ore_mined = $4, rare_ore_mined = $5,
+			is_mining = $6, next_mine_at = CASE WHEN $6 THEN $7::timestamptz END,
+			current_node_id = CASE WHEN $6 THEN current_node_id END,
+			mining_started_at = CASE WHEN $6 THEN mining_started_at END,
+			updated_at = NOW()
+		WHERE character_id = $1
+	`, st.CharacterID, st.Level, st.Exp, st.Total, st.Rare, st.IsMining, next)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update mining: %w", err)
+	}
+	if len(mined) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE characters SET total_ore_mined = COALESCE(total_ore_mined, 0) + $2 WHERE id = $1
+	`, st.CharacterID, len(mined))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update ore count: %w", err)
+	}
+
+	for itemID, qty := range items {
+		_, err := deliverItem(ctx, tx, st.CharacterID, &models.ItemStack{ItemDefinitionID: itemID, Quantity: qty},
+			"prison_reward", "Prison mine")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if node.IsPrison {
+		exp := 0
+		for _, e := range mined {
+			exp += e.ExpEarned
+		}
+		err = logPrisonerActivity(ctx, tx, st.CharacterID, &prisonActivity{
+			Type: "mining", OreMined: len(mined), Exp: exp,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mined, nil
+}
+
+// withMining locks the acting character's mining state, settles due
+// extractions, runs fn and returns the resulting status.
+func (s *MiningService) withMining(ctx context.Context, accountID, characterID uuid.UUID, fn func(tx pgx.Tx, st *miningState) error) (*models.MiningStatus, error) {
+	var status *models.MiningStatus
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		st, err := s.lockMining(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		mined, err := settleMining(ctx, tx, st, time.Now())
+		if err != nil {
+			return err
+		}
+		if fn != nil {
+			if err := fn(tx, st); err != nil {
+				return err
+			}
+		}
+
+		bag, err := oreBagCount(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		status = &models.MiningStatus{
+			CharacterID:   st.CharacterID,
+			MiningLevel:   st.Level,
+			MiningExp:     st.Exp,
+			NextLevelExp:  gatheringExpForLevel(min(st.Level+1, GatheringMaxLevel)),
+			TotalOreMined: st.Total,
+			RareOreMined:  st.Rare,
+			IsMining:      st.IsMining,
+			BagCount:      bag,
+			BagSize:       OreBagSize,
+			NewOre:        mined,
+		}
+		if st.IsMining && st.NodeID != nil {
+			status.Node, err = scanMiningNode(tx.QueryRow(ctx, `
+				SELECT `+miningNodeColumns+`
+				FROM mining_nodes n
+				JOIN maps m ON m.id = n.map_id
+				WHERE n.id = $1
+			`, *st.NodeID))
+			if err != nil {
+				return ErrMiningNodeNotFound
+			}
+			status.MiningStartedAt = st.StartedAt
+			status.NextMineAt = st.NextMineAt
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// GetNodes returns the active mining nodes, optionally on one map. Nodes
+// whose respawn is due are shown refilled.
+func (s *MiningService) GetNodes(ctx context.Context, mapID *int) ([]*models.MiningNode, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+miningNodeColumns+`
+		FROM mining_nodes n
+		JOIN maps m ON m.id = n.map_id
+		WHERE n.is_active AND ($1::int IS NULL OR n.map_id = $1)
+		ORDER BY n.map_id, n.id
+	`, mapID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mining nodes: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var nodes []*models.MiningNode
+	for rows.Next() {
+		n, err := scanMiningNode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan mining node: %w", err)
+		}
+		if n.RespawnAt != nil && !n.RespawnAt.After(now) {
+			n.CurrentResources, n.DepletedAt, n.RespawnAt = n.MaxResources, nil, nil
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, rows.Err()
+}
+
+// GetStatus returns the acting character's mining state, extracting any ore
+// that is due.
+func (s *MiningService) GetStatus(ctx context.Context, accountID, characterID uuid.UUID) (*models.MiningStatus, error) {
+	return s.withMining(ctx, accountID, characterID, nil)
+}
+
+// Start begins mining a node. Prison nodes are for prisoners only, and
+// prisoners cannot mine anywhere else.
+func (s *MiningService) Start(ctx context.Context, accountID, characterID uuid.UUID, nodeID int) (*models.MiningStatus, error) {
+	return s.withMining(ctx, accountID, characterID, func(tx pgx.Tx, st *miningState) error {
+		if st.IsMining {
+			return ErrAlreadyMining
+		}
+		now := time.Now()
+		node, err := lockMiningNode(ctx, tx, nodeID, true, now)
+		if err != nil {
+			return err
+		}
+		if node.CurrentResources <= 0 {
+			return ErrNodeDepleted
+		}
+
+		err = checkNotInPrison(ctx, tx, characterID)
+		switch {
+		case errors.Is(err, ErrInPrison):
+			if !node.IsPrison {
+				return ErrConfinedToPrison
+			}
+		case err != nil:
+			return err
+		case node.IsPrison:
+			return ErrPrisonNode
+		}
+
+		if !node.IsPrison {
+			bag, err := oreBagCount(ctx, tx, characterID)
+			if err != nil {
+				return err
+			}
+			if bag >= OreBagSize {
+				return ErrOreBagFull
+			}
+		}
+
+		next := now.Add(st.mineInterval())
+		_, err = tx.Exec(ctx, `
+			UPDATE character_mining SET is_mining = true, current_node_id = $2,
+				mining_started_at = $3, next_mine_at = $4, updated_at = NOW()
+			WHERE character_id = $1
+		`, characterID, node.ID, now, next)
+		if err != nil {
+			return fmt.Errorf("failed to start mining: %w", err)
+		}
+		st.IsMining, st.NodeID, st.StartedAt, st.NextMineAt = true, &node.ID, &now, &next
+		return nil
+	})
+}
+
+// Stop leaves the node, keeping whatever was mined so far
+func (s *MiningService) Stop(ctx context.Context, accountID, characterID uuid.UUID) (*models.MiningStatus, error) {
+	return s.withMining(ctx, accountID, characterID, func(tx pgx.Tx, st *miningState) error {
+		if !st.IsMining {
+			return ErrNotMining
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE character_mining SET is_mining = false, current_node_id = NULL,
+				mining_started_at = NULL, next_mine_at = NULL, updated_at = NOW()
+			WHERE character_id = $1
+		`, characterID)
+		if err != nil {
+			return fmt.Errorf("failed to stop mining: %w", err)
+		}
+		st.IsMining = false
+		return nil
+	})
+}
+
+// GetOre returns the ore kept in the acting character's bag, newest first
+func (s *MiningService) GetOre(ctx context.Context, accountID, characterID uuid.UUID, limit, offset int) ([]*models.OreExtraction, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT e.id, e.ore_id, o.name, COALESCE(o.rarity, 'common'), e.node_id, COALESCE(e.quantity, 1),
+		       COALESCE(o.sell_price, 0), COALESCE(e.exp_earned, 0), e.mined_at, e.sold_at, e.sold_for
+		FROM mining_extractions e
+		JOIN ore_definitions o ON o.id = e.ore_id
+		WHERE e.character_id = $1 AND e.sold_at IS NULL AND NOT COALESCE(o.is_prison_only, false)
+		ORDER BY e.mined_at DESC
+		LIMIT $2 OFFSET $3
+	`, characterID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ore: %w", err)
+	}
+	defer rows.Close()
+
+	var ore []*models.OreExtraction
+	for rows.Next() {
+		var e models.OreExtraction
+		if err := rows.Scan(&e.ID, &e.OreID, &e.OreName, &e.Rarity, &e.NodeID, &e.Quantity,
+			&e.SellPrice, &e.ExpEarned, &e.MinedAt, &e.SoldAt, &e.SoldFor); err != nil {
+			return nil, fmt.Errorf("failed to scan ore: %w", err)
+		}
+		ore = append(ore, &e)
+	}
+	return ore, rows.Err()
+}
+
+// Sell sells kept ore at its definition price, raised by the seller's guild
+// bonus. With no ids the whole bag is sold.
+func (s *MiningService) Sell(ctx context.Context, accountID, characterID uuid.UUID, extractionIDs []uuid.UUID) (*models.OreSale, error) {
+	sale := &models.OreSale{}
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		me, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		bonus, err := s.bonuses.Resolve(ctx, me.ID, models.BonusActivityMining)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `
+			UPDATE mining_extractions e SET sold_at = NOW(),
+				sold_for = ROUND(COALESCE(o.sell_price, 0) * COALESCE(e.quantity, 1) * $3::float8)
+			FROM ore_definitions o
+			WHERE o.id = e.ore_id AND e.character_id = $1 AND e.sold_at IS NULL
+			  AND NOT COALESCE(o.is_prison_only, false)
+			  AND (COALESCE(cardinality($2::uuid[]), 0) = 0 OR e.id = ANY($2))
+			RETURNING e.node_id, e.sold_for
+		`, me.ID, extractionIDs, bonus.Multiplier(models.BonusOreSellPrice))
+		if err != nil {
+			return fmt.Errorf("failed to sell ore: %w", err)
+		}
+		// Gold per node, taxed by whoever controls the zone around it
+		earned := make(map[int]int64)
+		for rows.Next() {
+			var id int
+			var price int64
+			if err := rows.Scan(&id, &price); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to sell ore: %w", err)
+			}
+			earned[id] += price
+			sale.Sold++
+			sale.GoldEarned += price
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to sell ore: %w", err)
+		}
+		if sale.Sold == 0 {
+			return ErrNoOreToSell
+		}
+		if sale.GoldEarned == 0 {
+			return nil
+		}
+
+		err = s.ledger.Post(ctx, tx, &Posting{
+			ServerID: me.ServerID,
+			Currency: models.CurrencyGold,
+			Amount:   sale.GoldEarned,
+			From:     SystemAccount(SystemOreSale),
+			To:       CharacterAccount(me.ID),
+			Reason:   "ore_sale",
+			Details:  map[string]interface{}{"ore_sold": sale.Sold},
+		})
+		if err != nil {
+			return err
+		}
+
+		for id, gold := range earned {
+			var mapID, x, y int
+			err := tx.QueryRow(ctx, "SELECT map_id, x, y FROM mining_nodes WHERE id = $1", id).Scan(&mapID, &x, &y)
+			if err != nil {
+				return fmt.Errorf("failed to get node location: %w", err)
+			}
+			tax, err := s.tax.Levy(ctx, tx, &TaxableIncome{
+				ServerID:    me.ServerID,
+				CharacterID: me.ID,
+				Activity:    models.TaxMining,
+				Amount:      gold,
+				MapID:       mapID,
+				X:           &x,
+				Y:           &y,
+			})
+			if err != nil {
+				return err
+			}
+			sale.TaxPaid += tax
+		}
+		return s.guilds.RecordActivity(ctx, tx, me.ID, models.GuildActivityOreSold, sale.Sold)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sale, nil
+}
+
+// ProcessMining refills nodes whose respawn is due and extracts due ore for
+// everyone mining.
+func (s *MiningService) ProcessMining(ctx context.Context) (int, error) {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE mining_nodes SET current_resources = max_resources, depleted_at = NULL, respawn_at = NULL
+		WHERE respawn_at <= NOW()
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to respawn mining nodes: %w", err)
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT character_id FROM character_mining
+		WHERE is_mining = true AND next_mine_at <= NOW()
+		ORDER BY next_mine_at
+		LIMIT $1
+	`, MiningSweepBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due miners: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan due miners: %w", err)
+	}
+
+	extracted := 0
+	for _, id := range ids {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			// Same lock order as the request path: character, then profile
+			if _, err := lockCharacters(ctx, tx, id); err != nil {
+				return err
+			}
+			st, err := s.lockMining(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			mined, err := settleMining(ctx, tx, st, time.Now())
+			extracted += len(mined)
+			return err
+		})
+		if err != nil {
+			return extracted, fmt.Errorf("failed to settle mining for %s: %w", id, err)
+		}
+	}
+	return extracted, nil
+}
+
+// RunSweeper respawns nodes and extracts due ore every interval until ctx is
+// cancelled
+func (s *MiningService) RunSweeper(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "mining sweeper", interval, s.ProcessMining)
+}
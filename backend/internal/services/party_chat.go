@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// partyChatChannel is the chat_messages channel_type of party chat; the
+// channel_id is the party id
+const partyChatChannel = "party"
+
+// SendChat posts to the acting character's party chat
+func (s *PartyService) SendChat(ctx context.Context, accountID, characterID uuid.UUID, message string) (*models.PartyChatMessage, error) {
+	message = strings.TrimSpace(message)
+	if n := utf8.RuneCountInString(message); n == 0 || n > GuildChatMaxLength {
+		return nil, ErrInvalidChatMessage
+	}
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	partyID, err := partyIDOf(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if partyID == nil {
+		return nil, ErrNotInParty
+	}
+
+	msg := &models.PartyChatMessage{
+		SenderID:   c.ID,
+		SenderName: c.Name,
+		Message:    message,
+	}
+	err = s.db.Pool.QueryRow(ctx, `
+		INSERT INTO chat_messages (server_id, channel_type, channel_id, sender_id, sender_name, message)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, sent_at
+	`, c.ServerID, partyChatChannel, partyID.String(), c.ID, c.Name, message).Scan(&msg.ID, &msg.SentAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send chat message: %w", err)
+	}
+	return msg, nil
+}
+
+// GetChat returns the latest messages of the acting character's party
+// chat, newest first
+func (s *PartyService) GetChat(ctx context.Context, accountID, characterID uuid.UUID, limit, offset int) ([]*models.PartyChatMessage, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	partyID, err := partyIDOf(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if partyID == nil {
+		return nil, ErrNotInParty
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, sender_id, sender_name, message, sent_at
+		FROM chat_messages
+		WHERE server_id = $1 AND channel_type = $2 AND channel_id = $3
+		ORDER BY sent_at DESC
+		LIMIT $4 OFFSET $5
+	`, c.ServerID, partyChatChannel, partyID.String(), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*models.PartyChatMessage
+	for rows.Next() {
+		var msg models.PartyChatMessage
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.SenderName, &msg.Message, &msg.SentAt); err != nil {
+			return nil, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		messages = append(messages, &msg)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Party EXP sharing. EXP a member earns is shared with the members in range:
+// online, on the same map and within PartyShareRange of the earner. Every
+// member in range past the first adds PartyExpMemberBonus percent to the
+// pool, and members of allied guilds fighting together add
+// PartyAllyExpBonus more (8.2.1). The pool is split by level.
+const (
+	PartyShareRange     = 100
+	PartyExpMemberBonus = 10
+	PartyAllyExpBonus   = 10
+)
+
+// partyMemberInRange is a party member close enough to share in a reward
+type partyMemberInRange struct {
+	CharacterID uuid.UUID
+	Level       int
+	GuildID     *uuid.UUID
+}
+
+// membersInRange returns the members of a party in range of one of them,
+// that member included, in join order
+func membersInRange(ctx context.Context, q querier, partyID, characterID uuid.UUID) ([]*partyMemberInRange, error) {
+	rows, err := q.Query(ctx, `
+		SELECT c.id, c.level, c.guild_id
+		FROM party_members m
+		JOIN characters c ON c.id = m.character_id AND c.deleted_at IS NULL
+		JOIN characters e ON e.id = $2
+		WHERE m.party_id = $1
+		  AND (c.id = e.id OR (
+		      COALESCE(c.is_online, false) AND c.current_map_id = e.current_map_id
+		      AND (c.position_x - e.position_x) * (c.position_x - e.position_x)
+		        + (c.position_y - e.position_y) * (c.position_y - e.position_y) <= $3::int * $3::int
+		  ))
+		ORDER BY m.joined_at, m.character_id
+	`, partyID, characterID, PartyShareRange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get party members in range: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*partyMemberInRange
+	for rows.Next() {
+		var m partyMemberInRange
+		if err := rows.Scan(&m.CharacterID, &m.Level, &m.GuildID); err != nil {
+			return nil, fmt.Errorf("failed to scan party member: %w", err)
+		}
+		members = append(members, &m)
+	}
+	return members, rows.Err()
+}
+
+// partyExpBonus returns the bonus in percent a group of members in range
+// adds to shared EXP
+func partyExpBonus(ctx context.Context, q querier, members []*partyMemberInRange) (int, error) {
+	bonus := PartyExpMemberBonus * (len(members) - 1)
+
+	var guilds []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, m := range members {
+		if m.GuildID != nil && !seen[*m.GuildID] {
+			seen[*m.GuildID] = true
+			guilds = append(guilds, *m.GuildID)
+		}
+	}
+	for i := range guilds {
+		for j := i + 1; j < len(guilds); j++ {
+			allied, err := alliedGuilds(ctx, q, guilds[i], guilds[j])
+			if err != nil {
+				return 0, err
+			}
+			if allied {
+				return bonus + PartyAllyExpBonus, nil
+			}
+		}
+	}
+	return bonus, nil
+}
+
+// ShareExp grants EXP a character earned, shared with their party members
+// in range. A member's cut is the pool times their level over the levels
+// of everyone in range; what rounding leaves over goes to the earner.
+// Grants are made in character id order. Without a party the earner gets
+// it all.
+func (s *PartyService) ShareExp(ctx context.Context, tx pgx.Tx, characterID uuid.UUID, exp int) ([]*models.PartyExpShare, error) {
+	if exp <= 0 {
+		return nil, nil
+	}
+	partyID, err := partyIDOf(ctx, tx, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if partyID == nil {
+		if err := grantExp(ctx, tx, characterID, exp); err != nil {
+			return nil, err
+		}
+		return []*models.PartyExpShare{{CharacterID: characterID, Exp: exp}}, nil
+	}
+
+	members, err := membersInRange(ctx, tx, *partyID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	bonus, err := partyExpBonus(ctx, tx, members)
+	if err != nil {
+		return nil, err
+	}
+	pool := exp * (100 + bonus) / 100
+
+	totalLevel := 0
+	for _, m := range members {
+		totalLevel += max(1, m.Level)
+	}
+	shares := make([]*models.PartyExpShare, 0, len(members))
+	left := pool
+	var earner *models.PartyExpShare
+	for _, m := range members {
+		share := &models.PartyExpShare{CharacterID: m.CharacterID, Exp: pool * max(1, m.Level) / totalLevel}
+		left -= share.Exp
+		if m.CharacterID == characterID {
+			earner = share
+		}
+		shares = append(shares, share)
+	}
+	earner.Exp += left
+
+	sort.Slice(shares, func(i, j int) bool {
+		return bytes.Compare(shares[i].CharacterID[:], shares[j].CharacterID[:]) < 0
+	})
+	for _, share := range shares {
+		if err := grantExp(ctx, tx, share.CharacterID, share.Exp); err != nil {
+			return nil, err
+		}
+	}
+	return shares, nil
+}
+
+// AssignLoot picks who gets an item of a rarity a character looted. Items
+// of the party's roll rarity or better go to a random member in range.
+// Otherwise free for all leaves it with the looter, leader mode gives it to
+// the leader when in range and round robin to the next member in range.
+func (s *PartyService) AssignLoot(ctx context.Context, tx pgx.Tx, characterID uuid.UUID, rarity string) (uuid.UUID, error) {
+	partyID, err := partyIDOf(ctx, tx, characterID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if partyID == nil {
+		return characterID, nil
+	}
+	p, err := lockParty(ctx, tx, *partyID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	members, err := membersInRange(ctx, tx, p.ID, characterID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if rarityOrder[rarity] >= rarityOrder[p.MinRollRarity] {
+		return members[rand.Intn(len(members))].CharacterID, nil
+	}
+	switch p.LootMode {
+	case models.LootLeader:
+		for _, m := range members {
+			if m.CharacterID == p.LeaderID {
+				return m.CharacterID, nil
+			}
+		}
+	case models.LootRoundRobin:
+		var position int
+		err := tx.QueryRow(ctx, `
+			UPDATE parties SET round_robin_position = COALESCE(round_robin_position, 0) + 1
+			WHERE id = $1
+			RETURNING round_robin_position - 1
+		`, p.ID).Scan(&position)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to advance party loot: %w", err)
+		}
+		return members[position%len(members)].CharacterID, nil
+	}
+	return characterID, nil
+}
+
+// RewardKill pays out a monster kill the game server reports: the EXP is
+// shared with the killer's party in range and every drop is assigned by the
+// party's loot mode, mailed when the winner's bag is full.
+func (s *PartyService) RewardKill(ctx context.Context, characterID uuid.UUID, report *models.KillReport) (*models.KillRewards, error) {
+	if report.Exp < 0 {
+		return nil, ErrInvalidKillReport
+	}
+	for _, d := range report.Drops {
+		if d.Quantity <= 0 {
+			return nil, ErrInvalidKillReport
+		}
+	}
+
+	rewards := &models.KillRewards{Exp: []*models.PartyExpShare{}, Loot: []*models.LootAward{}}
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		// The whole party before the party row, as the rewards may reach any member
+		ids := []uuid.UUID{characterID}
+		party, err := partyOf(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if party != nil {
+			for _, m := range party.Members {
+				if m.CharacterID != characterID {
+					ids = append(ids, m.CharacterID)
+				}
+			}
+		}
+		if _, err := lockCharacters(ctx, tx, ids...); err != nil {
+			return err
+		}
+		if err := checkNotInPrison(ctx, tx, characterID); err != nil {
+			return err
+		}
+
+		shares, err := s.ShareExp(ctx, tx, characterID, report.Exp)
+		if err != nil {
+			return err
+		}
+		if shares != nil {
+			rewards.Exp = shares
+		}
+
+		for i := range report.Drops {
+			stack := &report.Drops[i]
+			var name, rarity string
+			err := tx.QueryRow(ctx, `
+				SELECT name, COALESCE(rarity, 'common')::text FROM item_definitions WHERE id = $1
+			`, stack.ItemDefinitionID).Scan(&name, &rarity)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrInvalidKillReport
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get dropped item: %w", err)
+			}
+			winner, err := s.AssignLoot(ctx, tx, characterID, rarity)
+			if err != nil {
+				return err
+			}
+			mailed, err := deliverItem(ctx, tx, winner, stack, "party_loot", "Loot: "+name)
+			if err != nil {
+				return err
+			}
+			rewards.Loot = append(rewards.Loot, &models.LootAward{
+				CharacterID: winner,
+				ItemID:      stack.ItemDefinitionID,
+				Quantity:    stack.Quantity,
+				Mailed:      mailed,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rewards, nil
+}
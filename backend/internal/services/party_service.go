@@ -0,0 +1,679 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrPartyNotFound         = errors.New("party not found")
+	ErrNotInParty            = errors.New("character is not in a party")
+	ErrAlreadyInParty        = errors.New("character is already in a party")
+	ErrPartyFull             = errors.New("party is full")
+	ErrNotPartyLeader        = errors.New("only the party leader can do this")
+	ErrNotPartyMember        = errors.New("character is not a member of this party")
+	ErrPartyNotPublic        = errors.New("party is not open to join")
+	ErrPartyKickSelf         = errors.New("leave the party instead of kicking yourself")
+	ErrAlreadyPartyLeader    = errors.New("character already leads the party")
+	ErrPartyInviteNotFound   = errors.New("party invite not found")
+	ErrAlreadyInvitedToParty = errors.New("character already has a pending invite from this party")
+	ErrInvalidLootMode       = errors.New("invalid loot mode")
+	ErrInvalidRollRarity     = errors.New("invalid item rarity")
+	ErrInvalidKillReport     = errors.New("invalid kill report")
+)
+
+// PartyInviteDuration is how long a party invite can be accepted
+const PartyInviteDuration = 10 * time.Minute
+
+// PartyService manages parties. Other services read party state through
+// PartyOf and SameParty, or partyOf inside their own transactions.
+//
+// Every change to a character's membership holds that character's row lock
+// and then the party row lock, in that order.
+type PartyService struct {
+	db *database.DB
+}
+
+func NewPartyService(db *database.DB) *PartyService {
+	return &PartyService{db: db}
+}
+
+const partyColumns = `p.id, p.server_id, p.leader_id, l.name, COALESCE(p.loot_distribution, 'free_for_all'),
+	COALESCE(p.min_item_rarity_for_roll, 'rare')::text, COALESCE(p.is_public, false),
+	COALESCE(p.max_members, 5), p.created_at`
+
+func scanParty(row pgx.Row) (*models.Party, error) {
+	var p models.Party
+	if err := row.Scan(&p.ID, &p.ServerID, &p.LeaderID, &p.LeaderName, &p.LootMode,
+		&p.MinRollRarity, &p.IsPublic, &p.MaxMembers, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// loadParty reads an active party with its members, row-locking the party
+// when forUpdate is set
+func loadParty(ctx context.Context, q querier, partyID uuid.UUID, forUpdate bool) (*models.Party, error) {
+	lock := ""
+	if forUpdate {
+		lock = "FOR UPDATE OF p"
+	}
+	p, err := scanParty(q.QueryRow(ctx, `
+		SELECT `+partyColumns+`
+		FROM parties p
+		JOIN characters l ON l.id = p.leader_id
+		WHERE p.id = $1 AND p.disbanded_at IS NULL
+		`+lock, partyID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPartyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get party: %w", err)
+	}
+	if p.Members, err = partyMembers(ctx, q, p.ID); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func getParty(ctx context.Context, q querier, partyID uuid.UUID) (*models.Party, error) {
+	return loadParty(ctx, q, partyID, false)
+}
+
+func lockParty(ctx context.Context, tx pgx.Tx, partyID uuid.UUID) (*models.Party, error) {
+	return loadParty(ctx, tx, partyID, true)
+}
+
+func partyMembers(ctx context.Context, q querier, partyID uuid.UUID) ([]*models.PartyMember, error) {
+	rows, err := q.Query(ctx, `
+		SELECT m.character_id, c.name, c.level, c.class, c.specialization, m.role,
+		       c.guild_id, c.current_map_id, COALESCE(c.is_online, false), m.joined_at
+		FROM party_members m
+		JOIN characters c ON c.id = m.character_id
+		WHERE m.party_id = $1
+		ORDER BY m.joined_at, m.character_id
+	`, partyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get party members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []*models.PartyMember{}
+	for rows.Next() {
+		var m models.PartyMember
+		if err := rows.Scan(&m.CharacterID, &m.Name, &m.Level, &m.Class, &m.Specialization, &m.Role,
+			&m.GuildID, &m.MapID, &m.IsOnline, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan party member: %w", err)
+		}
+		members = append(members, &m)
+	}
+	return members, rows.Err()
+}
+
+// partyIDOf returns the active party a character is in, or nil
+func partyIDOf(ctx context.Context, q querier, characterID uuid.UUID) (*uuid.UUID, error) {
+	var partyID uuid.UUID
+	err := q.QueryRow(ctx, `
+		SELECT m.party_id
+		FROM party_members m
+		JOIN parties p ON p.id = m.party_id AND p.disbanded_at IS NULL
+		WHERE m.character_id = $1
+	`, characterID).Scan(&partyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get party membership: %w", err)
+	}
+	return &partyID, nil
+}
+
+// partyOf returns the party a character is in with its members, or nil
+func partyOf(ctx context.Context, q querier, characterID uuid.UUID) (*models.Party, error) {
+	partyID, err := partyIDOf(ctx, q, characterID)
+	if err != nil || partyID == nil {
+		return nil, err
+	}
+	return getParty(ctx, q, *partyID)
+}
+
+// lockPartyOf locks the party of a locked character and fails with
+// ErrNotInParty when there is none
+func lockPartyOf(ctx context.Context, tx pgx.Tx, characterID uuid.UUID) (*models.Party, error) {
+	partyID, err := partyIDOf(ctx, tx, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if partyID == nil {
+		return nil, ErrNotInParty
+	}
+	return lockParty(ctx, tx, *partyID)
+}
+
+// requireNoParty fails with ErrAlreadyInParty when a character is in a party
+func requireNoParty(ctx context.Context, q querier, characterID uuid.UUID) error {
+	partyID, err := partyIDOf(ctx, q, characterID)
+	if err != nil {
+		return err
+	}
+	if partyID != nil {
+		return ErrAlreadyInParty
+	}
+	return nil
+}
+
+// addPartyMember puts a character into a locked party, taking the role of
+// their class
+func addPartyMember(ctx context.Context, tx pgx.Tx, p *models.Party, characterID uuid.UUID) error {
+	if len(p.Members) >= min(p.MaxMembers, models.PartyMaxMembers) {
+		return ErrPartyFull
+	}
+	var class models.CharacterClass
+	if err := tx.QueryRow(ctx, "SELECT class FROM characters WHERE id = $1", characterID).Scan(&class); err != nil {
+		return fmt.Errorf("failed to get character class: %w", err)
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO party_members (party_id, character_id, role) VALUES ($1, $2, $3)
+	`, p.ID, characterID, models.DungeonRoles[class])
+	if _, ok := uniqueViolation(err); ok {
+		return ErrAlreadyInParty
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add party member: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE party_invites SET status = 'cancelled', responded_at = NOW()
+		WHERE character_id = $1 AND status = 'pending'
+	`, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel party invites: %w", err)
+	}
+	return nil
+}
+
+// removePartyMember takes a character out of a locked party. The longest
+// standing member takes over from a leader who leaves, and a party left
+// empty is disbanded.
+func removePartyMember(ctx context.Context, tx pgx.Tx, p *models.Party, characterID uuid.UUID) error {
+	tag, err := tx.Exec(ctx, "DELETE FROM party_members WHERE party_id = $1 AND character_id = $2", p.ID, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to remove party member: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotPartyMember
+	}
+
+	var next *uuid.UUID
+	for _, m := range p.Members {
+		if m.CharacterID != characterID {
+			next = &m.CharacterID
+			break
+		}
+	}
+	if next == nil {
+		if _, err := tx.Exec(ctx, "UPDATE parties SET disbanded_at = NOW() WHERE id = $1", p.ID); err != nil {
+			return fmt.Errorf("failed to disband party: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE party_invites SET status = 'cancelled', responded_at = NOW()
+			WHERE party_id = $1 AND status = 'pending'
+		`, p.ID)
+		if err != nil {
+			return fmt.Errorf("failed to cancel party invites: %w", err)
+		}
+		return nil
+	}
+	if p.LeaderID == characterID {
+		if _, err := tx.Exec(ctx, "UPDATE parties SET leader_id = $2 WHERE id = $1", p.ID, *next); err != nil {
+			return fmt.Errorf("failed to pass party leadership: %w", err)
+		}
+	}
+	return nil
+}
+
+// PartyOf returns the party a character is in, or nil. Other services use
+// it for eligibility checks.
+func (s *PartyService) PartyOf(ctx context.Context, characterID uuid.UUID) (*models.Party, error) {
+	return partyOf(ctx, s.db.Pool, characterID)
+}
+
+// SameParty reports whether all the characters are in one party
+func (s *PartyService) SameParty(ctx context.Context, characterIDs ...uuid.UUID) (bool, error) {
+	var parties, members int
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT m.party_id), COUNT(*)
+		FROM party_members m
+		JOIN parties p ON p.id = m.party_id AND p.disbanded_at IS NULL
+		WHERE m.character_id = ANY($1)
+	`, characterIDs).Scan(&parties, &members)
+	if err != nil {
+		return false, fmt.Errorf("failed to check party: %w", err)
+	}
+	return parties == 1 && members == len(characterIDs), nil
+}
+
+// GetMyParty returns the acting character's party
+func (s *PartyService) GetMyParty(ctx context.Context, accountID, characterID uuid.UUID) (*models.Party, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	p, err := partyOf(ctx, s.db.Pool, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrNotInParty
+	}
+	return p, nil
+}
+
+// ListPublic returns the public parties on the acting character's server
+// that still have room, newest first
+func (s *PartyService) ListPublic(ctx context.Context, accountID, characterID uuid.UUID, limit, offset int) ([]*models.Party, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+partyColumns+`
+		FROM parties p
+		JOIN characters l ON l.id = p.leader_id
+		WHERE p.server_id = $1 AND p.is_public AND p.disbanded_at IS NULL
+		  AND (SELECT COUNT(*) FROM party_members m WHERE m.party_id = p.id) < LEAST(COALESCE(p.max_members, 5), $2)
+		ORDER BY p.created_at DESC
+		LIMIT $3 OFFSET $4
+	`, c.ServerID, models.PartyMaxMembers, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parties: %w", err)
+	}
+	defer rows.Close()
+
+	var parties []*models.Party
+	for rows.Next() {
+		p, err := scanParty(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan party: %w", err)
+		}
+		parties = append(parties, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, p := range parties {
+		if p.Members, err = partyMembers(ctx, s.db.Pool, p.ID); err != nil {
+			return nil, err
+		}
+	}
+	return parties, nil
+}
+
+// Create starts a party led by the acting character
+func (s *PartyService) Create(ctx context.Context, accountID, characterID uuid.UUID, req *models.CreatePartyRequest) (*models.Party, error) {
+	if req.LootMode == "" {
+		req.LootMode = models.LootFreeForAll
+	}
+	if !req.LootMode.Valid() {
+		return nil, ErrInvalidLootMode
+	}
+
+	var partyID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		if err := requireNoParty(ctx, tx, characterID); err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO parties (server_id, leader_id, loot_distribution, is_public, max_members)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, c.ServerID, characterID, req.LootMode, req.IsPublic, models.PartyMaxMembers).Scan(&partyID)
+		if err != nil {
+			return fmt.Errorf("failed to create party: %w", err)
+		}
+		p, err := lockParty(ctx, tx, partyID)
+		if err != nil {
+			return err
+		}
+		return addPartyMember(ctx, tx, p, characterID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getParty(ctx, s.db.Pool, partyID)
+}
+
+// Join enters a public party on the acting character's server without an
+// invite
+func (s *PartyService) Join(ctx context.Context, accountID, characterID, partyID uuid.UUID) (*models.Party, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		if err := requireNoParty(ctx, tx, characterID); err != nil {
+			return err
+		}
+		p, err := lockParty(ctx, tx, partyID)
+		if err != nil {
+			return err
+		}
+		if p.ServerID != c.ServerID {
+			return ErrPartyNotFound
+		}
+		if !p.IsPublic {
+			return ErrPartyNotPublic
+		}
+		return addPartyMember(ctx, tx, p, characterID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getParty(ctx, s.db.Pool, partyID)
+}
+
+const partyInviteColumns = `i.id, i.party_id, l.name, i.character_id, c.name, i.invited_by, COALESCE(ib.name, ''),
+	COALESCE(i.status, 'pending'), i.created_at, i.expires_at`
+
+const partyInviteJoins = `
+	JOIN parties p ON p.id = i.party_id
+	JOIN characters l ON l.id = p.leader_id
+	JOIN characters c ON c.id = i.character_id
+	LEFT JOIN characters ib ON ib.id = i.invited_by`
+
+func scanPartyInvite(row pgx.Row) (*models.PartyInvite, error) {
+	var i models.PartyInvite
+	err := row.Scan(&i.ID, &i.PartyID, &i.LeaderName, &i.CharacterID, &i.CharacterName, &i.InvitedBy, &i.InvitedByName,
+		&i.Status, &i.CreatedAt, &i.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// Invite asks a character on the same server who is in no party to join
+// the acting leader's party
+func (s *PartyService) Invite(ctx context.Context, accountID, characterID, targetID uuid.UUID) (*models.PartyInvite, error) {
+	if targetID == characterID {
+		return nil, ErrAlreadyInParty
+	}
+
+	var inviteID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockCharacters(ctx, tx, characterID, targetID)
+		if err != nil {
+			return err
+		}
+		if locked[characterID].AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		if locked[targetID].ServerID != locked[characterID].ServerID {
+			return ErrCharacterNotFound
+		}
+		p, err := lockPartyOf(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if p.LeaderID != characterID {
+			return ErrNotPartyLeader
+		}
+		if err := requireNoParty(ctx, tx, targetID); err != nil {
+			return err
+		}
+		if len(p.Members) >= min(p.MaxMembers, models.PartyMaxMembers) {
+			return ErrPartyFull
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE party_invites SET status = 'expired'
+			WHERE party_id = $1 AND character_id = $2 AND status = 'pending' AND expires_at <= NOW()
+		`, p.ID, targetID)
+		if err != nil {
+			return fmt.Errorf("failed to expire party invites: %w", err)
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO party_invites (party_id, character_id, invited_by, expires_at)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, p.ID, targetID, characterID, time.Now().Add(PartyInviteDuration)).Scan(&inviteID)
+		if _, ok := uniqueViolation(err); ok {
+			return ErrAlreadyInvitedToParty
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create party invite: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invite, err := scanPartyInvite(s.db.Pool.QueryRow(ctx, `
+		SELECT `+partyInviteColumns+`
+		FROM party_invites i`+partyInviteJoins+`
+		WHERE i.id = $1
+	`, inviteID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get party invite: %w", err)
+	}
+	return invite, nil
+}
+
+// ListMyInvites returns the acting character's open party invites
+func (s *PartyService) ListMyInvites(ctx context.Context, accountID, characterID uuid.UUID) ([]*models.PartyInvite, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+partyInviteColumns+`
+		FROM party_invites i`+partyInviteJoins+`
+		WHERE i.character_id = $1 AND i.status = 'pending' AND i.expires_at > NOW()
+		  AND p.disbanded_at IS NULL
+		ORDER BY i.created_at DESC
+	`, characterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get party invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []*models.PartyInvite
+	for rows.Next() {
+		i, err := scanPartyInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan party invite: %w", err)
+		}
+		invites = append(invites, i)
+	}
+	return invites, rows.Err()
+}
+
+// AcceptInvite joins the party behind one of the acting character's invites
+func (s *PartyService) AcceptInvite(ctx context.Context, accountID, characterID, inviteID uuid.UUID) (*models.Party, error) {
+	var partyID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		if err := requireNoParty(ctx, tx, characterID); err != nil {
+			return err
+		}
+
+		err := tx.QueryRow(ctx, `
+			UPDATE party_invites SET status = 'accepted', responded_at = NOW()
+			WHERE id = $1 AND character_id = $2 AND status = 'pending' AND expires_at > NOW()
+			RETURNING party_id
+		`, inviteID, characterID).Scan(&partyID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPartyInviteNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to accept party invite: %w", err)
+		}
+		p, err := lockParty(ctx, tx, partyID)
+		if errors.Is(err, ErrPartyNotFound) {
+			return ErrPartyInviteNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return addPartyMember(ctx, tx, p, characterID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getParty(ctx, s.db.Pool, partyID)
+}
+
+// DeclineInvite turns down one of the acting character's invites
+func (s *PartyService) DeclineInvite(ctx context.Context, accountID, characterID, inviteID uuid.UUID) error {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return err
+	}
+	tag, err := s.db.Pool.Exec(ctx, `
+		UPDATE party_invites SET status = 'declined', responded_at = NOW()
+		WHERE id = $1 AND character_id = $2 AND status = 'pending'
+	`, inviteID, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to decline party invite: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPartyInviteNotFound
+	}
+	return nil
+}
+
+// Kick removes a member from the acting leader's party
+func (s *PartyService) Kick(ctx context.Context, accountID, characterID, targetID uuid.UUID) (*models.Party, error) {
+	if targetID == characterID {
+		return nil, ErrPartyKickSelf
+	}
+
+	var partyID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockCharacters(ctx, tx, characterID, targetID)
+		if err != nil {
+			return err
+		}
+		if locked[characterID].AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		p, err := lockPartyOf(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if p.LeaderID != characterID {
+			return ErrNotPartyLeader
+		}
+		partyID = p.ID
+		return removePartyMember(ctx, tx, p, targetID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getParty(ctx, s.db.Pool, partyID)
+}
+
+// Leave takes the acting character out of their party
+func (s *PartyService) Leave(ctx context.Context, accountID, characterID uuid.UUID) error {
+	return s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		p, err := lockPartyOf(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		return removePartyMember(ctx, tx, p, characterID)
+	})
+}
+
+// Transfer hands party leadership to another member
+func (s *PartyService) Transfer(ctx context.Context, accountID, characterID, targetID uuid.UUID) (*models.Party, error) {
+	if targetID == characterID {
+		return nil, ErrAlreadyPartyLeader
+	}
+
+	var partyID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		p, err := lockPartyOf(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if p.LeaderID != characterID {
+			return ErrNotPartyLeader
+		}
+		if !p.HasMember(targetID) {
+			return ErrNotPartyMember
+		}
+		partyID = p.ID
+
+		if _, err := tx.Exec(ctx, "UPDATE parties SET leader_id = $2 WHERE id = $1", p.ID, targetID); err != nil {
+			return fmt.Errorf("failed to transfer party: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getParty(ctx, s.db.Pool, partyID)
+}
+
+// UpdateSettings changes the loot mode, roll rarity and visibility of the
+// acting leader's party
+func (s *PartyService) UpdateSettings(ctx context.Context, accountID, characterID uuid.UUID, req *models.PartySettingsRequest) (*models.Party, error) {
+	if req.LootMode != nil && !req.LootMode.Valid() {
+		return nil, ErrInvalidLootMode
+	}
+	if req.MinRollRarity != nil {
+		if _, ok := rarityOrder[*req.MinRollRarity]; !ok {
+			return nil, ErrInvalidRollRarity
+		}
+	}
+
+	var partyID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		p, err := lockPartyOf(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if p.LeaderID != characterID {
+			return ErrNotPartyLeader
+		}
+		partyID = p.ID
+
+		_, err = tx.Exec(ctx, `
+			UPDATE parties SET
+				loot_distribution = COALESCE($2, loot_distribution),
+				min_item_rarity_for_roll = COALESCE($3::item_rarity, min_item_rarity_for_roll),
+				is_public = COALESCE($4, is_public)
+			WHERE id = $1
+		`, p.ID, req.LootMode, req.MinRollRarity, req.IsPublic)
+		if err != nil {
+			return fmt.Errorf("failed to update party settings: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getParty(ctx, s.db.Pool, partyID)
+}
@@ -0,0 +1,864 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInvalidPrisonEvent  = errors.New("invalid prison event type")
+	ErrNoOpenPrisonEvent   = errors.New("no prison event is open for sign-up")
+	ErrAlreadyJoinedEvent  = errors.New("already signed up for this event")
+	ErrPrisonEventNotFound = errors.New("prison event not found")
+	ErrNotInCourtyard      = errors.New("target is not a prisoner in your courtyard")
+)
+
+// Prison event schedule (9.2.2). Sign-ups open when a run starts and the run
+// is resolved when the window closes.
+const (
+	PrisonEscapeInterval     = 2 * time.Hour
+	PrisonEscapeSignupWindow = 15 * time.Minute
+	PrisonArenaInterval      = 30 * time.Minute
+	PrisonArenaSignupWindow  = 5 * time.Minute
+	PrisonBossWeekday        = time.Friday
+	PrisonBossHour           = 20
+	PrisonBossDuration       = 30 * time.Minute
+)
+
+// Prison event rewards
+const (
+	// A successful escape takes this much off the remaining sentence
+	EscapeSentenceCutPercent = 50
+	EscapeStageExp           = 500
+	// Every other escapee helps against the tunnel boss, up to the cap
+	EscapeGroupBonusPercent    = 2
+	EscapeGroupBonusCapPercent = 20
+
+	ArenaWinExp = 300
+
+	PrisonBossHP     = 5_000_000
+	PrisonBossRounds = 60   // rounds each participant fights the boss
+	PrisonBossExp    = 5000 // per participant, split by damage
+
+	PrisonEventBatchSize = 50
+)
+
+// Escape stages are tunnel, obstacles, boss and exit. escapeStageChances[i]
+// is the percent chance of clearing stage i; clearing all three escapes.
+var escapeStageChances = [...]int{90, 70, 50}
+
+const escapeBossStage = 2
+
+// Prison-only reward items, seeded by migration 018
+const (
+	itemDungeonStone  = "Zindan Taşı"
+	itemDarkCrystal   = "Karanlık Kristal"
+	itemPrisonDiamond = "Mahkum Elması"
+	itemCursedOpal    = "Lanetli Opal"
+)
+
+type prisonEventTable struct {
+	events       string
+	participants string
+	// extra selects the type-specific columns scanned by scanPrisonEvent
+	extra string
+}
+
+var prisonEventTables = map[models.PrisonEventType]prisonEventTable{
+	models.PrisonEventEscape: {
+		events:       "prison_escape_events",
+		participants: "prison_escape_participants",
+		extra:        "e.successful_escapes, NULL::uuid, NULL::text, NULL::bigint, NULL::bigint, NULL::boolean",
+	},
+	models.PrisonEventArena: {
+		events:       "prison_arena_events",
+		participants: "prison_arena_participants",
+		extra:        "NULL::int, e.winner_id, (SELECT name FROM characters WHERE id = e.winner_id), NULL::bigint, NULL::bigint, NULL::boolean",
+	},
+	models.PrisonEventBoss: {
+		events:       "prison_boss_events",
+		participants: "prison_boss_participants",
+		extra:        "NULL::int, NULL::uuid, NULL::text, e.boss_hp, e.damage_dealt, e.defeated",
+	},
+}
+
+// prisonEventQuery selects events of type t matching where. $1 is the
+// character whose sign-up is reported in Joined.
+func prisonEventQuery(t models.PrisonEventType, where string) string {
+	tbl := prisonEventTables[t]
+	return `
+		SELECT e.id, e.server_id, '` + string(t) + `', e.started_at, e.ends_at, e.resolved_at, e.total_participants,
+		       EXISTS (SELECT 1 FROM ` + tbl.participants + ` p WHERE p.event_id = e.id AND p.character_id = $1),
+		       ` + tbl.extra + `
+		FROM ` + tbl.events + ` e
+		WHERE ` + where
+}
+
+func scanPrisonEvent(row pgx.Row) (*models.PrisonEvent, error) {
+	var e models.PrisonEvent
+	err := row.Scan(&e.ID, &e.ServerID, &e.Type, &e.StartedAt, &e.EndsAt, &e.ResolvedAt, &e.TotalParticipants, &e.Joined,
+		&e.SuccessfulEscapes, &e.WinnerID, &e.WinnerName, &e.BossHP, &e.DamageDealt, &e.Defeated)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// prisonEventSlot returns when the run of t covering now started
+func prisonEventSlot(t models.PrisonEventType, now time.Time) time.Time {
+	y, m, d := now.Date()
+	switch t {
+	case models.PrisonEventEscape:
+		every := int(PrisonEscapeInterval / time.Hour)
+		return time.Date(y, m, d, now.Hour()-now.Hour()%every, 0, 0, 0, now.Location())
+	case models.PrisonEventArena:
+		every := int(PrisonArenaInterval / time.Minute)
+		return time.Date(y, m, d, now.Hour(), now.Minute()-now.Minute()%every, 0, 0, now.Location())
+	}
+	back := (int(now.Weekday()) - int(PrisonBossWeekday) + 7) % 7
+	start := time.Date(y, m, d-back, PrisonBossHour, 0, 0, 0, now.Location())
+	if start.After(now) {
+		start = start.AddDate(0, 0, -7)
+	}
+	return start
+}
+
+// nextPrisonEvent returns when the next run of t starts
+func nextPrisonEvent(t models.PrisonEventType, now time.Time) time.Time {
+	slot := prisonEventSlot(t, now)
+	switch t {
+	case models.PrisonEventEscape:
+		return slot.Add(PrisonEscapeInterval)
+	case models.PrisonEventArena:
+		return slot.Add(PrisonArenaInterval)
+	}
+	return slot.AddDate(0, 0, 7)
+}
+
+func prisonEventWindow(t models.PrisonEventType) time.Duration {
+	switch t {
+	case models.PrisonEventEscape:
+		return PrisonEscapeSignupWindow
+	case models.PrisonEventArena:
+		return PrisonArenaSignupWindow
+	}
+	return PrisonBossDuration
+}
+
+// requireInPrison fails with ErrNotInPrison unless a sentence is running
+func requireInPrison(ctx context.Context, q querier, characterID uuid.UUID) error {
+	err := checkNotInPrison(ctx, q, characterID)
+	if errors.Is(err, ErrInPrison) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrNotInPrison
+}
+
+// GetEvents returns the prison events open on the acting character's server
+// and when the next run of each starts.
+func (s *PrisonService) GetEvents(ctx context.Context, accountID, characterID uuid.UUID) (*models.PrisonEventSchedule, error) {
+	me, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	schedule := &models.PrisonEventSchedule{
+		Open:         []*models.PrisonEvent{},
+		NextEscapeAt: nextPrisonEvent(models.PrisonEventEscape, now),
+		NextArenaAt:  nextPrisonEvent(models.PrisonEventArena, now),
+		NextBossAt:   nextPrisonEvent(models.PrisonEventBoss, now),
+	}
+	for _, t := range []models.PrisonEventType{models.PrisonEventEscape, models.PrisonEventArena, models.PrisonEventBoss} {
+		e, err := scanPrisonEvent(s.db.Pool.QueryRow(ctx, prisonEventQuery(t,
+			"e.server_id = $2 AND e.resolved_at IS NULL AND e.ends_at > NOW()"), characterID, me.ServerID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get prison events: %w", err)
+		}
+		schedule.Open = append(schedule.Open, e)
+	}
+	return schedule, nil
+}
+
+// JoinEvent signs the acting prisoner up for the open event of type t
+func (s *PrisonService) JoinEvent(ctx context.Context, accountID, characterID uuid.UUID, t models.PrisonEventType) (*models.PrisonEvent, error) {
+	tbl, ok := prisonEventTables[t]
+	if !ok {
+		return nil, ErrInvalidPrisonEvent
+	}
+
+	var event *models.PrisonEvent
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		me, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		if err := requireInPrison(ctx, tx, me.ID); err != nil {
+			return err
+		}
+
+		event, err = scanPrisonEvent(tx.QueryRow(ctx, prisonEventQuery(t,
+			"e.server_id = $2 AND e.resolved_at IS NULL AND e.ends_at > NOW() FOR UPDATE OF e"), me.ID, me.ServerID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoOpenPrisonEvent
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get prison event: %w", err)
+		}
+		if event.Joined {
+			return ErrAlreadyJoinedEvent
+		}
+
+		_, err = tx.Exec(ctx, `INSERT INTO `+tbl.participants+` (event_id, character_id) VALUES ($1, $2)`, event.ID, me.ID)
+		if err != nil {
+			return fmt.Errorf("failed to join prison event: %w", err)
+		}
+		_, err = tx.Exec(ctx, `UPDATE `+tbl.events+` SET total_participants = total_participants + 1 WHERE id = $1`, event.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update prison event: %w", err)
+		}
+		event.Joined = true
+		event.TotalParticipants++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// GetEventResults returns the participants of a prison event with their
+// results once it is resolved.
+func (s *PrisonService) GetEventResults(ctx context.Context, t models.PrisonEventType, eventID uuid.UUID) ([]*models.PrisonEventEntry, error) {
+	var query string
+	switch t {
+	case models.PrisonEventEscape:
+		query = `
+			SELECT p.character_id, c.name, p.stage_reached, p.success, p.boss_defeated,
+			       NULL::int, NULL::int, NULL::bigint, COALESCE(p.exp_earned, 0)
+			FROM prison_escape_participants p JOIN characters c ON c.id = p.character_id
+			WHERE p.event_id = $1
+			ORDER BY p.stage_reached DESC, c.name`
+	case models.PrisonEventArena:
+		query = `
+			SELECT p.character_id, c.name, NULL::int, NULL::boolean, NULL::boolean,
+			       p.wins, p.placement, NULL::bigint, COALESCE(p.exp_earned, 0)
+			FROM prison_arena_participants p JOIN characters c ON c.id = p.character_id
+			WHERE p.event_id = $1
+			ORDER BY p.placement NULLS LAST, p.wins DESC, c.name`
+	case models.PrisonEventBoss:
+		query = `
+			SELECT p.character_id, c.name, NULL::int, NULL::boolean, NULL::boolean,
+			       NULL::int, NULL::int, p.damage, COALESCE(p.exp_earned, 0)
+			FROM prison_boss_participants p JOIN characters c ON c.id = p.character_id
+			WHERE p.event_id = $1
+			ORDER BY p.damage DESC, c.name`
+	default:
+		return nil, ErrInvalidPrisonEvent
+	}
+
+	var exists bool
+	err := s.db.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM `+prisonEventTables[t].events+` WHERE id = $1)`, eventID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prison event: %w", err)
+	}
+	if !exists {
+		return nil, ErrPrisonEventNotFound
+	}
+
+	rows, err := s.db.Pool.Query(ctx, query, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event results: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.PrisonEventEntry
+	for rows.Next() {
+		var e models.PrisonEventEntry
+		if err := rows.Scan(&e.CharacterID, &e.Name, &e.StageReached, &e.Success, &e.BossDefeated,
+			&e.Wins, &e.Placement, &e.Damage, &e.ExpEarned); err != nil {
+			return nil, fmt.Errorf("failed to scan event result: %w", err)
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// GetRankings returns the courtyard PvP ranking of the acting character's
+// server for the current week, or the finished previous week.
+func (s *PrisonService) GetRankings(ctx context.Context, accountID, characterID uuid.UUID, previous bool, limit, offset int) ([]*models.PrisonRanking, error) {
+	me, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+
+	week := "date_trunc('week', NOW())::date"
+	if previous {
+		week = "(date_trunc('week', NOW()) - INTERVAL '7 days')::date"
+	}
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT r.character_id, c.name, c.level, r.kills, r.deaths, r.week_start::timestamptz, r.current_rank, r.title
+		FROM prison_pvp_rankings r
+		JOIN characters c ON c.id = r.character_id
+		WHERE r.server_id = $1 AND r.week_start = `+week+`
+		ORDER BY r.kills DESC, r.deaths, c.name
+		LIMIT $2 OFFSET $3
+	`, me.ServerID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prison rankings: %w", err)
+	}
+	defer rows.Close()
+
+	var rankings []*models.PrisonRanking
+	for rows.Next() {
+		var r models.PrisonRanking
+		if err := rows.Scan(&r.CharacterID, &r.Name, &r.Level, &r.Kills, &r.Deaths, &r.WeekStart, &r.Rank, &r.Title); err != nil {
+			return nil, fmt.Errorf("failed to scan prison ranking: %w", err)
+		}
+		rankings = append(rankings, &r)
+	}
+	return rankings, rows.Err()
+}
+
+// CourtyardFight fights another prisoner in the prison courtyard. Courtyard
+// fights carry no sentence and count towards the weekly ranking.
+func (s *PrisonService) CourtyardFight(ctx context.Context, accountID, characterID, targetID uuid.UUID) (*models.PvPResult, error) {
+	if characterID == targetID {
+		return nil, ErrNotInCourtyard
+	}
+
+	var result *models.PvPResult
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockCharacters(ctx, tx, characterID, targetID)
+		if err != nil {
+			return err
+		}
+		me, target := locked[characterID], locked[targetID]
+		if me == nil {
+			return ErrCharacterNotFound
+		}
+		if me.AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		if err := requireInPrison(ctx, tx, me.ID); err != nil {
+			return err
+		}
+		if target == nil || target.ServerID != me.ServerID {
+			return ErrNotInCourtyard
+		}
+		err = requireInPrison(ctx, tx, target.ID)
+		if errors.Is(err, ErrNotInPrison) {
+			return ErrNotInCourtyard
+		}
+		if err != nil {
+			return err
+		}
+
+		var mapID int
+		err = tx.QueryRow(ctx, `
+			SELECT a.current_map_id
+			FROM characters a
+			JOIN characters d ON d.current_map_id = a.current_map_id
+			JOIN maps m ON m.id = a.current_map_id
+			WHERE a.id = $1 AND d.id = $2 AND m.is_prison
+		`, me.ID, target.ID).Scan(&mapID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotInCourtyard
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find courtyard: %w", err)
+		}
+
+		if result, err = duel(ctx, tx, mapID, me.ID, target.ID); err != nil {
+			return err
+		}
+		return recordPvPResult(ctx, tx, s.karma, s.ledger, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// recordCourtyardFight counts a prison courtyard fight in this week's ranking
+func recordCourtyardFight(ctx context.Context, q querier, serverID int, winnerID, loserID uuid.UUID) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO prison_pvp_rankings (server_id, character_id, kills, deaths, week_start)
+		VALUES ($1, $2, 1, 0, date_trunc('week', NOW())::date), ($1, $3, 0, 1, date_trunc('week', NOW())::date)
+		ON CONFLICT (server_id, character_id, week_start) DO UPDATE SET
+			kills = prison_pvp_rankings.kills + EXCLUDED.kills,
+			deaths = prison_pvp_rankings.deaths + EXCLUDED.deaths
+	`, serverID, winnerID, loserID)
+	if err != nil {
+		return fmt.Errorf("failed to update prison ranking: %w", err)
+	}
+	return nil
+}
+
+// prisonActivity is a row of prison_activities for a finished activity
+type prisonActivity struct {
+	Type           string
+	OreMined       int
+	FishCaught     int
+	PvPKills       int
+	PvPDeaths      int
+	ArenaWins      int
+	EscapeProgress int
+	BossDamage     int64
+	Exp            int
+}
+
+// logPrisonActivity records what a prisoner gained from an activity against
+// their current sentence.
+func logPrisonActivity(ctx context.Context, q querier, characterID, recordID uuid.UUID, a *prisonActivity) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO prison_activities (character_id, prison_record_id, activity_type, ore_mined, fish_caught,
+			pvp_kills, pvp_deaths, arena_wins, escape_progress, boss_damage, exp_earned, ended_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+	`, characterID, recordID, a.Type, a.OreMined, a.FishCaught, a.PvPKills, a.PvPDeaths,
+		a.ArenaWins, a.EscapeProgress, a.BossDamage, a.Exp)
+	if err != nil {
+		return fmt.Errorf("failed to log prison activity: %w", err)
+	}
+	return nil
+}
+
+// logPrisonerActivity logs an activity against the character's running
+// sentence, if any.
+func logPrisonerActivity(ctx context.Context, q querier, characterID uuid.UUID, a *prisonActivity) error {
+	var recordID uuid.UUID
+	err := q.QueryRow(ctx, `
+		SELECT id FROM prison_records
+		WHERE character_id = $1 AND released_at IS NULL
+		ORDER BY entered_at DESC LIMIT 1
+	`, characterID).Scan(&recordID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get prison record: %w", err)
+	}
+	return logPrisonActivity(ctx, q, characterID, recordID, a)
+}
+
+// grantPrisonItem delivers a prison-only reward item by name
+func grantPrisonItem(ctx context.Context, q querier, characterID uuid.UUID, name string, quantity int) error {
+	var itemID int
+	if err := q.QueryRow(ctx, "SELECT id FROM item_definitions WHERE name = $1", name).Scan(&itemID); err != nil {
+		return ErrItemDefNotFound
+	}
+	_, err := deliverItem(ctx, q, characterID, &models.ItemStack{ItemDefinitionID: itemID, Quantity: quantity},
+		"prison_reward", "Prison reward: "+name)
+	return err
+}
+
+// eventParticipant is a signed-up character at resolution. RecordID is their
+// open prison record, nil if they were released before the event resolved.
+type eventParticipant struct {
+	CharacterID uuid.UUID
+	Power       float64
+	RecordID    *uuid.UUID
+}
+
+func loadEventParticipants(ctx context.Context, tx pgx.Tx, t models.PrisonEventType, eventID uuid.UUID) ([]*eventParticipant, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT c.id, c.level + COALESCE(c.total_attack, 0) + COALESCE(c.total_defense, 0),
+		       (SELECT r.id FROM prison_records r
+		        WHERE r.character_id = c.id AND r.released_at IS NULL
+		        ORDER BY r.entered_at DESC LIMIT 1)
+		FROM `+prisonEventTables[t].participants+` p
+		JOIN characters c ON c.id = p.character_id
+		WHERE p.event_id = $1
+		ORDER BY c.id
+		FOR UPDATE OF c
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load event participants: %w", err)
+	}
+	defer rows.Close()
+
+	var ps []*eventParticipant
+	for rows.Next() {
+		var p eventParticipant
+		var power int
+		if err := rows.Scan(&p.CharacterID, &power, &p.RecordID); err != nil {
+			return nil, fmt.Errorf("failed to scan event participant: %w", err)
+		}
+		p.Power = float64(max(power, 1))
+		ps = append(ps, &p)
+	}
+	return ps, rows.Err()
+}
+
+// prisonerIDs returns the participants who were still serving when the
+// event ran
+func prisonerIDs(ps []*eventParticipant) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, p := range ps {
+		if p.RecordID != nil {
+			ids = append(ids, p.CharacterID)
+		}
+	}
+	return ids
+}
+
+// resolveEscape runs every escapee through the tunnel. Those who get out
+// have their remaining sentence cut.
+func (s *PrisonService) resolveEscape(ctx context.Context, tx pgx.Tx, eventID uuid.UUID) error {
+	ps, err := loadEventParticipants(ctx, tx, models.PrisonEventEscape, eventID)
+	if err != nil {
+		return err
+	}
+	bossBonus := min(EscapeGroupBonusPercent*max(len(ps)-1, 0), EscapeGroupBonusCapPercent)
+
+	escaped := 0
+	for _, p := range ps {
+		stage, bossDefeated := 0, false
+		for p.RecordID != nil && stage < len(escapeStageChances) {
+			chance := escapeStageChances[stage]
+			if stage == escapeBossStage {
+				chance += bossBonus
+			}
+			if rand.Intn(100) >= chance {
+				break
+			}
+			bossDefeated = bossDefeated || stage == escapeBossStage
+			stage++
+		}
+		success := stage == len(escapeStageChances)
+		exp := stage * EscapeStageExp
+
+		_, err := tx.Exec(ctx, `
+			UPDATE prison_escape_participants SET stage_reached = $3, success = $4, boss_defeated = $5,
+				exp_earned = $6, completed_at = NOW()
+			WHERE event_id = $1 AND character_id = $2
+		`, eventID, p.CharacterID, stage, success, bossDefeated, exp)
+		if err != nil {
+			return fmt.Errorf("failed to record escape: %w", err)
+		}
+		if p.RecordID == nil {
+			continue
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE prison_records SET escape_attempts = COALESCE(escape_attempts, 0) + 1, escaped = escaped OR $2
+			WHERE id = $1
+		`, *p.RecordID, success)
+		if err != nil {
+			return fmt.Errorf("failed to record escape attempt: %w", err)
+		}
+		if success {
+			escaped++
+			_, err = tx.Exec(ctx, `
+				UPDATE characters SET prison_release_at = NOW() + (prison_release_at - NOW()) * $2::float8
+				WHERE id = $1 AND is_in_prison AND prison_release_at > NOW()
+			`, p.CharacterID, float64(100-EscapeSentenceCutPercent)/100)
+			if err != nil {
+				return fmt.Errorf("failed to shorten sentence: %w", err)
+			}
+		}
+
+		if err := grantExp(ctx, tx, p.CharacterID, exp); err != nil {
+			return err
+		}
+		err = logPrisonActivity(ctx, tx, p.CharacterID, *p.RecordID, &prisonActivity{
+			Type: "escape", EscapeProgress: stage, Exp: exp,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE prison_escape_events SET successful_escapes = $2, total_participants = $3 WHERE id = $1
+	`, eventID, escaped, len(ps))
+	if err != nil {
+		return fmt.Errorf("failed to update escape event: %w", err)
+	}
+	return s.guilds.RecordActivities(ctx, tx, prisonerIDs(ps), models.GuildActivityPrisonEvents, 1)
+}
+
+// resolveArena plays a single-elimination bracket in random order. Each bout
+// is won with probability proportional to power.
+func (s *PrisonService) resolveArena(ctx context.Context, tx pgx.Tx, eventID uuid.UUID) error {
+	ps, err := loadEventParticipants(ctx, tx, models.PrisonEventArena, eventID)
+	if err != nil {
+		return err
+	}
+	var alive []*eventParticipant
+	for _, p := range ps {
+		if p.RecordID != nil {
+			alive = append(alive, p)
+		}
+	}
+	if len(alive) < 2 {
+		return nil
+	}
+	fighters := alive
+
+	rand.Shuffle(len(alive), func(i, j int) { alive[i], alive[j] = alive[j], alive[i] })
+	wins := make(map[uuid.UUID]int)
+	placement := make(map[uuid.UUID]int)
+	for len(alive) > 1 {
+		place := (len(alive)+1)/2 + 1
+		var next []*eventParticipant
+		for i := 0; i < len(alive); i += 2 {
+			if i+1 == len(alive) {
+				next = append(next, alive[i])
+				continue
+			}
+			winner, loser := alive[i], alive[i+1]
+			if rand.Float64()*(winner.Power+loser.Power) >= winner.Power {
+				winner, loser = loser, winner
+			}
+			wins[winner.CharacterID]++
+			placement[loser.CharacterID] = place
+			next = append(next, winner)
+		}
+		alive = next
+	}
+	champion := alive[0].CharacterID
+	placement[champion] = 1
+
+	for _, p := range fighters {
+		id := p.CharacterID
+		exp := wins[id] * ArenaWinExp
+		_, err := tx.Exec(ctx, `
+			UPDATE prison_arena_participants SET wins = $3, placement = $4, exp_earned = $5
+			WHERE event_id = $1 AND character_id = $2
+		`, eventID, id, wins[id], placement[id], exp)
+		if err != nil {
+			return fmt.Errorf("failed to record arena result: %w", err)
+		}
+		if err := grantExp(ctx, tx, id, exp); err != nil {
+			return err
+		}
+		switch placement[id] {
+		case 1:
+			err = grantPrisonItem(ctx, tx, id, itemPrisonDiamond, 1)
+		case 2:
+			err = grantPrisonItem(ctx, tx, id, itemDungeonStone, 5)
+		}
+		if err != nil {
+			return err
+		}
+		err = logPrisonActivity(ctx, tx, id, *p.RecordID, &prisonActivity{Type: "arena", ArenaWins: wins[id], Exp: exp})
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE prison_arena_events SET winner_id = $2 WHERE id = $1", eventID, champion); err != nil {
+		return fmt.Errorf("failed to update arena event: %w", err)
+	}
+	return s.guilds.RecordActivities(ctx, tx, prisonerIDs(fighters), models.GuildActivityPrisonEvents, 1)
+}
+
+// resolveBoss has every participant fight the weekly boss. EXP is split by
+// damage, halved if the boss survives; a kill also drops crystals for all and
+// an opal for the top damage dealer.
+func (s *PrisonService) resolveBoss(ctx context.Context, tx pgx.Tx, eventID uuid.UUID) error {
+	var bossHP int64
+	if err := tx.QueryRow(ctx, "SELECT boss_hp FROM prison_boss_events WHERE id = $1", eventID).Scan(&bossHP); err != nil {
+		return fmt.Errorf("failed to get boss event: %w", err)
+	}
+
+	ps, err := loadEventParticipants(ctx, tx, models.PrisonEventBoss, eventID)
+	if err != nil {
+		return err
+	}
+	var fighters []*eventParticipant
+	for _, p := range ps {
+		if p.RecordID != nil {
+			fighters = append(fighters, p)
+		}
+	}
+
+	damage := make(map[uuid.UUID]int64, len(fighters))
+	var total int64
+	var top uuid.UUID
+	for _, p := range fighters {
+		d := int64(p.Power * PrisonBossRounds * (0.8 + rand.Float64()*0.4))
+		damage[p.CharacterID] = d
+		total += d
+		if top == uuid.Nil || d > damage[top] {
+			top = p.CharacterID
+		}
+	}
+	defeated := total > 0 && total >= bossHP
+
+	pool := PrisonBossExp * len(fighters)
+	if !defeated {
+		pool /= 2
+	}
+	for _, p := range fighters {
+		id := p.CharacterID
+		share := float64(damage[id]) / float64(total)
+		exp := int(float64(pool) * share)
+		_, err := tx.Exec(ctx, `
+			UPDATE prison_boss_participants SET damage = $3, exp_earned = $4
+			WHERE event_id = $1 AND character_id = $2
+		`, eventID, id, damage[id], exp)
+		if err != nil {
+			return fmt.Errorf("failed to record boss damage: %w", err)
+		}
+		if err := grantExp(ctx, tx, id, exp); err != nil {
+			return err
+		}
+		if defeated {
+			if err := grantPrisonItem(ctx, tx, id, itemDarkCrystal, 1+min(int(share*10), 4)); err != nil {
+				return err
+			}
+			if id == top {
+				if err := grantPrisonItem(ctx, tx, id, itemCursedOpal, 1); err != nil {
+					return err
+				}
+			}
+		}
+		err = logPrisonActivity(ctx, tx, id, *p.RecordID, &prisonActivity{Type: "boss", BossDamage: damage[id], Exp: exp})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE prison_boss_events SET damage_dealt = $2, defeated = $3 WHERE id = $1
+	`, eventID, total, defeated)
+	if err != nil {
+		return fmt.Errorf("failed to update boss event: %w", err)
+	}
+	return s.guilds.RecordActivities(ctx, tx, prisonerIDs(fighters), models.GuildActivityPrisonEvents, 1)
+}
+
+// scheduleEvents opens the current run of every prison event on each active
+// server, if its sign-up window has not passed yet.
+func (s *PrisonService) scheduleEvents(ctx context.Context, now time.Time) error {
+	for t, tbl := range prisonEventTables {
+		slot := prisonEventSlot(t, now)
+		endsAt := slot.Add(prisonEventWindow(t))
+		if !now.Before(endsAt) {
+			continue
+		}
+
+		var err error
+		if t == models.PrisonEventBoss {
+			_, err = s.db.Pool.Exec(ctx, `
+				INSERT INTO prison_boss_events (server_id, started_at, ends_at, boss_hp)
+				SELECT id, $1, $2, $3 FROM servers WHERE is_active
+				ON CONFLICT (server_id, started_at) DO NOTHING
+			`, slot, endsAt, int64(PrisonBossHP))
+		} else {
+			_, err = s.db.Pool.Exec(ctx, `
+				INSERT INTO `+tbl.events+` (server_id, started_at, ends_at)
+				SELECT id, $1, $2 FROM servers WHERE is_active
+				ON CONFLICT (server_id, started_at) DO NOTHING
+			`, slot, endsAt)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to schedule %s events: %w", t, err)
+		}
+	}
+	return nil
+}
+
+// finalizeRankings fixes the ranks and titles of finished courtyard weeks.
+// Rankings are kept per week, so a new week starts from zero.
+func (s *PrisonService) finalizeRankings(ctx context.Context) (int, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE prison_pvp_rankings r SET
+			current_rank = ranked.rn,
+			title = CASE
+				WHEN ranked.rn = 1 THEN 'Avlu Kralı'
+				WHEN ranked.rn <= 3 THEN 'Gardiyan'
+				WHEN ranked.rn <= 10 THEN 'Kabadayı'
+			END
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY server_id, week_start ORDER BY kills DESC, deaths) AS rn
+			FROM prison_pvp_rankings
+			WHERE week_start < date_trunc('week', NOW())::date
+			  AND week_start IN (
+			      SELECT DISTINCT week_start FROM prison_pvp_rankings
+			      WHERE current_rank IS NULL AND week_start < date_trunc('week', NOW())::date
+			  )
+		) ranked
+		WHERE r.id = ranked.id AND r.current_rank IS NULL
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to finalize prison rankings: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// ProcessEvents opens scheduled prison events, resolves those whose window
+// has closed and closes out finished ranking weeks.
+func (s *PrisonService) ProcessEvents(ctx context.Context) (int, error) {
+	if err := s.scheduleEvents(ctx, time.Now()); err != nil {
+		return 0, err
+	}
+
+	resolvers := map[models.PrisonEventType]func(context.Context, pgx.Tx, uuid.UUID) error{
+		models.PrisonEventEscape: s.resolveEscape,
+		models.PrisonEventArena:  s.resolveArena,
+		models.PrisonEventBoss:   s.resolveBoss,
+	}
+
+	processed := 0
+	for t, resolve := range resolvers {
+		tbl := prisonEventTables[t]
+		rows, err := s.db.Pool.Query(ctx, `
+			SELECT id FROM `+tbl.events+`
+			WHERE resolved_at IS NULL AND ends_at <= NOW()
+			ORDER BY ends_at
+			LIMIT $1
+		`, PrisonEventBatchSize)
+		if err != nil {
+			return processed, fmt.Errorf("failed to find due %s events: %w", t, err)
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return processed, fmt.Errorf("failed to scan due %s events: %w", t, err)
+		}
+
+		for _, id := range ids {
+			err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+				tag, err := tx.Exec(ctx, `
+					UPDATE `+tbl.events+` SET resolved_at = NOW() WHERE id = $1 AND resolved_at IS NULL
+				`, id)
+				if err != nil {
+					return fmt.Errorf("failed to resolve event: %w", err)
+				}
+				if tag.RowsAffected() == 0 {
+					return nil
+				}
+				processed++
+				return resolve(ctx, tx, id)
+			})
+			if err != nil {
+				return processed, fmt.Errorf("failed to resolve %s event %s: %w", t, id, err)
+			}
+		}
+	}
+
+	ranked, err := s.finalizeRankings(ctx)
+	return processed + ranked, err
+}
+
+// RunEvents drives the prison event schedule every interval until ctx is
+// cancelled.
+func (s *PrisonService) RunEvents(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "prison events", interval, s.ProcessEvents)
+}
@@ -0,0 +1,637 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInPrison            = errors.New("character is in prison")
+	ErrNotInPrison         = errors.New("character is not in prison")
+	ErrConfinedToPrison    = errors.New("prisoners cannot leave the prison until released")
+	ErrInvalidPrisonReason = errors.New("invalid prison reason")
+	ErrInvalidSentence     = errors.New("invalid sentence length")
+	ErrCheatSentenceTooLow = errors.New("exploit sentences are at least 24 hours")
+	ErrInvalidPvPResult    = errors.New("invalid pvp result")
+)
+
+// Jail sentences (9.2.1)
+const (
+	PrisonPvPLossStreakSentence = 10 * time.Minute
+	PrisonCaravanFailSentence   = 15 * time.Minute
+	PrisonCityPvPSentence       = 20 * time.Minute
+	PrisonHighInfamySentence    = 30 * time.Minute
+	PrisonCheatSentence         = 24 * time.Hour
+
+	// Consecutive PvP losses that land a character in prison
+	PvPLossStreakForJail = 5
+
+	PrisonSweepBatchSize = 100
+)
+
+// Death penalty: the share of EXP and carried gold a death costs, scaled by
+// DeathPenaltyMultiplier
+const (
+	DeathExpLossPercent  = 5
+	DeathGoldLossPercent = 2
+
+	SystemDeathPenalty = "death_penalty"
+)
+
+// prisonSentences is the standard sentence per reason
+var prisonSentences = map[models.PrisonReason]time.Duration{
+	models.PrisonPvPLossStreak: PrisonPvPLossStreakSentence,
+	models.PrisonCaravanFail:   PrisonCaravanFailSentence,
+	models.PrisonCityPvP:       PrisonCityPvPSentence,
+	models.PrisonHighInfamy:    PrisonHighInfamySentence,
+	models.PrisonCheat:         PrisonCheatSentence,
+}
+
+// freedomMedallionEffect is the consumable_effect type of the Freedom
+// Medallion, whose value is the percentage taken off the next sentence.
+const freedomMedallionEffect = "prison_sentence_reduction"
+
+type PrisonService struct {
+	db     *database.DB
+	ledger *LedgerService
+	guilds *GuildService
+	karma  *KarmaService
+}
+
+func NewPrisonService(db *database.DB, ledger *LedgerService, guilds *GuildService, karma *KarmaService) *PrisonService {
+	return &PrisonService{db: db, ledger: ledger, guilds: guilds, karma: karma}
+}
+
+// jailOrder describes a sentence handed to imprison
+type jailOrder struct {
+	Reason   models.PrisonReason
+	Details  string
+	Sentence time.Duration
+	JailedBy *uuid.UUID
+}
+
+const prisonRecordColumns = `id, character_id, server_id, reason, reason_details, sentence_minutes,
+	COALESCE(time_served_minutes, 0), COALESCE(reduction_percent, 0), jailed_by, released_by,
+	entered_at, release_at, released_at, COALESCE(escaped, false)`
+
+func scanPrisonRecord(row pgx.Row) (*models.PrisonRecord, error) {
+	var p models.PrisonRecord
+	err := row.Scan(&p.ID, &p.CharacterID, &p.ServerID, &p.Reason, &p.ReasonDetails, &p.SentenceMinutes,
+		&p.TimeServedMinutes, &p.ReductionPercent, &p.JailedBy, &p.ReleasedBy,
+		&p.EnteredAt, &p.ReleaseAt, &p.ReleasedAt, &p.Escaped)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// imprison jails a character and moves them to the prison map. A character
+// already in prison has the new sentence added to the current one. Except
+// for cheating, a Freedom Medallion in the bag is used up to shorten the
+// sentence.
+func imprison(ctx context.Context, q querier, characterID uuid.UUID, order *jailOrder) (*models.PrisonRecord, error) {
+	var serverID int
+	err := q.QueryRow(ctx, `
+		SELECT server_id FROM characters WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, characterID).Scan(&serverID)
+	if err != nil {
+		return nil, ErrCharacterNotFound
+	}
+
+	sentence := order.Sentence
+	reduction := 0
+	if order.Reason != models.PrisonCheat {
+		reduction, err = useFreedomMedallion(ctx, q, characterID)
+		if err != nil {
+			return nil, err
+		}
+		sentence -= sentence * time.Duration(reduction) / 100
+	}
+	minutes := max(int(sentence/time.Minute), 1)
+
+	var releaseAt time.Time
+	err = q.QueryRow(ctx, `
+		UPDATE characters SET
+			is_in_prison = true,
+			prison_release_at = CASE
+				WHEN is_in_prison AND prison_release_at > NOW() THEN prison_release_at
+				ELSE NOW()
+			END + make_interval(mins => $1),
+			prison_reason = $2,
+			pre_prison_map_id = CASE WHEN is_in_prison THEN pre_prison_map_id ELSE current_map_id END,
+			current_map_id = COALESCE((SELECT id FROM maps WHERE is_prison ORDER BY id LIMIT 1), current_map_id)
+		WHERE id = $3
+		RETURNING prison_release_at
+	`, minutes, order.Reason, characterID).Scan(&releaseAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to imprison character: %w", err)
+	}
+
+	var details *string
+	if order.Details != "" {
+		details = &order.Details
+	}
+	record, err := scanPrisonRecord(q.QueryRow(ctx, `
+		INSERT INTO prison_records (character_id, server_id, reason, reason_details, sentence_minutes,
+			release_at, reduction_percent, jailed_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+prisonRecordColumns,
+		characterID, serverID, order.Reason, details, minutes, releaseAt, reduction, order.JailedBy))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record prison sentence: %w", err)
+	}
+	return record, nil
+}
+
+// useFreedomMedallion consumes one Freedom Medallion from the character's bag
+// and returns its reduction percentage, or 0 when the character has none.
+func useFreedomMedallion(ctx context.Context, q querier, characterID uuid.UUID) (int, error) {
+	var inventoryID uuid.UUID
+	var quantity, percent int
+	err := q.QueryRow(ctx, `
+		SELECT ci.id, ci.quantity, COALESCE((d.consumable_effect->>'value')::int, 0)
+		FROM character_inventory ci
+		JOIN item_definitions d ON d.id = ci.item_definition_id
+		WHERE ci.character_id = $1 AND d.consumable_effect->>'type' = $2
+		ORDER BY ci.slot_number
+		LIMIT 1
+		FOR UPDATE OF ci
+	`, characterID, freedomMedallionEffect).Scan(&inventoryID, &quantity, &percent)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find freedom medallion: %w", err)
+	}
+
+	if quantity > 1 {
+		_, err = q.Exec(ctx, "UPDATE character_inventory SET quantity = quantity - 1 WHERE id = $1", inventoryID)
+	} else {
+		_, err = q.Exec(ctx, "DELETE FROM character_inventory WHERE id = $1", inventoryID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to use freedom medallion: %w", err)
+	}
+	return min(max(percent, 0), 100), nil
+}
+
+// release frees a prisoner, closing their open sentences and returning them
+// to the map they were jailed from, or the starting map if that is unknown. releasedBy is set for GM releases.
+func release(ctx context.Context, q querier, characterID uuid.UUID, releasedBy *uuid.UUID) error {
+	var served int
+	err := q.QueryRow(ctx, `
+		WITH closed AS (
+			UPDATE prison_records SET
+				released_at = NOW(),
+				time_served_minutes = LEAST(sentence_minutes, GREATEST(EXTRACT(EPOCH FROM NOW() - entered_at) / 60, 0)::int),
+				released_by = $2
+			WHERE character_id = $1 AND released_at IS NULL
+			RETURNING entered_at
+		)
+		SELECT COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(entered_at)) / 60, 0)::int FROM closed
+	`, characterID, releasedBy).Scan(&served)
+	if err != nil {
+		return fmt.Errorf("failed to close prison records: %w", err)
+	}
+
+	tag, err := q.Exec(ctx, `
+		UPDATE characters SET
+			is_in_prison = false,
+			prison_release_at = NULL,
+			prison_reason = NULL,
+			total_prison_time_minutes = COALESCE(total_prison_time_minutes, 0) + $2,
+			current_map_id = COALESCE(pre_prison_map_id, $3),
+			pre_prison_map_id = NULL
+		WHERE id = $1 AND is_in_prison
+	`, characterID, served, DefaultMapID)
+	if err != nil {
+		return fmt.Errorf("failed to release character: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotInPrison
+	}
+	return nil
+}
+
+// checkNotInPrison fails with ErrInPrison while a sentence is running
+func checkNotInPrison(ctx context.Context, q querier, characterID uuid.UUID) error {
+	var jailed bool
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE(is_in_prison AND prison_release_at > NOW(), false) FROM characters WHERE id = $1
+	`, characterID).Scan(&jailed)
+	if err != nil {
+		return ErrCharacterNotFound
+	}
+	if jailed {
+		return ErrInPrison
+	}
+	return nil
+}
+
+// sentenceFor returns the sentence a GM hands out for reason. minutes
+// overrides the standard length; exploit sentences cannot go below it.
+func sentenceFor(reason models.PrisonReason, minutes int) (time.Duration, error) {
+	sentence, ok := prisonSentences[reason]
+	if !ok {
+		return 0, ErrInvalidPrisonReason
+	}
+	if minutes < 0 {
+		return 0, ErrInvalidSentence
+	}
+	if minutes == 0 {
+		return sentence, nil
+	}
+	custom := time.Duration(minutes) * time.Minute
+	if reason == models.PrisonCheat && custom < PrisonCheatSentence {
+		return 0, ErrCheatSentenceTooLow
+	}
+	return custom, nil
+}
+
+// RecordPvPResult records a fight reported by the game server. Fights
+// resolved by this API record themselves.
+func (s *PrisonService) RecordPvPResult(ctx context.Context, result *models.PvPResult) error {
+	return s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return recordPvPResult(ctx, tx, s.karma, s.ledger, result)
+	})
+}
+
+// recordPvPResult logs a finished fight and hands out the sentences it
+// triggers: fighting inside a city, losing too many fights in a row and
+// dying while wanted. Fights in the prison courtyard carry no penalty and
+// count towards the weekly courtyard ranking instead; kills between the
+// sides of a territory war count towards the war. Killing an innocent, a
+// character without a red flag who is not a guild enemy, costs karma, and
+// the loser pays the death penalty.
+func recordPvPResult(ctx context.Context, tx pgx.Tx, karma *KarmaService, ledger *LedgerService, result *models.PvPResult) error {
+	if result.AttackerID == result.DefenderID {
+		return ErrInvalidPvPResult
+	}
+	if w := result.WinnerID; w != nil && *w != result.AttackerID && *w != result.DefenderID {
+		return ErrInvalidPvPResult
+	}
+
+	chars, err := lockCharacters(ctx, tx, result.AttackerID, result.DefenderID)
+	if err != nil {
+		return err
+	}
+	if len(chars) != 2 {
+		return ErrCharacterNotFound
+	}
+
+	var inCity, inPrison bool
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(is_safe_zone, false), COALESCE(is_prison, false) FROM maps WHERE id = $1
+	`, result.MapID).Scan(&inCity, &inPrison)
+	if err != nil {
+		return ErrInvalidPvPResult
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO pvp_logs (server_id, attacker_id, defender_id, map_id, winner_id,
+			attacker_level, defender_level, attacker_class, defender_class,
+			attacker_flag, defender_flag, duration_seconds, total_rounds)
+		SELECT a.server_id, a.id, d.id, $3, $4, a.level, d.level, a.class, d.class,
+		       CASE WHEN a.flag_expires_at IS NULL OR a.flag_expires_at > NOW() THEN a.flag END,
+		       CASE WHEN d.flag_expires_at IS NULL OR d.flag_expires_at > NOW() THEN d.flag END,
+		       $5, $6
+		FROM characters a, characters d
+		WHERE a.id = $1 AND d.id = $2
+	`, result.AttackerID, result.DefenderID, result.MapID, result.WinnerID, result.DurationSeconds, result.TotalRounds)
+	if err != nil {
+		return fmt.Errorf("failed to log pvp result: %w", err)
+	}
+
+	if inPrison {
+		if result.WinnerID == nil {
+			return nil
+		}
+		loserID := result.AttackerID
+		if *result.WinnerID == result.AttackerID {
+			loserID = result.DefenderID
+		}
+		return recordCourtyardFight(ctx, tx, chars[loserID].ServerID, *result.WinnerID, loserID)
+	}
+
+	if inCity {
+		_, err := imprison(ctx, tx, result.AttackerID, &jailOrder{
+			Reason:   models.PrisonCityPvP,
+			Details:  "attacked " + chars[result.DefenderID].Name + " inside a city",
+			Sentence: PrisonCityPvPSentence,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if result.WinnerID == nil {
+		return nil
+	}
+	loserID := result.AttackerID
+	if *result.WinnerID == result.AttackerID {
+		loserID = result.DefenderID
+	}
+
+	inWar, err := recordWarKill(ctx, tx, result.MapID, *result.WinnerID, loserID)
+	if err != nil || inWar {
+		return err
+	}
+
+	if *result.WinnerID == result.AttackerID {
+		innocent, err := innocentVictim(ctx, tx, result.AttackerID, loserID)
+		if err != nil {
+			return err
+		}
+		if innocent {
+			if err := karma.Apply(ctx, tx, result.AttackerID, models.KarmaInnocentKill, "pvp", nil); err != nil {
+				return err
+			}
+		}
+	}
+	if err := applyDeathPenalty(ctx, tx, ledger, loserID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE characters SET pvp_loss_streak = 0 WHERE id = $1", *result.WinnerID); err != nil {
+		return fmt.Errorf("failed to reset loss streak: %w", err)
+	}
+	var streak, infamy int
+	err = tx.QueryRow(ctx, `
+		UPDATE characters SET pvp_loss_streak = COALESCE(pvp_loss_streak, 0) + 1
+		WHERE id = $1
+		RETURNING pvp_loss_streak, COALESCE(infamy, 0)
+	`, loserID).Scan(&streak, &infamy)
+	if err != nil {
+		return fmt.Errorf("failed to update loss streak: %w", err)
+	}
+
+	if streak >= PvPLossStreakForJail {
+		_, err := imprison(ctx, tx, loserID, &jailOrder{
+			Reason:   models.PrisonPvPLossStreak,
+			Details:  fmt.Sprintf("%d pvp losses in a row", streak),
+			Sentence: PrisonPvPLossStreakSentence,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE characters SET pvp_loss_streak = 0 WHERE id = $1", loserID); err != nil {
+			return fmt.Errorf("failed to reset loss streak: %w", err)
+		}
+	}
+
+	return jailIfWanted(ctx, tx, loserID, infamy)
+}
+
+// innocentVictim reports whether a killer's victim was innocent: carrying no
+// red flag and not a member of an enemy guild
+func innocentVictim(ctx context.Context, q querier, killerID, victimID uuid.UUID) (bool, error) {
+	victim, err := loadFlagState(ctx, q, victimID, false)
+	if err != nil {
+		return false, err
+	}
+	if flag := victim.activeFlag(time.Now()); flag != nil && *flag == models.FlagRed {
+		return false, nil
+	}
+	enemy, err := enemyGuilds(ctx, q, killerID, victimID)
+	if err != nil {
+		return false, err
+	}
+	return !enemy, nil
+}
+
+// RecordDeath records a death outside PvP reported by the game server
+func (s *PrisonService) RecordDeath(ctx context.Context, characterID uuid.UUID) error {
+	return s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return recordDeath(ctx, tx, s.ledger, characterID)
+	})
+}
+
+// recordDeath charges the death penalty and jails a character who died
+// while wanted. PvP deaths are handled by recordPvPResult.
+func recordDeath(ctx context.Context, tx pgx.Tx, ledger *LedgerService, characterID uuid.UUID) error {
+	var infamy int
+	var inPrison bool
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(c.infamy, 0), COALESCE(m.is_prison, false)
+		FROM characters c
+		LEFT JOIN maps m ON m.id = c.current_map_id
+		WHERE c.id = $1 AND c.deleted_at IS NULL
+		FOR UPDATE OF c
+	`, characterID).Scan(&infamy, &inPrison)
+	if err != nil {
+		return ErrCharacterNotFound
+	}
+	if inPrison {
+		return nil
+	}
+	if err := applyDeathPenalty(ctx, tx, ledger, characterID); err != nil {
+		return err
+	}
+	return jailIfWanted(ctx, tx, characterID, infamy)
+}
+
+// applyDeathPenalty takes the EXP and gold a death costs a locked character,
+// twice as much for a red flag carrier (6.2)
+func applyDeathPenalty(ctx context.Context, tx pgx.Tx, ledger *LedgerService, characterID uuid.UUID) error {
+	st, err := loadFlagState(ctx, tx, characterID, false)
+	if err != nil {
+		return err
+	}
+	multiplier := DeathPenaltyMultiplier(st.activeFlag(time.Now()))
+
+	var exp, gold int64
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(exp, 0), COALESCE(gold, 0) FROM characters WHERE id = $1
+	`, characterID).Scan(&exp, &gold)
+	if err != nil {
+		return ErrCharacterNotFound
+	}
+
+	expLoss := int64(float64(exp) * DeathExpLossPercent / 100 * multiplier)
+	if expLoss > 0 {
+		_, err := tx.Exec(ctx, "UPDATE characters SET exp = GREATEST(exp - $2, 0) WHERE id = $1", characterID, expLoss)
+		if err != nil {
+			return fmt.Errorf("failed to take death exp: %w", err)
+		}
+	}
+	goldLoss := min(gold, int64(float64(gold)*DeathGoldLossPercent/100*multiplier))
+	if goldLoss <= 0 {
+		return nil
+	}
+	return ledger.Post(ctx, tx, &Posting{
+		ServerID: st.ServerID,
+		Currency: models.CurrencyGold,
+		Amount:   goldLoss,
+		From:     CharacterAccount(characterID),
+		To:       SystemAccount(SystemDeathPenalty),
+		Reason:   "death_penalty",
+		Details:  map[string]interface{}{"exp_lost": expLoss, "multiplier": multiplier},
+	})
+}
+
+// jailIfWanted jails a character who died with wanted-level infamy
+func jailIfWanted(ctx context.Context, q querier, characterID uuid.UUID, infamy int) error {
+	if infamy < models.WantedInfamy {
+		return nil
+	}
+	_, err := imprison(ctx, q, characterID, &jailOrder{
+		Reason:   models.PrisonHighInfamy,
+		Details:  fmt.Sprintf("died with %d infamy", infamy),
+		Sentence: PrisonHighInfamySentence,
+	})
+	return err
+}
+
+// releaseIfDue frees the character if their sentence has run out
+func (s *PrisonService) releaseIfDue(ctx context.Context, characterID uuid.UUID) (bool, error) {
+	released := false
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var due bool
+		err := tx.QueryRow(ctx, `
+			SELECT COALESCE(is_in_prison AND prison_release_at <= NOW(), false)
+			FROM characters WHERE id = $1
+			FOR UPDATE
+		`, characterID).Scan(&due)
+		if err != nil {
+			return ErrCharacterNotFound
+		}
+		if !due {
+			return nil
+		}
+		released = true
+		return release(ctx, tx, characterID, nil)
+	})
+	return released, err
+}
+
+// GetStatus returns the acting character's prison standing and open
+// sentences, releasing them first if their time is up.
+func (s *PrisonService) GetStatus(ctx context.Context, accountID, characterID uuid.UUID) (*models.PrisonStatus, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	if _, err := s.releaseIfDue(ctx, characterID); err != nil {
+		return nil, err
+	}
+
+	status := &models.PrisonStatus{CharacterID: characterID}
+	var reason *string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(c.is_in_prison, false), c.prison_reason, c.prison_release_at,
+		       COALESCE(c.pvp_loss_streak, 0), COALESCE(c.total_prison_time_minutes, 0),
+		       (SELECT COALESCE(SUM(ci.quantity), 0)
+		        FROM character_inventory ci
+		        JOIN item_definitions d ON d.id = ci.item_definition_id
+		        WHERE ci.character_id = c.id AND d.consumable_effect->>'type' = $2)
+		FROM characters c WHERE c.id = $1
+	`, characterID, freedomMedallionEffect).Scan(
+		&status.InPrison, &reason, &status.ReleaseAt,
+		&status.PvPLossStreak, &status.TotalPrisonMinutes, &status.FreedomMedallions,
+	)
+	if err != nil {
+		return nil, ErrCharacterNotFound
+	}
+	if !status.InPrison {
+		status.ReleaseAt = nil
+		return status, nil
+	}
+
+	if reason != nil {
+		r := models.PrisonReason(*reason)
+		status.Reason = &r
+	}
+	if status.ReleaseAt != nil {
+		status.RemainingSeconds = max(int64(time.Until(*status.ReleaseAt).Seconds()), 0)
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+prisonRecordColumns+`
+		FROM prison_records
+		WHERE character_id = $1 AND released_at IS NULL
+		ORDER BY entered_at
+	`, characterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prison records: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPrisonRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan prison record: %w", err)
+		}
+		status.Records = append(status.Records, p)
+	}
+	return status, rows.Err()
+}
+
+// GetHistory returns the acting character's sentences, newest first
+func (s *PrisonService) GetHistory(ctx context.Context, accountID, characterID uuid.UUID, limit, offset int) ([]*models.PrisonRecord, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+prisonRecordColumns+`
+		FROM prison_records
+		WHERE character_id = $1
+		ORDER BY entered_at DESC
+		LIMIT $2 OFFSET $3
+	`, characterID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prison history: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*models.PrisonRecord
+	for rows.Next() {
+		p, err := scanPrisonRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan prison record: %w", err)
+		}
+		records = append(records, p)
+	}
+	return records, rows.Err()
+}
+
+// ReleaseDue frees every prisoner whose sentence has run out
+func (s *PrisonService) ReleaseDue(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM characters
+		WHERE is_in_prison = true AND prison_release_at <= NOW()
+		ORDER BY prison_release_at
+		LIMIT $1
+	`, PrisonSweepBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due prisoners: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan due prisoners: %w", err)
+	}
+
+	freed := 0
+	for _, id := range ids {
+		released, err := s.releaseIfDue(ctx, id)
+		if err != nil {
+			return freed, fmt.Errorf("failed to release %s: %w", id, err)
+		}
+		if released {
+			freed++
+		}
+	}
+	return freed, nil
+}
+
+// RunReleaser frees due prisoners every interval until ctx is cancelled
+func (s *PrisonService) RunReleaser(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "prison releaser", interval, s.ReleaseDue)
+}
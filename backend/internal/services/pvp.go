@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// PvPDuelExchanges is how many exchanges a duel lasts before it is a draw
+const PvPDuelExchanges = 10
+
+// duelist is one side of a duel
+type duelist struct {
+	stats *models.CombatStats
+	hp    int64
+}
+
+func loadDuelist(ctx context.Context, q querier, characterID uuid.UUID) (*duelist, error) {
+	st, err := loadFlagState(ctx, q, characterID, false)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := combatStats(ctx, q, st)
+	if err != nil {
+		return nil, err
+	}
+	var hp int64
+	err = q.QueryRow(ctx, "SELECT GREATEST(COALESCE(max_hp, 1), 1) FROM characters WHERE id = $1", characterID).Scan(&hp)
+	if err != nil {
+		return nil, ErrCharacterNotFound
+	}
+	return &duelist{stats: stats, hp: hp}, nil
+}
+
+// duel fights two characters on a map with their effective stats. Both
+// start at full HP and trade blows, the faster first, until one falls; a
+// duel nobody wins within PvPDuelExchanges is a draw. The result still has
+// to be recorded.
+func duel(ctx context.Context, q querier, mapID int, attackerID, defenderID uuid.UUID) (*models.PvPResult, error) {
+	a, err := loadDuelist(ctx, q, attackerID)
+	if err != nil {
+		return nil, err
+	}
+	d, err := loadDuelist(ctx, q, defenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.PvPResult{MapID: mapID, AttackerID: attackerID, DefenderID: defenderID}
+
+	// The faster side strikes first, the attacker on a tie
+	first, second := a, d
+	firstID, secondID := attackerID, defenderID
+	if d.stats.Speed > a.stats.Speed {
+		first, second = d, a
+		firstID, secondID = defenderID, attackerID
+	}
+
+	rounds := 0
+	for exchange := 0; exchange < PvPDuelExchanges && result.WinnerID == nil; exchange++ {
+		rounds += DungeonAttackRounds
+		damage, _ := dungeonHit(first.stats.Attack, second.stats.Defense, first.stats.CritRate, 1)
+		if second.hp -= damage; second.hp <= 0 {
+			result.WinnerID = &firstID
+			break
+		}
+		damage, _ = dungeonHit(second.stats.Attack, first.stats.Defense, second.stats.CritRate, 1)
+		if first.hp -= damage; first.hp <= 0 {
+			result.WinnerID = &secondID
+		}
+	}
+	result.TotalRounds = &rounds
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrNotCharacterOwner = errors.New("character does not belong to this account")
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx so helpers can run
+// inside or outside a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// characterRef is the subset of a character row that game systems need when
+// validating and mutating state inside a transaction.
+type characterRef struct {
+	ID        uuid.UUID
+	AccountID uuid.UUID
+	ServerID  int
+	Name      string
+	Level     int
+	Gold      int64
+}
+
+const characterRefColumns = `id, account_id, server_id, name, level, gold`
+
+func scanCharacterRef(row pgx.Row) (*characterRef, error) {
+	var c characterRef
+	if err := row.Scan(&c.ID, &c.AccountID, &c.ServerID, &c.Name, &c.Level, &c.Gold); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// getOwnedCharacter loads a character and checks it belongs to accountID.
+func getOwnedCharacter(ctx context.Context, q querier, accountID, characterID uuid.UUID) (*characterRef, error) {
+	c, err := scanCharacterRef(q.QueryRow(ctx, `
+		SELECT `+characterRefColumns+`
+		FROM characters WHERE id = $1 AND deleted_at IS NULL
+	`, characterID))
+	if err != nil {
+		return nil, ErrCharacterNotFound
+	}
+	if c.AccountID != accountID {
+		return nil, ErrNotCharacterOwner
+	}
+	return c, nil
+}
+
+// lockCharacters row-locks the given characters in id order so concurrent
+// transactions touching the same pair cannot deadlock.
+func lockCharacters(ctx context.Context, tx pgx.Tx, ids ...uuid.UUID) (map[uuid.UUID]*characterRef, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT `+characterRefColumns+`
+		FROM characters WHERE id = ANY($1) AND deleted_at IS NULL
+		ORDER BY id
+		FOR UPDATE
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock characters: %w", err)
+	}
+	defer rows.Close()
+
+	locked := make(map[uuid.UUID]*characterRef, len(ids))
+	for rows.Next() {
+		c, err := scanCharacterRef(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan character: %w", err)
+		}
+		locked[c.ID] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, ok := locked[id]; !ok {
+			return nil, ErrCharacterNotFound
+		}
+	}
+	return locked, nil
+}
+
+// lockOwnedCharacter locks a single character and checks it belongs to accountID.
+func lockOwnedCharacter(ctx context.Context, tx pgx.Tx, accountID, characterID uuid.UUID) (*characterRef, error) {
+	locked, err := lockCharacters(ctx, tx, characterID)
+	if err != nil {
+		return nil, err
+	}
+	c := locked[characterID]
+	if c.AccountID != accountID {
+		return nil, ErrNotCharacterOwner
+	}
+	return c, nil
+}
+
+// grantExp adds EXP to a character
+func grantExp(ctx context.Context, q querier, characterID uuid.UUID, amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	_, err := q.Exec(ctx, "UPDATE characters SET exp = COALESCE(exp, 0) + $1 WHERE id = $2", amount, characterID)
+	if err != nil {
+		return fmt.Errorf("failed to grant exp: %w", err)
+	}
+	return nil
+}
+
+// uniqueViolation reports whether err is a unique constraint violation and
+// returns the violated constraint or index name.
+func uniqueViolation(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return pgErr.ConstraintName, true
+	}
+	return "", false
+}
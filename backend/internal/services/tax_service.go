@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNotGuildLeader = errors.New("only the guild leader can do this")
+
+const (
+	TaxReportDefaultDays = 7
+	TaxReportMaxDays     = 90
+)
+
+// Zone types that income is taxed in regardless of where the earner stands
+const (
+	ZoneTypeCaravanRoute    = "caravan_route"    // caravans pay passage
+	ZoneTypeDungeonEntrance = "dungeon_entrance" // dungeon clears pay the entrance's holder
+)
+
+type TaxService struct {
+	db     *database.DB
+	ledger *LedgerService
+}
+
+func NewTaxService(db *database.DB, ledger *LedgerService) *TaxService {
+	return &TaxService{db: db, ledger: ledger}
+}
+
+// TaxableIncome is gold a character has just been paid. Where it was earned
+// is MapID at X, Y; without coordinates any controlled zone of ZoneType on
+// the map applies, and with no MapID the payer's current position is used.
+type TaxableIncome struct {
+	ServerID      int
+	CharacterID   uuid.UUID
+	Activity      models.TaxActivity
+	Amount        int64
+	MapID         int
+	X, Y          *int
+	ZoneType      string
+	ReferenceType string
+	ReferenceID   *uuid.UUID
+}
+
+// controlledZone is a zone under a guild's current control
+type controlledZone struct {
+	ZoneID  int
+	GuildID uuid.UUID
+}
+
+// findControlledZone returns the controlled zone an income was earned in,
+// nil if the spot is not under any guild's control.
+func findControlledZone(ctx context.Context, q querier, in *TaxableIncome) (*controlledZone, error) {
+	mapID, x, y := in.MapID, in.X, in.Y
+	if mapID == 0 {
+		var px, py int
+		err := q.QueryRow(ctx, `
+			SELECT COALESCE(current_map_id, 0), COALESCE(position_x, 0), COALESCE(position_y, 0)
+			FROM characters WHERE id = $1
+		`, in.CharacterID).Scan(&mapID, &px, &py)
+		if err != nil {
+			return nil, ErrCharacterNotFound
+		}
+		x, y = &px, &py
+	}
+	var zoneType *string
+	if in.ZoneType != "" {
+		zoneType = &in.ZoneType
+	}
+
+	var z controlledZone
+	err := q.QueryRow(ctx, `
+		SELECT z.id, zc.guild_id
+		FROM map_zones z
+		JOIN zone_control zc ON zc.zone_id = z.id
+		WHERE z.map_id = $1 AND z.is_controllable
+		  AND (zc.control_expires_at IS NULL OR zc.control_expires_at > NOW())
+		  AND ($2::int IS NULL OR ($2 BETWEEN z.x_min AND z.x_max AND $3 BETWEEN z.y_min AND z.y_max))
+		  AND ($4::text IS NULL OR z.zone_type = $4)
+		  AND zc.server_id = $5
+		ORDER BY z.id
+		LIMIT 1
+	`, mapID, x, y, zoneType, in.ServerID).Scan(&z.ZoneID, &z.GuildID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find controlled zone: %w", err)
+	}
+	return &z, nil
+}
+
+// taxExempt reports whether a character belongs to the controlling guild or
+// one of its allies.
+func taxExempt(ctx context.Context, q querier, characterID, guildID uuid.UUID) (bool, error) {
+	var exempt bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM guild_members gm
+			WHERE gm.character_id = $1
+			  AND (gm.guild_id = $2 OR EXISTS(
+				SELECT 1 FROM guild_relations r
+				WHERE r.relation_type = 'ally' AND r.is_confirmed
+				  AND ((r.guild_id = gm.guild_id AND r.target_guild_id = $2)
+				    OR (r.guild_id = $2 AND r.target_guild_id = gm.guild_id))
+			  ))
+		)
+	`, characterID, guildID).Scan(&exempt)
+	if err != nil {
+		return false, fmt.Errorf("failed to check tax exemption: %w", err)
+	}
+	return exempt, nil
+}
+
+// Levy takes zone tax out of an income the character was just paid and moves
+// it to the controlling guild's treasury. It returns the tax taken, zero when
+// the zone is uncontrolled or the payer is exempt.
+func (s *TaxService) Levy(ctx context.Context, tx pgx.Tx, in *TaxableIncome) (int64, error) {
+	rate, ok := models.ZoneTaxRates[in.Activity]
+	if !ok || in.Amount <= 0 {
+		return 0, nil
+	}
+	tax := in.Amount * int64(rate) / 100
+	if tax <= 0 {
+		return 0, nil
+	}
+
+	zone, err := findControlledZone(ctx, tx, in)
+	if err != nil || zone == nil {
+		return 0, err
+	}
+	exempt, err := taxExempt(ctx, tx, in.CharacterID, zone.GuildID)
+	if err != nil || exempt {
+		return 0, err
+	}
+
+	err = s.ledger.Post(ctx, tx, &Posting{
+		ServerID:      in.ServerID,
+		Currency:      models.CurrencyGold,
+		Amount:        tax,
+		From:          CharacterAccount(in.CharacterID),
+		To:            GuildAccount(zone.GuildID),
+		Reason:        "zone_tax",
+		ReferenceType: in.ReferenceType,
+		ReferenceID:   in.ReferenceID,
+		Details: map[string]interface{}{
+			"activity": in.Activity,
+			"zone_id":  zone.ZoneID,
+			"gross":    in.Amount,
+			"rate":     rate,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var referenceType *string
+	if in.ReferenceType != "" {
+		referenceType = &in.ReferenceType
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO zone_tax_logs (zone_id, guild_id, character_id, activity, gross_amount, tax_rate, tax_amount,
+			reference_type, reference_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, zone.ZoneID, zone.GuildID, in.CharacterID, in.Activity, in.Amount, rate, tax, referenceType, in.ReferenceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to log zone tax: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE zone_control SET total_tax_collected = COALESCE(total_tax_collected, 0) + $2
+		WHERE zone_id = $1 AND guild_id = $3
+	`, zone.ZoneID, tax, zone.GuildID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update zone tax total: %w", err)
+	}
+	if err := logGuild(ctx, tx, zone.GuildID, "treasury_tax", &in.CharacterID, nil, map[string]interface{}{
+		"amount":   tax,
+		"activity": in.Activity,
+		"zone_id":  zone.ZoneID,
+	}); err != nil {
+		return 0, err
+	}
+	return tax, nil
+}
+
+// GetReport returns the tax collected in the acting character's guild's
+// zones over the last days, per zone and activity. Only the guild leader can
+// read it.
+func (s *TaxService) GetReport(ctx context.Context, accountID, characterID uuid.UUID, days int) (*models.ZoneTaxReport, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	if days <= 0 {
+		days = TaxReportDefaultDays
+	}
+	days = min(days, TaxReportMaxDays)
+
+	report := &models.ZoneTaxReport{
+		Since: time.Now().AddDate(0, 0, -days),
+		Rates: models.ZoneTaxRates,
+		Zones: []*models.ZoneTaxSummary{},
+	}
+	err := s.db.Pool.QueryRow(ctx, "SELECT id FROM guilds WHERE leader_id = $1 AND disbanded_at IS NULL", characterID).Scan(&report.GuildID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotGuildLeader
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild: %w", err)
+	}
+
+	// Zones the guild holds now or collected from during the period
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT z.id, z.name, z.map_id, zc.zone_id IS NOT NULL, zc.controlled_since, COALESCE(zc.total_tax_collected, 0)
+		FROM map_zones z
+		LEFT JOIN zone_control zc ON zc.zone_id = z.id AND zc.guild_id = $1
+		WHERE zc.zone_id IS NOT NULL
+		   OR EXISTS(SELECT 1 FROM zone_tax_logs l WHERE l.zone_id = z.id AND l.guild_id = $1 AND l.created_at >= $2)
+		ORDER BY z.id
+	`, report.GuildID, report.Since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild zones: %w", err)
+	}
+	zones := make(map[int]*models.ZoneTaxSummary)
+	for rows.Next() {
+		z := &models.ZoneTaxSummary{Activities: []*models.TaxActivityTotal{}}
+		if err := rows.Scan(&z.ZoneID, &z.ZoneName, &z.MapID, &z.Controlled, &z.ControlledSince, &z.TotalTaxCollected); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan zone: %w", err)
+		}
+		zones[z.ZoneID] = z
+		report.Zones = append(report.Zones, z)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Pool.Query(ctx, `
+		SELECT zone_id, activity, COUNT(*), SUM(gross_amount), SUM(tax_amount)
+		FROM zone_tax_logs
+		WHERE guild_id = $1 AND created_at >= $2
+		GROUP BY zone_id, activity
+	`, report.GuildID, report.Since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get zone tax: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var zoneID int
+		var t models.TaxActivityTotal
+		if err := rows.Scan(&zoneID, &t.Activity, &t.Payments, &t.GrossAmount, &t.TaxAmount); err != nil {
+			return nil, fmt.Errorf("failed to scan zone tax: %w", err)
+		}
+		if z, ok := zones[zoneID]; ok {
+			z.Activities = append(z.Activities, &t)
+			z.PeriodTax += t.TaxAmount
+			report.PeriodTax += t.TaxAmount
+		}
+	}
+	for _, z := range report.Zones {
+		sort.Slice(z.Activities, func(i, j int) bool { return z.Activities[i].Activity < z.Activities[j].Activity })
+	}
+	return report, rows.Err()
+}
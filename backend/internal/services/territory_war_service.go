@@ -0,0 +1,900 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrZoneNotFound         = errors.New("zone not found")
+	ErrZoneNotControllable  = errors.New("zone cannot be controlled")
+	ErrOwnZone              = errors.New("guild already controls this zone")
+	ErrCannotAttackAlly     = errors.New("cannot declare war on an allied guild")
+	ErrWarAlreadyDeclared   = errors.New("guild has already declared a war for this window")
+	ErrZoneWarDeclared      = errors.New("a war has already been declared on this zone")
+	ErrWarNotFound          = errors.New("territory war not found")
+	ErrWarNotScheduled      = errors.New("territory war has already started")
+	ErrWarNotInProgress     = errors.New("territory war is not in progress")
+	ErrWarClosed            = errors.New("territory war is over")
+	ErrNotWarGuild          = errors.New("guild is not fighting in this war")
+	ErrAlreadyJoinedWar     = errors.New("already joined this war")
+	ErrNotWarParticipant    = errors.New("not a participant of this war")
+	ErrNotOnCapturePoint    = errors.New("character is not inside the contested zone")
+	ErrNotDeclaringAttacker = errors.New("only the attacking guild can cancel the war")
+	ErrNotWarEnemy          = errors.New("target is not fighting for the other side of this war")
+	ErrNotOnWarMap          = errors.New("both fighters must be on the war map")
+)
+
+// Territory war schedule (8.3.1). Wars are fought on Saturdays and must be
+// declared two days ahead. A guild alone on the capture point for
+// TerritoryCaptureHold wins; otherwise the defender keeps the zone.
+const (
+	TerritoryWarWeekday     = time.Saturday
+	TerritoryWarHour        = 20
+	TerritoryWarDuration    = 2 * time.Hour
+	TerritoryWarDeclareLead = 48 * time.Hour
+	TerritoryCaptureHold    = 10 * time.Minute
+	// TerritoryControlDuration is how long the winner controls the zone
+	TerritoryControlDuration = 7 * 24 * time.Hour
+	// TerritoryPresenceTTL is how long a presence report keeps a character
+	// on the point
+	TerritoryPresenceTTL = 30 * time.Second
+	// TerritoryWarWinExp is the guild EXP a won war is worth
+	TerritoryWarWinExp = 5000
+
+	TerritoryWarBatchSize = 50
+)
+
+type TerritoryWarService struct {
+	db     *database.DB
+	ledger *LedgerService
+	karma  *KarmaService
+}
+
+func NewTerritoryWarService(db *database.DB, ledger *LedgerService, karma *KarmaService) *TerritoryWarService {
+	return &TerritoryWarService{db: db, ledger: ledger, karma: karma}
+}
+
+// territoryWarWindow returns the first war window starting at least
+// TerritoryWarDeclareLead after now
+func territoryWarWindow(now time.Time) time.Time {
+	earliest := now.Add(TerritoryWarDeclareLead)
+	y, m, d := earliest.Date()
+	ahead := (int(TerritoryWarWeekday) - int(earliest.Weekday()) + 7) % 7
+	start := time.Date(y, m, d+ahead, TerritoryWarHour, 0, 0, 0, earliest.Location())
+	if start.Before(earliest) {
+		start = start.AddDate(0, 0, 7)
+	}
+	return start
+}
+
+const territoryWarColumns = `w.id, w.server_id, w.zone_id, z.name, z.map_id, w.attacker_guild_id, a.name,
+	w.defender_guild_id, d.name, w.declared_by, COALESCE(w.declared_at, w.scheduled_at), w.scheduled_at, w.ends_at,
+	w.started_at, w.ended_at, w.winner_guild_id, COALESCE(w.attacker_score, 0), COALESCE(w.defender_score, 0),
+	COALESCE(w.attacker_participants, 0), COALESCE(w.defender_participants, 0), COALESCE(w.status, 'scheduled'),
+	w.holder_guild_id, w.held_since`
+
+const territoryWarJoins = `
+	FROM guild_wars w
+	JOIN map_zones z ON z.id = w.zone_id
+	JOIN guilds a ON a.id = w.attacker_guild_id
+	LEFT JOIN guilds d ON d.id = w.defender_guild_id`
+
+func scanTerritoryWar(row pgx.Row) (*models.TerritoryWar, error) {
+	var w models.TerritoryWar
+	err := row.Scan(&w.ID, &w.ServerID, &w.ZoneID, &w.ZoneName, &w.MapID, &w.AttackerGuildID, &w.AttackerGuildName,
+		&w.DefenderGuildID, &w.DefenderGuildName, &w.DeclaredBy, &w.DeclaredAt, &w.ScheduledAt, &w.EndsAt,
+		&w.StartedAt, &w.EndedAt, &w.WinnerGuildID, &w.AttackerScore, &w.DefenderScore,
+		&w.AttackerParticipants, &w.DefenderParticipants, &w.Status,
+		&w.HolderGuildID, &w.HeldSince)
+	if err != nil {
+		return nil, err
+	}
+	setCaptureAt(&w)
+	return &w, nil
+}
+
+func setCaptureAt(w *models.TerritoryWar) {
+	w.CaptureAt = nil
+	if w.HolderGuildID != nil && w.HeldSince != nil {
+		at := w.HeldSince.Add(TerritoryCaptureHold)
+		w.CaptureAt = &at
+	}
+}
+
+// getTerritoryWar reads a war, locking its row when forUpdate is set. Guild
+// rows are locked before war rows.
+func getTerritoryWar(ctx context.Context, q querier, warID uuid.UUID, forUpdate bool) (*models.TerritoryWar, error) {
+	query := `SELECT ` + territoryWarColumns + territoryWarJoins + ` WHERE w.id = $1`
+	if forUpdate {
+		query += " FOR UPDATE OF w"
+	}
+	w, err := scanTerritoryWar(q.QueryRow(ctx, query, warID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWarNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get territory war: %w", err)
+	}
+	return w, nil
+}
+
+// zoneController returns the guild controlling a zone on a server, nil if
+// nobody does
+func zoneController(ctx context.Context, q querier, serverID, zoneID int) (*uuid.UUID, error) {
+	var guildID uuid.UUID
+	err := q.QueryRow(ctx, `
+		SELECT guild_id FROM zone_control
+		WHERE server_id = $1 AND zone_id = $2
+		  AND (control_expires_at IS NULL OR control_expires_at > NOW())
+	`, serverID, zoneID).Scan(&guildID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get zone controller: %w", err)
+	}
+	return &guildID, nil
+}
+
+// alliedGuilds reports whether two guilds have a confirmed alliance
+func alliedGuilds(ctx context.Context, q querier, guildID, otherID uuid.UUID) (bool, error) {
+	var allied bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM guild_relations
+			WHERE relation_type = 'ally' AND is_confirmed
+			  AND ((guild_id = $1 AND target_guild_id = $2) OR (guild_id = $2 AND target_guild_id = $1))
+		)
+	`, guildID, otherID).Scan(&allied)
+	if err != nil {
+		return false, fmt.Errorf("failed to check alliance: %w", err)
+	}
+	return allied, nil
+}
+
+// Declare schedules a war on a zone for the first window at least two days
+// away. Officers declare for their guild; the zone's controller defends it.
+func (s *TerritoryWarService) Declare(ctx context.Context, accountID, characterID uuid.UUID, zoneID int) (*models.TerritoryWar, error) {
+	scheduledAt := territoryWarWindow(time.Now())
+
+	var warID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		c, err := lockOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if !canManageMembers(m.Rank) {
+			return ErrInsufficientGuildRank
+		}
+		g, err := lockGuild(ctx, tx, m.GuildID)
+		if err != nil {
+			return err
+		}
+
+		var controllable bool
+		err = tx.QueryRow(ctx, "SELECT COALESCE(is_controllable, false) FROM map_zones WHERE id = $1", zoneID).Scan(&controllable)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrZoneNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get zone: %w", err)
+		}
+		if !controllable {
+			return ErrZoneNotControllable
+		}
+
+		defender, err := zoneController(ctx, tx, c.ServerID, zoneID)
+		if err != nil {
+			return err
+		}
+		if defender != nil {
+			if *defender == g.ID {
+				return ErrOwnZone
+			}
+			allied, err := alliedGuilds(ctx, tx, g.ID, *defender)
+			if err != nil {
+				return err
+			}
+			if allied {
+				return ErrCannotAttackAlly
+			}
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO guild_wars (server_id, attacker_guild_id, defender_guild_id, zone_id, declared_by, scheduled_at, ends_at, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, 'scheduled')
+			RETURNING id
+		`, c.ServerID, g.ID, defender, zoneID, characterID, scheduledAt, scheduledAt.Add(TerritoryWarDuration)).Scan(&warID)
+		if constraint, ok := uniqueViolation(err); ok {
+			if constraint == "idx_guild_wars_attacker_window" {
+				return ErrWarAlreadyDeclared
+			}
+			return ErrZoneWarDeclared
+		}
+		if err != nil {
+			return fmt.Errorf("failed to declare war: %w", err)
+		}
+
+		details := map[string]interface{}{"war_id": warID, "zone_id": zoneID, "scheduled_at": scheduledAt}
+		if err := logGuild(ctx, tx, g.ID, "war_declared", &characterID, defender, details); err != nil {
+			return err
+		}
+		if defender != nil {
+			return logGuild(ctx, tx, *defender, "war_declared_on", nil, &g.ID, details)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getTerritoryWar(ctx, s.db.Pool, warID, false)
+}
+
+// Cancel withdraws a declaration before the war starts
+func (s *TerritoryWarService) Cancel(ctx context.Context, accountID, characterID, warID uuid.UUID) error {
+	return s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		if !canManageMembers(m.Rank) {
+			return ErrInsufficientGuildRank
+		}
+		if _, err := lockGuild(ctx, tx, m.GuildID); err != nil {
+			return err
+		}
+		w, err := getTerritoryWar(ctx, tx, warID, true)
+		if err != nil {
+			return err
+		}
+		if w.AttackerGuildID != m.GuildID {
+			return ErrNotDeclaringAttacker
+		}
+		if w.Status != models.TerritoryWarScheduled {
+			return ErrWarNotScheduled
+		}
+
+		if _, err := tx.Exec(ctx, "UPDATE guild_wars SET status = 'cancelled', ended_at = NOW() WHERE id = $1", w.ID); err != nil {
+			return fmt.Errorf("failed to cancel war: %w", err)
+		}
+		details := map[string]interface{}{"war_id": w.ID, "zone_id": w.ZoneID}
+		if err := logGuild(ctx, tx, w.AttackerGuildID, "war_cancelled", &characterID, w.DefenderGuildID, details); err != nil {
+			return err
+		}
+		if w.DefenderGuildID != nil {
+			return logGuild(ctx, tx, *w.DefenderGuildID, "war_cancelled", nil, &w.AttackerGuildID, details)
+		}
+		return nil
+	})
+}
+
+// Join signs the acting character up to fight for their guild in a
+// scheduled or running war
+func (s *TerritoryWarService) Join(ctx context.Context, accountID, characterID, warID uuid.UUID) (*models.TerritoryWar, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		m, err := requireMembership(ctx, tx, characterID)
+		if err != nil {
+			return err
+		}
+		w, err := getTerritoryWar(ctx, tx, warID, true)
+		if err != nil {
+			return err
+		}
+		if w.Status != models.TerritoryWarScheduled && w.Status != models.TerritoryWarInProgress {
+			return ErrWarClosed
+		}
+		counter := "attacker_participants"
+		switch {
+		case m.GuildID == w.AttackerGuildID:
+		case w.DefenderGuildID != nil && m.GuildID == *w.DefenderGuildID:
+			counter = "defender_participants"
+		default:
+			return ErrNotWarGuild
+		}
+
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO guild_war_participants (war_id, character_id, guild_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (war_id, character_id) DO NOTHING
+		`, w.ID, characterID, m.GuildID)
+		if err != nil {
+			return fmt.Errorf("failed to join war: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrAlreadyJoinedWar
+		}
+		_, err = tx.Exec(ctx, "UPDATE guild_wars SET "+counter+" = COALESCE("+counter+", 0) + 1 WHERE id = $1", w.ID)
+		if err != nil {
+			return fmt.Errorf("failed to count war participant: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetWar(ctx, accountID, characterID, warID)
+}
+
+// ReportPresence puts the acting character on or off the capture point. A
+// character counts as present for TerritoryPresenceTTL after each report.
+func (s *TerritoryWarService) ReportPresence(ctx context.Context, accountID, characterID, warID uuid.UUID, onPoint bool) (*models.TerritoryWar, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+			return err
+		}
+		w, err := getTerritoryWar(ctx, tx, warID, true)
+		if err != nil {
+			return err
+		}
+		if w.Status != models.TerritoryWarInProgress {
+			return ErrWarNotInProgress
+		}
+
+		var participating bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(
+				SELECT 1 FROM guild_war_participants p
+				JOIN guild_members gm ON gm.character_id = p.character_id AND gm.guild_id = p.guild_id
+				WHERE p.war_id = $1 AND p.character_id = $2
+			)
+		`, w.ID, characterID).Scan(&participating)
+		if err != nil {
+			return fmt.Errorf("failed to get war participant: %w", err)
+		}
+		if !participating {
+			return ErrNotWarParticipant
+		}
+
+		if onPoint {
+			var inside bool
+			err := tx.QueryRow(ctx, `
+				SELECT EXISTS(
+					SELECT 1 FROM characters c
+					JOIN map_zones z ON z.id = $2
+					WHERE c.id = $1 AND c.current_map_id = z.map_id
+					  AND c.position_x BETWEEN z.x_min AND z.x_max
+					  AND c.position_y BETWEEN z.y_min AND z.y_max
+				)
+			`, characterID, w.ZoneID).Scan(&inside)
+			if err != nil {
+				return fmt.Errorf("failed to check character position: %w", err)
+			}
+			if !inside {
+				return ErrNotOnCapturePoint
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE guild_war_participants SET on_point = $3, last_presence_at = NOW()
+			WHERE war_id = $1 AND character_id = $2
+		`, w.ID, characterID, onPoint)
+		if err != nil {
+			return fmt.Errorf("failed to update war presence: %w", err)
+		}
+		return advanceCapture(ctx, tx, w, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetWar(ctx, accountID, characterID, warID)
+}
+
+// Attack fights a participant of the other side of a running war on the
+// war map. A kill counts towards the war and knocks the loser off the
+// capture point.
+func (s *TerritoryWarService) Attack(ctx context.Context, accountID, characterID, warID, targetID uuid.UUID) (*models.WarFight, error) {
+	fight := &models.WarFight{}
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockCharacters(ctx, tx, characterID, targetID)
+		if err != nil {
+			return err
+		}
+		if locked[characterID] == nil {
+			return ErrCharacterNotFound
+		}
+		if locked[characterID].AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		if err := checkNotInPrison(ctx, tx, characterID); err != nil {
+			return err
+		}
+		w, err := getTerritoryWar(ctx, tx, warID, true)
+		if err != nil {
+			return err
+		}
+		if w.Status != models.TerritoryWarInProgress {
+			return ErrWarNotInProgress
+		}
+
+		sides := map[uuid.UUID]uuid.UUID{}
+		rows, err := tx.Query(ctx, `
+			SELECT p.character_id, p.guild_id
+			FROM guild_war_participants p
+			JOIN guild_members gm ON gm.character_id = p.character_id AND gm.guild_id = p.guild_id
+			WHERE p.war_id = $1 AND p.character_id = ANY($2)
+		`, w.ID, []uuid.UUID{characterID, targetID})
+		if err != nil {
+			return fmt.Errorf("failed to get war participants: %w", err)
+		}
+		for rows.Next() {
+			var id, guildID uuid.UUID
+			if err := rows.Scan(&id, &guildID); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan war participant: %w", err)
+			}
+			sides[id] = guildID
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		mine, ok := sides[characterID]
+		if !ok {
+			return ErrNotWarParticipant
+		}
+		if theirs, ok := sides[targetID]; !ok || theirs == mine {
+			return ErrNotWarEnemy
+		}
+
+		var onMap bool
+		err = tx.QueryRow(ctx, `
+			SELECT COUNT(*) = 2 FROM characters WHERE id = ANY($1) AND current_map_id = $2
+		`, []uuid.UUID{characterID, targetID}, w.MapID).Scan(&onMap)
+		if err != nil {
+			return fmt.Errorf("failed to check character position: %w", err)
+		}
+		if !onMap {
+			return ErrNotOnWarMap
+		}
+
+		if fight.Result, err = duel(ctx, tx, w.MapID, characterID, targetID); err != nil {
+			return err
+		}
+		return recordPvPResult(ctx, tx, s.karma, s.ledger, fight.Result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if fight.War, err = s.GetWar(ctx, accountID, characterID, warID); err != nil {
+		return nil, err
+	}
+	return fight, nil
+}
+
+// advanceCapture moves the capture point of a locked, running war to now. A
+// guild holds the point while it is the only one with characters on it;
+// a contested or empty point resets the hold. Holders earn capture time.
+// Wars are won by ProcessWars, which locks the guilds first.
+func advanceCapture(ctx context.Context, tx pgx.Tx, w *models.TerritoryWar, now time.Time) error {
+	cutoff := now.Add(-TerritoryPresenceTTL)
+	rows, err := tx.Query(ctx, `
+		SELECT guild_id FROM guild_war_participants
+		WHERE war_id = $1 AND on_point AND last_presence_at > $2
+		GROUP BY guild_id
+	`, w.ID, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to get capture point presence: %w", err)
+	}
+	present, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return fmt.Errorf("failed to scan capture point presence: %w", err)
+	}
+	var holder *uuid.UUID
+	if len(present) == 1 {
+		holder = &present[0]
+	}
+
+	var pointUpdatedAt *time.Time
+	if err := tx.QueryRow(ctx, "SELECT point_updated_at FROM guild_wars WHERE id = $1", w.ID).Scan(&pointUpdatedAt); err != nil {
+		return fmt.Errorf("failed to get capture point: %w", err)
+	}
+
+	kept := holder != nil && w.HolderGuildID != nil && *holder == *w.HolderGuildID
+	updatedAt := now
+	heldSince := w.HeldSince
+	if kept && pointUpdatedAt != nil {
+		// Credit whole seconds only and carry the rest to the next update
+		secs := int(now.Sub(*pointUpdatedAt) / time.Second)
+		updatedAt = pointUpdatedAt.Add(time.Duration(secs) * time.Second)
+		if secs > 0 {
+			_, err := tx.Exec(ctx, `
+				UPDATE guild_war_participants SET capture_time_seconds = COALESCE(capture_time_seconds, 0) + $3
+				WHERE war_id = $1 AND guild_id = $2 AND on_point AND last_presence_at > $4
+			`, w.ID, *holder, secs, cutoff)
+			if err != nil {
+				return fmt.Errorf("failed to credit capture time: %w", err)
+			}
+		}
+	}
+	if !kept {
+		heldSince = nil
+		if holder != nil {
+			heldSince = &now
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE guild_wars SET holder_guild_id = $2, held_since = $3, point_updated_at = $4 WHERE id = $1
+	`, w.ID, holder, heldSince, updatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update capture point: %w", err)
+	}
+	w.HolderGuildID, w.HeldSince = holder, heldSince
+	setCaptureAt(w)
+	return nil
+}
+
+// recordWarKill credits a fight on a war map between participants of
+// opposite sides of a running war. The loser is knocked off the capture
+// point. It reports whether the fight was part of a war.
+func recordWarKill(ctx context.Context, tx pgx.Tx, mapID int, winnerID, loserID uuid.UUID) (bool, error) {
+	var warID, winnerGuildID uuid.UUID
+	err := tx.QueryRow(ctx, `
+		SELECT w.id, pw.guild_id
+		FROM guild_wars w
+		JOIN map_zones z ON z.id = w.zone_id
+		JOIN guild_war_participants pw ON pw.war_id = w.id AND pw.character_id = $2
+		JOIN guild_war_participants pl ON pl.war_id = w.id AND pl.character_id = $3
+		WHERE w.status = 'in_progress' AND z.map_id = $1 AND pw.guild_id <> pl.guild_id
+		LIMIT 1
+		FOR UPDATE OF w
+	`, mapID, winnerID, loserID).Scan(&warID, &winnerGuildID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to find territory war: %w", err)
+	}
+	w, err := getTerritoryWar(ctx, tx, warID, false)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE guild_war_participants SET kills = COALESCE(kills, 0) + 1 WHERE war_id = $1 AND character_id = $2
+	`, w.ID, winnerID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record war kill: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE guild_war_participants SET deaths = COALESCE(deaths, 0) + 1, on_point = false
+		WHERE war_id = $1 AND character_id = $2
+	`, w.ID, loserID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record war death: %w", err)
+	}
+	score := "defender_score"
+	if winnerGuildID == w.AttackerGuildID {
+		score = "attacker_score"
+	}
+	if _, err := tx.Exec(ctx, "UPDATE guild_wars SET "+score+" = COALESCE("+score+", 0) + 1 WHERE id = $1", w.ID); err != nil {
+		return false, fmt.Errorf("failed to update war score: %w", err)
+	}
+	return true, advanceCapture(ctx, tx, w, time.Now())
+}
+
+// startWar opens a locked, scheduled war. The zone's controller at the
+// start defends it; a war on a zone the attacker has taken meanwhile is
+// called off.
+func startWar(ctx context.Context, tx pgx.Tx, w *models.TerritoryWar, defender *uuid.UUID) error {
+	details := map[string]interface{}{"war_id": w.ID, "zone_id": w.ZoneID}
+	if defender != nil && *defender == w.AttackerGuildID {
+		if _, err := tx.Exec(ctx, "UPDATE guild_wars SET status = 'cancelled', ended_at = NOW() WHERE id = $1", w.ID); err != nil {
+			return fmt.Errorf("failed to cancel war: %w", err)
+		}
+		return logGuild(ctx, tx, w.AttackerGuildID, "war_cancelled", nil, nil, details)
+	}
+
+	// Sign-ups from a guild that no longer defends the zone are dropped
+	_, err := tx.Exec(ctx, `
+		DELETE FROM guild_war_participants
+		WHERE war_id = $1 AND guild_id <> $2 AND guild_id IS DISTINCT FROM $3
+	`, w.ID, w.AttackerGuildID, defender)
+	if err != nil {
+		return fmt.Errorf("failed to drop war participants: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE guild_wars SET status = 'in_progress', started_at = NOW(), defender_guild_id = $2,
+			defender_participants = (SELECT COUNT(*) FROM guild_war_participants WHERE war_id = $1 AND guild_id = $2),
+			holder_guild_id = NULL, held_since = NULL, point_updated_at = NOW()
+		WHERE id = $1
+	`, w.ID, defender)
+	if err != nil {
+		return fmt.Errorf("failed to start war: %w", err)
+	}
+	w.Status, w.DefenderGuildID = models.TerritoryWarInProgress, defender
+	return nil
+}
+
+// finishWar ends a locked war. The winner, if any, controls the zone for
+// TerritoryControlDuration from now. The war's guilds must be locked.
+func finishWar(ctx context.Context, tx pgx.Tx, w *models.TerritoryWar, winner *uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE guild_wars SET status = 'completed', ended_at = NOW(), winner_guild_id = $2 WHERE id = $1
+	`, w.ID, winner)
+	if err != nil {
+		return fmt.Errorf("failed to finish war: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "UPDATE guild_war_participants SET on_point = false WHERE war_id = $1", w.ID); err != nil {
+		return fmt.Errorf("failed to clear capture point: %w", err)
+	}
+
+	guilds := []uuid.UUID{w.AttackerGuildID}
+	if w.DefenderGuildID != nil {
+		guilds = append(guilds, *w.DefenderGuildID)
+	}
+	if winner != nil {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO zone_control (server_id, zone_id, guild_id, controlled_since, control_expires_at)
+			VALUES ($1, $2, $3, NOW(), $4)
+			ON CONFLICT (server_id, zone_id) DO UPDATE SET
+				guild_id = EXCLUDED.guild_id,
+				controlled_since = CASE WHEN zone_control.guild_id = EXCLUDED.guild_id
+					THEN zone_control.controlled_since ELSE NOW() END,
+				total_tax_collected = CASE WHEN zone_control.guild_id = EXCLUDED.guild_id
+					THEN zone_control.total_tax_collected ELSE 0 END,
+				control_expires_at = EXCLUDED.control_expires_at
+		`, w.ServerID, w.ZoneID, *winner, time.Now().Add(TerritoryControlDuration))
+		if err != nil {
+			return fmt.Errorf("failed to hand over zone: %w", err)
+		}
+	}
+
+	for _, id := range guilds {
+		action, won, lost := "war_lost", 0, 1
+		if winner != nil && *winner == id {
+			action, won, lost = "war_won", 1, 0
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE guilds SET total_wars_won = COALESCE(total_wars_won, 0) + $2,
+				total_wars_lost = COALESCE(total_wars_lost, 0) + $3,
+				total_zones_controlled = (
+					SELECT COUNT(*) FROM zone_control zc
+					WHERE zc.guild_id = guilds.id AND (zc.control_expires_at IS NULL OR zc.control_expires_at > NOW())
+				),
+				updated_at = NOW()
+			WHERE id = $1
+		`, id, won, lost)
+		if err != nil {
+			return fmt.Errorf("failed to update guild war record: %w", err)
+		}
+		if err := logGuild(ctx, tx, id, action, nil, nil, map[string]interface{}{
+			"war_id":  w.ID,
+			"zone_id": w.ZoneID,
+		}); err != nil {
+			return err
+		}
+		if won == 1 {
+			if err := addGuildExp(ctx, tx, id, TerritoryWarWinExp, "territory_war"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ProcessWars opens wars whose window has come, moves running capture
+// points on and ends wars that were captured or ran out of time
+func (s *TerritoryWarService) ProcessWars(ctx context.Context) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM guild_wars WHERE status = 'scheduled' AND scheduled_at <= NOW() ORDER BY scheduled_at LIMIT $1
+	`, TerritoryWarBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due wars: %w", err)
+	}
+	dueIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan due wars: %w", err)
+	}
+
+	processed := 0
+	for _, id := range dueIDs {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			w, err := getTerritoryWar(ctx, tx, id, false)
+			if err != nil {
+				return err
+			}
+			defender, err := zoneController(ctx, tx, w.ServerID, w.ZoneID)
+			if err != nil {
+				return err
+			}
+			guildIDs := []uuid.UUID{w.AttackerGuildID}
+			if defender != nil {
+				guildIDs = append(guildIDs, *defender)
+			}
+			if _, err := lockGuilds(ctx, tx, guildIDs...); err != nil {
+				return err
+			}
+			if w, err = getTerritoryWar(ctx, tx, id, true); err != nil {
+				return err
+			}
+			if w.Status != models.TerritoryWarScheduled {
+				return nil
+			}
+			processed++
+			return startWar(ctx, tx, w, defender)
+		})
+		if err != nil {
+			return processed, fmt.Errorf("failed to start war %s: %w", id, err)
+		}
+	}
+
+	rows, err = s.db.Pool.Query(ctx, `
+		SELECT id FROM guild_wars WHERE status = 'in_progress' ORDER BY ends_at LIMIT $1
+	`, TerritoryWarBatchSize)
+	if err != nil {
+		return processed, fmt.Errorf("failed to find running wars: %w", err)
+	}
+	runningIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return processed, fmt.Errorf("failed to scan running wars: %w", err)
+	}
+
+	for _, id := range runningIDs {
+		err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			w, err := getTerritoryWar(ctx, tx, id, false)
+			if err != nil {
+				return err
+			}
+			guildIDs := []uuid.UUID{w.AttackerGuildID}
+			if w.DefenderGuildID != nil {
+				guildIDs = append(guildIDs, *w.DefenderGuildID)
+			}
+			if _, err := lockGuilds(ctx, tx, guildIDs...); err != nil {
+				return err
+			}
+			if w, err = getTerritoryWar(ctx, tx, id, true); err != nil {
+				return err
+			}
+			if w.Status != models.TerritoryWarInProgress {
+				return nil
+			}
+
+			now := time.Now()
+			if err := advanceCapture(ctx, tx, w, now); err != nil {
+				return err
+			}
+			if w.CaptureAt != nil && !now.Before(*w.CaptureAt) {
+				processed++
+				return finishWar(ctx, tx, w, w.HolderGuildID)
+			}
+			if !now.Before(w.EndsAt) {
+				processed++
+				return finishWar(ctx, tx, w, w.DefenderGuildID)
+			}
+			return nil
+		})
+		if err != nil {
+			return processed, fmt.Errorf("failed to update war %s: %w", id, err)
+		}
+	}
+	return processed, nil
+}
+
+// RunWarScheduler opens, advances and closes territory wars every interval
+// until ctx is cancelled
+func (s *TerritoryWarService) RunWarScheduler(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "territory war scheduler", interval, s.ProcessWars)
+}
+
+// ListZones returns the controllable zones and their controllers on the
+// acting character's server
+func (s *TerritoryWarService) ListZones(ctx context.Context, accountID, characterID uuid.UUID) ([]*models.TerritoryZone, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT z.id, z.name, z.map_id, z.zone_type, zc.guild_id, g.name, zc.controlled_since, zc.control_expires_at
+		FROM map_zones z
+		LEFT JOIN zone_control zc ON zc.zone_id = z.id AND zc.server_id = $1
+		     AND (zc.control_expires_at IS NULL OR zc.control_expires_at > NOW())
+		LEFT JOIN guilds g ON g.id = zc.guild_id
+		WHERE z.is_controllable
+		ORDER BY z.id
+	`, c.ServerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list zones: %w", err)
+	}
+	defer rows.Close()
+
+	var zones []*models.TerritoryZone
+	for rows.Next() {
+		var z models.TerritoryZone
+		if err := rows.Scan(&z.ZoneID, &z.ZoneName, &z.MapID, &z.ZoneType, &z.GuildID, &z.GuildName,
+			&z.ControlledSince, &z.ControlExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan zone: %w", err)
+		}
+		zones = append(zones, &z)
+	}
+	return zones, rows.Err()
+}
+
+// ListWars returns the wars of the acting character's server, latest window
+// first
+func (s *TerritoryWarService) ListWars(ctx context.Context, accountID, characterID uuid.UUID, activeOnly bool, limit, offset int) ([]*models.TerritoryWar, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+territoryWarColumns+territoryWarJoins+`
+		WHERE w.server_id = $1 AND (NOT $2 OR w.status IN ('scheduled', 'in_progress'))
+		ORDER BY w.scheduled_at DESC, w.declared_at
+		LIMIT $3 OFFSET $4
+	`, c.ServerID, activeOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wars: %w", err)
+	}
+	defer rows.Close()
+
+	var wars []*models.TerritoryWar
+	for rows.Next() {
+		w, err := scanTerritoryWar(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan war: %w", err)
+		}
+		wars = append(wars, w)
+	}
+	return wars, rows.Err()
+}
+
+// GetWar returns a war of the acting character's server with its
+// participants
+func (s *TerritoryWarService) GetWar(ctx context.Context, accountID, characterID, warID uuid.UUID) (*models.TerritoryWar, error) {
+	c, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	w, err := getTerritoryWar(ctx, s.db.Pool, warID, false)
+	if err != nil {
+		return nil, err
+	}
+	if w.ServerID != c.ServerID {
+		return nil, ErrWarNotFound
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT p.character_id, c.name, p.guild_id, COALESCE(p.kills, 0), COALESCE(p.deaths, 0),
+		       COALESCE(p.capture_time_seconds, 0),
+		       COALESCE(p.on_point AND p.last_presence_at > $2, false), p.joined_at
+		FROM guild_war_participants p
+		JOIN characters c ON c.id = p.character_id
+		WHERE p.war_id = $1
+		ORDER BY p.kills DESC, p.capture_time_seconds DESC, p.joined_at
+	`, w.ID, time.Now().Add(-TerritoryPresenceTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get war participants: %w", err)
+	}
+	defer rows.Close()
+
+	w.Participants = []*models.TerritoryWarParticipant{}
+	for rows.Next() {
+		var p models.TerritoryWarParticipant
+		if err := rows.Scan(&p.CharacterID, &p.Name, &p.GuildID, &p.Kills, &p.Deaths,
+			&p.CaptureTimeSeconds, &p.OnPoint, &p.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan war participant: %w", err)
+		}
+		w.Participants = append(w.Participants, &p)
+	}
+	return w, rows.Err()
+}
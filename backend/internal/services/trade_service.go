@@ -0,0 +1,572 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"realm-of-conquest/internal/database"
+	"realm-of-conquest/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrTradeNotFound       = errors.New("trade not found")
+	ErrTradeNotPending     = errors.New("trade is no longer open")
+	ErrTradeNotAccepted    = errors.New("trade invitation has not been accepted")
+	ErrTradeAlreadyStarted = errors.New("trade invitation was already accepted")
+	ErrCannotTradeSelf     = errors.New("cannot trade with your own characters")
+	ErrAlreadyTrading      = errors.New("character already has an open trade")
+	ErrTradeTrustTooLow    = errors.New("trust score too low to trade")
+	ErrTradeRateLimited    = errors.New("too many trades in the last hour")
+	ErrTradeOfferLocked    = errors.New("offer is locked")
+	ErrTradeNotLocked      = errors.New("both offers must be locked before confirming")
+	ErrTooManyTradeItems   = errors.New("too many items in trade")
+	ErrTradeItemNotFound   = errors.New("trade item not found")
+	ErrInvalidGoldAmount   = errors.New("invalid gold amount")
+)
+
+const (
+	TradeInviteTimeout   = 2 * time.Minute
+	TradeSessionTimeout  = 10 * time.Minute // refreshed on every change
+	MinTradeTrustScore   = 100
+	MaxTradesPerHour     = 50
+	MaxTradeItemsPerSide = 12
+)
+
+type TradeService struct {
+	db     *database.DB
+	ledger *LedgerService
+}
+
+func NewTradeService(db *database.DB, ledger *LedgerService) *TradeService {
+	return &TradeService{db: db, ledger: ledger}
+}
+
+const tradeColumns = `
+	t.id, t.player1_id, c1.name, t.player2_id, c2.name, t.status,
+	t.player1_locked, t.player2_locked, t.player1_confirmed, t.player2_confirmed,
+	t.player1_gold, t.player2_gold, t.created_at, t.accepted_at, t.updated_at,
+	t.completed_at, t.expires_at`
+
+const tradeJoins = `
+	FROM player_trades t
+	JOIN characters c1 ON c1.id = t.player1_id
+	JOIN characters c2 ON c2.id = t.player2_id`
+
+func scanTrade(row pgx.Row) (*models.PlayerTrade, error) {
+	var t models.PlayerTrade
+	err := row.Scan(
+		&t.ID, &t.Player1ID, &t.Player1Name, &t.Player2ID, &t.Player2Name, &t.Status,
+		&t.Player1Locked, &t.Player2Locked, &t.Player1Confirmed, &t.Player2Confirmed,
+		&t.Player1Gold, &t.Player2Gold, &t.CreatedAt, &t.AcceptedAt, &t.UpdatedAt,
+		&t.CompletedAt, &t.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func loadTradeItems(ctx context.Context, q querier, t *models.PlayerTrade) error {
+	rows, err := q.Query(ctx, `
+		SELECT ti.id, ti.owner_id, ti.inventory_item_id, ti.item_definition_id, d.name,
+		       ti.quantity, ti.upgrade_level
+		FROM player_trade_items ti
+		JOIN item_definitions d ON d.id = ti.item_definition_id
+		WHERE ti.trade_id = $1
+		ORDER BY ti.owner_id, d.name
+	`, t.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get trade items: %w", err)
+	}
+	defer rows.Close()
+
+	t.Items = []*models.TradeItem{}
+	for rows.Next() {
+		var item models.TradeItem
+		if err := rows.Scan(&item.ID, &item.OwnerID, &item.InventoryItemID, &item.ItemDefinitionID, &item.ItemName,
+			&item.Quantity, &item.UpgradeLevel); err != nil {
+			return fmt.Errorf("failed to scan trade item: %w", err)
+		}
+		t.Items = append(t.Items, &item)
+	}
+	return rows.Err()
+}
+
+func getTrade(ctx context.Context, q querier, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+	t, err := scanTrade(q.QueryRow(ctx, "SELECT "+tradeColumns+tradeJoins+" WHERE t.id = $1", tradeID))
+	if err != nil {
+		return nil, ErrTradeNotFound
+	}
+	if err := loadTradeItems(ctx, q, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// tradeSide reports whether characterID is player 1 or 2 of the trade
+func tradeSide(t *models.PlayerTrade, characterID uuid.UUID) (int, error) {
+	switch characterID {
+	case t.Player1ID:
+		return 1, nil
+	case t.Player2ID:
+		return 2, nil
+	}
+	return 0, ErrTradeNotFound
+}
+
+// lockOpenTrade locks a pending, unexpired trade that characterID takes part in
+// and returns it with the caller's side.
+func lockOpenTrade(ctx context.Context, tx pgx.Tx, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, int, error) {
+	t, err := scanTrade(tx.QueryRow(ctx, "SELECT "+tradeColumns+tradeJoins+" WHERE t.id = $1 FOR UPDATE OF t", tradeID))
+	if err != nil {
+		return nil, 0, ErrTradeNotFound
+	}
+	side, err := tradeSide(t, characterID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := getOwnedCharacter(ctx, tx, accountID, characterID); err != nil {
+		return nil, 0, err
+	}
+	if t.Status != models.TradePending || !t.ExpiresAt.After(time.Now()) {
+		return nil, 0, ErrTradeNotPending
+	}
+	if err := loadTradeItems(ctx, tx, t); err != nil {
+		return nil, 0, err
+	}
+	return t, side, nil
+}
+
+// touchTrade records a change to either offer. Both confirmations are cleared
+// so nobody can confirm one offer and receive another.
+func touchTrade(ctx context.Context, tx pgx.Tx, tradeID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE player_trades
+		SET player1_confirmed = false, player2_confirmed = false,
+		    updated_at = NOW(), expires_at = $2
+		WHERE id = $1
+	`, tradeID, time.Now().Add(TradeSessionTimeout))
+	if err != nil {
+		return fmt.Errorf("failed to update trade: %w", err)
+	}
+	return nil
+}
+
+// editableOffer checks the caller may still change their side of the trade
+func editableOffer(t *models.PlayerTrade, side int) error {
+	if t.AcceptedAt == nil {
+		return ErrTradeNotAccepted
+	}
+	if (side == 1 && t.Player1Locked) || (side == 2 && t.Player2Locked) {
+		return ErrTradeOfferLocked
+	}
+	return nil
+}
+
+// mutate runs fn against a locked open trade and returns the trade as it
+// stands after the transaction commits.
+func (s *TradeService) mutate(ctx context.Context, accountID, characterID, tradeID uuid.UUID, fn func(tx pgx.Tx, t *models.PlayerTrade, side int) error) (*models.PlayerTrade, error) {
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		t, side, err := lockOpenTrade(ctx, tx, accountID, characterID, tradeID)
+		if err != nil {
+			return err
+		}
+		return fn(tx, t, side)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getTrade(ctx, s.db.Pool, tradeID)
+}
+
+// Invite opens a trade between the acting character and the target
+func (s *TradeService) Invite(ctx context.Context, accountID, characterID uuid.UUID, req *models.CreateTradeRequest) (*models.PlayerTrade, error) {
+	if req.TargetCharacterID == characterID {
+		return nil, ErrCannotTradeSelf
+	}
+
+	var tradeID uuid.UUID
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockCharacters(ctx, tx, characterID, req.TargetCharacterID)
+		if err != nil {
+			return err
+		}
+		self, target := locked[characterID], locked[req.TargetCharacterID]
+		if self.AccountID != accountID {
+			return ErrNotCharacterOwner
+		}
+		if target.AccountID == self.AccountID {
+			return ErrCannotTradeSelf
+		}
+		if target.ServerID != self.ServerID {
+			return ErrCharacterNotFound
+		}
+
+		var minTrust int
+		err = tx.QueryRow(ctx, `
+			SELECT MIN(trust_score) FROM accounts WHERE id = ANY($1)
+		`, []uuid.UUID{self.AccountID, target.AccountID}).Scan(&minTrust)
+		if err != nil {
+			return fmt.Errorf("failed to check trust score: %w", err)
+		}
+		if minTrust < MinTradeTrustScore {
+			return ErrTradeTrustTooLow
+		}
+
+		for _, id := range []uuid.UUID{self.ID, target.ID} {
+			var open bool
+			var recent int
+			err := tx.QueryRow(ctx, `
+				SELECT
+					EXISTS (
+						SELECT 1 FROM player_trades
+						WHERE (player1_id = $1 OR player2_id = $1)
+						  AND status = 'pending' AND expires_at > NOW()
+					),
+					(SELECT COUNT(*) FROM player_trades
+					 WHERE (player1_id = $1 OR player2_id = $1)
+					   AND created_at > NOW() - INTERVAL '1 hour')
+			`, id).Scan(&open, &recent)
+			if err != nil {
+				return fmt.Errorf("failed to check open trades: %w", err)
+			}
+			if open {
+				return ErrAlreadyTrading
+			}
+			if recent >= MaxTradesPerHour {
+				return ErrTradeRateLimited
+			}
+		}
+
+		tradeID = uuid.New()
+		_, err = tx.Exec(ctx, `
+			INSERT INTO player_trades (id, player1_id, player2_id, status, expires_at)
+			VALUES ($1, $2, $3, 'pending', $4)
+		`, tradeID, self.ID, target.ID, time.Now().Add(TradeInviteTimeout))
+		if err != nil {
+			return fmt.Errorf("failed to create trade: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getTrade(ctx, s.db.Pool, tradeID)
+}
+
+// Accept starts the session for an invited character
+func (s *TradeService) Accept(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+	return s.mutate(ctx, accountID, characterID, tradeID, func(tx pgx.Tx, t *models.PlayerTrade, side int) error {
+		if side != 2 {
+			return ErrTradeNotFound
+		}
+		if t.AcceptedAt != nil {
+			return ErrTradeAlreadyStarted
+		}
+		if _, err := tx.Exec(ctx, "UPDATE player_trades SET accepted_at = NOW() WHERE id = $1", t.ID); err != nil {
+			return fmt.Errorf("failed to accept trade: %w", err)
+		}
+		return touchTrade(ctx, tx, t.ID)
+	})
+}
+
+// Cancel closes the trade for both sides. Declining an invitation is a cancel.
+func (s *TradeService) Cancel(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+	return s.mutate(ctx, accountID, characterID, tradeID, func(tx pgx.Tx, t *models.PlayerTrade, side int) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE player_trades SET status = 'cancelled', updated_at = NOW() WHERE id = $1
+		`, t.ID)
+		if err != nil {
+			return fmt.Errorf("failed to cancel trade: %w", err)
+		}
+		return nil
+	})
+}
+
+// AddItem offers an inventory item. The item stays in the bag until the
+// trade executes but cannot be listed or offered elsewhere meanwhile.
+func (s *TradeService) AddItem(ctx context.Context, accountID, characterID, tradeID uuid.UUID, req *models.AddTradeItemRequest) (*models.PlayerTrade, error) {
+	if req.Quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	return s.mutate(ctx, accountID, characterID, tradeID, func(tx pgx.Tx, t *models.PlayerTrade, side int) error {
+		if err := editableOffer(t, side); err != nil {
+			return err
+		}
+
+		offered := 0
+		for _, item := range t.Items {
+			if item.OwnerID == characterID {
+				offered++
+			}
+		}
+		if offered >= MaxTradeItemsPerSide {
+			return ErrTooManyTradeItems
+		}
+
+		stack, err := lockInventoryItem(ctx, tx, characterID, req.InventoryItemID)
+		if err != nil {
+			return err
+		}
+		if req.Quantity > stack.Quantity {
+			return ErrInvalidQuantity
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO player_trade_items (id, trade_id, owner_id, inventory_item_id, item_definition_id, upgrade_level, quantity)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, uuid.New(), t.ID, characterID, req.InventoryItemID, stack.ItemDefinitionID, stack.UpgradeLevel, req.Quantity)
+		if err != nil {
+			return fmt.Errorf("failed to add trade item: %w", err)
+		}
+		return touchTrade(ctx, tx, t.ID)
+	})
+}
+
+// RemoveItem withdraws one of the caller's offered items
+func (s *TradeService) RemoveItem(ctx context.Context, accountID, characterID, tradeID, tradeItemID uuid.UUID) (*models.PlayerTrade, error) {
+	return s.mutate(ctx, accountID, characterID, tradeID, func(tx pgx.Tx, t *models.PlayerTrade, side int) error {
+		if err := editableOffer(t, side); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(ctx, `
+			DELETE FROM player_trade_items WHERE id = $1 AND trade_id = $2 AND owner_id = $3
+		`, tradeItemID, t.ID, characterID)
+		if err != nil {
+			return fmt.Errorf("failed to remove trade item: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrTradeItemNotFound
+		}
+		return touchTrade(ctx, tx, t.ID)
+	})
+}
+
+// SetGold replaces the amount of gold the caller offers
+func (s *TradeService) SetGold(ctx context.Context, accountID, characterID, tradeID uuid.UUID, gold int64) (*models.PlayerTrade, error) {
+	if gold < 0 {
+		return nil, ErrInvalidGoldAmount
+	}
+
+	return s.mutate(ctx, accountID, characterID, tradeID, func(tx pgx.Tx, t *models.PlayerTrade, side int) error {
+		if err := editableOffer(t, side); err != nil {
+			return err
+		}
+
+		c, err := getOwnedCharacter(ctx, tx, accountID, characterID)
+		if err != nil {
+			return err
+		}
+		if gold > c.Gold {
+			return ErrInsufficientGold
+		}
+
+		column := "player1_gold"
+		if side == 2 {
+			column = "player2_gold"
+		}
+		if _, err := tx.Exec(ctx, "UPDATE player_trades SET "+column+" = $1 WHERE id = $2", gold, t.ID); err != nil {
+			return fmt.Errorf("failed to set trade gold: %w", err)
+		}
+		return touchTrade(ctx, tx, t.ID)
+	})
+}
+
+// SetLocked locks or unlocks the caller's offer. Unlocking counts as a change
+// and clears both confirmations.
+func (s *TradeService) SetLocked(ctx context.Context, accountID, characterID, tradeID uuid.UUID, locked bool) (*models.PlayerTrade, error) {
+	return s.mutate(ctx, accountID, characterID, tradeID, func(tx pgx.Tx, t *models.PlayerTrade, side int) error {
+		if t.AcceptedAt == nil {
+			return ErrTradeNotAccepted
+		}
+
+		column := "player1_locked"
+		if side == 2 {
+			column = "player2_locked"
+		}
+		if _, err := tx.Exec(ctx, "UPDATE player_trades SET "+column+" = $1 WHERE id = $2", locked, t.ID); err != nil {
+			return fmt.Errorf("failed to lock trade: %w", err)
+		}
+		if !locked {
+			return touchTrade(ctx, tx, t.ID)
+		}
+		_, err := tx.Exec(ctx, "UPDATE player_trades SET updated_at = NOW() WHERE id = $1", t.ID)
+		return err
+	})
+}
+
+// Confirm accepts both offers as they stand. Once both sides have confirmed
+// the exchange is executed in the same transaction.
+func (s *TradeService) Confirm(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+	return s.mutate(ctx, accountID, characterID, tradeID, func(tx pgx.Tx, t *models.PlayerTrade, side int) error {
+		if !t.Player1Locked || !t.Player2Locked {
+			return ErrTradeNotLocked
+		}
+
+		if side == 1 {
+			t.Player1Confirmed = true
+		} else {
+			t.Player2Confirmed = true
+		}
+		if !t.Player1Confirmed || !t.Player2Confirmed {
+			_, err := tx.Exec(ctx, `
+				UPDATE player_trades SET player1_confirmed = $1, player2_confirmed = $2, updated_at = NOW()
+				WHERE id = $3
+			`, t.Player1Confirmed, t.Player2Confirmed, t.ID)
+			if err != nil {
+				return fmt.Errorf("failed to confirm trade: %w", err)
+			}
+			return nil
+		}
+
+		return s.executeTrade(ctx, tx, t)
+	})
+}
+
+// executeTrade swaps both offers. The trade is marked completed before items
+// move so its own offers no longer count as held by a pending trade.
+func (s *TradeService) executeTrade(ctx context.Context, tx pgx.Tx, t *models.PlayerTrade) error {
+	locked, err := lockCharacters(ctx, tx, t.Player1ID, t.Player2ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE player_trades
+		SET status = 'completed', player1_confirmed = true, player2_confirmed = true,
+		    completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, t.ID)
+	if err != nil {
+		return fmt.Errorf("failed to complete trade: %w", err)
+	}
+
+	for _, item := range t.Items {
+		if item.InventoryItemID == nil {
+			return ErrItemNotFound
+		}
+		stack, err := takeInventoryItem(ctx, tx, item.OwnerID, *item.InventoryItemID, item.Quantity)
+		if err != nil {
+			return err
+		}
+
+		receiver, from := t.Player2ID, t.Player1Name
+		if item.OwnerID == t.Player2ID {
+			receiver, from = t.Player1ID, t.Player2Name
+		}
+		if _, err := deliverItem(ctx, tx, receiver, stack, "trade", "Trade with "+from); err != nil {
+			return err
+		}
+	}
+
+	offers := []struct {
+		from, to uuid.UUID
+		gold     int64
+	}{
+		{t.Player1ID, t.Player2ID, t.Player1Gold},
+		{t.Player2ID, t.Player1ID, t.Player2Gold},
+	}
+	for _, offer := range offers {
+		if offer.gold == 0 {
+			continue
+		}
+		err := s.ledger.Post(ctx, tx, &Posting{
+			ServerID:      locked[offer.from].ServerID,
+			Currency:      models.CurrencyGold,
+			Amount:        offer.gold,
+			From:          CharacterAccount(offer.from),
+			To:            CharacterAccount(offer.to),
+			Reason:        "player_trade",
+			ReferenceType: "trade",
+			ReferenceID:   &t.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE characters SET total_trades = total_trades + 1 WHERE id = ANY($1)
+	`, []uuid.UUID{t.Player1ID, t.Player2ID})
+	if err != nil {
+		return fmt.Errorf("failed to update trade stats: %w", err)
+	}
+	return nil
+}
+
+// Get returns a trade the acting character takes part in. Clients poll this
+// and compare updated_at to pick up the other side's changes.
+func (s *TradeService) Get(ctx context.Context, accountID, characterID, tradeID uuid.UUID) (*models.PlayerTrade, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+	t, err := getTrade(ctx, s.db.Pool, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tradeSide(t, characterID); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// List returns the acting character's trades, newest first, without items
+func (s *TradeService) List(ctx context.Context, accountID, characterID uuid.UUID, status string, limit, offset int) ([]*models.PlayerTrade, error) {
+	if _, err := getOwnedCharacter(ctx, s.db.Pool, accountID, characterID); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + tradeColumns + tradeJoins + " WHERE (t.player1_id = $1 OR t.player2_id = $1)"
+	args := []interface{}{characterID}
+	argIndex := 2
+
+	if status != "" {
+		query += fmt.Sprintf(" AND t.status = $%d", argIndex)
+		args = append(args, status)
+		argIndex++
+	}
+
+	query += fmt.Sprintf(" ORDER BY t.created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, limit, offset)
+
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trades: %w", err)
+	}
+	defer rows.Close()
+
+	var trades []*models.PlayerTrade
+	for rows.Next() {
+		t, err := scanTrade(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+		trades = append(trades, t)
+	}
+	return trades, rows.Err()
+}
+
+// ExpireTrades closes pending trades past their deadline. Offers are never
+// escrowed, so there is nothing to hand back.
+func (s *TradeService) ExpireTrades(ctx context.Context) (int, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE player_trades SET status = 'expired', updated_at = NOW()
+		WHERE status = 'pending' AND expires_at <= NOW()
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire trades: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// RunSweeper expires trades every interval until ctx is cancelled
+func (s *TradeService) RunSweeper(ctx context.Context, interval time.Duration) {
+	runPeriodic(ctx, "trade sweeper", interval, s.ExpireTrades)
+}
@@ -0,0 +1,15 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 008: Market Escrow, Fees & Taxes
+-- ============================================================
+
+-- 10.1 Pazar Listelemeleri - ücret ve vergi kayıtları
+ALTER TABLE market_listings
+    ADD COLUMN listing_fee BIGINT NOT NULL DEFAULT 0, -- Listeleme anında alınır, iade edilmez
+    ADD COLUMN sales_tax BIGINT NOT NULL DEFAULT 0;   -- Satışta satıcının kazancından düşülür
+
+-- Süresi dolan listelemeleri tarayan job için
+CREATE INDEX idx_market_listings_expiry ON market_listings(expires_at) WHERE status = 'active';
+
+-- Fiyata göre sıralı arama (keyset pagination)
+CREATE INDEX idx_market_listings_search ON market_listings(server_id, price_per_unit, id) WHERE status = 'active';
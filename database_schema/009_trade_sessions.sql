@@ -0,0 +1,27 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 009: Player Trade Sessions
+-- ============================================================
+
+-- 10.2 Oyuncu Arası Ticaret - davet kabulü ve son değişiklik zamanı
+ALTER TABLE player_trades
+    ADD COLUMN accepted_at TIMESTAMPTZ,                -- NULL ise davet henüz kabul edilmedi
+    ADD COLUMN updated_at TIMESTAMPTZ DEFAULT NOW();   -- İstemciler bu alanla değişiklikleri takip eder
+
+-- Süresi dolan ticaretleri tarayan job için
+CREATE INDEX idx_player_trades_pending ON player_trades(expires_at) WHERE status = 'pending';
+
+-- Saatlik ticaret limiti için
+CREATE INDEX idx_player_trades_player1_created ON player_trades(player1_id, created_at);
+CREATE INDEX idx_player_trades_player2_created ON player_trades(player2_id, created_at);
+
+-- 10.3 Ticaret İtemleri - item el değiştirdikten sonra da kayıt kalsın
+ALTER TABLE player_trade_items
+    ADD COLUMN item_definition_id INTEGER REFERENCES item_definitions(id),
+    ADD COLUMN upgrade_level INTEGER DEFAULT 0,
+    ALTER COLUMN inventory_item_id DROP NOT NULL,
+    DROP CONSTRAINT player_trade_items_inventory_item_id_fkey,
+    ADD CONSTRAINT player_trade_items_inventory_item_id_fkey
+        FOREIGN KEY (inventory_item_id) REFERENCES character_inventory(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_trade_items_inventory ON player_trade_items(inventory_item_id);
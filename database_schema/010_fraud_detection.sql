@@ -0,0 +1,19 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 010: Price Manipulation & RMT Detection
+-- ============================================================
+
+-- 22.4 Şüpheli Aktivite Log - analiz job'u aynı olayı iki kez işaretlemesin
+-- Yeni activity_type değerleri: 'price_manipulation', 'repeated_trading', 'rmt_gold_flow'
+ALTER TABLE suspicious_activity_logs
+    ADD COLUMN dedupe_key VARCHAR(300); -- Örn: 'listing:<id>', 'ip:<adres>'
+
+CREATE UNIQUE INDEX idx_suspicious_logs_dedupe
+    ON suspicious_activity_logs(account_id, activity_type, dedupe_key);
+
+-- GM inceleme kuyruğu için
+CREATE INDEX idx_suspicious_logs_queue ON suspicious_activity_logs(created_at) WHERE reviewed = FALSE;
+
+-- Analiz job'unun taradığı satışlar ve ticaretler
+CREATE INDEX idx_market_listings_sold ON market_listings(sold_at) WHERE status = 'sold';
+CREATE INDEX idx_player_trades_completed ON player_trades(completed_at) WHERE status = 'completed';
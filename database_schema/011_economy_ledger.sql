@@ -0,0 +1,21 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 011: Double-Entry Economy Ledger
+-- ============================================================
+
+-- 22.1 Ekonomi Log - her hareket iki kayıt (borç + alacak) olarak yazılır
+-- Sistem hesapları ('system:market_tax' gibi) karakter değildir ve bakiyeleri yoktur:
+-- sistemden çıkan para "faucet", sisteme giren para "sink" sayılır.
+-- gold_change/gold_before/gold_after alanları 'currency' cinsinden tutarı taşır.
+ALTER TABLE economy_logs
+    ADD COLUMN entry_id UUID,                                  -- Aynı hareketin iki kaydı aynı entry_id'yi paylaşır
+    ADD COLUMN account VARCHAR(100),                           -- 'character:<uuid>', 'system:<ad>'
+    ADD COLUMN counterparty VARCHAR(100),                      -- Karşı hesap
+    ADD COLUMN currency VARCHAR(10) NOT NULL DEFAULT 'gold',   -- 'gold', 'gems'
+    ALTER COLUMN character_id DROP NOT NULL,                   -- Sistem hesabı kayıtlarında NULL
+    ALTER COLUMN gold_before DROP NOT NULL,
+    ALTER COLUMN gold_after DROP NOT NULL;
+
+CREATE INDEX idx_economy_logs_entry ON economy_logs(entry_id);
+CREATE INDEX idx_economy_logs_character_date ON economy_logs(character_id, created_at);
+CREATE INDEX idx_economy_logs_system ON economy_logs(account, created_at) WHERE character_id IS NULL;
@@ -0,0 +1,18 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 012: Caravan Travel & Payout
+-- ============================================================
+
+-- 9.3 Aktif Kervanlar - yatırım, ödeme ve sunucu saatine göre ilerleme
+-- İlerleme = (şimdi - started_at - paused_seconds) / duration_seconds
+-- Saldırı altındayken geçen süre paused_seconds'a eklenir.
+ALTER TABLE caravans
+    ADD COLUMN investment BIGINT NOT NULL DEFAULT 0,     -- Yola çıkarken ödenen
+    ADD COLUMN expected_reward BIGINT NOT NULL DEFAULT 0, -- Başarı ödülü x rota bonusu
+    ADD COLUMN payout BIGINT,                            -- Varışta ödenen
+    ADD COLUMN duration_seconds INTEGER,
+    ADD COLUMN paused_seconds INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN failure_reason VARCHAR(50);               -- 'cancelled', 'abandoned', 'expired', 'raided'
+
+-- Varış job'u için
+CREATE INDEX idx_caravans_arrival ON caravans(estimated_arrival) WHERE status = 'traveling';
@@ -0,0 +1,16 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 013: Flag (Puşe) System
+-- ============================================================
+
+-- Puşe değiştirme bekleme süresi için son değişiklik zamanı
+-- (bırakma da değişiklik sayılır, flag_started_at yetmez)
+ALTER TABLE characters
+    ADD COLUMN flag_changed_at TIMESTAMPTZ;
+
+-- Kırmızı puşeliler haritada herkese görünür
+CREATE INDEX idx_characters_red_flag ON characters(server_id, current_map_id)
+    WHERE flag = 'red' AND deleted_at IS NULL;
+
+-- Mavi puşe sadece karşılık verebilir: son saldırıları bulmak için
+CREATE INDEX idx_pvp_logs_pair ON pvp_logs(attacker_id, defender_id, created_at DESC);
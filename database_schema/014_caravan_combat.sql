@@ -0,0 +1,23 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 014: Caravan Attack & Defense
+-- ============================================================
+
+-- Yağma büyük kervanlarda INTEGER sınırını aşabilir
+ALTER TABLE caravan_attacks
+    ALTER COLUMN loot_obtained TYPE BIGINT,
+    ADD COLUMN loot_percent INTEGER;                     -- Başarılı saldırıda %40-60
+
+-- Başarılı savunmada muhafızların payı
+ALTER TABLE caravan_guards
+    ALTER COLUMN fee_amount TYPE BIGINT,
+    ADD COLUMN reward_earned BIGINT NOT NULL DEFAULT 0;
+
+-- Açık (sonuçlanmamış) saldırılar
+CREATE INDEX idx_caravan_attacks_open ON caravan_attacks(caravan_id) WHERE ended_at IS NULL;
+
+-- Günlük başarısız saldırı sayımı (3 başarısız = hapis)
+CREATE INDEX idx_caravan_attacks_failed ON caravan_attacks(attacker_id, ended_at) WHERE success = false;
+
+-- Sonuçlanmayı bekleyen saldırılar
+CREATE INDEX idx_caravans_under_attack ON caravans(last_attack_at) WHERE status = 'under_attack';
@@ -0,0 +1,16 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 015: NPC Guards & Protector Contracts
+-- ============================================================
+
+-- Koruyucu panosundan yapılan sözleşmeler caravan_guards'a yazılır.
+-- Ücret emanette tutulur: kervan varınca koruyucuya, kaybolursa sahibine.
+ALTER TABLE caravan_guards
+    ADD COLUMN listing_id UUID REFERENCES guard_listings(id) ON DELETE SET NULL,
+    ADD COLUMN hours INTEGER NOT NULL DEFAULT 0;        -- Kiralanan saat
+
+CREATE INDEX idx_caravan_guards_unpaid ON caravan_guards(caravan_id) WHERE fee_paid = false AND fee_amount > 0;
+
+-- Pano araması: sunucu + ücret
+CREATE INDEX idx_guard_listings_board ON guard_listings(server_id, hourly_fee)
+    WHERE is_active = TRUE AND is_available = TRUE;
@@ -0,0 +1,35 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 016: Karma & Infamy History
+-- ============================================================
+
+-- 9.3 Karma değişim geçmişi
+CREATE TABLE karma_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    character_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    server_id INTEGER NOT NULL REFERENCES servers(id),
+
+    -- 'caravan_protect', 'bandit_kill', 'caravan_attack',
+    -- 'innocent_kill', 'fisher_attack', 'infamy_decay', 'prison_served'
+    reason VARCHAR(50) NOT NULL,
+
+    karma_change INTEGER NOT NULL DEFAULT 0,
+    infamy_change INTEGER NOT NULL DEFAULT 0,
+    karma_after INTEGER NOT NULL,
+    infamy_after INTEGER NOT NULL,
+
+    -- Kaynak (kervan, pvp, balık vb.)
+    reference_type VARCHAR(50),
+    reference_id UUID,
+
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_karma_logs_character ON karma_logs(character_id, created_at DESC);
+
+-- Infamy azalması son kazanımdan sonra başlar
+ALTER TABLE characters
+    ADD COLUMN last_infamy_at TIMESTAMPTZ;
+
+-- Aranan listesi ve azalma job'u
+CREATE INDEX idx_characters_infamy ON characters(server_id, infamy DESC) WHERE infamy > 0 AND deleted_at IS NULL;
@@ -0,0 +1,35 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 017: Prison Sentences & Confinement
+-- ============================================================
+
+-- 9.2 Hapishane haritası: mahkumlar cezaları bitene kadar burada kalır
+ALTER TABLE maps
+    ADD COLUMN is_prison BOOLEAN DEFAULT FALSE;
+
+INSERT INTO maps (name, description, min_level, max_level, is_safe_zone, is_pvp_enabled)
+SELECT 'Hapishane', 'Cezasını çeken mahkumların farm alanı', 1, 120, FALSE, TRUE
+WHERE NOT EXISTS (SELECT 1 FROM maps WHERE name = 'Hapishane');
+
+UPDATE maps SET is_prison = TRUE WHERE name = 'Hapishane';
+
+-- Üst üste PvP kayıpları ve hapisten önceki konum
+ALTER TABLE characters
+    ADD COLUMN pvp_loss_streak INTEGER DEFAULT 0,
+    ADD COLUMN pre_prison_map_id INTEGER REFERENCES maps(id);
+
+-- Madalyon indirimi ve GM kararları
+ALTER TABLE prison_records
+    ADD COLUMN reduction_percent INTEGER DEFAULT 0,
+    ADD COLUMN jailed_by UUID REFERENCES gm_accounts(id),
+    ADD COLUMN released_by UUID REFERENCES gm_accounts(id);
+
+-- Süresi dolan mahkumları bulmak için
+CREATE INDEX idx_characters_prison_release ON characters(prison_release_at) WHERE is_in_prison = TRUE;
+
+-- 9.2.3 Özgürlük Madalyonu: sonraki hapis süresi -%50
+INSERT INTO item_definitions (name, description, item_type, rarity, is_upgradeable, is_consumable,
+    consumable_effect, is_stackable, max_stack, is_tradeable)
+SELECT 'Özgürlük Madalyonu', 'Sonraki hapis süresi -%50', 'consumable', 'epic', FALSE, TRUE,
+    '{"type": "prison_sentence_reduction", "value": 50}', TRUE, 20, TRUE
+WHERE NOT EXISTS (SELECT 1 FROM item_definitions WHERE name = 'Özgürlük Madalyonu');
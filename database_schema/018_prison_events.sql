@@ -0,0 +1,91 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 018: Prison Events (Escape, Arena, Boss, Courtyard)
+-- ============================================================
+
+-- 9.2.2 Kaçış Tüneli: her 2 saatte bir, sunucu başına tek event
+ALTER TABLE prison_escape_events
+    ADD COLUMN resolved_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX idx_prison_escape_events_slot ON prison_escape_events(server_id, started_at);
+CREATE INDEX idx_prison_escape_events_open ON prison_escape_events(ends_at) WHERE resolved_at IS NULL;
+
+-- 9.2.2 Arena: her 30 dakikada turnuva
+CREATE TABLE prison_arena_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    server_id INTEGER NOT NULL REFERENCES servers(id),
+
+    started_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    resolved_at TIMESTAMPTZ,
+
+    total_participants INTEGER DEFAULT 0,
+    winner_id UUID REFERENCES characters(id),
+
+    UNIQUE(server_id, started_at)
+);
+
+CREATE INDEX idx_prison_arena_events_open ON prison_arena_events(ends_at) WHERE resolved_at IS NULL;
+
+CREATE TABLE prison_arena_participants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    event_id UUID NOT NULL REFERENCES prison_arena_events(id) ON DELETE CASCADE,
+    character_id UUID NOT NULL REFERENCES characters(id),
+
+    wins INTEGER DEFAULT 0,
+    placement INTEGER, -- 1: Şampiyon, 2: Finalist ...
+
+    exp_earned INTEGER DEFAULT 0,
+    joined_at TIMESTAMPTZ DEFAULT NOW(),
+
+    UNIQUE(event_id, character_id)
+);
+
+-- 9.2.2 Haftalık Boss: Cuma 20:00
+CREATE TABLE prison_boss_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    server_id INTEGER NOT NULL REFERENCES servers(id),
+
+    started_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    resolved_at TIMESTAMPTZ,
+
+    total_participants INTEGER DEFAULT 0,
+    boss_hp BIGINT NOT NULL,
+    damage_dealt BIGINT DEFAULT 0,
+    defeated BOOLEAN DEFAULT FALSE,
+
+    UNIQUE(server_id, started_at)
+);
+
+CREATE INDEX idx_prison_boss_events_open ON prison_boss_events(ends_at) WHERE resolved_at IS NULL;
+
+CREATE TABLE prison_boss_participants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    event_id UUID NOT NULL REFERENCES prison_boss_events(id) ON DELETE CASCADE,
+    character_id UUID NOT NULL REFERENCES characters(id),
+
+    damage BIGINT DEFAULT 0,
+    exp_earned INTEGER DEFAULT 0,
+    joined_at TIMESTAMPTZ DEFAULT NOW(),
+
+    UNIQUE(event_id, character_id)
+);
+
+-- Kaçış ödülleri
+ALTER TABLE prison_escape_participants
+    ADD COLUMN exp_earned INTEGER DEFAULT 0;
+
+-- Avlu PvP sıralaması: haftalık, sıralama hafta bitince kesinleşir
+CREATE INDEX idx_prison_pvp_rankings_week ON prison_pvp_rankings(server_id, week_start, kills DESC);
+
+-- 9.2.3 Hapise özel malzemeler (sadece hapiste farm edilir)
+INSERT INTO item_definitions (name, description, item_type, rarity, is_upgradeable, is_stackable, max_stack, is_tradeable)
+SELECT v.name, v.description, 'material', v.rarity::item_rarity, FALSE, TRUE, 999, FALSE
+FROM (VALUES
+    ('Zindan Taşı', 'Hapishane madeninden çıkar', 'uncommon'),
+    ('Karanlık Kristal', 'Hapishane bossundan düşer', 'rare'),
+    ('Mahkum Elması', 'Hapishane arenasının ödülü', 'epic'),
+    ('Lanetli Opal', 'Hapishane bossunun en güçlü rakibine verilir', 'legendary')
+) AS v(name, description, rarity)
+WHERE NOT EXISTS (SELECT 1 FROM item_definitions d WHERE d.name = v.name);
@@ -0,0 +1,27 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 019: Fishing Sessions, Fish Bag & Treacherous Attack
+-- ============================================================
+
+-- 9.1 Balık çantası: satılmayan balıklar saklanır
+ALTER TABLE fishing_catches
+    ADD COLUMN exp_earned INTEGER DEFAULT 0,
+    ADD COLUMN sold_at TIMESTAMPTZ,
+    ADD COLUMN sold_for BIGINT;
+
+CREATE INDEX idx_fishing_catches_unsold ON fishing_catches(character_id, caught_at DESC) WHERE sold_at IS NULL;
+
+-- Zamanı gelen avları işlemek için
+CREATE INDEX idx_character_fishing_active ON character_fishing(next_catch_at) WHERE is_fishing = TRUE;
+
+-- 9.1.2 'Hain Saldırı' debuff'ı: balıkçıya saldıran oyuncuya uygulanır
+ALTER TABLE characters
+    ADD COLUMN treacherous_until TIMESTAMPTZ,
+    ADD COLUMN treacherous_percent INTEGER DEFAULT 0;
+
+-- 9.2.2 Hapishane gölü: mahkumların balık tutabildiği tek nokta
+INSERT INTO fishing_spots (map_id, name, x, y, radius, zone_type, pvp_attacker_debuff, min_rarity, max_rarity)
+SELECT m.id, 'Hapishane Gölü', 0, 0, 50, 'safe', 0.40, 'common', 'uncommon'
+FROM maps m
+WHERE m.is_prison
+  AND NOT EXISTS (SELECT 1 FROM fishing_spots s WHERE s.map_id = m.id AND s.name = 'Hapishane Gölü');
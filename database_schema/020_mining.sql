@@ -0,0 +1,51 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 020: Mining Sessions, Node Depletion & Prison Ores
+-- ============================================================
+
+-- Tükenen maden noktası respawn_at zamanında tamamen dolar
+ALTER TABLE mining_nodes
+    ADD COLUMN depleted_at TIMESTAMPTZ,
+    ADD COLUMN respawn_at TIMESTAMPTZ;
+
+CREATE INDEX idx_mining_nodes_respawn ON mining_nodes(respawn_at) WHERE respawn_at IS NOT NULL;
+
+-- 9.2.2 Maden Ocağı: sadece hapiste bulunan cevherler
+ALTER TABLE ore_definitions
+    ADD COLUMN is_prison_only BOOLEAN DEFAULT FALSE;
+
+-- Cevher çantası: satılmayan cevherler saklanır
+CREATE TABLE mining_extractions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    character_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    node_id INTEGER NOT NULL REFERENCES mining_nodes(id),
+    ore_id INTEGER NOT NULL REFERENCES ore_definitions(id),
+
+    quantity INTEGER DEFAULT 1,
+    exp_earned INTEGER DEFAULT 0,
+
+    mined_at TIMESTAMPTZ DEFAULT NOW(),
+    sold_at TIMESTAMPTZ,
+    sold_for BIGINT
+);
+
+CREATE INDEX idx_mining_extractions_character ON mining_extractions(character_id);
+CREATE INDEX idx_mining_extractions_unsold ON mining_extractions(character_id, mined_at DESC) WHERE sold_at IS NULL;
+
+-- Zamanı gelen kazıları işlemek için
+CREATE INDEX idx_character_mining_active ON character_mining(next_mine_at) WHERE is_mining = TRUE;
+
+-- Hapis cevheri: çantaya girmez, eritilmiş hali envantere gelir
+INSERT INTO ore_definitions (name, description, rarity, required_mining_level, sell_price,
+    is_smeltable, smelts_into_id, smelt_quantity, spawn_zones, is_prison_only)
+SELECT 'Zindan Cevheri', 'Hapishane madeninden çıkan kara taş', 'uncommon', 1, 0,
+    TRUE, d.id, 1, ARRAY['safe'], TRUE
+FROM item_definitions d
+WHERE d.name = 'Zindan Taşı'
+  AND NOT EXISTS (SELECT 1 FROM ore_definitions WHERE name = 'Zindan Cevheri');
+
+INSERT INTO mining_nodes (map_id, name, x, y, zone_type, min_rarity, max_rarity, respawn_time_seconds, current_resources, max_resources)
+SELECT m.id, 'Maden Ocağı', 0, 0, 'safe', 'common', 'uncommon', 600, 200, 200
+FROM maps m
+WHERE m.is_prison
+  AND NOT EXISTS (SELECT 1 FROM mining_nodes n WHERE n.map_id = m.id AND n.name = 'Maden Ocağı');
@@ -0,0 +1,34 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 021: Zone Control Tax
+-- ============================================================
+
+-- Lonca kasası defter hesabı: 'guild:<uuid>'
+ALTER TABLE economy_logs
+    ADD COLUMN guild_id UUID REFERENCES guilds(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_economy_logs_guild_date ON economy_logs(guild_id, created_at) WHERE guild_id IS NOT NULL;
+
+-- 8.3.2 Vergi Sistemi: kontrol edilen bölgedeki her vergi tahsilatı
+CREATE TABLE zone_tax_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    zone_id INTEGER NOT NULL REFERENCES map_zones(id),
+    guild_id UUID NOT NULL REFERENCES guilds(id) ON DELETE CASCADE,
+    character_id UUID REFERENCES characters(id) ON DELETE SET NULL,
+
+    activity VARCHAR(20) NOT NULL, -- 'mob_farm', 'fishing', 'mining', 'dungeon', 'caravan', 'upgrade'
+    gross_amount BIGINT NOT NULL,
+    tax_rate INTEGER NOT NULL, -- Yüzde
+    tax_amount BIGINT NOT NULL,
+
+    reference_type VARCHAR(50),
+    reference_id UUID,
+
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_zone_tax_logs_guild_date ON zone_tax_logs(guild_id, created_at);
+CREATE INDEX idx_zone_tax_logs_zone_date ON zone_tax_logs(zone_id, created_at);
+
+-- Bölge araması için
+CREATE INDEX idx_map_zones_controllable ON map_zones(map_id) WHERE is_controllable = TRUE;
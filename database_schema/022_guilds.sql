@@ -0,0 +1,35 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 022: Guild Founding, Membership & Invites
+-- ============================================================
+
+-- 8.1 Kapanan lonca kaydı saklanır; aynı uzmanlıkta yeni lonca kurulabilir
+ALTER TABLE guilds
+    ADD COLUMN disbanded_at TIMESTAMPTZ;
+
+ALTER TABLE guilds
+    DROP CONSTRAINT guilds_server_id_name_key,
+    DROP CONSTRAINT guilds_server_id_specialization_key;
+
+CREATE UNIQUE INDEX idx_guilds_active_name ON guilds(server_id, LOWER(name)) WHERE disbanded_at IS NULL;
+CREATE UNIQUE INDEX idx_guilds_active_spec ON guilds(server_id, specialization) WHERE disbanded_at IS NULL;
+
+-- Lonca davetleri
+CREATE TABLE guild_invites (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    guild_id UUID NOT NULL REFERENCES guilds(id) ON DELETE CASCADE,
+    character_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    invited_by UUID NOT NULL REFERENCES characters(id),
+
+    status VARCHAR(20) DEFAULT 'pending', -- 'pending', 'accepted', 'declined', 'cancelled', 'expired'
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    responded_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_guild_invites_pending ON guild_invites(guild_id, character_id) WHERE status = 'pending';
+CREATE INDEX idx_guild_invites_character ON guild_invites(character_id) WHERE status = 'pending';
+
+CREATE INDEX idx_guild_applications_pending ON guild_applications(guild_id, created_at) WHERE status = 'pending';
+CREATE INDEX idx_guild_applications_character ON guild_applications(character_id) WHERE status = 'pending';
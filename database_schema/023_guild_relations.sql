@@ -0,0 +1,56 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 023: Guild Alliances, Enemies & Voting
+-- ============================================================
+
+-- 8.2 İlişki durumu: oylamada, geçerli, iptal bekleniyor (dost lonca 7 gün)
+ALTER TABLE guild_relations
+    ADD COLUMN status VARCHAR(20) DEFAULT 'pending', -- 'pending', 'active', 'cancelling'
+    ADD COLUMN proposed_by UUID REFERENCES characters(id),
+    ADD COLUMN cancel_requested_at TIMESTAMPTZ,
+    ADD COLUMN ends_at TIMESTAMPTZ;
+
+CREATE INDEX idx_guild_relations_target ON guild_relations(target_guild_id);
+CREATE INDEX idx_guild_relations_ending ON guild_relations(ends_at) WHERE status = 'cancelling';
+
+-- Lonca oylamaları
+CREATE TABLE guild_votes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    guild_id UUID NOT NULL REFERENCES guilds(id) ON DELETE CASCADE,
+
+    vote_type VARCHAR(30) NOT NULL, -- 'ally_propose', 'ally_accept', 'ally_cancel', 'enemy_declare', 'enemy_end'
+    relation_id UUID REFERENCES guild_relations(id) ON DELETE SET NULL,
+    target_guild_id UUID REFERENCES guilds(id),
+    proposed_by UUID REFERENCES characters(id),
+
+    -- Kural: oy verebilecek üyelerin yüzdesi, lider onayı
+    approval_percent INTEGER NOT NULL,
+    requires_leader BOOLEAN DEFAULT FALSE,
+    leader_approved BOOLEAN DEFAULT FALSE,
+
+    -- Sayım (oylama açıldığında üye sayısı sabitlenir)
+    eligible_voters INTEGER NOT NULL,
+    votes_required INTEGER NOT NULL,
+    votes_for INTEGER DEFAULT 0,
+    votes_against INTEGER DEFAULT 0,
+
+    status VARCHAR(20) DEFAULT 'open', -- 'open', 'passed', 'failed', 'cancelled'
+    deadline TIMESTAMPTZ NOT NULL,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_guild_votes_guild ON guild_votes(guild_id, created_at);
+CREATE INDEX idx_guild_votes_deadline ON guild_votes(deadline) WHERE status = 'open';
+CREATE UNIQUE INDEX idx_guild_votes_open ON guild_votes(guild_id, vote_type, target_guild_id) WHERE status = 'open';
+
+CREATE TABLE guild_vote_ballots (
+    vote_id UUID NOT NULL REFERENCES guild_votes(id) ON DELETE CASCADE,
+    character_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+
+    approve BOOLEAN NOT NULL,
+    cast_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (vote_id, character_id)
+);
@@ -0,0 +1,51 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 024: Territory Wars
+-- ============================================================
+
+-- Haritalar tüm sunucularda ortak; bölge kontrolü sunucu başına tutulur
+ALTER TABLE zone_control ADD COLUMN server_id INTEGER REFERENCES servers(id);
+
+UPDATE zone_control zc SET server_id = g.server_id
+FROM guilds g
+WHERE g.id = zc.guild_id;
+
+ALTER TABLE zone_control
+    ALTER COLUMN server_id SET NOT NULL,
+    DROP CONSTRAINT zone_control_zone_id_key,
+    ADD CONSTRAINT zone_control_server_zone_key UNIQUE (server_id, zone_id); -- Bir bölge sunucu başına tek loncaya ait
+
+-- 8.3.1 Bölge savaşları: Cumartesi 20:00-22:00, 48 saat önceden ilan
+-- Sahipsiz bölgeye saldırıda savunan lonca yoktur
+ALTER TABLE guild_wars
+    ADD COLUMN server_id INTEGER REFERENCES servers(id),
+    ADD COLUMN declared_by UUID REFERENCES characters(id),
+    ADD COLUMN ends_at TIMESTAMPTZ,
+    ALTER COLUMN defender_guild_id DROP NOT NULL,
+
+    -- Bayrak noktası: tek başına noktada olan lonca, ne zamandan beri
+    ADD COLUMN holder_guild_id UUID REFERENCES guilds(id),
+    ADD COLUMN held_since TIMESTAMPTZ,
+    ADD COLUMN point_updated_at TIMESTAMPTZ;
+
+UPDATE guild_wars w SET server_id = g.server_id, ends_at = w.scheduled_at + INTERVAL '2 hours'
+FROM guilds g
+WHERE g.id = w.attacker_guild_id;
+
+ALTER TABLE guild_wars
+    ALTER COLUMN server_id SET NOT NULL,
+    ALTER COLUMN ends_at SET NOT NULL;
+
+-- Bir bölgeye savaş başına tek saldırı, bir lonca savaş başına tek saldırı
+CREATE UNIQUE INDEX idx_guild_wars_zone_window ON guild_wars(server_id, zone_id, scheduled_at)
+    WHERE status <> 'cancelled';
+CREATE UNIQUE INDEX idx_guild_wars_attacker_window ON guild_wars(attacker_guild_id, scheduled_at)
+    WHERE status <> 'cancelled';
+CREATE INDEX idx_guild_wars_in_progress ON guild_wars(ends_at) WHERE status = 'in_progress';
+
+-- Noktadaki katılımcılar; son bildirim süresini aşan sayılmaz
+ALTER TABLE guild_war_participants
+    ADD COLUMN on_point BOOLEAN DEFAULT FALSE,
+    ADD COLUMN last_presence_at TIMESTAMPTZ;
+
+CREATE INDEX idx_guild_war_participants_point ON guild_war_participants(war_id, guild_id) WHERE on_point;
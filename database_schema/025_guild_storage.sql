@@ -0,0 +1,20 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 025: Guild Storage, Treasury & Activity Log
+-- ============================================================
+
+-- Rütbe başına günlük çekim limitleri için sayaçlar (depo + kasa)
+CREATE TABLE guild_storage_withdrawals (
+    guild_id UUID NOT NULL REFERENCES guilds(id) ON DELETE CASCADE,
+    character_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+
+    items_withdrawn INTEGER DEFAULT 0,
+    gold_withdrawn BIGINT DEFAULT 0,
+
+    PRIMARY KEY (guild_id, character_id, day)
+);
+
+-- Lonca günlüğü: işleme göre filtreli sayfalama
+CREATE INDEX idx_guild_logs_recent ON guild_logs(guild_id, created_at DESC);
+CREATE INDEX idx_guild_logs_action ON guild_logs(guild_id, action_type, created_at DESC);
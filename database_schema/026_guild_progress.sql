@@ -0,0 +1,23 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 026: Guild EXP, Levels & Rotating Quests
+-- ============================================================
+
+-- Günlük ve haftalık görev rotasyonu: dönem başına aynı görev bir kez
+CREATE UNIQUE INDEX idx_guild_quests_rotation ON guild_quests(guild_id, is_weekly, quest_type, starts_at);
+CREATE INDEX idx_guild_quest_contributions_character ON guild_quest_contributions(character_id);
+
+-- Lonca bildirimleri (seviye atlama vb.), üyelere sistem postasıyla gönderilir
+CREATE TABLE guild_notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    guild_id UUID NOT NULL REFERENCES guilds(id) ON DELETE CASCADE,
+
+    notification_type VARCHAR(50) NOT NULL, -- 'level_up'
+    subject VARCHAR(200) NOT NULL,
+    body TEXT,
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_guild_notifications_pending ON guild_notifications(created_at) WHERE delivered_at IS NULL;
@@ -0,0 +1,62 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 027: Dungeon Instances, Boss Progress & Entry Limits
+-- ============================================================
+
+-- Aktif bossun kalan canı ve terk edilen instance'ların tespiti
+ALTER TABLE dungeon_instances
+    ADD COLUMN boss_hp BIGINT,
+    ADD COLUMN boss_max_hp BIGINT,
+    ADD COLUMN last_activity_at TIMESTAMPTZ DEFAULT NOW();
+
+-- Zaman aşımı süpürücüsü için
+CREATE INDEX idx_dungeon_instances_expiry ON dungeon_instances(expires_at) WHERE status IN ('forming', 'in_progress');
+CREATE INDEX idx_dungeon_instances_forming ON dungeon_instances(server_id, dungeon_id) WHERE status = 'forming';
+
+-- Boss saldırıları arasındaki bekleme
+ALTER TABLE dungeon_participants
+    ADD COLUMN last_attack_at TIMESTAMPTZ;
+
+CREATE INDEX idx_dungeon_participants_active ON dungeon_participants(character_id) WHERE is_active;
+
+-- 5.2 Dungeon Türleri
+INSERT INTO dungeon_definitions (name, description, min_level, daily_entries, weekly_entries, has_hell,
+    time_limit_minutes, base_exp_reward, base_gold_reward, is_cross_server)
+SELECT v.name, v.description, v.min_level, v.daily_entries, v.weekly_entries, v.has_hell,
+    v.time_limit_minutes, v.base_exp_reward, v.base_gold_reward, v.is_cross_server
+FROM (VALUES
+    ('Goblin Mağarası', 'Başlangıç dungeon', 40, 5, NULL::INTEGER, FALSE, 45, 8000, 5000, FALSE),
+    ('Karanlık Orman', 'Zehir temalı', 50, 4, NULL, FALSE, 50, 15000, 9000, FALSE),
+    ('Buzul Tapınağı', 'Donma mekaniği', 60, 3, NULL, TRUE, 55, 26000, 15000, FALSE),
+    ('Volkan Kalesi', 'Yanık mekaniği', 70, 3, NULL, TRUE, 60, 42000, 24000, FALSE),
+    ('Şeytan Kulesi', 'Çok aşamalı', 80, 2, NULL, TRUE, 75, 65000, 38000, FALSE),
+    ('Ejderha Yuvası', 'Boss odaklı', 90, 2, NULL, TRUE, 75, 95000, 55000, FALSE),
+    ('Karanlık Diyar', 'En zor içerik', 100, 1, NULL, TRUE, 90, 140000, 80000, FALSE),
+    ('Efsanevi Zindan', 'Sunucular arası', 110, 1, 1, TRUE, 90, 220000, 120000, TRUE)
+) AS v(name, description, min_level, daily_entries, weekly_entries, has_hell,
+       time_limit_minutes, base_exp_reward, base_gold_reward, is_cross_server)
+WHERE NOT EXISTS (SELECT 1 FROM dungeon_definitions d WHERE d.name = v.name);
+
+INSERT INTO dungeon_bosses (dungeon_id, name, base_hp, base_attack, base_defense, boss_order, is_final_boss)
+SELECT d.id, v.name, v.base_hp, v.base_attack, v.base_defense, v.boss_order, v.is_final_boss
+FROM (VALUES
+    ('Goblin Mağarası', 'Goblin Şefi', 60000, 180, 80, 1, FALSE),
+    ('Goblin Mağarası', 'Goblin Kralı', 120000, 240, 110, 2, TRUE),
+    ('Karanlık Orman', 'Zehirli Örümcek', 110000, 260, 130, 1, FALSE),
+    ('Karanlık Orman', 'Orman Cadısı', 220000, 340, 170, 2, TRUE),
+    ('Buzul Tapınağı', 'Buz Golemi', 180000, 360, 220, 1, FALSE),
+    ('Buzul Tapınağı', 'Buzul Rahibi', 360000, 460, 260, 2, TRUE),
+    ('Volkan Kalesi', 'Lav Muhafızı', 260000, 480, 300, 1, FALSE),
+    ('Volkan Kalesi', 'Ateş Lordu', 520000, 600, 350, 2, TRUE),
+    ('Şeytan Kulesi', 'Kapı Bekçisi', 300000, 560, 360, 1, FALSE),
+    ('Şeytan Kulesi', 'Kule Büyücüsü', 420000, 640, 380, 2, FALSE),
+    ('Şeytan Kulesi', 'Şeytan Prens', 700000, 760, 420, 3, TRUE),
+    ('Ejderha Yuvası', 'Ejderha Yavrusu', 450000, 760, 460, 1, FALSE),
+    ('Ejderha Yuvası', 'Kadim Ejderha', 1000000, 920, 520, 2, TRUE),
+    ('Karanlık Diyar', 'Gölge Şövalye', 700000, 950, 580, 1, FALSE),
+    ('Karanlık Diyar', 'Karanlık Hükümdar', 1500000, 1150, 650, 2, TRUE),
+    ('Efsanevi Zindan', 'Kayıp Titan', 1200000, 1250, 720, 1, FALSE),
+    ('Efsanevi Zindan', 'Efsanevi Ejderha', 2500000, 1500, 800, 2, TRUE)
+) AS v(dungeon_name, name, base_hp, base_attack, base_defense, boss_order, is_final_boss)
+JOIN dungeon_definitions d ON d.name = v.dungeon_name
+WHERE NOT EXISTS (SELECT 1 FROM dungeon_bosses b WHERE b.dungeon_id = d.id AND b.name = v.name);
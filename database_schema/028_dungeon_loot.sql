@@ -0,0 +1,80 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 028: Personal Dungeon Loot & Loot Roll Audit
+-- ============================================================
+
+-- Her katılımcının her boss için yaptığı loot zarları (denetim kaydı)
+CREATE TABLE dungeon_loot_rolls (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    instance_id UUID NOT NULL REFERENCES dungeon_instances(id) ON DELETE CASCADE,
+    boss_id INTEGER NOT NULL REFERENCES dungeon_bosses(id),
+    character_id UUID NOT NULL REFERENCES characters(id),
+
+    loot_table_id INTEGER REFERENCES loot_tables(id),
+    loot_table_entry_id INTEGER REFERENCES loot_table_entries(id),
+    item_definition_id INTEGER REFERENCES item_definitions(id),
+    rarity item_rarity,
+
+    -- Zar: roll < chance ise kazanılır
+    base_chance DECIMAL(6,3) NOT NULL,
+    chance DECIMAL(6,3) NOT NULL,
+    roll DECIMAL(6,3) NOT NULL,
+    won BOOLEAN NOT NULL,
+    quantity INTEGER DEFAULT 0,
+
+    -- Garantili rare drop (5.4)
+    is_guaranteed BOOLEAN DEFAULT FALSE,
+
+    -- Uygulanan bonuslar (yüzde)
+    difficulty dungeon_difficulty NOT NULL,
+    team_bonus DECIMAL(5,2) DEFAULT 0,
+    specialization_bonus DECIMAL(5,2) DEFAULT 0,
+    guild_bonus DECIMAL(5,2) DEFAULT 0,
+
+    -- 'inventory', 'mail'
+    delivered_to VARCHAR(20),
+
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_dungeon_loot_rolls_instance ON dungeon_loot_rolls(instance_id, character_id);
+CREATE INDEX idx_dungeon_loot_rolls_character ON dungeon_loot_rolls(character_id, created_at DESC);
+
+-- Dungeon ganimet malzemeleri
+INSERT INTO item_definitions (name, description, item_type, rarity, is_upgradeable, is_stackable, max_stack, is_tradeable)
+SELECT v.name, v.description, 'material', v.rarity::item_rarity, FALSE, TRUE, 999, TRUE
+FROM (VALUES
+    ('Kırık Zırh Parçası', 'Dungeon canavarlarından düşer', 'common'),
+    ('Büyülü Toz', 'Dungeon bosslarının kalıntısı', 'uncommon'),
+    ('Boss Ruhu', 'Yenilen bir bossun ruhu', 'rare'),
+    ('Kadim Mühür', 'Zor dungeonların ödülü', 'epic'),
+    ('Ejderha Kalbi', 'Yalnızca en zor bosslardan düşer', 'legendary')
+) AS v(name, description, rarity)
+WHERE NOT EXISTS (SELECT 1 FROM item_definitions d WHERE d.name = v.name);
+
+-- Her dungeon için bir loot tablosu
+INSERT INTO loot_tables (name, description)
+SELECT d.name || ' Ganimeti', d.name || ' bosslarının loot tablosu'
+FROM dungeon_definitions d
+WHERE NOT EXISTS (SELECT 1 FROM loot_tables t WHERE t.name = d.name || ' Ganimeti');
+
+INSERT INTO loot_table_entries (loot_table_id, item_definition_id, drop_chance, min_quantity, max_quantity)
+SELECT t.id, i.id, v.drop_chance, v.min_quantity, v.max_quantity
+FROM (VALUES
+    ('Kırık Zırh Parçası', 60.000, 2, 5),
+    ('Büyülü Toz', 30.000, 1, 3),
+    ('Boss Ruhu', 8.000, 1, 1),
+    ('Kadim Mühür', 2.000, 1, 1),
+    ('Ejderha Kalbi', 0.300, 1, 1)
+) AS v(item_name, drop_chance, min_quantity, max_quantity)
+JOIN item_definitions i ON i.name = v.item_name
+JOIN dungeon_definitions d ON TRUE
+JOIN loot_tables t ON t.name = d.name || ' Ganimeti'
+WHERE NOT EXISTS (
+    SELECT 1 FROM loot_table_entries e WHERE e.loot_table_id = t.id AND e.item_definition_id = i.id
+);
+
+UPDATE dungeon_bosses b SET loot_table_id = t.id
+FROM dungeon_definitions d
+JOIN loot_tables t ON t.name = d.name || ' Ganimeti'
+WHERE b.dungeon_id = d.id AND b.loot_table_id IS NULL;
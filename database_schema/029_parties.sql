@@ -0,0 +1,27 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 029: Party Invites, Loot Modes & Party Chat
+-- ============================================================
+
+-- Parti davetleri
+CREATE TABLE party_invites (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    party_id UUID NOT NULL REFERENCES parties(id) ON DELETE CASCADE,
+    character_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    invited_by UUID NOT NULL REFERENCES characters(id),
+
+    status VARCHAR(20) DEFAULT 'pending', -- 'pending', 'accepted', 'declined', 'cancelled', 'expired'
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    responded_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_party_invites_pending ON party_invites(party_id, character_id) WHERE status = 'pending';
+CREATE INDEX idx_party_invites_character ON party_invites(character_id) WHERE status = 'pending';
+
+-- Sıralı loot dağıtımında sıradaki üye
+ALTER TABLE parties
+    ADD COLUMN round_robin_position INTEGER DEFAULT 0;
+
+CREATE INDEX idx_parties_active ON parties(server_id, is_public) WHERE disbanded_at IS NULL;
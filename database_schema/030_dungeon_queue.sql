@@ -0,0 +1,69 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 030: Dungeon Matchmaking Queue & Ready Checks
+-- ============================================================
+
+-- Eşleştirmeleri (hazır kontrolü)
+CREATE TABLE dungeon_queue_matches (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    server_id INTEGER NOT NULL REFERENCES servers(id),
+    dungeon_id INTEGER NOT NULL REFERENCES dungeon_definitions(id),
+    difficulty dungeon_difficulty NOT NULL,
+
+    status VARCHAR(20) DEFAULT 'ready_check', -- 'ready_check', 'accepted', 'cancelled'
+
+    -- Herkes onaylayınca açılan zindan
+    instance_id UUID REFERENCES dungeon_instances(id),
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_dungeon_queue_matches_pending ON dungeon_queue_matches(expires_at) WHERE status = 'ready_check';
+
+-- Kuyruk kayıtları: tek oyuncu ya da parti tek kayıt olarak sıraya girer
+CREATE TABLE dungeon_queue_entries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    server_id INTEGER NOT NULL REFERENCES servers(id),
+    dungeon_id INTEGER NOT NULL REFERENCES dungeon_definitions(id),
+    difficulty dungeon_difficulty NOT NULL,
+
+    leader_id UUID NOT NULL REFERENCES characters(id),
+    party_id UUID REFERENCES parties(id) ON DELETE SET NULL,
+
+    -- Üyelerin ortalama gear score'u
+    gear_score INTEGER NOT NULL,
+
+    status VARCHAR(20) DEFAULT 'queued', -- 'queued', 'ready_check', 'matched', 'left', 'declined', 'expired'
+    match_id UUID REFERENCES dungeon_queue_matches(id),
+
+    -- Reddedilen eşleşmeden dönen kayıt sırasını korur
+    queued_at TIMESTAMPTZ DEFAULT NOW(),
+    ended_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_dungeon_queue_entries_waiting ON dungeon_queue_entries(server_id, dungeon_id, difficulty, queued_at)
+    WHERE status = 'queued';
+CREATE INDEX idx_dungeon_queue_entries_match ON dungeon_queue_entries(match_id) WHERE match_id IS NOT NULL;
+
+-- Kayıttaki karakterler
+CREATE TABLE dungeon_queue_members (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    entry_id UUID NOT NULL REFERENCES dungeon_queue_entries(id) ON DELETE CASCADE,
+    character_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+
+    class class_type NOT NULL,
+    gear_score INTEGER NOT NULL,
+
+    -- Hazır kontrolü yanıtı
+    is_ready BOOLEAN DEFAULT FALSE,
+    responded_at TIMESTAMPTZ,
+
+    is_active BOOLEAN DEFAULT TRUE,
+
+    UNIQUE(entry_id, character_id)
+);
+
+-- Bir karakter aynı anda tek kuyrukta olabilir
+CREATE UNIQUE INDEX idx_dungeon_queue_members_active ON dungeon_queue_members(character_id) WHERE is_active;
@@ -0,0 +1,51 @@
+-- ============================================================
+-- REALM OF CONQUEST - DATABASE SCHEMA
+-- Migration 031: Cross-Server Dungeon Rankings & Season Rewards
+-- ============================================================
+
+-- Haftalık sunucular arası zindan sıralaması. Her sezon kendi
+-- tablosuyla başlar; sezonu olmayan haftalar season_id NULL tutar.
+CREATE TABLE cross_server_dungeon_rankings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    season_id INTEGER REFERENCES seasons(id),
+    week_start DATE NOT NULL,
+
+    character_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    server_id INTEGER NOT NULL REFERENCES servers(id), -- Karakterin ana sunucusu
+
+    score INTEGER DEFAULT 0,
+    clears INTEGER DEFAULT 0,
+    best_clear_seconds INTEGER,
+
+    -- Hafta bitince yazılır
+    current_rank INTEGER,
+    reward_gold BIGINT,
+    rewarded_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_cs_rankings_character_week ON cross_server_dungeon_rankings(character_id, week_start, (COALESCE(season_id, 0)));
+CREATE INDEX idx_cs_rankings_board ON cross_server_dungeon_rankings(week_start, season_id, score DESC);
+CREATE INDEX idx_cs_rankings_unranked ON cross_server_dungeon_rankings(week_start) WHERE current_rank IS NULL;
+
+-- Sezon sonu sıralaması ve ödülleri
+CREATE TABLE cross_server_season_results (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    season_id INTEGER NOT NULL REFERENCES seasons(id),
+
+    character_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    server_id INTEGER NOT NULL REFERENCES servers(id),
+
+    score INTEGER NOT NULL,
+    clears INTEGER NOT NULL,
+    final_rank INTEGER NOT NULL,
+
+    reward_gold BIGINT,
+    rewarded_at TIMESTAMPTZ,
+
+    UNIQUE(season_id, character_id)
+);
+
+CREATE INDEX idx_cs_season_results_rank ON cross_server_season_results(season_id, final_rank);
+
+-- Sezonun sunucular arası sıralaması kapandığında
+ALTER TABLE seasons ADD COLUMN cross_server_closed_at TIMESTAMPTZ;